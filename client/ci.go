@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"os"
+)
+
+// CIResult is a finished CI build or deploy; see ReportCI
+type CIResult struct {
+	// ExternalRef identifies the pipeline, e.g. repository, workflow and
+	// branch; results with the same ref share a todo
+	ExternalRef string `json:"external_ref"`
+	// Status is success or failure; cancelled and skipped are accepted
+	// and change nothing
+	Status string `json:"status"`
+	// Kind is build, the default, or deploy
+	Kind      string `json:"kind,omitempty"`
+	Pipeline  string `json:"pipeline,omitempty"`
+	Build     string `json:"build,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	ProjectID string `json:"project_id,omitempty"`
+}
+
+// CIOutcome is what the server did with a CI result
+type CIOutcome struct {
+	// Action is created, updated, completed or unchanged
+	Action string `json:"action"`
+	// Todo is the todo tracking the pipeline, if there is one
+	Todo *Todo `json:"todo,omitempty"`
+}
+
+// ReportCI reports a CI result. A failure creates a todo such as "Fix
+// failing build #123", or adds to the open one for the same ExternalRef; a
+// success completes the open one.
+func (c *Client) ReportCI(ctx context.Context, result CIResult) (*CIOutcome, error) {
+	var outcome CIOutcome
+	if err := c.do(ctx, http.MethodPost, "/integrations/ci", nil, result, &outcome); err != nil {
+		return nil, err
+	}
+	return &outcome, nil
+}
+
+// GitHubActionsResult describes the current GitHub Actions run, from the
+// environment variables GitHub sets for every step. status is the job's
+// status, as in ${{ job.status }}.
+func GitHubActionsResult(status string) CIResult {
+	repo, workflow, branch := os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_WORKFLOW"), os.Getenv("GITHUB_REF_NAME")
+	result := CIResult{
+		ExternalRef: "github:" + repo + "/" + workflow + "@" + branch,
+		Status:      status,
+		Pipeline:    workflow,
+		Build:       os.Getenv("GITHUB_RUN_NUMBER"),
+		Commit:      os.Getenv("GITHUB_SHA"),
+		Branch:      branch,
+	}
+	if server, runID := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_RUN_ID"); server != "" && runID != "" {
+		result.URL = server + "/" + repo + "/actions/runs/" + runID
+	}
+	return result
+}
@@ -0,0 +1,390 @@
+// Package client talks to a todo API server over HTTP:
+//
+//	c, err := client.New("https://todo.example.com", client.WithToken(token))
+//	if err != nil {
+//		return err
+//	}
+//	todo, err := c.Create(ctx, client.NewTodo{Title: "buy milk", Tags: []string{"home"}})
+//
+// It only depends on the standard library, so programs using it don't pull
+// in the server and its storage drivers.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statuses every server knows; the server's workflow may add more
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+)
+
+// Todo is a todo as the server returns it
+type Todo struct {
+	ID                  string         `json:"id"`
+	Title               string         `json:"title"`
+	Description         string         `json:"description"`
+	Status              string         `json:"status"`
+	Priority            string         `json:"priority,omitempty"`
+	ProjectID           string         `json:"project_id,omitempty"`
+	Tags                []string       `json:"tags,omitempty"`
+	BlockedBy           []string       `json:"blocked_by,omitempty"`
+	ExternalRef         string         `json:"external_ref,omitempty"`
+	Metadata            map[string]any `json:"metadata,omitempty"`
+	DueAt               *time.Time     `json:"due_at,omitempty"`
+	RemindAt            *time.Time     `json:"remind_at,omitempty"`
+	RemindBeforeMinutes int            `json:"remind_before_minutes,omitempty"`
+	EstimateMinutes     int            `json:"estimate_minutes,omitempty"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	CompletedAt         *time.Time     `json:"completed_at,omitempty"`
+	ArchivedAt          *time.Time     `json:"archived_at,omitempty"`
+	Version             int            `json:"version"`
+}
+
+// NewTodo is what Create sends; only Title is required
+type NewTodo struct {
+	Title               string         `json:"title"`
+	Description         string         `json:"description,omitempty"`
+	Priority            string         `json:"priority,omitempty"`
+	ProjectID           string         `json:"project_id,omitempty"`
+	Tags                []string       `json:"tags,omitempty"`
+	DueAt               *time.Time     `json:"due_at,omitempty"`
+	Metadata            map[string]any `json:"metadata,omitempty"`
+	RemindAt            *time.Time     `json:"remind_at,omitempty"`
+	RemindBeforeMinutes int            `json:"remind_before_minutes,omitempty"`
+	EstimateMinutes     int            `json:"estimate_minutes,omitempty"`
+}
+
+// ListOptions filter List
+type ListOptions struct {
+	// Query uses the server's query syntax, e.g. "status:pending tag:home"
+	Query string
+	// Archived lists archived todos instead of current ones
+	Archived bool
+	// Metadata only lists todos with these metadata values
+	Metadata map[string]string
+	// IncludeCold adds todos moved to the server's cold storage tier
+	IncludeCold bool
+}
+
+func (opts ListOptions) values() url.Values {
+	query := url.Values{}
+	if opts.Query != "" {
+		query.Set("query", opts.Query)
+	}
+	if opts.Archived {
+		query.Set("archived", "true")
+	}
+	if opts.IncludeCold {
+		query.Set("include_cold", "true")
+	}
+	for key, value := range opts.Metadata {
+		query.Set("meta."+key, value)
+	}
+	return query
+}
+
+// Error is returned for responses with a 4xx or 5xx status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is the server saying a todo doesn't exist
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Client sends requests to one server. It is safe for concurrent use.
+type Client struct {
+	router      *router
+	replicaURLs []string
+	token       string
+	user        string
+	class       string
+	http        *http.Client
+}
+
+// Option configures New
+type Option func(*Client)
+
+// WithToken sends token as a bearer token with every request
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithUser attributes changes to user, as the X-User-ID header does
+func WithUser(user string) Option {
+	return func(c *Client) { c.user = user }
+}
+
+// WithClientClass sends class as the X-Client-Class header, which sets the
+// page sizes the server uses for the client, e.g. "mobile". Requests made
+// with an API key or service account token get that token's class instead.
+func WithClientClass(class string) Option {
+	return func(c *Client) { c.class = class }
+}
+
+// WithHTTPClient sends requests through hc instead of a client with a 30
+// second timeout
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// New returns a client for the server at baseURL, such as
+// "http://localhost:8080" or "https://example.com/todo"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	c := &Client{http: &http.Client{Timeout: 30 * time.Second}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	primary, err := parseEndpoint(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	c.router = &router{primary: primary}
+	for _, raw := range c.replicaURLs {
+		replica, err := parseEndpoint(raw)
+		if err != nil {
+			return nil, err
+		}
+		c.router.replicas = append(c.router.replicas, replica)
+	}
+	return c, nil
+}
+
+// Create adds a todo
+func (c *Client) Create(ctx context.Context, todo NewTodo) (*Todo, error) {
+	var created Todo
+	if err := c.do(ctx, http.MethodPost, "/todos", nil, todo, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// QuickAdd creates a todo from a line such as "Pay rent tomorrow 9am
+// #finance !high", which the server parses into a title, due date, tags
+// and priority. timezone is the IANA zone the dates are meant in; empty
+// means the server's.
+func (c *Client) QuickAdd(ctx context.Context, text, timezone string) (*Todo, error) {
+	body := map[string]string{"text": text, "timezone": timezone}
+	var created Todo
+	if err := c.do(ctx, http.MethodPost, "/todos/quickadd", nil, body, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// List returns the todos matching opts, in the server's order, going
+// through the server's pages until it links to no next one
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]Todo, error) {
+	todos := []Todo{}
+	query := opts.values()
+	for {
+		resp, err := c.roundTrip(ctx, http.MethodGet, "/todos", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page []Todo
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		more := strings.Contains(resp.Header.Get("Link"), `rel="next"`)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding GET /todos response: %w", err)
+		}
+		todos = append(todos, page...)
+		if !more || len(page) == 0 {
+			return todos, nil
+		}
+		query.Set("offset", strconv.Itoa(len(todos)))
+	}
+}
+
+// Stream calls fn with each todo matching opts as the server sends them,
+// so exports too large to hold in memory can be processed one todo at a
+// time. It stops at the first error fn returns.
+func (c *Client) Stream(ctx context.Context, opts ListOptions, fn func(Todo) error) error {
+	resp, err := c.roundTrip(ctx, http.MethodGet, "/todos/stream", opts.values(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var line struct {
+			Todo
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("decoding todo stream: %w", err)
+		}
+		if line.Error != "" {
+			// the server failed partway through
+			return &Error{StatusCode: resp.StatusCode, Message: line.Error}
+		}
+		if err := fn(line.Todo); err != nil {
+			return err
+		}
+	}
+}
+
+// Get returns the todo with id
+func (c *Client) Get(ctx context.Context, id string) (*Todo, error) {
+	var todo Todo
+	if err := c.do(ctx, http.MethodGet, "/todos/"+url.PathEscape(id), nil, nil, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// SetStatus moves a todo to status
+func (c *Client) SetStatus(ctx context.Context, id, status string) (*Todo, error) {
+	var todo Todo
+	body := map[string]string{"status": status}
+	if err := c.do(ctx, http.MethodPatch, "/todos/"+url.PathEscape(id), nil, body, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// Complete marks a todo completed
+func (c *Client) Complete(ctx context.Context, id string) (*Todo, error) {
+	return c.SetStatus(ctx, id, StatusCompleted)
+}
+
+// Delete removes a todo
+func (c *Client) Delete(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/todos/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// do sends a request with body encoded as JSON, if any, and decodes the
+// response into out unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	resp, err := c.roundTrip(ctx, method, path, query, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// roundTrip sends a request and returns the successful response, whose
+// body the caller closes. Reads move on to the next endpoint when one is
+// unreachable or unavailable.
+func (c *Client) roundTrip(ctx context.Context, method, path string, query url.Values, data []byte) (*http.Response, error) {
+
+	c.measure(method)
+	targets := c.router.targets(method, time.Now())
+	var resp *http.Response
+	for i, ep := range targets {
+		start := time.Now()
+		var err error
+		resp, err = c.send(ctx, ep, method, path, query, data)
+		last := i == len(targets)-1
+		switch {
+		case err != nil:
+			c.router.observe(ep, method, 0, true, time.Now())
+			if last || ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		case retryElsewhere(resp.StatusCode) && !last:
+			resp.Body.Close()
+			c.router.observe(ep, method, 0, true, time.Now())
+			continue
+		}
+		c.router.observe(ep, method, time.Since(start), retryElsewhere(resp.StatusCode), time.Now())
+		break
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// send makes one attempt at a request against ep
+func (c *Client) send(ctx context.Context, ep *endpoint, method, path string, query url.Values, data []byte) (*http.Response, error) {
+	u := *ep.base
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var reqBody io.Reader
+	if data != nil {
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.user != "" {
+		req.Header.Set("X-User-ID", c.user)
+	}
+	if c.class != "" {
+		req.Header.Set("X-Client-Class", c.class)
+	}
+	return c.http.Do(req)
+}
+
+// responseError reads the server's explanation of a failed request, which
+// is either plain text or a problem+json document
+func responseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := strings.TrimSpace(string(data))
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/problem+json" {
+		var problem struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(data, &problem) == nil {
+			msg = problem.Title
+			if problem.Detail != "" {
+				msg = problem.Detail
+			}
+		}
+	}
+	if msg == "" {
+		msg = resp.Status
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: msg}
+}
@@ -0,0 +1,45 @@
+// Command ci-report reports a GitHub Actions run to a todo server, opening
+// a todo when the build fails and completing it once it passes again. Copy
+// it into the repository being built, say as tools/ci-report, and run it
+// as the last step of a job:
+//
+//	steps:
+//	  - name: Report to todo
+//	    if: always()
+//	    run: go run ./tools/ci-report ${{ job.status }}
+//	    env:
+//	      TODO_SERVER: https://todo.example.com
+//	      TODO_TOKEN: ${{ secrets.TODO_PROJECT_TOKEN }}
+//
+// TODO_TOKEN is best a write token for the project the todos belong in,
+// issued with POST /projects/{id}/tokens.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang-todo/client"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: ci-report success|failure|cancelled")
+	}
+	c, err := client.New(os.Getenv("TODO_SERVER"), client.WithToken(os.Getenv("TODO_TOKEN")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	outcome, err := c.ReportCI(ctx, client.GitHubActionsResult(os.Args[1]))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if outcome.Todo != nil {
+		fmt.Printf("%s todo %s: %s\n", outcome.Action, outcome.Todo.ID, outcome.Todo.Title)
+	}
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// probeInterval is how often read endpoints are re-measured
+	probeInterval = time.Minute
+	// probeTimeout bounds one latency probe
+	probeTimeout = 2 * time.Second
+	// downFor is how long an endpoint that failed is skipped for reads,
+	// unless every endpoint is down
+	downFor = 30 * time.Second
+	// readYourWrites is how long reads go to the primary after a write, so
+	// replicas that haven't caught up yet don't hide it
+	readYourWrites = 2 * time.Second
+)
+
+// WithReplicas adds read-only endpoints, such as replicas in other regions.
+// Reads go to whichever of the server and its replicas has been answering
+// fastest, and fail over to the next one when it is unreachable; writes
+// always go to the server passed to New.
+func WithReplicas(urls ...string) Option {
+	return func(c *Client) { c.replicaURLs = append(c.replicaURLs, urls...) }
+}
+
+// endpoint is one server the client can send requests to
+type endpoint struct {
+	base *url.URL
+	// latency is a moving average of response times; zero until measured
+	latency   time.Duration
+	downUntil time.Time
+}
+
+// router picks the endpoint for each request
+type router struct {
+	mu        sync.Mutex
+	primary   *endpoint
+	replicas  []*endpoint
+	probedAt  time.Time
+	probing   bool
+	lastWrite time.Time
+}
+
+func parseEndpoint(raw string) (*endpoint, error) {
+	base, err := url.Parse(strings.TrimSuffix(raw, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid server URL %q: want http:// or https://", raw)
+	}
+	return &endpoint{base: base}, nil
+}
+
+// targets lists the endpoints to try for a request, best first. Writes
+// only go to the primary; reads go to every endpoint, healthy ones first
+// by latency.
+func (rt *router) targets(method string, now time.Time) []*endpoint {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if method != http.MethodGet || len(rt.replicas) == 0 || now.Sub(rt.lastWrite) < readYourWrites {
+		return []*endpoint{rt.primary}
+	}
+	all := append([]*endpoint{rt.primary}, rt.replicas...)
+	slices.SortStableFunc(all, func(a, b *endpoint) int {
+		aDown, bDown := now.Before(a.downUntil), now.Before(b.downUntil)
+		switch {
+		case aDown != bDown:
+			if aDown {
+				return 1
+			}
+			return -1
+		case a.latency == 0 && b.latency != 0:
+			// unmeasured endpoints go last among their kind
+			return 1
+		case b.latency == 0 && a.latency != 0:
+			return -1
+		}
+		return cmp.Compare(a.latency, b.latency)
+	})
+	return all
+}
+
+// observe records how a request to ep went
+func (rt *router) observe(ep *endpoint, method string, took time.Duration, failed bool, now time.Time) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if failed {
+		ep.downUntil = now.Add(downFor)
+		return
+	}
+	ep.downUntil = time.Time{}
+	if ep.latency == 0 {
+		ep.latency = took
+	} else {
+		ep.latency = (ep.latency*7 + took*3) / 10
+	}
+	if method != http.MethodGet && ep == rt.primary {
+		rt.lastWrite = now
+	}
+}
+
+// probeDue reports whether endpoints need measuring, claiming the probe
+// if so, and whether no endpoint has ever been measured
+func (rt *router) probeDue(now time.Time) (due, first bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.replicas) == 0 || rt.probing || now.Sub(rt.probedAt) < probeInterval {
+		return false, false
+	}
+	rt.probing = true
+	return true, rt.probedAt.IsZero()
+}
+
+// probe measures every endpoint with a request to /health
+func (c *Client) probe() {
+	all := append([]*endpoint{c.router.primary}, c.router.replicas...)
+	var wg sync.WaitGroup
+	for _, ep := range all {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+			u := *ep.base
+			u.Path += "/health"
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+			if err != nil {
+				return
+			}
+			start := time.Now()
+			resp, err := c.http.Do(req)
+			failed := err != nil
+			if err == nil {
+				resp.Body.Close()
+				failed = resp.StatusCode >= 500
+			}
+			c.router.observe(ep, http.MethodGet, time.Since(start), failed, time.Now())
+		}()
+	}
+	wg.Wait()
+	c.router.mu.Lock()
+	c.router.probedAt, c.router.probing = time.Now(), false
+	c.router.mu.Unlock()
+}
+
+// measure probes the endpoints when due: the first time before the read
+// that needs the ranking, afterwards in the background
+func (c *Client) measure(method string) {
+	if method != http.MethodGet {
+		return
+	}
+	due, first := c.router.probeDue(time.Now())
+	switch {
+	case due && first:
+		c.probe()
+	case due:
+		go c.probe()
+	}
+}
+
+// retryElsewhere reports whether a response status means the endpoint
+// can't serve requests right now, so a read should try another
+func retryElsewhere(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
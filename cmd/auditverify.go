@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"golang-todo/internal/api"
+)
+
+// runAuditVerify implements the audit-verify subcommand, which checks an
+// unfiltered export of GET /admin/audit offline, so auditors needn't trust
+// the server
+func runAuditVerify(args []string) error {
+	flags := flag.NewFlagSet("audit-verify", flag.ContinueOnError)
+	path := flags.String("file", "-", "audit export to verify, or - for stdin")
+	head := flags.String("head", "", "expected hash of the last entry, e.g. one recorded earlier")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if *path != "-" {
+		f, err := os.Open(*path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	var entries []api.AuditEntry
+	if err := json.NewDecoder(in).Decode(&entries); err != nil {
+		return fmt.Errorf("failed to read audit export: %w", err)
+	}
+
+	result := api.VerifyAuditChain(entries)
+	if !result.Valid {
+		return fmt.Errorf("audit chain broken at seq %d: %s", result.BrokenAt, result.Reason)
+	}
+	if *head != "" && result.HeadHash != *head {
+		if !containsHash(entries, *head) {
+			return errors.New("audit chain doesn't contain the expected head hash; history was rewritten")
+		}
+	}
+	fmt.Printf("ok: %d entries, head %s\n", result.Entries, result.HeadHash)
+	return nil
+}
+
+// containsHash reports whether an earlier head is still part of the chain,
+// as it is when entries were only appended since
+func containsHash(entries []api.AuditEntry, hash string) bool {
+	for _, entry := range entries {
+		if entry.Hash == hash {
+			return true
+		}
+	}
+	return false
+}
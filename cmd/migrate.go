@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+// runMigrate implements the migrate subcommand
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	url := flags.String("store-url", "", "PostgreSQL URL to migrate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *url == "" {
+		return errors.New("-store-url is required")
+	}
+	command := "up"
+	if flags.NArg() > 0 {
+		command = flags.Arg(0)
+	}
+	ctx := context.Background()
+	dsn, err := secrets.Resolve(ctx, *url)
+	if err != nil {
+		return err
+	}
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("invalid postgres URL: %w", err)
+	}
+	defer pool.Close()
+	return store.MigratePostgres(ctx, pool, command)
+}
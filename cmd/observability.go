@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// observabilityConfig parameterizes the generated alert rules and dashboard
+type observabilityConfig struct {
+	Job         string
+	RouteLabel  string
+	TenantLabel string
+	ErrorRate   float64
+	P99         time.Duration
+	For         time.Duration
+}
+
+// by returns the "by (...)" grouping used in every aggregation
+func (c observabilityConfig) by(extra ...string) string {
+	labels := append(extra, c.RouteLabel)
+	if c.TenantLabel != "" {
+		labels = append(labels, c.TenantLabel)
+	}
+	return "by (" + strings.Join(labels, ", ") + ")"
+}
+
+// selector returns the label matchers for a metric; dashboard queries also
+// filter on the route and tenant template variables
+func (c observabilityConfig) selector(extra string, dashboard bool) string {
+	matchers := []string{fmt.Sprintf("job=%q", c.Job)}
+	if dashboard {
+		matchers = append(matchers, c.RouteLabel+`=~"$route"`)
+		if c.TenantLabel != "" {
+			matchers = append(matchers, c.TenantLabel+`=~"$tenant"`)
+		}
+	}
+	if extra != "" {
+		matchers = append(matchers, extra)
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+func (c observabilityConfig) errorRatioExpr(dashboard bool) string {
+	return fmt.Sprintf("sum %s (rate(todo_http_requests_total%s[5m])) / sum %s (rate(todo_http_requests_total%s[5m]))",
+		c.by(), c.selector(`code=~"5.."`, dashboard), c.by(), c.selector("", dashboard))
+}
+
+func (c observabilityConfig) latencyExpr(quantile float64, dashboard bool) string {
+	return fmt.Sprintf("histogram_quantile(%g, sum %s (rate(todo_http_request_duration_seconds_bucket%s[5m])))",
+		quantile, c.by("le"), c.selector("", dashboard))
+}
+
+func (c observabilityConfig) budgetExpr(dashboard bool) string {
+	return fmt.Sprintf("sum %s (rate(todo_latency_budget_exceeded_total%s[5m]))", c.by(), c.selector("", dashboard))
+}
+
+func (c observabilityConfig) requestRateExpr(dashboard bool) string {
+	return fmt.Sprintf("sum %s (rate(todo_http_requests_total%s[5m]))", c.by(), c.selector("", dashboard))
+}
+
+// alertRulesTemplate renders a Prometheus rule file
+var alertRulesTemplate = template.Must(template.New("rules").Parse(`# Generated by "golang-todo gen-observability"; regenerate instead of editing.
+groups:
+  - name: golang-todo
+    rules:
+      - alert: TodoServerDown
+        expr: 'up{job="{{.Job}}"} == 0'
+        for: 2m
+        labels:
+          severity: critical
+        annotations:
+          summary: "golang-todo instance {{"{{"}} $labels.instance {{"}}"}} is down"
+      - alert: TodoHighErrorRate
+        expr: '{{.ErrorRatioExpr}} > {{.ErrorRate}}'
+        for: {{.For}}
+        labels:
+          severity: warning
+        annotations:
+          summary: "More than {{.ErrorRatePercent}}% of {{"{{"}} $labels.{{.RouteLabel}} {{"}}"}} requests are failing"
+      - alert: TodoHighLatency
+        expr: '{{.LatencyExpr}} > {{.P99Seconds}}'
+        for: {{.For}}
+        labels:
+          severity: warning
+        annotations:
+          summary: "p99 latency of {{"{{"}} $labels.{{.RouteLabel}} {{"}}"}} is above {{.P99}}"
+      - alert: TodoLatencyBudgetExceeded
+        expr: '{{.BudgetExpr}} > 0'
+        for: {{.For}}
+        labels:
+          severity: warning
+        annotations:
+          summary: "{{"{{"}} $labels.{{.RouteLabel}} {{"}}"}} requests are being cut off by their latency budget"
+`))
+
+// writeAlertRules renders the Prometheus alerting rules for cfg
+func writeAlertRules(w io.Writer, cfg observabilityConfig) error {
+	return alertRulesTemplate.Execute(w, map[string]any{
+		"Job":              cfg.Job,
+		"RouteLabel":       cfg.RouteLabel,
+		"ErrorRate":        cfg.ErrorRate,
+		"ErrorRatePercent": cfg.ErrorRate * 100,
+		"ErrorRatioExpr":   cfg.errorRatioExpr(false),
+		"LatencyExpr":      cfg.latencyExpr(0.99, false),
+		"P99":              cfg.P99,
+		"P99Seconds":       cfg.P99.Seconds(),
+		"BudgetExpr":       cfg.budgetExpr(false),
+		"For":              promDuration(cfg.For),
+	})
+}
+
+// promDuration formats a duration the way Prometheus rule files expect
+func promDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+// grafanaDashboard builds a Grafana dashboard model for cfg
+func grafanaDashboard(cfg observabilityConfig) map[string]any {
+	legend := "{{" + cfg.RouteLabel + "}}"
+	if cfg.TenantLabel != "" {
+		legend = "{{" + cfg.TenantLabel + "}} " + legend
+	}
+	panel := func(id int, title, unit string, x, y int, targets ...map[string]any) map[string]any {
+		return map[string]any{
+			"id":         id,
+			"type":       "timeseries",
+			"title":      title,
+			"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+			"gridPos":    map[string]int{"h": 8, "w": 12, "x": x, "y": y},
+			"fieldConfig": map[string]any{
+				"defaults":  map[string]any{"unit": unit},
+				"overrides": []any{},
+			},
+			"targets": targets,
+		}
+	}
+	target := func(ref, expr, legendFormat string) map[string]any {
+		return map[string]any{"refId": ref, "expr": expr, "legendFormat": legendFormat}
+	}
+	variable := func(name, label string) map[string]any {
+		return map[string]any{
+			"name":       name,
+			"type":       "query",
+			"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+			"query":      fmt.Sprintf("label_values(todo_http_requests_total{job=%q}, %s)", cfg.Job, label),
+			"includeAll": true,
+			"multi":      true,
+			"allValue":   ".*",
+			"refresh":    2,
+		}
+	}
+
+	variables := []any{
+		map[string]any{"name": "datasource", "type": "datasource", "query": "prometheus"},
+		variable("route", cfg.RouteLabel),
+	}
+	if cfg.TenantLabel != "" {
+		variables = append(variables, variable("tenant", cfg.TenantLabel))
+	}
+
+	return map[string]any{
+		"title":         "golang-todo",
+		"uid":           "golang-todo",
+		"tags":          []string{"golang-todo", "generated"},
+		"timezone":      "browser",
+		"schemaVersion": 39,
+		"refresh":       "30s",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating":    map[string]any{"list": variables},
+		"panels": []any{
+			panel(1, "Request rate", "reqps", 0, 0, target("A", cfg.requestRateExpr(true), legend)),
+			panel(2, "Error ratio (5xx)", "percentunit", 12, 0, target("A", cfg.errorRatioExpr(true), legend)),
+			panel(3, "Latency", "s", 0, 8,
+				target("A", cfg.latencyExpr(0.5, true), "p50 "+legend),
+				target("B", cfg.latencyExpr(0.95, true), "p95 "+legend),
+				target("C", cfg.latencyExpr(0.99, true), "p99 "+legend)),
+			panel(4, "Latency budget violations", "reqps", 12, 8, target("A", cfg.budgetExpr(true), legend)),
+		},
+	}
+}
+
+// runGenObservability implements the gen-observability subcommand
+func runGenObservability(args []string) error {
+	fs := flag.NewFlagSet("gen-observability", flag.ContinueOnError)
+	cfg := observabilityConfig{}
+	fs.StringVar(&cfg.Job, "job", "golang-todo", "Prometheus job name the server is scraped under")
+	fs.StringVar(&cfg.RouteLabel, "route-label", "route", "label carrying the route pattern")
+	fs.StringVar(&cfg.TenantLabel, "tenant-label", "", "label distinguishing tenants, e.g. one added by relabeling (optional)")
+	fs.Float64Var(&cfg.ErrorRate, "error-rate", 0.05, "5xx ratio above which TodoHighErrorRate fires")
+	fs.DurationVar(&cfg.P99, "p99", time.Second, "p99 latency above which TodoHighLatency fires")
+	fs.DurationVar(&cfg.For, "for", 10*time.Minute, "how long a condition must hold before alerting")
+	out := fs.String("out", "", "directory to write alerts.yml and dashboard.json to (default: print both to stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dashboard, err := json.MarshalIndent(grafanaDashboard(cfg), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		if err := writeAlertRules(os.Stdout, cfg); err != nil {
+			return err
+		}
+		fmt.Println("---")
+		_, err := fmt.Printf("%s\n", dashboard)
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(*out, "alerts.yml"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeAlertRules(f, cfg); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*out, "dashboard.json"), append(dashboard, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s and %s\n", filepath.Join(*out, "alerts.yml"), filepath.Join(*out, "dashboard.json"))
+	return f.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang-todo/internal/secrets"
+)
+
+// backfillJob is the part of an admin job the stats-backfill subcommand
+// reports on
+type backfillJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Total  int    `json:"total"`
+	Done   int    `json:"done"`
+	Error  string `json:"error"`
+}
+
+// runStatsBackfill implements the stats-backfill subcommand, which has a
+// running server reconstruct the daily stats snapshots of days before
+// they were taken, and waits for it to finish. It authenticates with
+// TODO_ADMIN_TOKEN, as the server reads it.
+func runStatsBackfill(args []string) error {
+	flags := flag.NewFlagSet("stats-backfill", flag.ContinueOnError)
+	server := flags.String("server", "http://localhost:8080", "base URL of the server to backfill")
+	poll := flags.Duration("poll", time.Second, "how often to check on the backfill")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	token, err := secrets.Resolve(ctx, os.Getenv("TODO_ADMIN_TOKEN"))
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.New("TODO_ADMIN_TOKEN is required")
+	}
+	base := strings.TrimSuffix(*server, "/")
+
+	call := func(method, path string) (backfillJob, error) {
+		var job backfillJob
+		req, err := http.NewRequestWithContext(ctx, method, base+path, nil)
+		if err != nil {
+			return job, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return job, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return job, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return job, json.NewDecoder(resp.Body).Decode(&job)
+	}
+
+	job, err := call(http.MethodPost, "/admin/stats/backfill")
+	if err != nil {
+		return err
+	}
+	for job.Status == "running" {
+		time.Sleep(*poll)
+		if job, err = call(http.MethodGet, "/admin/jobs/"+job.ID); err != nil {
+			return err
+		}
+	}
+	if job.Status != "done" {
+		return fmt.Errorf("backfill %s failed after %d of %d days: %s", job.ID, job.Done, job.Total, job.Error)
+	}
+	fmt.Printf("ok: went through %d days, keeping the snapshots taken on the day\n", job.Done)
+	return nil
+}
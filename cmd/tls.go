@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsOptions selects how the server terminates TLS: with certificate
+// files, with certificates obtained from Let's Encrypt for an allowlist of
+// domains, or not at all
+type tlsOptions struct {
+	CertFile string
+	KeyFile  string
+	// Domains enables autocert; certificates are only requested for these
+	Domains  []string
+	CacheDir string
+	Email    string
+	// RedirectAddr serves plain HTTP redirects to HTTPS, and answers ACME
+	// HTTP-01 challenges when autocert is on; empty disables it
+	RedirectAddr string
+}
+
+// parseDomains splits a comma-separated domain list
+func parseDomains(spec string) []string {
+	var domains []string
+	for _, d := range strings.Split(spec, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, strings.ToLower(d))
+		}
+	}
+	return domains
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || len(o.Domains) > 0
+}
+
+func (o tlsOptions) validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return errors.New("-tls-cert and -tls-key must be set together")
+	}
+	if o.CertFile != "" && len(o.Domains) > 0 {
+		return errors.New("use either -tls-cert/-tls-key or -tls-domains, not both")
+	}
+	if len(o.Domains) > 0 && o.CacheDir == "" {
+		return errors.New("-tls-cache-dir is required with -tls-domains so certificates survive restarts")
+	}
+	return nil
+}
+
+// serve runs srv, over TLS when configured
+func serve(srv *http.Server, opts tlsOptions) error {
+	if !opts.enabled() {
+		return srv.ListenAndServe()
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// plain HTTP only redirects, except for ACME challenges
+	var redirect http.Handler = http.HandlerFunc(redirectToHTTPS(srv.Addr))
+	if len(opts.Domains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(opts.Domains...),
+			Cache:      autocert.DirCache(opts.CacheDir),
+			Email:      opts.Email,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		redirect = m.HTTPHandler(redirect)
+	} else {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if opts.RedirectAddr != "" {
+		go func() {
+			redirectSrv := &http.Server{
+				Addr:              opts.RedirectAddr,
+				Handler:           redirect,
+				ReadHeaderTimeout: srv.ReadHeaderTimeout,
+				ReadTimeout:       srv.ReadTimeout,
+				WriteTimeout:      srv.WriteTimeout,
+				IdleTimeout:       srv.IdleTimeout,
+			}
+			if err := redirectSrv.ListenAndServe(); err != nil {
+				log.Printf("HTTP redirect listener on %s stopped: %v", opts.RedirectAddr, err)
+			}
+		}()
+	}
+	// with autocert the certificate comes from TLSConfig.GetCertificate
+	return srv.ListenAndServeTLS(opts.CertFile, opts.KeyFile)
+}
+
+// redirectToHTTPS sends clients to the same URL on the HTTPS address; the
+// port is dropped when HTTPS listens on the default one
+func redirectToHTTPS(httpsAddr string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := fmt.Sprintf("https://%s%s", host, r.URL.RequestURI())
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
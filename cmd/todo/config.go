@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config says which server to talk to and as whom. It is read from a YAML
+// file such as
+//
+//	server: https://todo.example.com
+//	token: s3cr3t
+//	user: alice
+//	replicas: [https://eu.todo.example.com, https://ap.todo.example.com]
+//
+// where replicas are optional read-only endpoints, and the TODO_SERVER, TODO_TOKEN and TODO_USER environment variables
+// override it.
+type config struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token"`
+	User   string `yaml:"user"`
+	// Replicas serve reads when they answer faster than Server
+	Replicas []string `yaml:"replicas"`
+}
+
+// defaultConfigPath is todo/config.yaml in the user's configuration
+// directory, e.g. ~/.config/todo/config.yaml on Linux
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "todo", "config.yaml")
+}
+
+// loadConfig reads path, which may be missing when it is the default
+func loadConfig(path string, explicit bool) (config, error) {
+	cfg := config{Server: "http://localhost:8080"}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && !explicit:
+		case err != nil:
+			return config{}, err
+		default:
+			if err := yaml.Unmarshal(data, &cfg); err != nil {
+				return config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		}
+	}
+	for env, field := range map[string]*string{
+		"TODO_SERVER": &cfg.Server,
+		"TODO_TOKEN":  &cfg.Token,
+		"TODO_USER":   &cfg.User,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,372 @@
+// Command todo manages todos on a todo API server from the terminal:
+//
+//	todo add "buy milk" --due tomorrow --tag home
+//	todo list --status pending
+//	todo done 1a2b3c4d
+//
+// The server URL and token are read from ~/.config/todo/config.yaml or
+// the file given with --config; see config for the format.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang-todo/client"
+)
+
+const usage = `usage: todo <command> [flags] [arguments]
+
+Commands:
+  add TITLE      add a todo (--due, --tag, --priority, --project, --description)
+  list           list todos (--status, --tag, --query, --archived)
+  show ID        show one todo
+  done ID...     mark todos completed
+  rm ID...       delete todos
+
+Every command accepts --config FILE and -o table|json. IDs may be
+shortened to any unique prefix, as shown by list.
+`
+
+// session is what a command runs with once the common flags are parsed
+type session struct {
+	client *client.Client
+	out    io.Writer
+	json   bool
+}
+
+// command registers its own flags on fs and returns the function to run
+// with the remaining arguments
+type command func(fs *flag.FlagSet) func(ctx context.Context, s *session, args []string) error
+
+var commands = map[string]command{
+	"add":  addCommand,
+	"list": listCommand,
+	"show": showCommand,
+	"done": doneCommand,
+	"rm":   removeCommand,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:], os.Stdout)
+	stop()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "todo:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(out, usage)
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q; run todo help", args[0])
+	}
+
+	fs := flag.NewFlagSet("todo "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", "", "config file (default "+defaultConfigPath()+")")
+	output := fs.String("o", "table", "output format: table or json")
+	action := cmd(fs)
+	rest, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %q; want table or json", *output)
+	}
+
+	path, explicit := *configPath, *configPath != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	cfg, err := loadConfig(path, explicit)
+	if err != nil {
+		return err
+	}
+	c, err := client.New(cfg.Server, client.WithToken(cfg.Token), client.WithUser(cfg.User), client.WithReplicas(cfg.Replicas...))
+	if err != nil {
+		return err
+	}
+	return action(ctx, &session{client: c, out: out, json: *output == "json"}, rest)
+}
+
+// parseInterspersed parses flags wherever they appear among the positional
+// arguments, so "todo add milk --tag home" works like "todo add --tag home
+// milk"; arguments after "--" are never taken as flags
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// listFlag collects a repeatable flag such as --tag home --tag errands
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func addCommand(fs *flag.FlagSet) func(context.Context, *session, []string) error {
+	due := fs.String("due", "", "due date: today, tomorrow, a weekday, YYYY-MM-DD or an RFC 3339 time")
+	priority := fs.String("priority", "", "low, medium, high or urgent")
+	project := fs.String("project", "", "project ID")
+	description := fs.String("description", "", "longer description")
+	var tags listFlag
+	fs.Var(&tags, "tag", "tag, repeatable or comma-separated")
+	return func(ctx context.Context, s *session, args []string) error {
+		title := strings.TrimSpace(strings.Join(args, " "))
+		if title == "" {
+			return errors.New("add needs a title, e.g. todo add \"buy milk\"")
+		}
+		todo := client.NewTodo{
+			Title:       title,
+			Description: *description,
+			Priority:    *priority,
+			ProjectID:   *project,
+			Tags:        tags,
+		}
+		if *due != "" {
+			dueAt, err := parseDue(*due, time.Now())
+			if err != nil {
+				return err
+			}
+			todo.DueAt = &dueAt
+		}
+		created, err := s.client.Create(ctx, todo)
+		if err != nil {
+			return err
+		}
+		if s.json {
+			return writeJSON(s.out, created)
+		}
+		fmt.Fprintf(s.out, "Added %s %s\n", shortID(created.ID), created.Title)
+		return nil
+	}
+}
+
+func listCommand(fs *flag.FlagSet) func(context.Context, *session, []string) error {
+	status := fs.String("status", "", "only todos in this status, e.g. pending")
+	query := fs.String("query", "", "server query, e.g. 'due:<tomorrow priority:>=high'")
+	archived := fs.Bool("archived", false, "list archived todos instead")
+	var tags listFlag
+	fs.Var(&tags, "tag", "only todos with this tag, repeatable")
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("list takes no arguments, got %q", args[0])
+		}
+		terms := []string{}
+		if *status != "" {
+			terms = append(terms, "status:"+quoteTerm(*status))
+		}
+		for _, tag := range tags {
+			terms = append(terms, "tag:"+quoteTerm(tag))
+		}
+		if *query != "" {
+			terms = append(terms, *query)
+		}
+		todos, err := s.client.List(ctx, client.ListOptions{Query: strings.Join(terms, " "), Archived: *archived})
+		if err != nil {
+			return err
+		}
+		if s.json {
+			return writeJSON(s.out, todos)
+		}
+		return writeTable(s.out, todos)
+	}
+}
+
+func showCommand(fs *flag.FlagSet) func(context.Context, *session, []string) error {
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) != 1 {
+			return errors.New("show needs exactly one ID")
+		}
+		todo, err := resolve(ctx, s.client, args[0])
+		if err != nil {
+			return err
+		}
+		if s.json {
+			return writeJSON(s.out, todo)
+		}
+		return writeTable(s.out, []client.Todo{*todo})
+	}
+}
+
+func doneCommand(fs *flag.FlagSet) func(context.Context, *session, []string) error {
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) == 0 {
+			return errors.New("done needs at least one ID")
+		}
+		var completed []client.Todo
+		for _, arg := range args {
+			todo, err := resolve(ctx, s.client, arg)
+			if err != nil {
+				return err
+			}
+			if todo, err = s.client.Complete(ctx, todo.ID); err != nil {
+				return fmt.Errorf("%s: %w", arg, err)
+			}
+			completed = append(completed, *todo)
+			if !s.json {
+				fmt.Fprintf(s.out, "Completed %s %s\n", shortID(todo.ID), todo.Title)
+			}
+		}
+		if s.json {
+			return writeJSON(s.out, completed)
+		}
+		return nil
+	}
+}
+
+func removeCommand(fs *flag.FlagSet) func(context.Context, *session, []string) error {
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) == 0 {
+			return errors.New("rm needs at least one ID")
+		}
+		var removed []string
+		for _, arg := range args {
+			todo, err := resolve(ctx, s.client, arg)
+			if err != nil {
+				return err
+			}
+			if err := s.client.Delete(ctx, todo.ID); err != nil {
+				return fmt.Errorf("%s: %w", arg, err)
+			}
+			removed = append(removed, todo.ID)
+			if !s.json {
+				fmt.Fprintf(s.out, "Deleted %s %s\n", shortID(todo.ID), todo.Title)
+			}
+		}
+		if s.json {
+			return writeJSON(s.out, map[string][]string{"deleted": removed})
+		}
+		return nil
+	}
+}
+
+// resolve finds the todo an ID or unique ID prefix refers to
+func resolve(ctx context.Context, c *client.Client, id string) (*client.Todo, error) {
+	todo, err := c.Get(ctx, id)
+	if err == nil || !client.IsNotFound(err) {
+		return todo, err
+	}
+	todos, err := c.List(ctx, client.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var matches []client.Todo
+	for _, t := range todos {
+		if strings.HasPrefix(t.ID, id) {
+			matches = append(matches, t)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no todo with ID %s", id)
+	case 1:
+		return &matches[0], nil
+	}
+	return nil, fmt.Errorf("ID %s is ambiguous: it matches %d todos", id, len(matches))
+}
+
+// parseDue reads a due date relative to now. Dates without a time are due
+// at the end of that day in the local time zone.
+func parseDue(value string, now time.Time) (time.Time, error) {
+	endOfDay := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 0, 0, time.Local)
+	}
+	lower := strings.ToLower(value)
+	switch lower {
+	case "today":
+		return endOfDay(now), nil
+	case "tomorrow":
+		return endOfDay(now.AddDate(0, 0, 1)), nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if name := strings.ToLower(day.String()); lower == name || lower == name[:3] {
+			ahead := (int(day) - int(now.Weekday()) + 7) % 7
+			if ahead == 0 {
+				ahead = 7
+			}
+			return endOfDay(now.AddDate(0, 0, ahead)), nil
+		}
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return endOfDay(t), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid due date %q; want today, tomorrow, a weekday, YYYY-MM-DD, \"YYYY-MM-DD HH:MM\" or an RFC 3339 time", value)
+}
+
+// quoteTerm quotes a query value containing spaces
+func quoteTerm(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeTable(w io.Writer, todos []client.Todo) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tPRIORITY\tDUE\tTAGS\tTITLE")
+	for _, todo := range todos {
+		due := ""
+		if todo.DueAt != nil {
+			due = todo.DueAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", shortID(todo.ID), todo.Status, todo.Priority, due, strings.Join(todo.Tags, ","), todo.Title)
+	}
+	return tw.Flush()
+}
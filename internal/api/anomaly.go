@@ -0,0 +1,266 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/metrics"
+	"golang-todo/internal/store"
+)
+
+var anomaliesTotal = metrics.Default.NewCounterVec("todo_anomalies_total",
+	"Unusual activity flagged by the anomaly detector, by rule.", "rule")
+
+// anomalyRule names a kind of unusual activity the detector looks for
+type anomalyRule string
+
+const (
+	// anomalyMassDeletion counts todos deleted by one actor
+	anomalyMassDeletion anomalyRule = "mass_deletion"
+	// anomalyFailedAuth counts rejected credentials from one client address
+	anomalyFailedAuth anomalyRule = "failed_auth"
+	// anomalyBulkExport counts todos exported by one actor
+	anomalyBulkExport anomalyRule = "bulk_export"
+	// anomalyCanaryAccess is raised on any access to a canary todo
+	anomalyCanaryAccess anomalyRule = "canary_access"
+)
+
+// anomalyRules lists every rule with a threshold, in a stable order
+var anomalyRules = []anomalyRule{anomalyMassDeletion, anomalyFailedAuth, anomalyBulkExport}
+
+// anomalyThreshold flags a subject once its count within Window reaches
+// Count. A zero Count disables the rule.
+type anomalyThreshold struct {
+	Count  int           `yaml:"count"`
+	Window time.Duration `yaml:"window"`
+}
+
+func (t anomalyThreshold) validate() error {
+	if t.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+	if t.Count > 0 && t.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	return nil
+}
+
+// defaultAnomalyThresholds are deliberately loose so ordinary cleanups and
+// backups don't raise notifications
+func defaultAnomalyThresholds() map[anomalyRule]anomalyThreshold {
+	return map[anomalyRule]anomalyThreshold{
+		anomalyMassDeletion: {Count: 50, Window: 5 * time.Minute},
+		anomalyFailedAuth:   {Count: 20, Window: 5 * time.Minute},
+		anomalyBulkExport:   {Count: 5000, Window: time.Hour},
+	}
+}
+
+// Anomaly is an admin notification about unusual activity
+type Anomaly struct {
+	ID             string            `json:"id"`
+	Rule           anomalyRule       `json:"rule"`
+	Subject        string            `json:"subject"`
+	Count          int               `json:"count"`
+	Window         string            `json:"window,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
+	DetectedAt     time.Time         `json:"detected_at"`
+	AcknowledgedAt *time.Time        `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string            `json:"acknowledged_by,omitempty"`
+}
+
+// maxAnomalies bounds how many notifications are kept
+const maxAnomalies = 500
+
+var errAnomalyNotFound = errors.New("anomaly not found")
+
+type anomalyKey struct {
+	rule    anomalyRule
+	subject string
+}
+
+type anomalyHit struct {
+	at time.Time
+	n  int
+}
+
+// anomalyDetector counts activity per rule and subject over sliding
+// windows. A subject is flagged at most once per window, so a sustained
+// burst raises one notification rather than one per request.
+type anomalyDetector struct {
+	mu         sync.Mutex
+	thresholds map[anomalyRule]anomalyThreshold
+	hits       map[anomalyKey][]anomalyHit
+	flagged    map[anomalyKey]time.Time
+	anomalies  []Anomaly
+}
+
+func newAnomalyDetector() *anomalyDetector {
+	return &anomalyDetector{
+		thresholds: defaultAnomalyThresholds(),
+		hits:       map[anomalyKey][]anomalyHit{},
+		flagged:    map[anomalyKey]time.Time{},
+	}
+}
+
+// observe counts n occurrences of rule for subject
+func (d *anomalyDetector) observe(rule anomalyRule, subject string, n int, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	threshold := d.thresholds[rule]
+	if threshold.Count == 0 || n <= 0 {
+		return
+	}
+	key := anomalyKey{rule, subject}
+	cutoff := now.Add(-threshold.Window)
+	hits := slices.DeleteFunc(d.hits[key], func(h anomalyHit) bool { return h.at.Before(cutoff) })
+	hits = append(hits, anomalyHit{at: now, n: n})
+	d.hits[key] = hits
+	d.sweep(now)
+
+	total := 0
+	for _, h := range hits {
+		total += h.n
+	}
+	if total < threshold.Count {
+		return
+	}
+	if at, ok := d.flagged[key]; ok && at.After(cutoff) {
+		return
+	}
+	d.flagged[key] = now
+	d.raise(Anomaly{Rule: rule, Subject: subject, Count: total, Window: threshold.Window.String(), DetectedAt: now})
+}
+
+// raise records a notification; the caller holds d.mu
+func (d *anomalyDetector) raise(anomaly Anomaly) {
+	anomaly.ID = uuid.New().String()
+	d.anomalies = append(d.anomalies, anomaly)
+	if len(d.anomalies) > maxAnomalies {
+		d.anomalies = d.anomalies[len(d.anomalies)-maxAnomalies:]
+	}
+	anomaliesTotal.Inc(string(anomaly.Rule))
+	if anomaly.Window != "" {
+		log.Printf("anomaly: %s by %s: %d in %s", anomaly.Rule, anomaly.Subject, anomaly.Count, anomaly.Window)
+	} else {
+		log.Printf("anomaly: %s by %s: %v", anomaly.Rule, anomaly.Subject, anomaly.Details)
+	}
+}
+
+// alert raises a notification right away, without a threshold
+func (d *anomalyDetector) alert(anomaly Anomaly) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.raise(anomaly)
+}
+
+// sweep forgets subjects with no activity inside their rule's window
+func (d *anomalyDetector) sweep(now time.Time) {
+	for key, hits := range d.hits {
+		if len(hits) == 0 || hits[len(hits)-1].at.Before(now.Add(-d.thresholds[key.rule].Window)) {
+			delete(d.hits, key)
+			delete(d.flagged, key)
+		}
+	}
+}
+
+// observeEvent is a server listener counting deletions per actor
+func (d *anomalyDetector) observeEvent(evt store.Event) {
+	if evt.Type == store.EventTodoDeleted {
+		d.observe(anomalyMassDeletion, evt.Actor, 1, evt.OccurredAt)
+	}
+}
+
+// thresholdsSnapshot returns a copy of the current thresholds
+func (d *anomalyDetector) thresholdsSnapshot() map[anomalyRule]anomalyThreshold {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	thresholds := make(map[anomalyRule]anomalyThreshold, len(d.thresholds))
+	for rule, t := range d.thresholds {
+		thresholds[rule] = t
+	}
+	return thresholds
+}
+
+func (d *anomalyDetector) setThreshold(rule anomalyRule, t anomalyThreshold) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.thresholds[rule] = t
+}
+
+// list returns notifications newest first, optionally only unacknowledged
+func (d *anomalyDetector) list(unacknowledged bool) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	anomalies := []Anomaly{}
+	for i := len(d.anomalies) - 1; i >= 0; i-- {
+		if unacknowledged && d.anomalies[i].AcknowledgedAt != nil {
+			continue
+		}
+		anomalies = append(anomalies, d.anomalies[i])
+	}
+	return anomalies
+}
+
+func (d *anomalyDetector) acknowledge(id, actor string, now time.Time) (Anomaly, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.anomalies {
+		if d.anomalies[i].ID == id {
+			if d.anomalies[i].AcknowledgedAt == nil {
+				d.anomalies[i].AcknowledgedAt = &now
+				d.anomalies[i].AcknowledgedBy = actor
+			}
+			return d.anomalies[i], nil
+		}
+	}
+	return Anomaly{}, errAnomalyNotFound
+}
+
+// validAnomalyRule reports whether rule is one the detector knows
+func validAnomalyRule(rule anomalyRule) bool {
+	return slices.Contains(anomalyRules, rule)
+}
+
+// clientAddress identifies the client a request came from for failed
+// authentication counts
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authFailed records a rejected credential
+func (s *server) authFailed(r *http.Request) {
+	s.anomalies.observe(anomalyFailedAuth, clientAddress(r), 1, time.Now())
+}
+
+// GET /admin/anomalies
+func (s *server) handleListAnomalies(w http.ResponseWriter, r *http.Request) {
+	anomalies := s.anomalies.list(r.URL.Query().Get("unacknowledged") == "true")
+	if err := respondJSON(w, http.StatusOK, anomalies); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/anomalies/{id}/ack
+func (s *server) handleAckAnomaly(w http.ResponseWriter, r *http.Request) {
+	anomaly, err := s.anomalies.acknowledge(r.PathValue("id"), actorFromRequest(r), time.Now())
+	if errors.Is(err, errAnomalyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, anomaly); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,360 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix starts every API key, so they can be told apart from other
+// bearer tokens without a lookup
+const apiKeyPrefix = "tdk_"
+
+// APIKey lets a script act as a user. Read keys can only make GET
+// requests. Like project tokens, only a hash of the secret is kept.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Class      string     `json:"class,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Usage      keyUsage   `json:"usage"`
+	hash       string
+}
+
+// keyUsage counts the requests made with a key
+type keyUsage struct {
+	Requests int64 `json:"requests"`
+	// Writes are the requests other than GETs
+	Writes int64 `json:"writes"`
+	// Denied are the requests refused because of the key's scope or a
+	// disabled user
+	Denied int64 `json:"denied"`
+	// Routes counts requests by route pattern
+	Routes map[string]int64 `json:"routes,omitempty"`
+}
+
+// apiKeyRegistry holds the issued API keys
+type apiKeyRegistry struct {
+	mu   sync.RWMutex
+	keys []*APIKey
+}
+
+// issue creates a key and returns it along with its secret
+func (a *apiKeyRegistry) issue(userID, name, scope, class, actor string, now time.Time) (APIKey, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", err
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(b)
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Scope:     scope,
+		Class:     class,
+		CreatedAt: now,
+		CreatedBy: actor,
+		hash:      hashSecret(secret),
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = append(a.keys, key)
+	return key.snapshot(), secret, nil
+}
+
+// snapshot copies a key, including its usage counters
+func (k *APIKey) snapshot() APIKey {
+	c := *k
+	if k.Usage.Routes != nil {
+		c.Usage.Routes = make(map[string]int64, len(k.Usage.Routes))
+		for route, n := range k.Usage.Routes {
+			c.Usage.Routes[route] = n
+		}
+	}
+	return c
+}
+
+// use looks up the key with secret and counts a request on route with it,
+// reporting whether the key exists and whether authorize allowed the
+// request
+func (a *apiKeyRegistry) use(secret, route string, write bool, authorize func(APIKey) bool, now time.Time) (APIKey, bool, bool) {
+	hash := hashSecret(secret)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range a.keys {
+		if key.hash != hash {
+			continue
+		}
+		allowed := authorize(*key)
+		key.LastUsedAt = &now
+		key.Usage.Requests++
+		if write {
+			key.Usage.Writes++
+		}
+		if !allowed {
+			key.Usage.Denied++
+		}
+		if key.Usage.Routes == nil {
+			key.Usage.Routes = map[string]int64{}
+		}
+		key.Usage.Routes[route]++
+		return key.snapshot(), true, allowed
+	}
+	return APIKey{}, false, false
+}
+
+func (a *apiKeyRegistry) get(id string) (APIKey, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, key := range a.keys {
+		if key.ID == id {
+			return key.snapshot(), true
+		}
+	}
+	return APIKey{}, false
+}
+
+// list returns the keys of the user with id, or every key for ""
+func (a *apiKeyRegistry) list(userID string) []APIKey {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	keys := []APIKey{}
+	for _, key := range a.keys {
+		if userID == "" || key.UserID == userID {
+			keys = append(keys, key.snapshot())
+		}
+	}
+	return keys
+}
+
+// replace swaps in a whole new set of keys, as loading a state file does
+func (a *apiKeyRegistry) replace(keys []APIKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = make([]*APIKey, len(keys))
+	for i := range keys {
+		key := keys[i].snapshot()
+		a.keys[i] = &key
+	}
+}
+
+// revoke removes a key, reporting whether it existed
+func (a *apiKeyRegistry) revoke(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := len(a.keys)
+	a.keys = slices.DeleteFunc(a.keys, func(k *APIKey) bool { return k.ID == id })
+	return len(a.keys) < n
+}
+
+// authenticateUsers turns API keys into the user they belong to and
+// service account tokens into the account, and refuses requests from
+// disabled users. Requests with a key or token act as its user or account
+// whatever X-User-ID they send; only a token can act as an account.
+func (s *server) authenticateUsers(pattern string, next http.Handler) http.Handler {
+	method, _, _ := strings.Cut(pattern, " ")
+	write := method != http.MethodGet
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := bearerToken(r)
+		if strings.HasPrefix(secret, serviceTokenPrefix) {
+			account, ok := s.services.authenticate(secret, time.Now())
+			if !ok {
+				s.authFailed(r)
+				http.Error(w, "invalid or revoked service account token", http.StatusUnauthorized)
+				return
+			}
+			if account.Scope == scopeRead && write {
+				http.Error(w, "this service account is read-only", http.StatusForbidden)
+				return
+			}
+			r.Header.Set("X-User-ID", account.actor())
+			r.Header.Set(clientClassHeader, account.Class)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(secret, apiKeyPrefix) {
+			if isServiceActor(actorFromRequest(r)) {
+				http.Error(w, "acting as a service account takes its token", http.StatusUnauthorized)
+				return
+			}
+			if user := actorFromRequest(r); s.users.disabled(user) {
+				http.Error(w, "user "+user+" is disabled", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		var reason string
+		key, ok, allowed := s.apiKeys.use(secret, pattern, write, func(key APIKey) bool {
+			switch {
+			case s.users.disabled(key.UserID):
+				reason = "user " + key.UserID + " is disabled"
+			case key.Scope == scopeRead && write:
+				reason = "this API key is read-only"
+			}
+			return reason == ""
+		}, time.Now())
+		if !ok {
+			s.authFailed(r)
+			http.Error(w, "invalid or revoked API key", http.StatusUnauthorized)
+			return
+		}
+		if !allowed {
+			http.Error(w, reason, http.StatusForbidden)
+			return
+		}
+		r.Header.Set("X-User-ID", key.UserID)
+		r.Header.Set(clientClassHeader, key.Class)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GET /admin/users
+func (s *server) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.users.list()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PUT /admin/users/{id}
+func (s *server) handleAdminPutUser(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := strings.TrimSpace(r.PathValue("id"))
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(id, "token:") || isServiceActor(id) || id == anonymousActor {
+		http.Error(w, "user IDs can't start with token: or "+serviceActorPrefix+" or be "+anonymousActor, http.StatusBadRequest)
+		return
+	}
+	user, exists := s.users.get(id)
+	status := http.StatusOK
+	if !exists {
+		user = User{ID: id, CreatedAt: time.Now()}
+		status = http.StatusCreated
+	}
+	user.Name, user.Email = strings.TrimSpace(req.Name), strings.TrimSpace(req.Email)
+	s.users.put(user)
+	if err := respondJSON(w, status, user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/users/{id}/disable
+func (s *server) handleDisableUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, true)
+}
+
+// POST /admin/users/{id}/enable
+func (s *server) handleEnableUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, false)
+}
+
+func (s *server) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	now := time.Now()
+	user, ok := s.users.setDisabled(r.PathValue("id"), disabled, now)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if disabled {
+		s.cascadeUserDisabled(user.ID, now)
+	}
+	if err := respondJSON(w, http.StatusOK, user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/api-keys
+func (s *server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		UserID string `json:"user_id"`
+		Name   string `json:"name"`
+		Scope  string `json:"scope"`
+		Class  string `json:"class"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.users.get(req.UserID); !ok {
+		http.Error(w, "unknown user "+req.UserID+"; create it with PUT /admin/users/{id}", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required, e.g. the script the key is for", http.StatusBadRequest)
+		return
+	}
+	if req.Scope != scopeRead && req.Scope != scopeWrite {
+		http.Error(w, "scope must be read or write", http.StatusBadRequest)
+		return
+	}
+	if err := s.checkClientClass(req.Class); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, secret, err := s.apiKeys.issue(req.UserID, strings.TrimSpace(req.Name), req.Scope, req.Class, actorFromRequest(r), time.Now())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	resp := struct {
+		APIKey
+		Key string `json:"key"`
+	}{key, secret}
+	if err := respondJSON(w, http.StatusCreated, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/api-keys
+func (s *server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.apiKeys.list(r.URL.Query().Get("user_id"))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/api-keys/{id}
+func (s *server) handleGetAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.apiKeys.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /admin/api-keys/{id}
+func (s *server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.apiKeys.revoke(r.PathValue("id")) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
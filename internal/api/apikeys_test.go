@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"golang-todo/internal/secrets"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	admin := &secrets.Setting{}
+	admin.Set("adm1n")
+	srv := newTestServer(t, Options{AdminToken: admin})
+	h := srv.routes()
+	asAdmin := []string{"Authorization", "Bearer adm1n"}
+	if w := serve(h, "PUT", "/admin/users/bo", `{"name":"Bo"}`, asAdmin...); w.Code != http.StatusCreated {
+		t.Fatalf("create user: %d %s", w.Code, w.Body)
+	}
+	issue := func(scope string) (APIKey, []string) {
+		t.Helper()
+		w := serve(h, "POST", "/admin/api-keys", `{"user_id":"bo","name":"backup script","scope":"`+scope+`"}`, asAdmin...)
+		var created struct {
+			APIKey
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("create %s key: %d %s", scope, w.Code, w.Body)
+		}
+		return created.APIKey, []string{"Authorization", "Bearer " + created.Key}
+	}
+	readKey, read := issue(scopeRead)
+	_, write := issue(scopeWrite)
+	revokedKey, revoked := issue(scopeWrite)
+	if w := serve(h, "DELETE", "/admin/api-keys/"+revokedKey.ID, "", asAdmin...); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body)
+	}
+
+	// keys act as their user whatever X-User-ID says
+	todo := createTodo(t, h, `{"title":"from the script"}`, write...)
+	if entries := srv.audit.all(); entries[len(entries)-1].Actor != "bo" {
+		t.Errorf("creation attributed to %q, want bo", entries[len(entries)-1].Actor)
+	}
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		header []string
+		status int
+	}{
+		{"read with a read key", "GET", "/todos/" + todo.ID, "", read, http.StatusOK},
+		{"write with a read key", "PATCH", "/todos/" + todo.ID, `{"description":"x"}`, read, http.StatusForbidden},
+		{"write with a write key", "PATCH", "/todos/" + todo.ID, `{"description":"x"}`, write, http.StatusOK},
+		{"admin route with a key", "GET", "/admin/users", "", write, http.StatusUnauthorized},
+		{"revoked key", "GET", "/todos", "", revoked, http.StatusUnauthorized},
+		{"unknown key", "GET", "/todos", "", []string{"Authorization", "Bearer " + apiKeyPrefix + "nope"}, http.StatusUnauthorized},
+		{"unknown scope", "POST", "/admin/api-keys", `{"user_id":"bo","name":"x","scope":"admin"}`, asAdmin, http.StatusBadRequest},
+		{"key for an unknown user", "POST", "/admin/api-keys", `{"user_id":"cy","name":"x","scope":"read"}`, asAdmin, http.StatusBadRequest},
+		{"key without the admin token", "POST", "/admin/api-keys", `{"user_id":"bo","name":"x","scope":"read"}`, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h, tt.method, tt.target, tt.body, tt.header...); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+
+	w := serve(h, "GET", "/admin/api-keys/"+readKey.ID, "", asAdmin...)
+	var got APIKey
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("get key: %d %s", w.Code, w.Body)
+	}
+	usage := got.Usage
+	if usage.Requests != 2 || usage.Writes != 1 || usage.Denied != 1 || usage.Routes["PATCH /todos/{id}"] != 1 || got.LastUsedAt == nil {
+		t.Errorf("read key usage = %+v, want 2 requests, 1 write denied", usage)
+	}
+
+	// disabling the user stops their keys
+	if w := serve(h, "POST", "/admin/users/bo/disable", "", asAdmin...); w.Code != http.StatusOK {
+		t.Fatalf("disable: %d %s", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/todos", "", read...); w.Code != http.StatusForbidden {
+		t.Errorf("key of a disabled user: %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// archiverActor is recorded for changes made by the auto-archiving job
+const archiverActor = "archiver"
+
+// archivable reports whether a todo completed long enough ago to be
+// archived
+func archivable(todo store.Todo, cutoff time.Time) bool {
+	return todo.Status == store.StatusCompleted && todo.ArchivedAt == nil && todo.CompletedAt != nil && todo.CompletedAt.Before(cutoff)
+}
+
+// runArchiver archives old completed todos every interval until ctx is
+// cancelled
+func (s *server) runArchiver(ctx context.Context, after, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.archiveOnce(ctx, time.Now(), after); err != nil {
+			log.Printf("auto-archiving failed after archiving %d todos: %v", n, err)
+		} else if n > 0 {
+			log.Printf("auto-archiving archived %d todos", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveOnce archives every todo completed more than after ago and
+// returns how many were archived. Archived todos stay in the store but are
+// left out of default listings.
+func (s *server) archiveOnce(ctx context.Context, now time.Time, after time.Duration) (int, error) {
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := now.Add(-after)
+	archived := 0
+	for _, candidate := range todos {
+		if !archivable(candidate, cutoff) {
+			continue
+		}
+		// recheck inside the transaction in case the todo changed meanwhile
+		var events []store.Event
+		err := s.store.Atomically(ctx, func(tx store.Tx) error {
+			todo, err := tx.Get(ctx, candidate.ID)
+			if err != nil || !archivable(todo, cutoff) {
+				return err
+			}
+			todo, events = applyUpdate(todo, archiverActor, now, func(t *store.Todo) { t.ArchivedAt = &now })
+			return tx.Update(ctx, todo, s.outboxEvents(events...)...)
+		})
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return archived, err
+		}
+		if len(events) > 0 {
+			s.emit(events...)
+			archived++
+		}
+	}
+	return archived, nil
+}
@@ -0,0 +1,449 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// Attachment describes a file uploaded to a todo; its contents live in the
+// configured blob store
+type Attachment struct {
+	ID          string `json:"id"`
+	TodoID      string `json:"todo_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// SHA256 is the hex digest of the contents, which are stored once per
+	// digest however many todos they're attached to. Attachments uploaded
+	// before deduplication have none and keep a blob of their own.
+	SHA256     string    `json:"sha256,omitempty"`
+	UploadedBy string    `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (a Attachment) key() string {
+	if a.SHA256 != "" {
+		return contentKey(a.SHA256)
+	}
+	return a.TodoID + "/" + a.ID
+}
+
+// contentKey is where the blob with a digest is stored
+func contentKey(digest string) string {
+	return "sha256/" + digest[:2] + "/" + digest
+}
+
+// attachmentGCGrace is how long contents no attachment refers to any more
+// are kept before they're deleted, in case an upload of the same file
+// reuses them
+const attachmentGCGrace = 10 * time.Minute
+
+// attachmentRegistry holds attachment metadata by todo. Attachments are
+// kept when their todo is deleted so reverting or undoing the delete
+// brings them back.
+type attachmentRegistry struct {
+	mu     sync.RWMutex
+	byTodo map[string][]Attachment
+	// refs counts the attachments sharing each digest's contents; digests
+	// dropping to zero wait in orphaned until collect deletes them
+	refs     map[string]int
+	orphaned map[string]time.Time
+	// blobMu serializes storing and deleting content-addressed blobs, so
+	// collect never deletes contents an upload has just decided to reuse
+	blobMu  sync.Mutex
+	blobs   store.BlobStore
+	maxSize int64
+}
+
+func newAttachmentRegistry(blobs store.BlobStore, maxSize int64) *attachmentRegistry {
+	return &attachmentRegistry{
+		byTodo:   map[string][]Attachment{},
+		refs:     map[string]int{},
+		orphaned: map[string]time.Time{},
+		blobs:    blobs,
+		maxSize:  maxSize,
+	}
+}
+
+func (a *attachmentRegistry) list(todoID string) []Attachment {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return slices.Clone(a.byTodo[todoID])
+}
+
+func (a *attachmentRegistry) get(todoID, id string) (Attachment, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, att := range a.byTodo[todoID] {
+		if att.ID == id {
+			return att, true
+		}
+	}
+	return Attachment{}, false
+}
+
+func (a *attachmentRegistry) add(att Attachment) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.byTodo[att.TodoID] = append(a.byTodo[att.TodoID], att)
+	if att.SHA256 != "" {
+		a.refs[att.SHA256]++
+		delete(a.orphaned, att.SHA256)
+	}
+}
+
+func (a *attachmentRegistry) remove(todoID, id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.byTodo[todoID] = slices.DeleteFunc(a.byTodo[todoID], func(att Attachment) bool {
+		if att.ID != id {
+			return false
+		}
+		a.release(att.SHA256, time.Now())
+		return true
+	})
+}
+
+// removeTodo drops every attachment of a todo, leaving contents nothing
+// else refers to for the garbage collector
+func (a *attachmentRegistry) removeTodo(todoID string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, att := range a.byTodo[todoID] {
+		a.release(att.SHA256, now)
+	}
+	delete(a.byTodo, todoID)
+}
+
+// release drops a reference to a digest's contents; a.mu must be held
+func (a *attachmentRegistry) release(digest string, now time.Time) {
+	if digest == "" {
+		return
+	}
+	if a.refs[digest]--; a.refs[digest] <= 0 {
+		delete(a.refs, digest)
+		a.orphaned[digest] = now
+	}
+}
+
+// store moves freshly uploaded contents from tmpKey to their
+// content-addressed key and registers att. When the same contents are
+// already stored the upload is dropped instead.
+func (a *attachmentRegistry) store(ctx context.Context, att Attachment, tmpKey string) error {
+	a.blobMu.Lock()
+	defer a.blobMu.Unlock()
+
+	a.mu.RLock()
+	_, orphaned := a.orphaned[att.SHA256]
+	stored := a.refs[att.SHA256] > 0 || orphaned
+	a.mu.RUnlock()
+
+	if stored {
+		if err := a.blobs.Delete(ctx, tmpKey); err != nil {
+			log.Printf("failed to delete duplicate upload %s: %v", tmpKey, err)
+		}
+	} else if err := a.blobs.Move(ctx, tmpKey, att.key()); err != nil {
+		a.blobs.Delete(ctx, tmpKey)
+		return err
+	}
+	a.add(att)
+	return nil
+}
+
+// collect deletes contents no attachment has referred to for longer than
+// grace, returning how many blobs it deleted
+func (a *attachmentRegistry) collect(ctx context.Context, grace time.Duration, now time.Time) int {
+	a.blobMu.Lock()
+	defer a.blobMu.Unlock()
+
+	a.mu.Lock()
+	var garbage []string
+	for digest, since := range a.orphaned {
+		if now.Sub(since) >= grace {
+			garbage = append(garbage, digest)
+			delete(a.orphaned, digest)
+		}
+	}
+	a.mu.Unlock()
+
+	deleted := 0
+	for _, digest := range garbage {
+		if err := a.blobs.Delete(ctx, contentKey(digest)); err != nil {
+			log.Printf("failed to delete unreferenced attachment contents %s: %v", digest, err)
+			// try again on the next run
+			a.mu.Lock()
+			a.orphaned[digest] = now.Add(-grace)
+			a.mu.Unlock()
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+// all returns every attachment's metadata, grouped by todo
+func (a *attachmentRegistry) all() []Attachment {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	atts := []Attachment{}
+	for _, todoID := range slices.Sorted(maps.Keys(a.byTodo)) {
+		atts = append(atts, a.byTodo[todoID]...)
+	}
+	return atts
+}
+
+// replace swaps in a whole new set of metadata, as restoring a backup does.
+// Contents aren't touched; they stay in the blob store.
+func (a *attachmentRegistry) replace(atts []Attachment) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	previous := a.refs
+	a.byTodo = map[string][]Attachment{}
+	a.refs = map[string]int{}
+	for _, att := range atts {
+		a.byTodo[att.TodoID] = append(a.byTodo[att.TodoID], att)
+		if att.SHA256 != "" {
+			a.refs[att.SHA256]++
+			delete(a.orphaned, att.SHA256)
+		}
+	}
+	for digest := range previous {
+		if a.refs[digest] == 0 {
+			a.orphaned[digest] = now
+		}
+	}
+}
+
+// runGC deletes unreferenced contents every interval until ctx is
+// cancelled
+func (a *attachmentRegistry) runGC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := a.collect(ctx, attachmentGCGrace, now); n > 0 {
+				log.Printf("Deleted %d unreferenced attachment blobs", n)
+			}
+		}
+	}
+}
+
+// errAttachmentTooLarge is returned while streaming a file over the limit
+var errAttachmentTooLarge = errors.New("attachment too large")
+
+// limitedReader fails once more than max bytes have been read
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		return n, errAttachmentTooLarge
+	}
+	return n, err
+}
+
+// rejectOversizedUpload answers 413 if err comes from reading past the
+// request body limit, reporting whether it did
+func rejectOversizedUpload(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("upload is larger than the %d byte limit", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+	return true
+}
+
+// sniffedReader detects the content type from the first bytes of r
+// without consuming them
+func sniffedReader(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", nil, err
+	}
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// POST /todos/{id}/attachments
+func (s *server) handleUploadAttachments(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.store.Get(r.Context(), id); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	var uploaded []Attachment
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if rejectOversizedUpload(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if part.FileName() == "" {
+			// ignore non-file form fields
+			part.Close()
+			continue
+		}
+
+		att := Attachment{
+			ID:          uuid.New().String(),
+			TodoID:      id,
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			UploadedBy:  actorFromRequest(r),
+			CreatedAt:   time.Now(),
+		}
+		body := &limitedReader{r: part, max: s.attachments.maxSize}
+		var content io.Reader = body
+		if att.ContentType == "" || att.ContentType == "application/octet-stream" {
+			att.ContentType, content, err = sniffedReader(body)
+			switch {
+			case rejectOversizedUpload(w, err):
+				return
+			case errors.Is(err, errAttachmentTooLarge):
+				http.Error(w, fmt.Sprintf("%s is larger than the %d byte limit", att.Filename, s.attachments.maxSize), http.StatusRequestEntityTooLarge)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// The digest is only known once the upload is complete, so it goes
+		// to a temporary key first
+		tmpKey := "uploads/" + att.ID
+		digest := sha256.New()
+		err = s.attachments.blobs.Put(r.Context(), tmpKey, io.TeeReader(content, digest), att.ContentType)
+		part.Close()
+		// check the count too, as backends may wrap the reader's error
+		if errors.Is(err, errAttachmentTooLarge) || body.n > s.attachments.maxSize {
+			s.attachments.blobs.Delete(r.Context(), tmpKey)
+			http.Error(w, fmt.Sprintf("%s is larger than the %d byte limit", att.Filename, s.attachments.maxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			s.attachments.blobs.Delete(r.Context(), tmpKey)
+			if rejectOversizedUpload(w, err) {
+				return
+			}
+			respondError(w, err)
+			return
+		}
+		att.Size = body.n
+		att.SHA256 = hex.EncodeToString(digest.Sum(nil))
+		if err := s.attachments.store(r.Context(), att, tmpKey); err != nil {
+			respondError(w, err)
+			return
+		}
+		uploaded = append(uploaded, att)
+	}
+	if len(uploaded) == 0 {
+		http.Error(w, "no files in upload", http.StatusBadRequest)
+		return
+	}
+
+	if err := respondJSON(w, http.StatusCreated, uploaded); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /todos/{id}/attachments
+func (s *server) handleListAttachments(w http.ResponseWriter, r *http.Request) {
+	attachments := s.attachments.list(r.PathValue("id"))
+	if len(attachments) == 0 {
+		if _, err := s.store.Get(r.Context(), r.PathValue("id")); err != nil {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		attachments = []Attachment{}
+	}
+	if err := respondJSON(w, http.StatusOK, attachments); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /todos/{id}/attachments/{attachment_id}
+func (s *server) handleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	att, ok := s.attachments.get(r.PathValue("id"), r.PathValue("attachment_id"))
+	if !ok {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	body, err := s.attachments.blobs.Get(r.Context(), att.key())
+	if errors.Is(err, store.ErrBlobNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprint(att.Size))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, body)
+}
+
+// DELETE /todos/{id}/attachments/{attachment_id}
+func (s *server) handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	att, ok := s.attachments.get(r.PathValue("id"), r.PathValue("attachment_id"))
+	if !ok {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	// shared contents are deleted by the collector once unreferenced
+	if att.SHA256 == "" {
+		if err := s.attachments.blobs.Delete(r.Context(), att.key()); err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+	s.attachments.remove(att.TodoID, att.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// uploadBody is a multipart form with one file per size, each filled with
+// that many bytes
+func uploadBody(t *testing.T, sizes ...int) (string, *bytes.Buffer) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, size := range sizes {
+		part, err := mw.CreateFormFile("file", fmt.Sprintf("f%d.txt", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(strings.Repeat("x", size)))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), &body
+}
+
+func TestUploadLimits(t *testing.T) {
+	h := newTestHandler(t, Options{AttachmentMaxSize: 100, MaxBodySize: 1000})
+	todo := createTodo(t, h, `{"title":"a"}`)
+	tests := []struct {
+		name   string
+		sizes  []int
+		status int
+	}{
+		{"files within the limit", []int{100, 50}, http.StatusCreated},
+		{"a file over the limit", []int{101}, http.StatusRequestEntityTooLarge},
+		{"files over the limit together", []int{90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90, 90}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		for _, streamed := range []bool{false, true} {
+			contentType, body := uploadBody(t, tt.sizes...)
+			r := httptest.NewRequest("POST", "/todos/"+todo.ID+"/attachments", body)
+			r.Header.Set("X-User-ID", "al")
+			r.Header.Set("Content-Type", contentType)
+			if streamed {
+				// no Content-Length, so the limit applies while reading
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("%s (streamed %v): status = %d, want %d: %s", tt.name, streamed, w.Code, tt.status, w.Body)
+			}
+		}
+	}
+}
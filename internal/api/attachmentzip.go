@@ -0,0 +1,163 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+
+	"golang-todo/internal/store"
+)
+
+// zipFolder is a directory in a downloaded archive with the attachments
+// it holds; the folder name is empty for the archive root
+type zipFolder struct {
+	name        string
+	attachments []Attachment
+}
+
+// zipName turns a user-supplied name into a safe archive entry name: no
+// directories, no control characters and no leading dots, so extracting
+// the archive can't write outside the target directory or hide files
+func zipName(name, fallback string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = path.Base(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	name = strings.TrimRight(name, ". ")
+	if len(name) > 200 {
+		name = strings.ToValidUTF8(name[:200], "")
+	}
+	if name == "" || name == "/" {
+		return fallback
+	}
+	return name
+}
+
+// slashes are part of a title, while in an uploaded filename they only
+// carry the uploader's local path
+var titleSlashes = strings.NewReplacer("/", "-", `\`, "-")
+
+// uniqueNames hands out names that are unique within one directory of an
+// archive, numbering repeats as "report (2).pdf"
+type uniqueNames map[string]int
+
+func (u uniqueNames) name(name string) string {
+	key := strings.ToLower(name)
+	u[key]++
+	if u[key] == 1 {
+		return name
+	}
+	ext := path.Ext(name)
+	for {
+		candidate := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), u[key], ext)
+		if _, taken := u[strings.ToLower(candidate)]; !taken {
+			u[strings.ToLower(candidate)] = 1
+			return candidate
+		}
+		u[key]++
+	}
+}
+
+// writeAttachmentZip streams the folders' attachments from the blob store
+// into a zip archive one at a time, so the archive is never held in
+// memory. Contents missing from the blob store are left out.
+func (s *server) writeAttachmentZip(ctx context.Context, w io.Writer, folders []zipFolder) error {
+	zw := zip.NewWriter(w)
+	for _, folder := range folders {
+		names := uniqueNames{}
+		for _, att := range folder.attachments {
+			body, err := s.attachments.blobs.Get(ctx, att.key())
+			if errors.Is(err, store.ErrBlobNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			header := &zip.FileHeader{
+				Name:     path.Join(folder.name, names.name(zipName(att.Filename, "attachment"))),
+				Modified: att.CreatedAt,
+				Method:   zip.Deflate,
+			}
+			if !compressible(att.ContentType) {
+				// images and archives don't shrink, so don't spend time trying
+				header.Method = zip.Store
+			}
+			entry, err := zw.CreateHeader(header)
+			if err == nil {
+				_, err = io.Copy(entry, body)
+			}
+			body.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// respondZip sends folders as a zip download named filename. Once the
+// first entry is written the status is sent, so a failure part way through
+// can only cut the archive short.
+func (s *server) respondZip(w http.ResponseWriter, r *http.Request, filename string, folders []zipFolder) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if err := s.writeAttachmentZip(r.Context(), w, folders); err != nil {
+		log.Printf("attachment archive %s: %v", filename, err)
+	}
+}
+
+// GET /todos/{id}/attachments.zip
+func (s *server) handleDownloadAttachmentsZip(w http.ResponseWriter, r *http.Request) {
+	todo, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	filename := zipName(titleSlashes.Replace(todo.Title), "todo") + " attachments.zip"
+	s.respondZip(w, r, filename, []zipFolder{{attachments: s.attachments.list(todo.ID)}})
+}
+
+// GET /projects/{id}/attachments.zip
+func (s *server) handleDownloadProjectAttachmentsZip(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projects.get(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// one folder per todo with attachments, named after its title
+	var folders []zipFolder
+	dirs := uniqueNames{}
+	for _, todo := range todos {
+		if todo.ProjectID != project.ID {
+			continue
+		}
+		if atts := s.attachments.list(todo.ID); len(atts) > 0 {
+			folders = append(folders, zipFolder{name: dirs.name(zipName(titleSlashes.Replace(todo.Title), todo.ID)), attachments: atts})
+		}
+	}
+	s.respondZip(w, r, zipName(titleSlashes.Replace(project.Name), "project")+" attachments.zip", folders)
+}
@@ -0,0 +1,377 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// AuditAction is the kind of mutation an audit entry records
+type AuditAction string
+
+const (
+	AuditCreated AuditAction = "created"
+	AuditUpdated AuditAction = "updated"
+	AuditDeleted AuditAction = "deleted"
+)
+
+// auditIgnoredFields change on every write or are fixed at creation, so
+// listing them in diffs is noise
+var auditIgnoredFields = []string{"id", "created_at", "updated_at", "version"}
+
+// AuditEntry records who changed a todo, when, and what changed. Revision
+// is the todo's version after the change, or the version it was deleted at.
+// Entries are hash-chained: Hash covers the entry and PrevHash, the hash of
+// the entry before it, so altering or removing any entry breaks the chain.
+type AuditEntry struct {
+	Seq      int                 `json:"seq"`
+	ID       string              `json:"id"`
+	TodoID   string              `json:"todo_id"`
+	Revision int                 `json:"revision"`
+	Action   AuditAction         `json:"action"`
+	Actor    string              `json:"actor"`
+	At       time.Time           `json:"at"`
+	EventID  string              `json:"event_id"`
+	Changes  []store.FieldChange `json:"changes,omitempty"`
+	PrevHash string              `json:"prev_hash"`
+	Hash     string              `json:"hash"`
+
+	// ProjectID is set instead of TodoID on entries recording a change to
+	// a project, such as a transfer of its ownership
+	ProjectID string `json:"project_id,omitempty"`
+
+	// snapshot is the full todo after a create or update, used by revert
+	snapshot *store.Todo
+}
+
+// auditQuery filters audit entries; zero fields match everything
+type auditQuery struct {
+	TodoID    string
+	ProjectID string
+	Actor     string
+	Action    AuditAction
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	// Humans leaves out the entries of service accounts
+	Humans bool
+}
+
+// auditLog is an append-only, in-memory record of every todo mutation
+type auditLog struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+}
+
+// record is an event listener turning lifecycle events into audit entries.
+// Completion events are skipped because the matching update already
+// records the status change.
+func (a *auditLog) record(evt store.Event) {
+	entry := AuditEntry{
+		ID:       uuid.New().String(),
+		TodoID:   evt.Todo.ID,
+		Revision: evt.Todo.Version,
+		Actor:    evt.Actor,
+		At:       evt.OccurredAt,
+		EventID:  evt.ID,
+	}
+	snapshot := evt.Todo
+	switch evt.Type {
+	case store.EventTodoCreated:
+		entry.Action = AuditCreated
+		entry.snapshot = &snapshot
+		entry.Changes = diffTodos(store.Todo{}, evt.Todo)
+	case store.EventTodoUpdated:
+		entry.Action = AuditUpdated
+		entry.snapshot = &snapshot
+		before := store.Todo{}
+		if evt.Before != nil {
+			before = *evt.Before
+		}
+		entry.Changes = diffTodos(before, evt.Todo)
+	case store.EventTodoDeleted:
+		entry.Action = AuditDeleted
+	default:
+		return
+	}
+	a.append(entry)
+}
+
+// recordProject adds an entry for a change actor made to a project, if
+// anything changed
+func (a *auditLog) recordProject(before, after Project, actor string, at time.Time) {
+	changes := diffFields(before, after)
+	if len(changes) == 0 {
+		return
+	}
+	a.append(AuditEntry{
+		ID:        uuid.New().String(),
+		ProjectID: after.ID,
+		Action:    AuditUpdated,
+		Actor:     actor,
+		At:        at,
+		Changes:   changes,
+	})
+}
+
+// append chains entry onto the log
+func (a *auditLog) append(entry AuditEntry) {
+	if entry.Actor == "" {
+		entry.Actor = anonymousActor
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.Seq, entry.PrevHash = 1, auditGenesisHash
+	if n := len(a.entries); n > 0 {
+		entry.Seq, entry.PrevHash = a.entries[n-1].Seq+1, a.entries[n-1].Hash
+	}
+	entry.Hash = auditHash(entry)
+	a.entries = append(a.entries, entry)
+}
+
+// all returns every entry in chronological order
+func (a *auditLog) all() []AuditEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return slices.Clone(a.entries)
+}
+
+// replace swaps in a whole new log, as loading a state file does
+func (a *auditLog) replace(entries []AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = slices.Clone(entries)
+}
+
+// query returns matching entries in chronological order, keeping only the
+// most recent Limit entries when a limit is set
+func (a *auditLog) query(q auditQuery) []AuditEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	matches := []AuditEntry{}
+	for _, entry := range a.entries {
+		switch {
+		case q.TodoID != "" && entry.TodoID != q.TodoID,
+			q.ProjectID != "" && entry.ProjectID != q.ProjectID,
+			q.Humans && isServiceActor(entry.Actor),
+			q.Actor != "" && entry.Actor != q.Actor,
+			q.Action != "" && entry.Action != q.Action,
+			!q.Since.IsZero() && entry.At.Before(q.Since),
+			!q.Until.IsZero() && !entry.At.Before(q.Until):
+			continue
+		}
+		matches = append(matches, entry)
+	}
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[len(matches)-q.Limit:]
+	}
+	return matches
+}
+
+// creator returns who created todo id, if the audit log saw it happen
+func (a *auditLog) creator(id string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, entry := range a.entries {
+		if entry.TodoID == id && entry.Action == AuditCreated {
+			return entry.Actor, true
+		}
+	}
+	return "", false
+}
+
+// createdBy returns the IDs of the todos the audit log saw actor create
+func (a *auditLog) createdBy(actor string) map[string]bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	ids := map[string]bool{}
+	for _, entry := range a.entries {
+		if entry.TodoID != "" && entry.Action == AuditCreated && entry.Actor == actor {
+			ids[entry.TodoID] = true
+		}
+	}
+	return ids
+}
+
+// revision returns the snapshot of todo id at the given revision, and the
+// highest revision recorded for it
+func (a *auditLog) revision(id string, rev int) (snapshot *store.Todo, latest int) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, entry := range a.entries {
+		if entry.TodoID != id {
+			continue
+		}
+		latest = max(latest, entry.Revision)
+		if entry.Revision == rev && entry.snapshot != nil {
+			snapshot = entry.snapshot
+		}
+	}
+	return snapshot, latest
+}
+
+// diffTodos compares two todos field by field using their JSON form, so
+// the field names in a diff match the API
+func diffTodos(before, after store.Todo) []store.FieldChange {
+	return diffFields(before, after)
+}
+
+// diffFields lists the differences between the JSON fields of two values
+// of the same type
+func diffFields(before, after any) []store.FieldChange {
+	old, cur := jsonFields(before), jsonFields(after)
+	keys := map[string]bool{}
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range cur {
+		keys[k] = true
+	}
+	var names []string
+	for k := range keys {
+		if !slices.Contains(auditIgnoredFields, k) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []store.FieldChange
+	for _, name := range names {
+		if !reflect.DeepEqual(old[name], cur[name]) {
+			changes = append(changes, store.FieldChange{Field: name, Old: old[name], New: cur[name]})
+		}
+	}
+	return changes
+}
+
+func jsonFields(v any) map[string]any {
+	fields := map[string]any{}
+	b, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(b, &fields)
+	}
+	return fields
+}
+
+// GET /todos/{id}/history
+func (s *server) handleTodoHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	entries := s.audit.query(auditQuery{TodoID: id, Humans: excludeServices(r)})
+	if len(entries) == 0 {
+		// todos created before auditing started have no history yet
+		if _, err := s.store.Get(r.Context(), id); err != nil {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+	}
+	if err := respondJSON(w, http.StatusOK, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /todos/{id}/revert
+func (s *server) handleRevertTodo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	req, err := decodeJSON[struct {
+		Revision int `json:"revision"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshot, latest := s.audit.revision(id, req.Revision)
+	if snapshot == nil {
+		http.Error(w, fmt.Sprintf("todo has no revision %d", req.Revision), http.StatusNotFound)
+		return
+	}
+
+	// a deleted todo is recreated as it was at the revision
+	var current *store.Todo
+	todo, err := s.store.Get(r.Context(), id)
+	if err == nil {
+		current = &todo
+	} else if !errors.Is(err, store.ErrNotFound) {
+		respondError(w, err)
+		return
+	}
+
+	todo, events := restoreTodo(current, *snapshot, latest, actorFromRequest(r), time.Now())
+	status := http.StatusOK
+	if current == nil {
+		err = s.store.Create(r.Context(), todo, s.outboxEvents(events...)...)
+		status = http.StatusCreated
+	} else {
+		err = s.store.Update(r.Context(), todo, s.outboxEvents(events...)...)
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	s.emitFor(r, events...)
+
+	if err := respondJSON(w, status, todo); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/audit
+func (s *server) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := s.parseAuditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.audit.query(q)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// defaultAuditPageSize and maxAuditPageSize bound GET /admin/audit
+// pages; see routePageLimits
+const (
+	defaultAuditPageSize = 1000
+	maxAuditPageSize     = 10000
+)
+
+// parseAuditQuery reads user, todo_id, project_id, action, since, until
+// (RFC 3339), limit and exclude_services from the query string
+func (s *server) parseAuditQuery(r *http.Request) (auditQuery, error) {
+	limit, err := s.pageSize(r)
+	if err != nil {
+		return auditQuery{}, err
+	}
+	v := r.URL.Query()
+	q := auditQuery{
+		TodoID:    v.Get("todo_id"),
+		ProjectID: v.Get("project_id"),
+		Humans:    excludeServices(r),
+		Actor:     v.Get("user"),
+		Action:    AuditAction(v.Get("action")),
+		Limit:     limit,
+	}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := v.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = t
+		}
+	}
+	return q, nil
+}
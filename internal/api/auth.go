@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// anonymousActor is recorded for requests that don't identify their user
+const anonymousActor = "anonymous"
+
+// actorFromRequest returns who is making a request, as recorded in events
+// and the audit log. Until user accounts exist it is the X-User-ID header.
+func actorFromRequest(r *http.Request) string {
+	if user := strings.TrimSpace(r.Header.Get("X-User-ID")); user != "" {
+		return user
+	}
+	return anonymousActor
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// isAdmin reports whether the request carries the configured admin token
+func (s *server) isAdmin(r *http.Request) bool {
+	token := bearerToken(r)
+	admin := s.adminToken.Get()
+	return admin != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1
+}
+
+// requireAdmin rejects requests without the admin token. The admin API is
+// disabled entirely when no token is configured.
+func (s *server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken.Get() == "" {
+			http.Error(w, "admin API is disabled; set TODO_ADMIN_TOKEN to enable it", http.StatusForbidden)
+			return
+		}
+		if !s.isAdmin(r) {
+			s.authFailed(r)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// backupVersion is the format version written to backups
+const backupVersion = 1
+
+// backupSnapshot is everything needed to rebuild a server's data. Todos
+// already moved to cold storage aren't included since that tier is
+// durable on its own; attachments are included as metadata only, their
+// contents staying in the blob store.
+type backupSnapshot struct {
+	Version     int          `json:"version"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Todos       []store.Todo `json:"todos"`
+	Projects    []Project    `json:"projects"`
+	Users       []User       `json:"users"`
+	Comments    []Comment    `json:"comments"`
+	TimeEntries []TimeEntry  `json:"time_entries,omitempty"`
+	Attachments []Attachment `json:"attachments"`
+	Canaries    []string     `json:"canaries,omitempty"`
+}
+
+// restoreReport counts what a restore loaded
+type restoreReport struct {
+	Todos       int `json:"todos"`
+	Projects    int `json:"projects"`
+	Users       int `json:"users"`
+	Comments    int `json:"comments"`
+	TimeEntries int `json:"time_entries"`
+	Attachments int `json:"attachments"`
+}
+
+// backup captures the current data. Registries are read one after the
+// other, so a backup taken under write load may hold, say, a comment on a
+// todo deleted a moment before.
+func (s *server) backup(ctx context.Context, now time.Time) (backupSnapshot, error) {
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return backupSnapshot{}, err
+	}
+	return backupSnapshot{
+		Version:     backupVersion,
+		CreatedAt:   now,
+		Todos:       todos,
+		Projects:    s.projects.list(),
+		Users:       s.users.list(),
+		Comments:    s.comments.all(),
+		TimeEntries: s.timeEntries.all(),
+		Attachments: s.attachments.all(),
+		Canaries:    s.canaries.list(),
+	}, nil
+}
+
+func (b backupSnapshot) validate() error {
+	if b.Version != backupVersion {
+		return fmt.Errorf("unsupported backup version %d; want %d", b.Version, backupVersion)
+	}
+	seen := map[string]bool{}
+	for i, todo := range b.Todos {
+		if todo.ID == "" || seen[todo.ID] {
+			return fmt.Errorf("todos[%d]: id is missing or duplicated", i)
+		}
+		seen[todo.ID] = true
+	}
+	return nil
+}
+
+// restore replaces all data with the snapshot's. It doesn't emit events,
+// so webhook and broker subscribers should resync afterwards.
+func (s *server) restore(ctx context.Context, b backupSnapshot) (restoreReport, error) {
+	if err := b.validate(); err != nil {
+		return restoreReport{}, err
+	}
+	err := s.store.Atomically(ctx, func(tx store.Tx) error {
+		existing, err := tx.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, todo := range existing {
+			if err := tx.Delete(ctx, todo.ID); err != nil {
+				return err
+			}
+		}
+		for _, todo := range b.Todos {
+			if err := tx.Create(ctx, todo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return restoreReport{}, err
+	}
+	s.projects.replace(b.Projects)
+	s.users.replace(b.Users)
+	s.comments.replace(b.Comments)
+	s.timeEntries.replace(b.TimeEntries)
+	s.attachments.replace(b.Attachments)
+	s.canaries.replace(b.Canaries)
+	s.search.rebuild(b.Todos)
+	return restoreReport{
+		Todos:       len(b.Todos),
+		Projects:    len(b.Projects),
+		Users:       len(b.Users),
+		Comments:    len(b.Comments),
+		TimeEntries: len(b.TimeEntries),
+		Attachments: len(b.Attachments),
+	}, nil
+}
+
+// backupName is the file or object name of a backup taken at t
+func backupName(t time.Time) string {
+	return "todo-backup-" + t.UTC().Format("20060102T150405Z") + ".json"
+}
+
+// runBackups writes a backup to dest every interval until ctx is cancelled
+func (s *server) runBackups(ctx context.Context, dest store.BlobStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		name, err := s.backupTo(ctx, dest, time.Now())
+		if err != nil {
+			log.Printf("scheduled backup failed: %v", err)
+			continue
+		}
+		log.Printf("wrote backup %s", name)
+	}
+}
+
+func (s *server) backupTo(ctx context.Context, dest store.BlobStore, now time.Time) (string, error) {
+	snapshot, err := s.backup(ctx, now)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+	name := backupName(now)
+	return name, dest.Put(ctx, name, bytes.NewReader(data), "application/json")
+}
+
+// POST /admin/backup
+func (s *server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	snapshot, err := s.backup(r.Context(), now)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+backupName(now)+`"`)
+	if err := respondJSON(w, http.StatusOK, snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/restore
+func (s *server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := decodeJSON[backupSnapshot](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := snapshot.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := s.restore(r.Context(), snapshot)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("backup from %s restored by %s: %d todos", snapshot.CreatedAt.Format(time.RFC3339), actorFromRequest(r), report.Todos)
+	if err := respondJSON(w, http.StatusOK, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,402 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// maxBatchSize caps how many items a single bulk request may touch
+const maxBatchSize = 1000
+
+// errBatchAborted rolls back an atomic batch when one of its items fails
+var errBatchAborted = errors.New("batch aborted")
+
+// errPreconditionFailed reports a todo that changed since the client read it
+var errPreconditionFailed = errors.New("precondition failed: todo has changed")
+
+// precondition is an optional per-item guard on the todo's current state,
+// given either as its version or as its ETag
+type precondition struct {
+	IfVersion int    `json:"if_version,omitempty"`
+	IfMatch   string `json:"if_match,omitempty"`
+}
+
+func (p precondition) set() bool {
+	return p.IfVersion != 0 || p.IfMatch != ""
+}
+
+// check reports whether todo still satisfies the precondition
+func (p precondition) check(todo store.Todo) bool {
+	if p.IfVersion != 0 && todo.Version != p.IfVersion {
+		return false
+	}
+	if p.IfMatch != "" && p.IfMatch != "*" && strings.TrimPrefix(p.IfMatch, "W/") != todoETag(todo) {
+		return false
+	}
+	return true
+}
+
+// itemConflict reports an item skipped because its precondition failed,
+// with the current todo so the client can reconcile
+func itemConflict(todo store.Todo) batchItemResult {
+	return batchItemResult{ID: todo.ID, Status: http.StatusPreconditionFailed, Error: errPreconditionFailed.Error(), Todo: &todo}
+}
+
+// batchItemResult reports the outcome of one item of a bulk request
+type batchItemResult struct {
+	Index  int         `json:"index"`
+	ID     string      `json:"id,omitempty"`
+	Status int         `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Todo   *store.Todo `json:"todo,omitempty"`
+}
+
+// batchResponse is the report returned by bulk endpoints
+type batchResponse struct {
+	Atomic    bool              `json:"atomic"`
+	Committed bool              `json:"committed"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Conflicts int               `json:"conflicts"`
+	Results   []batchItemResult `json:"results"`
+}
+
+// itemOK and itemFailed build per-item results
+func itemOK(status int, todo store.Todo) batchItemResult {
+	return batchItemResult{ID: todo.ID, Status: status, Todo: &todo}
+}
+
+func itemFailed(id string, status int, err error) batchItemResult {
+	return batchItemResult{ID: id, Status: status, Error: err.Error()}
+}
+
+// runBatch applies n items either atomically, where the first failure rolls
+// everything back, or best-effort, where each item commits on its own.
+// Events are only emitted for items whose writes were committed.
+func (s *server) runBatch(r *http.Request, atomic bool, n int, apply func(tx store.Tx, i int) (batchItemResult, []store.Event)) batchResponse {
+	var results []batchItemResult
+	var events []store.Event
+	var err error
+	if atomic {
+		err = s.store.Atomically(r.Context(), func(tx store.Tx) error {
+			results, events = make([]batchItemResult, 0, n), nil
+			for i := range n {
+				res, evts := apply(tx, i)
+				res.Index = i
+				results = append(results, res)
+				if res.Error != "" {
+					return errBatchAborted
+				}
+				events = append(events, evts...)
+			}
+			return nil
+		})
+	} else {
+		// each item reads and writes in a transaction of its own, so one
+		// item's checks still hold when it is written
+		results = make([]batchItemResult, 0, n)
+		for i := range n {
+			var res batchItemResult
+			var evts []store.Event
+			txErr := s.store.Atomically(r.Context(), func(tx store.Tx) error {
+				res, evts = apply(tx, i)
+				if res.Error != "" {
+					return errBatchAborted
+				}
+				return nil
+			})
+			if txErr != nil && res.Error == "" {
+				res = itemFailed(res.ID, http.StatusInternalServerError, txErr)
+			}
+			res.Index = i
+			results = append(results, res)
+			if res.Error == "" {
+				events = append(events, evts...)
+			}
+		}
+	}
+
+	resp := batchResponse{Atomic: atomic, Committed: err == nil, Results: results}
+	if err != nil {
+		// report earlier items as rolled back and later ones as skipped
+		for i := range resp.Results {
+			if resp.Results[i].Error == "" {
+				resp.Results[i] = batchItemResult{Index: i, ID: resp.Results[i].ID, Status: http.StatusFailedDependency, Error: "rolled back: another item in the batch failed"}
+			}
+		}
+		for i := len(resp.Results); i < n; i++ {
+			resp.Results = append(resp.Results, batchItemResult{Index: i, Status: http.StatusFailedDependency, Error: "not attempted: another item in the batch failed"})
+		}
+	} else {
+		s.emitFor(r, events...)
+	}
+	for _, res := range resp.Results {
+		switch {
+		case res.Error == "":
+			resp.Succeeded++
+		case res.Status == http.StatusPreconditionFailed:
+			resp.Conflicts++
+			resp.Failed++
+		default:
+			resp.Failed++
+		}
+	}
+	return resp
+}
+
+// respondBatch writes a batch report; an aborted atomic batch is a 422
+func respondBatch(w http.ResponseWriter, resp batchResponse) {
+	status := http.StatusOK
+	if !resp.Committed {
+		status = http.StatusUnprocessableEntity
+	}
+	if err := respondJSON(w, status, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// POST /todos/batch
+func (s *server) handleBatchCreateTodos(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Todos  []store.Todo `json:"todos"`
+		Atomic bool         `json:"atomic"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Todos) == 0 || len(req.Todos) > maxBatchSize {
+		http.Error(w, "todos must contain between 1 and 1000 items", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	resp := s.runBatch(r, req.Atomic, len(req.Todos), func(tx store.Tx, i int) (batchItemResult, []store.Event) {
+		return s.batchCreate(r, tx, req.Todos[i], now)
+	})
+	respondBatch(w, resp)
+}
+
+// batchCreate creates one todo of a batch as POST /todos would
+func (s *server) batchCreate(r *http.Request, tx store.Tx, todo store.Todo, now time.Time) (batchItemResult, []store.Event) {
+	todo, created, rejected, err := s.insertTodo(r, tx, todo, now)
+	if err != nil && rejected != 0 {
+		return itemFailed("", rejected, err), nil
+	}
+	if err != nil {
+		return itemFailed("", http.StatusInternalServerError, err), nil
+	}
+	return itemOK(http.StatusCreated, todo), []store.Event{created}
+}
+
+// batchTarget names one todo of a bulk update, optionally guarded by a
+// precondition
+type batchTarget struct {
+	ID string `json:"id"`
+	precondition
+}
+
+// todoFilter selects todos for bulk operations
+type todoFilter struct {
+	Tag    string           `json:"tag,omitempty"`
+	Status store.TodoStatus `json:"status,omitempty"`
+}
+
+func (f todoFilter) empty() bool {
+	return f.Tag == "" && f.Status == ""
+}
+
+func (f todoFilter) matches(todo store.Todo) bool {
+	if f.Tag != "" && !tagMatcher(f.Tag)(todo.Tags) {
+		return false
+	}
+	if f.Status != "" && todo.Status != f.Status {
+		return false
+	}
+	return true
+}
+
+// PATCH /todos/batch
+func (s *server) handleBatchUpdateTodos(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		IDs    []string         `json:"ids"`
+		Items  []batchTarget    `json:"items"`
+		Filter *todoFilter      `json:"filter"`
+		Status store.TodoStatus `json:"status"`
+		Force  bool             `json:"force"`
+		Delete bool             `json:"delete"`
+		Atomic bool             `json:"atomic"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	selectors := 0
+	for _, set := range []bool{len(req.IDs) > 0, len(req.Items) > 0, req.Filter != nil} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		http.Error(w, "exactly one of ids, items or filter is required", http.StatusBadRequest)
+		return
+	}
+	if req.Filter != nil && req.Filter.empty() {
+		http.Error(w, "filter must set at least one of tag or status", http.StatusBadRequest)
+		return
+	}
+	if (req.Status != "") == req.Delete {
+		http.Error(w, "exactly one of status or delete is required", http.StatusBadRequest)
+		return
+	}
+	if req.Status != "" && !s.workflow.valid(req.Status) {
+		http.Error(w, "invalid status "+string(req.Status), http.StatusBadRequest)
+		return
+	}
+
+	// resolve the selection to concrete targets up front
+	targets := req.Items
+	for _, id := range req.IDs {
+		targets = append(targets, batchTarget{ID: id})
+	}
+	if req.Filter != nil {
+		todos, err := s.store.List(r.Context())
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		for _, todo := range todos {
+			if req.Filter.matches(todo) {
+				targets = append(targets, batchTarget{ID: todo.ID})
+			}
+		}
+	}
+	if len(targets) > maxBatchSize {
+		http.Error(w, "batch matches more than 1000 todos", http.StatusBadRequest)
+		return
+	}
+
+	now, actor := time.Now(), actorFromRequest(r)
+	resp := s.runBatch(r, req.Atomic, len(targets), func(tx store.Tx, i int) (batchItemResult, []store.Event) {
+		todo, err := tx.Get(r.Context(), targets[i].ID)
+		if errors.Is(err, store.ErrNotFound) {
+			return itemFailed(targets[i].ID, http.StatusNotFound, err), nil
+		}
+		if err != nil {
+			return itemFailed(targets[i].ID, http.StatusInternalServerError, err), nil
+		}
+		if !targets[i].check(todo) {
+			return itemConflict(todo), nil
+		}
+
+		if req.Delete {
+			deleted := store.NewEvent(store.EventTodoDeleted, actor, todo)
+			if err := tx.Delete(r.Context(), todo.ID, s.outboxEvents(deleted)...); err != nil {
+				return itemFailed(todo.ID, http.StatusInternalServerError, err), nil
+			}
+			return batchItemResult{ID: todo.ID, Status: http.StatusNoContent}, []store.Event{deleted}
+		}
+
+		if err := checkCanComplete(r.Context(), tx, todo, req.Status, req.Force); err != nil {
+			return itemFailed(todo.ID, completionErrorStatus(err), err), nil
+		}
+		todo, events, err := s.applyStatus(todo, req.Status, actor, now)
+		if err != nil {
+			return itemFailed(todo.ID, statusErrorCode(err), err), nil
+		}
+		if err := tx.Update(r.Context(), todo, s.outboxEvents(events...)...); err != nil {
+			return itemFailed(todo.ID, http.StatusInternalServerError, err), nil
+		}
+		return itemOK(http.StatusOK, todo), events
+	})
+	respondBatch(w, resp)
+}
+
+// batchOperation is one entry of a POST /batch request
+type batchOperation struct {
+	Op     string           `json:"op"`
+	ID     string           `json:"id,omitempty"`
+	Todo   *store.Todo      `json:"todo,omitempty"`
+	Status store.TodoStatus `json:"status,omitempty"`
+	Force  bool             `json:"force,omitempty"`
+	precondition
+}
+
+// POST /batch
+func (s *server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Operations []batchOperation `json:"operations"`
+		Atomic     bool             `json:"atomic"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchSize {
+		http.Error(w, "operations must contain between 1 and 1000 items", http.StatusBadRequest)
+		return
+	}
+
+	now, actor := time.Now(), actorFromRequest(r)
+	resp := s.runBatch(r, req.Atomic, len(req.Operations), func(tx store.Tx, i int) (batchItemResult, []store.Event) {
+		op := req.Operations[i]
+		if op.Op == "create" {
+			if op.set() {
+				return itemFailed("", http.StatusBadRequest, errors.New("preconditions only apply to existing todos")), nil
+			}
+			if op.Todo == nil {
+				return itemFailed("", http.StatusBadRequest, errors.New("create requires todo")), nil
+			}
+			return s.batchCreate(r, tx, *op.Todo, now)
+		}
+
+		switch op.Op {
+		case "update", "complete", "delete":
+		default:
+			return itemFailed(op.ID, http.StatusBadRequest, fmt.Errorf("unknown op %q; want create, update, complete or delete", op.Op)), nil
+		}
+		if op.ID == "" {
+			return itemFailed("", http.StatusBadRequest, fmt.Errorf("%s requires id", op.Op)), nil
+		}
+		todo, err := tx.Get(r.Context(), op.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			return itemFailed(op.ID, http.StatusNotFound, err), nil
+		}
+		if err != nil {
+			return itemFailed(op.ID, http.StatusInternalServerError, err), nil
+		}
+		if !op.check(todo) {
+			return itemConflict(todo), nil
+		}
+
+		if op.Op == "delete" {
+			deleted := store.NewEvent(store.EventTodoDeleted, actor, todo)
+			if err := tx.Delete(r.Context(), todo.ID, s.outboxEvents(deleted)...); err != nil {
+				return itemFailed(todo.ID, http.StatusInternalServerError, err), nil
+			}
+			return batchItemResult{ID: todo.ID, Status: http.StatusNoContent}, []store.Event{deleted}
+		}
+
+		status := op.Status
+		if op.Op == "complete" {
+			status = store.StatusCompleted
+		}
+		if err := checkCanComplete(r.Context(), tx, todo, status, op.Force); err != nil {
+			return itemFailed(todo.ID, completionErrorStatus(err), err), nil
+		}
+		todo, events, err := s.applyStatus(todo, status, actor, now)
+		if err != nil {
+			return itemFailed(todo.ID, statusErrorCode(err), err), nil
+		}
+		if err := tx.Update(r.Context(), todo, s.outboxEvents(events...)...); err != nil {
+			return itemFailed(todo.ID, http.StatusInternalServerError, err), nil
+		}
+		return itemOK(http.StatusOK, todo), events
+	})
+	respondBatch(w, resp)
+}
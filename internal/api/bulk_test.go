@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func decodeBatch(t *testing.T, body []byte) batchResponse {
+	t.Helper()
+	var resp batchResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode batch response: %v: %s", err, body)
+	}
+	return resp
+}
+
+func TestBatchCreateLikeSingleCreate(t *testing.T) {
+	srv := newTestServer(t, Options{})
+	h := srv.routes()
+	var projects [2]Project
+	for i, name := range []string{"Home", "Work"} {
+		w := serve(h, "POST", "/projects", `{"name":"`+name+`"}`)
+		if err := json.Unmarshal(w.Body.Bytes(), &projects[i]); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("create project: %d %s", w.Code, w.Body)
+		}
+	}
+	_, secret, err := srv.projectTokens.issue(projects[0].ID, "ci", scopeWrite, "al", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"todos":[
+		{"title":"scoped"},
+		{"title":"elsewhere","project_id":"` + projects[1].ID + `"},
+		{"title":"due","due_at":"2025-06-18T09:00:00Z"}
+	]}`
+	for _, target := range []string{"/todos/batch", "/batch"} {
+		req := body
+		if target == "/batch" {
+			req = `{"operations":[
+				{"op":"create","todo":{"title":"scoped"}},
+				{"op":"create","todo":{"title":"elsewhere","project_id":"` + projects[1].ID + `"}},
+				{"op":"create","todo":{"title":"due","due_at":"2025-06-18T09:00:00Z"}}
+			]}`
+		}
+		w := serve(h, "POST", target, req, "X-Timezone", "Europe/Berlin")
+		resp := decodeBatch(t, w.Body.Bytes())
+		if resp.Succeeded != 3 {
+			t.Fatalf("%s: %+v", target, resp)
+		}
+		if due := resp.Results[2].Todo; due.DueTimezone != "Europe/Berlin" {
+			t.Errorf("%s: due_timezone = %q, want the creator's zone", target, due.DueTimezone)
+		}
+	}
+
+	// project tokens create in their own project only
+	w := serve(h, "POST", "/todos/batch", body, "Authorization", "Bearer "+secret)
+	resp := decodeBatch(t, w.Body.Bytes())
+	if resp.Succeeded != 2 || resp.Results[1].Status != http.StatusForbidden {
+		t.Fatalf("batch with a project token: %+v", resp)
+	}
+	if got := resp.Results[0].Todo.ProjectID; got != projects[0].ID {
+		t.Errorf("project_id = %q, want the token's project %q", got, projects[0].ID)
+	}
+}
+
+func TestBestEffortBatch(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	blocker := createTodo(t, h, `{"title":"blocker"}`)
+	todo := createTodo(t, h, `{"title":"todo","blocked_by":["`+blocker.ID+`"]}`)
+	body := `{"operations":[
+		{"op":"complete","id":"` + todo.ID + `"},
+		{"op":"update","id":"` + todo.ID + `","status":"in_progress"},
+		{"op":"delete","id":"missing"},
+		{"op":"update","id":"` + blocker.ID + `","status":"in_progress","if_version":99}
+	]}`
+	w := serve(h, "POST", "/batch", body)
+	resp := decodeBatch(t, w.Body.Bytes())
+	want := []int{http.StatusConflict, http.StatusOK, http.StatusNotFound, http.StatusPreconditionFailed}
+	if w.Code != http.StatusOK || !resp.Committed || len(resp.Results) != len(want) {
+		t.Fatalf("best-effort batch: %d %+v", w.Code, resp)
+	}
+	for i, status := range want {
+		if resp.Results[i].Status != status {
+			t.Errorf("item %d: status = %d, want %d: %s", i, resp.Results[i].Status, status, resp.Results[i].Error)
+		}
+	}
+	if resp.Succeeded != 1 || resp.Failed != 3 || resp.Conflicts != 1 {
+		t.Errorf("counts = %d succeeded, %d failed, %d conflicts; want 1, 3, 1", resp.Succeeded, resp.Failed, resp.Conflicts)
+	}
+
+	// the same batch atomically rolls back the update that went through
+	w = serve(h, "POST", "/batch", `{"atomic":true,"operations":[
+		{"op":"update","id":"`+blocker.ID+`","status":"in_progress"},
+		{"op":"delete","id":"missing"}
+	]}`)
+	if resp := decodeBatch(t, w.Body.Bytes()); w.Code != http.StatusUnprocessableEntity || resp.Committed {
+		t.Fatalf("atomic batch: %d %+v", w.Code, resp)
+	}
+	w = serve(h, "GET", "/todos/"+blocker.ID, "")
+	var got struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Status != "pending" {
+		t.Errorf("blocker after the aborted batch: %s, want it still pending", w.Body)
+	}
+}
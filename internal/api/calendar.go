@@ -0,0 +1,223 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// calendarSigner creates and checks the tokens embedded in calendar feed
+// URLs. Calendar apps can't send auth headers, so the URL itself carries a
+// signature over the feed's filter. Tokens are "<key id>.<signature>" so
+// the signing key can be rotated without breaking every subscription.
+type calendarSigner struct {
+	keys *keyRing
+}
+
+func calendarMAC(secret []byte, tag string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("calendar:" + tag))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sign returns the token for a feed filtered by tag ("" means all todos)
+func (c calendarSigner) sign(tag string) string {
+	key, _ := c.keys.signer()
+	return key.ID + "." + calendarMAC(key.secret, tag)
+}
+
+// verify accepts tokens signed by any key still in the ring, including
+// tokens issued before they carried a key ID
+func (c calendarSigner) verify(tag, token string) bool {
+	id, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		id, mac = "", token
+	}
+	for _, key := range c.keys.verifiers(time.Now()) {
+		if (id == "" || id == key.ID) && hmac.Equal([]byte(calendarMAC(key.secret, tag)), []byte(mac)) {
+			return true
+		}
+	}
+	return false
+}
+
+// POST /calendar/tokens
+func (s *server) handleCreateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Tag string `json:"tag"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := url.Values{}
+	if req.Tag != "" {
+		query.Set("tag", req.Tag)
+	}
+	query.Set("token", s.calendar.sign(req.Tag))
+	feedURL := url.URL{Scheme: "http", Host: r.Host, Path: "/todos/calendar.ics", RawQuery: query.Encode()}
+	if r.TLS != nil {
+		feedURL.Scheme = "https"
+	}
+
+	if err := respondJSON(w, http.StatusCreated, map[string]string{
+		"url":    feedURL.String(),
+		"webcal": strings.Replace(feedURL.String(), feedURL.Scheme+"://", "webcal://", 1),
+	}); err != nil {
+		respondError(w, err)
+		return
+	}
+}
+
+// GET /todos/calendar.ics
+func (s *server) handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tag := q.Get("tag")
+	if !s.calendar.verify(tag, q.Get("token")) {
+		s.authFailed(r)
+		http.Error(w, "invalid or missing calendar token", http.StatusForbidden)
+		return
+	}
+	if !strings.Contains(q.Get("token"), ".") {
+		s.deprecatedUse(w, r, "calendar-token-without-key-id")
+	}
+
+	component := strings.ToUpper(q.Get("component"))
+	if component == "" {
+		component = "VEVENT"
+	}
+	if component != "VEVENT" && component != "VTODO" {
+		http.Error(w, "component must be vevent or vtodo", http.StatusBadRequest)
+		return
+	}
+
+	// Times are written in UTC, which every client converts correctly; the
+	// feed timezone decides which due times count as all-day (local midnight)
+	loc := time.UTC
+	if name := q.Get("tz"); name != "" {
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			http.Error(w, fmt.Sprintf("unknown timezone %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	includeCompleted := component == "VTODO" || q.Get("include_completed") == "true"
+	var due []store.Todo
+	for _, todo := range todos {
+		if todo.DueAt == nil || (tag != "" && !tagMatcher(tag)(todo.Tags)) {
+			continue
+		}
+		if todo.Status == store.StatusCompleted && !includeCompleted {
+			continue
+		}
+		due = append(due, todo)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="todos.ics"`)
+	w.Write([]byte(renderCalendar(due, component, loc)))
+}
+
+// renderCalendar renders todos with due dates as an RFC 5545 calendar
+func renderCalendar(todos []store.Todo, component string, loc *time.Location) string {
+	var b strings.Builder
+	line := func(s string) { b.WriteString(foldICalLine(s)) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//golang-todo//calendar feed//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Todos")
+	line("X-WR-TIMEZONE:" + loc.String())
+	line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	line("X-PUBLISHED-TTL:PT1H")
+
+	for _, todo := range todos {
+		line("BEGIN:" + component)
+		line("UID:" + todo.ID + "@golang-todo")
+		line("DTSTAMP:" + icalUTC(todo.UpdatedAt))
+		line("CREATED:" + icalUTC(todo.CreatedAt))
+		line("LAST-MODIFIED:" + icalUTC(todo.UpdatedAt))
+		line("SUMMARY:" + escapeICalText(todo.Title))
+		if todo.Description != "" {
+			line("DESCRIPTION:" + escapeICalText(todo.Description))
+		}
+		if len(todo.Tags) > 0 {
+			tags := make([]string, len(todo.Tags))
+			for i, tag := range todo.Tags {
+				tags[i] = escapeICalText(tag)
+			}
+			line("CATEGORIES:" + strings.Join(tags, ","))
+		}
+
+		local := todo.DueAt.In(loc)
+		allDay := local.Hour() == 0 && local.Minute() == 0 && local.Second() == 0
+		dueProp := "DTSTART"
+		if component == "VTODO" {
+			dueProp = "DUE"
+		}
+		if allDay {
+			line(dueProp + ";VALUE=DATE:" + local.Format("20060102"))
+		} else {
+			line(dueProp + ":" + icalUTC(*todo.DueAt))
+		}
+
+		if component == "VTODO" {
+			if todo.Status == store.StatusCompleted {
+				line("STATUS:COMPLETED")
+				if todo.CompletedAt != nil {
+					line("COMPLETED:" + icalUTC(*todo.CompletedAt))
+				}
+			} else {
+				line("STATUS:NEEDS-ACTION")
+			}
+		} else {
+			line("TRANSP:TRANSPARENT")
+		}
+		line("END:" + component)
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+func icalUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeICalText escapes a TEXT value per RFC 5545 section 3.3.11
+func escapeICalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICalLine terminates a content line with CRLF, folding it at 75
+// octets without splitting multi-byte characters
+func foldICalLine(s string) string {
+	var b strings.Builder
+	lineLen := 0
+	for _, r := range s {
+		n := len(string(r))
+		if lineLen+n > 75 {
+			b.WriteString("\r\n ")
+			lineLen = 1
+		}
+		b.WriteRune(r)
+		lineLen += n
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// canaryRegistry holds the IDs of canary todos: ordinary-looking todos no
+// one has a reason to open, so any access to one suggests leaked
+// credentials or someone probing the API
+type canaryRegistry struct {
+	mu  sync.RWMutex
+	ids []string
+}
+
+func (c *canaryRegistry) add(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !slices.Contains(c.ids, id) {
+		c.ids = append(c.ids, id)
+	}
+}
+
+func (c *canaryRegistry) remove(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.ids)
+	c.ids = slices.DeleteFunc(c.ids, func(v string) bool { return v == id })
+	return len(c.ids) < n
+}
+
+func (c *canaryRegistry) contains(id string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Contains(c.ids, id)
+}
+
+func (c *canaryRegistry) list() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string{}, c.ids...)
+}
+
+// replace swaps in a whole new set of canaries, as restoring a backup does
+func (c *canaryRegistry) replace(ids []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = append([]string{}, ids...)
+}
+
+// canaryAccessed raises an alert describing who touched a canary and how.
+// Admins are exempt so canaries can be managed without setting them off.
+func (s *server) canaryAccessed(r *http.Request, id, how string) {
+	if s.isAdmin(r) {
+		return
+	}
+	details := map[string]string{
+		"todo_id":    id,
+		"access":     how,
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"client":     clientAddress(r),
+		"user_agent": r.UserAgent(),
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		details["forwarded_for"] = fwd
+	}
+	s.anomalies.alert(Anomaly{Rule: anomalyCanaryAccess, Subject: actorFromRequest(r), Count: 1, Details: details, DetectedAt: time.Now()})
+}
+
+// watchCanaries alerts on requests to a route addressing a canary todo by
+// its ID, whether the handler succeeds or not
+func (s *server) watchCanaries(pattern string, next http.Handler) http.Handler {
+	if !strings.Contains(pattern, "/todos/{id}") {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.PathValue("id"); s.canaries.contains(id) {
+			s.canaryAccessed(r, id, "direct")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkExportedCanaries alerts once per export that includes canaries
+func (s *server) checkExportedCanaries(r *http.Request, todos []store.Todo) {
+	for _, todo := range todos {
+		if s.canaries.contains(todo.ID) {
+			s.canaryAccessed(r, todo.ID, "export")
+			return
+		}
+	}
+}
+
+// POST /admin/canaries
+func (s *server) handleCreateCanary(w http.ResponseWriter, r *http.Request) {
+	todo, err := decodeJSON[store.Todo](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.checkNewTodo(todo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// canaries are created like any other todo so nothing gives them away
+	todo = newTodo(todo, time.Now())
+	created := store.NewEvent(store.EventTodoCreated, actorFromRequest(r), todo)
+	if err := s.store.Create(r.Context(), todo, s.outboxEvents(created)...); err != nil {
+		respondError(w, err)
+		return
+	}
+	s.canaries.add(todo.ID)
+	s.emitFor(r, created)
+
+	if err := respondJSON(w, http.StatusCreated, todo); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/canaries
+func (s *server) handleListCanaries(w http.ResponseWriter, r *http.Request) {
+	todos := []store.Todo{}
+	for _, id := range s.canaries.list() {
+		todo, err := s.store.Get(r.Context(), id)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		todos = append(todos, todo)
+	}
+	if err := respondJSON(w, http.StatusOK, todos); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /admin/canaries/{id}
+func (s *server) handleDeleteCanary(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.canaries.remove(id) {
+		http.Error(w, "canary not found", http.StatusNotFound)
+		return
+	}
+	// the todo itself may already be gone
+	todo, err := s.store.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	deleted := store.NewEvent(store.EventTodoDeleted, actorFromRequest(r), todo)
+	if err := s.store.Delete(r.Context(), id, s.outboxEvents(deleted)...); err != nil && !errors.Is(err, store.ErrNotFound) {
+		respondError(w, err)
+		return
+	}
+	s.emitFor(r, deleted)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// What deleting a todo or project, or disabling a user, does to everything
+// referring to it. None of these is final straight away: a deleted todo
+// comes back through POST /undo during the undo window, a deleted project
+// through POST /projects/{id}/restore and a disabled user by enabling
+// them. So nothing that would be needed to bring one back is destroyed
+// until that can no longer happen:
+//
+//	deleted todo     its comments, attachments, time entries and touches
+//	                 are hidden with it and purged once the todo can't be
+//	                 undone; its edit lock is dropped at once; todos it
+//	                 blocks keep the link until then, ignoring it
+//	deleted project  its todos keep their project_id and stay visible; no
+//	                 todo can be created in or moved to it, nobody can
+//	                 join its presence and its tokens are refused, until
+//	                 it is restored
+//	disabled user    their edit locks are dropped and running timers
+//	                 stopped; their todos, comments and time entries stay
+//	                 theirs
+//
+// Resources that refer to todos, projects or users follow these rules
+// rather than making up their own: hang cleanup off the functions here.
+
+// purgerActor is recorded for changes made when purging deleted todos
+const purgerActor = "purger"
+
+// cascadeTodoDeleted is a server listener applying what deleting a todo
+// does at once
+func (s *server) cascadeTodoDeleted(evt store.Event) {
+	if evt.Type == store.EventTodoDeleted {
+		s.locks.release(evt.Todo.ID, "", true, evt.OccurredAt)
+	}
+}
+
+// cascadeProjectDeleted applies what deleting a project does at once
+func (s *server) cascadeProjectDeleted(id string) {
+	s.presence.clear(id)
+}
+
+// cascadeUserDisabled applies what disabling a user does at once
+func (s *server) cascadeUserDisabled(id string, now time.Time) {
+	s.locks.releaseHolder(id)
+	if stopped := s.timeEntries.stopUser(id, now); len(stopped) > 0 {
+		log.Printf("stopped %d running timers of disabled user %s", len(stopped), id)
+	}
+}
+
+// runPurger purges deleted todos every interval until ctx is cancelled
+func (s *server) runPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n, err := s.purgeOnce(ctx, now); err != nil {
+				log.Printf("purging deleted todos failed after purging %d: %v", n, err)
+			} else if n > 0 {
+				log.Printf("purged %d deleted todos", n)
+			}
+		}
+	}
+}
+
+// purgeOnce purges what is left of todos that can no longer be undone and
+// returns how many were purged. A todo is past undoing once it was deleted
+// longer ago than the undo window, or when its deletion isn't known at
+// all, as after a restart.
+func (s *server) purgeOnce(ctx context.Context, now time.Time) (int, error) {
+	// collect the referenced todos before listing, so a todo whose comments
+	// are seen is either listed or has been deleted since
+	var referenced []string
+	for _, c := range s.comments.all() {
+		referenced = append(referenced, c.TodoID)
+	}
+	for _, att := range s.attachments.all() {
+		referenced = append(referenced, att.TodoID)
+	}
+	for _, e := range s.timeEntries.all() {
+		referenced = append(referenced, e.TodoID)
+	}
+	referenced = append(referenced, s.touches.todoIDs()...)
+
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	exists := map[string]bool{}
+	for _, todo := range todos {
+		exists[todo.ID] = true
+	}
+	if s.cold != nil {
+		err := s.cold.Each(ctx, func(todo store.Todo) error {
+			exists[todo.ID] = true
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	cutoff := now.Add(-s.undo.window)
+	purgeable := func(id string) bool {
+		if exists[id] {
+			return false
+		}
+		deletedAt, ok := s.changes.Tombstone(id)
+		return !ok || deletedAt.Before(cutoff)
+	}
+
+	slices.Sort(referenced)
+	purged := 0
+	for _, id := range slices.Compact(referenced) {
+		if !purgeable(id) {
+			continue
+		}
+		s.comments.removeTodo(id)
+		s.attachments.removeTodo(id, now)
+		s.timeEntries.removeTodo(id)
+		s.touches.forget(id)
+		purged++
+	}
+
+	// unlink the purged todos from the todos they blocked, rechecking
+	// inside the transaction in case the todo changed meanwhile
+	for _, candidate := range todos {
+		if !slices.ContainsFunc(candidate.BlockedBy, purgeable) {
+			continue
+		}
+		var events []store.Event
+		err := s.store.Atomically(ctx, func(tx store.Tx) error {
+			todo, err := tx.Get(ctx, candidate.ID)
+			if err != nil || !slices.ContainsFunc(todo.BlockedBy, purgeable) {
+				return err
+			}
+			todo, events = applyUpdate(todo, purgerActor, now, func(t *store.Todo) {
+				t.BlockedBy = slices.DeleteFunc(slices.Clone(t.BlockedBy), purgeable)
+			})
+			return tx.Update(ctx, todo, s.outboxEvents(events...)...)
+		})
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return purged, err
+		}
+		s.emit(events...)
+	}
+	return purged, nil
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+// createTodo creates a todo through h and returns it
+func createTodo(t *testing.T, h http.Handler, body string, header ...string) store.Todo {
+	t.Helper()
+	w := serve(h, "POST", "/todos", body, header...)
+	var todo store.Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create %s: %d %s", body, w.Code, w.Body)
+	}
+	return todo
+}
+
+func deleteTodo(t *testing.T, h http.Handler, id string) {
+	t.Helper()
+	if w := serve(h, "DELETE", "/todos/"+id, ""); w.Code != http.StatusNoContent && w.Code != http.StatusOK {
+		t.Fatalf("delete %s: %d %s", id, w.Code, w.Body)
+	}
+}
+
+func TestPurgeAfterUndoWindow(t *testing.T) {
+	srv := newTestServer(t, Options{UndoWindow: time.Hour})
+	h := srv.routes()
+	ctx := context.Background()
+	deleted := createTodo(t, h, `{"title":"deleted"}`)
+	kept := createTodo(t, h, `{"title":"kept"}`)
+	now := time.Now()
+	for _, todo := range []store.Todo{deleted, kept} {
+		srv.comments.add(Comment{ID: "c-" + todo.ID, TodoID: todo.ID, Author: "al", Body: "note", CreatedAt: now})
+		srv.timeEntries.start(todo.ID, "al", now)
+	}
+	deleteTodo(t, h, deleted.ID)
+
+	// inside the window the todo can still be undone, so nothing goes
+	if n, err := srv.purgeOnce(ctx, now.Add(59*time.Minute)); err != nil || n != 0 {
+		t.Fatalf("purge inside the window = %d, %v; want 0", n, err)
+	}
+	if len(srv.comments.list(deleted.ID)) != 1 || len(srv.timeEntries.list(deleted.ID, now)) != 1 {
+		t.Fatal("purge inside the window dropped the deleted todo's comments or time entries")
+	}
+
+	if n, err := srv.purgeOnce(ctx, now.Add(61*time.Minute)); err != nil || n != 1 {
+		t.Fatalf("purge after the window = %d, %v; want 1", n, err)
+	}
+	if len(srv.comments.list(deleted.ID)) != 0 || len(srv.timeEntries.list(deleted.ID, now)) != 0 {
+		t.Error("purge after the window kept the deleted todo's comments or time entries")
+	}
+	if len(srv.comments.list(kept.ID)) != 1 || len(srv.timeEntries.list(kept.ID, now)) != 1 {
+		t.Error("purge dropped the comments or time entries of a todo that wasn't deleted")
+	}
+}
+
+func TestPurgeKeepsColdTodos(t *testing.T) {
+	cold, err := store.NewBlobColdStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, Options{Cold: cold})
+	ctx := context.Background()
+	now := time.Now()
+	archived := store.Todo{ID: "archived", Title: "archived", Status: store.StatusCompleted, CreatedAt: now, UpdatedAt: now}
+	if err := cold.Put(ctx, archived); err != nil {
+		t.Fatal(err)
+	}
+	srv.comments.add(Comment{ID: "c1", TodoID: archived.ID, Author: "al", Body: "note", CreatedAt: now})
+
+	// it is in no hot store and has no tombstone, but it was never deleted
+	if n, err := srv.purgeOnce(ctx, now.Add(24*time.Hour)); err != nil || n != 0 {
+		t.Fatalf("purge = %d, %v; want 0", n, err)
+	}
+	if len(srv.comments.list(archived.ID)) != 1 {
+		t.Error("purge dropped the comments of a todo in the cold tier")
+	}
+}
+
+func TestPurgeUnlinksBlockedBy(t *testing.T) {
+	srv := newTestServer(t, Options{UndoWindow: time.Hour})
+	h := srv.routes()
+	ctx := context.Background()
+	blocker := createTodo(t, h, `{"title":"blocker"}`)
+	other := createTodo(t, h, `{"title":"other"}`)
+	blocked := createTodo(t, h, `{"title":"blocked","blocked_by":["`+blocker.ID+`","`+other.ID+`"]}`)
+	if len(blocked.BlockedBy) != 2 {
+		t.Fatalf("blocked_by = %v, want both blockers", blocked.BlockedBy)
+	}
+	deleteTodo(t, h, blocker.ID)
+	now := time.Now()
+
+	// the link stays while the blocker can be undone
+	if _, err := srv.purgeOnce(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if todo, err := srv.store.Get(ctx, blocked.ID); err != nil || len(todo.BlockedBy) != 2 {
+		t.Fatalf("blocked_by inside the window = %v, %v; want both blockers", todo.BlockedBy, err)
+	}
+
+	if _, err := srv.purgeOnce(ctx, now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	todo, err := srv.store.Get(ctx, blocked.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todo.BlockedBy) != 1 || todo.BlockedBy[0] != other.ID {
+		t.Errorf("blocked_by after the purge = %v, want [%s]", todo.BlockedBy, other.ID)
+	}
+	if todo.Version == blocked.Version {
+		t.Error("unlinking the blocker didn't bump the todo's version")
+	}
+}
+
+func TestDisableUserReleasesLocksAndTimers(t *testing.T) {
+	admin := &secrets.Setting{}
+	admin.Set("adm1n")
+	srv := newTestServer(t, Options{AdminToken: admin})
+	h := srv.routes()
+	todo := createTodo(t, h, `{"title":"shared"}`)
+	other := createTodo(t, h, `{"title":"other"}`)
+	now := time.Now()
+	srv.users.put(User{ID: "bob", Name: "Bob", CreatedAt: now})
+	if _, err := srv.locks.acquire(todo.ID, "bob", time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.locks.acquire(other.ID, "al", time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	srv.timeEntries.start(todo.ID, "bob", now)
+	srv.timeEntries.start(todo.ID, "al", now)
+
+	w := serve(h, "POST", "/admin/users/bob/disable", "", "Authorization", "Bearer adm1n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("disable: %d %s", w.Code, w.Body)
+	}
+	if lock := srv.locks.current(todo.ID, time.Now()); lock != nil {
+		t.Errorf("bob's lock survived disabling them: %+v", lock)
+	}
+	if lock := srv.locks.current(other.ID, time.Now()); lock == nil || lock.Holder != "al" {
+		t.Errorf("al's lock = %+v, want it kept", lock)
+	}
+	for _, entry := range srv.timeEntries.list(todo.ID, time.Now()) {
+		if running := entry.EndedAt == nil; running != (entry.User == "al") {
+			t.Errorf("%s's timer running = %v after disabling bob", entry.User, running)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// ciResult is a finished CI build or deploy as a pipeline reports it
+type ciResult struct {
+	// ExternalRef identifies what the result is about, such as a workflow
+	// on a branch; it links the result to its todo
+	ExternalRef string `json:"external_ref"`
+	// Status is success or failure; GitHub Actions conclusions such as
+	// timed_out and cancelled are accepted too
+	Status string `json:"status"`
+	// Kind is build, the default, or deploy
+	Kind      string `json:"kind"`
+	Pipeline  string `json:"pipeline"`
+	Build     string `json:"build"`
+	URL       string `json:"url"`
+	Commit    string `json:"commit"`
+	Branch    string `json:"branch"`
+	ProjectID string `json:"project_id"`
+}
+
+// ciOutcome is what handling a CI result did to its todo
+type ciOutcome struct {
+	Action string      `json:"action"` // created, updated, completed or unchanged
+	Todo   *store.Todo `json:"todo,omitempty"`
+}
+
+// CI verdicts: what a reported status means for the linked todo
+const (
+	ciFailed  = "failed"
+	ciPassed  = "passed"
+	ciIgnored = "ignored"
+)
+
+// ciVerdict interprets a reported status. Cancelled and skipped runs say
+// nothing about whether the pipeline works, so they are ignored.
+func ciVerdict(status string) (string, error) {
+	switch status {
+	case "failure", "timed_out":
+		return ciFailed, nil
+	case "success":
+		return ciPassed, nil
+	case "cancelled", "skipped", "neutral":
+		return ciIgnored, nil
+	}
+	return "", fmt.Errorf("unknown status %q; want success or failure", status)
+}
+
+// ciTitle names the todo for a failing result, e.g. "Fix failing build #123"
+func ciTitle(result ciResult) string {
+	title := "Fix failing build"
+	if result.Kind == "deploy" {
+		title = "Fix failed deploy"
+	}
+	if result.Build != "" {
+		title += " #" + strings.TrimPrefix(result.Build, "#")
+	}
+	if result.Pipeline != "" {
+		title += " of " + result.Pipeline
+	}
+	return title
+}
+
+// ciFailureLine describes one failing run for the todo's description
+func ciFailureLine(result ciResult, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- %s", now.UTC().Format(time.RFC3339))
+	if result.Build != "" {
+		fmt.Fprintf(&b, " #%s", strings.TrimPrefix(result.Build, "#"))
+	}
+	fmt.Fprintf(&b, " %s", result.Status)
+	if result.Branch != "" {
+		fmt.Fprintf(&b, " on %s", result.Branch)
+	}
+	if result.Commit != "" {
+		fmt.Fprintf(&b, " at %.12s", result.Commit)
+	}
+	if result.URL != "" {
+		fmt.Fprintf(&b, ": %s", result.URL)
+	}
+	return b.String() + "\n"
+}
+
+// openTodoByRef finds the todo tracking ref that isn't completed yet. A
+// failure after the last one was fixed starts a new todo.
+func (s *server) openTodoByRef(ctx context.Context, ref string) (store.Todo, bool, error) {
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return store.Todo{}, false, err
+	}
+	for _, todo := range todos {
+		if todo.ExternalRef == ref && todo.Status != store.StatusCompleted && todo.ArchivedAt == nil {
+			return todo, true, nil
+		}
+	}
+	return store.Todo{}, false, nil
+}
+
+// POST /integrations/ci
+func (s *server) handleCIResult(w http.ResponseWriter, r *http.Request) {
+	result, err := decodeJSON[ciResult](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result.ExternalRef = strings.TrimSpace(result.ExternalRef)
+	if result.ExternalRef == "" {
+		http.Error(w, "external_ref is required, e.g. the repository, workflow and branch", http.StatusBadRequest)
+		return
+	}
+	if result.Kind != "" && result.Kind != "build" && result.Kind != "deploy" {
+		http.Error(w, "kind must be build or deploy", http.StatusBadRequest)
+		return
+	}
+	verdict, err := ciVerdict(result.Status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if token, ok := s.projectToken(r); ok {
+		if result.ProjectID != "" && result.ProjectID != token.ProjectID {
+			http.Error(w, "project tokens can only report to their own project", http.StatusForbidden)
+			return
+		}
+		result.ProjectID = token.ProjectID
+	}
+
+	// one result at a time, so concurrent failures share a todo
+	s.ciMu.Lock()
+	defer s.ciMu.Unlock()
+	current, open, err := s.openTodoByRef(r.Context(), result.ExternalRef)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	now, actor := time.Now(), actorFromRequest(r)
+	outcome := ciOutcome{Action: "unchanged"}
+	if open {
+		outcome.Todo = &current
+	}
+	var events []store.Event
+	status := http.StatusOK
+	switch {
+	case verdict == ciFailed && !open:
+		todo := store.Todo{
+			Title:       ciTitle(result),
+			Description: "Failing runs:\n" + ciFailureLine(result, now),
+			Priority:    store.PriorityHigh,
+			ProjectID:   result.ProjectID,
+			Tags:        []string{"ci"},
+			ExternalRef: result.ExternalRef,
+		}
+		if err := s.checkNewTodo(todo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		todo = newTodo(todo, now)
+		created := store.NewEvent(store.EventTodoCreated, actor, todo)
+		if err := s.store.Create(r.Context(), todo, s.outboxEvents(created)...); err != nil {
+			respondError(w, err)
+			return
+		}
+		events = []store.Event{created}
+		outcome = ciOutcome{Action: "created", Todo: &todo}
+		status = http.StatusCreated
+	case verdict == ciFailed:
+		todo, evts := applyUpdate(current, actor, now, func(t *store.Todo) {
+			t.Title = ciTitle(result)
+			t.Description += ciFailureLine(result, now)
+		})
+		if err := s.store.Update(r.Context(), todo, s.outboxEvents(evts...)...); err != nil {
+			respondError(w, err)
+			return
+		}
+		events = evts
+		outcome = ciOutcome{Action: "updated", Todo: &todo}
+	case verdict == ciPassed && open:
+		if err := checkCanComplete(r.Context(), s.store, current, store.StatusCompleted, false); err != nil {
+			http.Error(w, err.Error(), completionErrorStatus(err))
+			return
+		}
+		todo, evts, err := s.applyStatus(current, store.StatusCompleted, actor, now)
+		if err != nil {
+			http.Error(w, err.Error(), statusErrorCode(err))
+			return
+		}
+		if err := s.store.Update(r.Context(), todo, s.outboxEvents(evts...)...); err != nil {
+			respondError(w, err)
+			return
+		}
+		events = evts
+		outcome = ciOutcome{Action: "completed", Todo: &todo}
+	}
+	if len(events) > 0 {
+		s.emitFor(r, events...)
+	}
+	if err := respondJSON(w, status, outcome); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
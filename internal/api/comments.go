@@ -0,0 +1,173 @@
+package api
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// maxCommentLength caps comment bodies, in characters
+const maxCommentLength = 10000
+
+// Comment is a markdown note left on a todo by a collaborator
+type Comment struct {
+	ID        string    `json:"id"`
+	TodoID    string    `json:"todo_id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// commentRegistry holds comments by todo, oldest first
+type commentRegistry struct {
+	mu     sync.RWMutex
+	byTodo map[string][]Comment
+}
+
+func newCommentRegistry() *commentRegistry {
+	return &commentRegistry{byTodo: map[string][]Comment{}}
+}
+
+func (c *commentRegistry) add(comment Comment) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byTodo[comment.TodoID] = append(c.byTodo[comment.TodoID], comment)
+}
+
+func (c *commentRegistry) list(todoID string) []Comment {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Comment{}, c.byTodo[todoID]...)
+}
+
+func (c *commentRegistry) count(todoID string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.byTodo[todoID])
+}
+
+func (c *commentRegistry) get(todoID, id string) (Comment, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := slices.IndexFunc(c.byTodo[todoID], func(comment Comment) bool { return comment.ID == id })
+	if i < 0 {
+		return Comment{}, false
+	}
+	return c.byTodo[todoID][i], true
+}
+
+func (c *commentRegistry) remove(todoID, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byTodo[todoID] = slices.DeleteFunc(c.byTodo[todoID], func(comment Comment) bool { return comment.ID == id })
+}
+
+// removeTodo drops every comment on a todo
+func (c *commentRegistry) removeTodo(todoID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.byTodo, todoID)
+}
+
+// all returns every comment, grouped by todo
+func (c *commentRegistry) all() []Comment {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	comments := []Comment{}
+	for _, todoID := range slices.Sorted(maps.Keys(c.byTodo)) {
+		comments = append(comments, c.byTodo[todoID]...)
+	}
+	return comments
+}
+
+// replace swaps in a whole new set of comments, as restoring a backup does
+func (c *commentRegistry) replace(comments []Comment) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byTodo = map[string][]Comment{}
+	for _, comment := range comments {
+		c.byTodo[comment.TodoID] = append(c.byTodo[comment.TodoID], comment)
+	}
+}
+
+// POST /todos/{id}/comments
+func (s *server) handleCreateComment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.store.Get(r.Context(), id); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	req, err := decodeJSON[struct {
+		Body string `json:"body"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Body) > maxCommentLength {
+		http.Error(w, "body must be at most 10000 characters", http.StatusBadRequest)
+		return
+	}
+
+	comment := Comment{
+		ID:        uuid.New().String(),
+		TodoID:    id,
+		Author:    actorFromRequest(r),
+		Body:      req.Body,
+		CreatedAt: time.Now(),
+	}
+	s.comments.add(comment)
+
+	if err := respondJSON(w, http.StatusCreated, comment); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /todos/{id}/comments
+func (s *server) handleListComments(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	comments := s.comments.list(id)
+	if len(comments) == 0 {
+		if _, err := s.store.Get(r.Context(), id); err != nil {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+	}
+	if err := respondJSON(w, http.StatusOK, comments); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /todos/{id}/comments/{comment_id}
+func (s *server) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := s.comments.get(r.PathValue("id"), r.PathValue("comment_id"))
+	if !ok {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if comment.Author != actorFromRequest(r) && !s.isAdmin(r) {
+		http.Error(w, "only the author or an admin can delete a comment", http.StatusForbidden)
+		return
+	}
+	s.comments.remove(comment.TodoID, comment.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+// configBundleVersion is the format version written to exported bundles
+const configBundleVersion = 1
+
+// configBundle is the non-data configuration of a server: everything an
+// operator sets up, but none of the todos themselves. It is exported as
+// YAML so it can be kept in version control and promoted between
+// environments, e.g. from staging to production.
+type configBundle struct {
+	Version  int             `yaml:"version"`
+	Projects []configProject `yaml:"projects"`
+	Webhooks []configWebhook `yaml:"webhooks"`
+	// ImportMappings and ScheduledImports set up recurring imports; a
+	// scheduled import may use a mapping from the same bundle
+	ImportMappings   []configImportMapping   `yaml:"import_mappings,omitempty"`
+	ScheduledImports []configScheduledImport `yaml:"scheduled_imports,omitempty"`
+	// Anomalies sets anomaly detection thresholds by rule; rules left out
+	// keep their current thresholds
+	Anomalies map[anomalyRule]anomalyThreshold `yaml:"anomalies,omitempty"`
+}
+
+type configProject struct {
+	ID          string `yaml:"id"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// configWebhook omits the signing secret on export unless it is a secret
+// store reference, which is safe to keep in version control. On apply an
+// empty secret keeps the existing one, or generates a new one for new
+// webhooks.
+type configWebhook struct {
+	ID     string            `yaml:"id"`
+	URL    string            `yaml:"url"`
+	Events []store.EventType `yaml:"events,omitempty"`
+	Secret string            `yaml:"secret,omitempty"`
+}
+
+type configImportMapping struct {
+	Source   string         `yaml:"source"`
+	Format   string         `yaml:"format"`
+	Records  string         `yaml:"records,omitempty"`
+	Timezone string         `yaml:"timezone,omitempty"`
+	Fields   []fieldMapping `yaml:"fields"`
+}
+
+// configScheduledImport omits the bearer token and password on export
+// unless they are secret store references, like webhook secrets. On
+// apply an empty one keeps the existing one.
+type configScheduledImport struct {
+	ID          string            `yaml:"id"`
+	Name        string            `yaml:"name"`
+	URL         string            `yaml:"url"`
+	Mapping     string            `yaml:"mapping,omitempty"`
+	Format      string            `yaml:"format,omitempty"`
+	Credentials importCredentials `yaml:"credentials,omitempty"`
+	Interval    duration          `yaml:"interval"`
+	Paused      bool              `yaml:"paused,omitempty"`
+}
+
+// configChanges lists the IDs applying a bundle touched, by outcome
+type configChanges struct {
+	Created   []string `json:"created,omitempty"`
+	Updated   []string `json:"updated,omitempty"`
+	Unchanged []string `json:"unchanged,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+}
+
+// configReport describes what applying a bundle changed, or would change
+// for a dry run. Secrets generated for new webhooks are only returned here.
+type configReport struct {
+	DryRun           bool              `json:"dry_run"`
+	Projects         configChanges     `json:"projects"`
+	Webhooks         configChanges     `json:"webhooks"`
+	ImportMappings   configChanges     `json:"import_mappings"`
+	ScheduledImports configChanges     `json:"scheduled_imports"`
+	Anomalies        configChanges     `json:"anomalies"`
+	Secrets          map[string]string `json:"secrets,omitempty"`
+}
+
+// exportConfig captures the current configuration
+func (s *server) exportConfig() configBundle {
+	bundle := configBundle{Version: configBundleVersion}
+	for _, p := range s.projects.list() {
+		bundle.Projects = append(bundle.Projects, configProject{ID: p.ID, Name: p.Name, Description: p.Description})
+	}
+	for _, wh := range s.webhooks.list() {
+		bundle.Webhooks = append(bundle.Webhooks, configWebhook{ID: wh.ID, URL: wh.URL, Events: wh.Events, Secret: wh.secretRef})
+	}
+	for _, m := range s.importMappings.list() {
+		bundle.ImportMappings = append(bundle.ImportMappings, configImportMapping{Source: m.Source, Format: m.Format, Records: m.Records, Timezone: m.Timezone, Fields: m.Fields})
+	}
+	refOnly := func(v string) string {
+		if secrets.IsRef(v) {
+			return v
+		}
+		return ""
+	}
+	for _, si := range s.imports.all() {
+		creds := importCredentials{BearerToken: refOnly(si.Credentials.BearerToken), Username: si.Credentials.Username, Password: refOnly(si.Credentials.Password)}
+		bundle.ScheduledImports = append(bundle.ScheduledImports, configScheduledImport{ID: si.ID, Name: si.Name, URL: si.URL,
+			Mapping: si.Mapping, Format: si.Format, Credentials: creds, Interval: si.Interval, Paused: si.Paused})
+	}
+	bundle.Anomalies = s.anomalies.thresholdsSnapshot()
+	return bundle
+}
+
+// validate checks the bundle can be applied as a whole before anything
+// is changed
+func (b configBundle) validate() error {
+	if b.Version != configBundleVersion {
+		return fmt.Errorf("unsupported config version %d; want %d", b.Version, configBundleVersion)
+	}
+	projects, webhooks, mappings, imports := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for i, p := range b.Projects {
+		if p.ID == "" || projects[p.ID] {
+			return fmt.Errorf("projects[%d]: id is missing or duplicated", i)
+		}
+		if strings.TrimSpace(p.Name) == "" {
+			return fmt.Errorf("projects[%d]: name is required", i)
+		}
+		projects[p.ID] = true
+	}
+	for i, wh := range b.Webhooks {
+		if wh.ID == "" || webhooks[wh.ID] {
+			return fmt.Errorf("webhooks[%d]: id is missing or duplicated", i)
+		}
+		if err := validateWebhook(Webhook{URL: wh.URL, Events: wh.Events}); err != nil {
+			return fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+		webhooks[wh.ID] = true
+	}
+	for i, cm := range b.ImportMappings {
+		if mappings[cm.Source] {
+			return fmt.Errorf("import_mappings[%d]: source is duplicated", i)
+		}
+		if err := cm.mapping().validate(); err != nil {
+			return fmt.Errorf("import_mappings[%d]: %w", i, err)
+		}
+		mappings[cm.Source] = true
+	}
+	for i, ci := range b.ScheduledImports {
+		if ci.ID == "" || imports[ci.ID] {
+			return fmt.Errorf("scheduled_imports[%d]: id is missing or duplicated", i)
+		}
+		imports[ci.ID] = true
+	}
+	for rule, t := range b.Anomalies {
+		if !validAnomalyRule(rule) {
+			return fmt.Errorf("anomalies: unknown rule %q", rule)
+		}
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("anomalies.%s: %w", rule, err)
+		}
+	}
+	return nil
+}
+
+func (cm configImportMapping) mapping() *importMapping {
+	return &importMapping{Source: cm.Source, Format: cm.Format, Records: cm.Records, Timezone: cm.Timezone, Fields: cm.Fields}
+}
+
+// sameImportMapping reports whether a and b read exports the same way
+func sameImportMapping(a, b *importMapping) bool {
+	return a.Format == b.Format && a.Records == b.Records && a.Timezone == b.Timezone &&
+		slices.EqualFunc(a.Fields, b.Fields, func(x, y fieldMapping) bool {
+			return x.From == y.From && x.To == y.To && x.Default == y.Default && x.Split == y.Split &&
+				x.DateFormat == y.DateFormat && maps.Equal(x.Values, y.Values)
+		})
+}
+
+// applyConfig makes the server's configuration match bundle. Webhooks,
+// import mappings and scheduled imports the bundle doesn't mention are
+// removed when prune is set; projects are never removed since todos may
+// still belong to them. Every change is worked out, and webhook secrets
+// resolved, before the first one is made, so a failing bundle changes
+// nothing.
+func (s *server) applyConfig(bundle configBundle, actor string, prune, dryRun bool) (configReport, error) {
+	report := configReport{DryRun: dryRun}
+	if err := bundle.validate(); err != nil {
+		return report, err
+	}
+	now := time.Now()
+	var (
+		projects   []Project
+		webhooks   []Webhook
+		mappings   []*importMapping
+		imports    []scheduledImport
+		thresholds = map[anomalyRule]anomalyThreshold{}
+	)
+
+	for _, cp := range bundle.Projects {
+		// ownership, collaborators and deletion aren't configuration
+		project, err := s.projects.get(cp.ID)
+		if err != nil {
+			project = Project{ID: cp.ID, CreatedAt: now}
+		}
+		changed := project.Name != cp.Name || project.Description != cp.Description
+		project.Name, project.Description = cp.Name, cp.Description
+		switch {
+		case err != nil:
+			report.Projects.Created = append(report.Projects.Created, cp.ID)
+		case changed:
+			report.Projects.Updated = append(report.Projects.Updated, cp.ID)
+		default:
+			report.Projects.Unchanged = append(report.Projects.Unchanged, cp.ID)
+			continue
+		}
+		projects = append(projects, project)
+	}
+
+	for _, cw := range bundle.Webhooks {
+		wh := Webhook{ID: cw.ID, URL: cw.URL, Events: cw.Events, Secret: cw.Secret, CreatedAt: now}
+		if secrets.IsRef(cw.Secret) {
+			secret, err := secrets.Resolve(context.Background(), cw.Secret)
+			if err != nil {
+				return report, fmt.Errorf("webhook %s: %w", cw.ID, err)
+			}
+			wh.Secret, wh.secretRef = secret, cw.Secret
+		}
+		existing, err := s.webhooks.get(cw.ID)
+		if err == nil {
+			wh.CreatedAt = existing.CreatedAt
+			if wh.Secret == "" {
+				wh.Secret, wh.secretRef = existing.Secret, existing.secretRef
+			}
+		}
+		switch {
+		case err != nil:
+			report.Webhooks.Created = append(report.Webhooks.Created, cw.ID)
+			if wh.Secret == "" && !dryRun {
+				if wh.Secret, err = newWebhookSecret(); err != nil {
+					return report, err
+				}
+				if report.Secrets == nil {
+					report.Secrets = map[string]string{}
+				}
+				report.Secrets[wh.ID] = wh.Secret
+			}
+		case existing.URL != wh.URL || existing.Secret != wh.Secret || existing.secretRef != wh.secretRef || !slices.Equal(existing.Events, wh.Events):
+			report.Webhooks.Updated = append(report.Webhooks.Updated, cw.ID)
+		default:
+			report.Webhooks.Unchanged = append(report.Webhooks.Unchanged, cw.ID)
+			continue
+		}
+		webhooks = append(webhooks, wh)
+	}
+
+	bundled := map[string]*importMapping{}
+	for _, cm := range bundle.ImportMappings {
+		m := cm.mapping()
+		if err := m.validate(); err != nil {
+			return report, fmt.Errorf("import mapping %s: %w", cm.Source, err)
+		}
+		m.UpdatedAt, m.UpdatedBy = now, actor
+		bundled[cm.Source] = m
+		existing, ok := s.importMappings.get(cm.Source)
+		switch {
+		case !ok:
+			report.ImportMappings.Created = append(report.ImportMappings.Created, cm.Source)
+		case !sameImportMapping(existing, m):
+			report.ImportMappings.Updated = append(report.ImportMappings.Updated, cm.Source)
+		default:
+			report.ImportMappings.Unchanged = append(report.ImportMappings.Unchanged, cm.Source)
+			continue
+		}
+		mappings = append(mappings, m)
+	}
+	// scheduled imports may use mappings the bundle sets, or that are kept
+	mappingFor := func(source string) (*importMapping, bool) {
+		if m, ok := bundled[source]; ok || prune {
+			return m, ok
+		}
+		return s.importMappings.get(source)
+	}
+	current := map[string]scheduledImport{}
+	for _, si := range s.imports.all() {
+		current[si.ID] = si
+	}
+	for i, ci := range bundle.ScheduledImports {
+		si := scheduledImport{ID: ci.ID, Name: ci.Name, URL: ci.URL, Mapping: ci.Mapping, Format: ci.Format,
+			Credentials: ci.Credentials, Interval: ci.Interval, Paused: ci.Paused, CreatedAt: now, CreatedBy: actor, NextRunAt: now}
+		if err := checkScheduledImport(&si, mappingFor); err != nil {
+			return report, fmt.Errorf("scheduled_imports[%d]: %w", i, err)
+		}
+		existing, ok := current[ci.ID]
+		if ok {
+			if si.Credentials.BearerToken == "" {
+				si.Credentials.BearerToken = existing.Credentials.BearerToken
+			}
+			if si.Credentials.Password == "" {
+				si.Credentials.Password = existing.Credentials.Password
+			}
+		}
+		switch {
+		case !ok:
+			report.ScheduledImports.Created = append(report.ScheduledImports.Created, ci.ID)
+		case existing.Name != si.Name || existing.URL != si.URL || existing.Mapping != si.Mapping || existing.Format != si.Format ||
+			existing.Credentials != si.Credentials || existing.Interval != si.Interval || existing.Paused != si.Paused:
+			report.ScheduledImports.Updated = append(report.ScheduledImports.Updated, ci.ID)
+		default:
+			report.ScheduledImports.Unchanged = append(report.ScheduledImports.Unchanged, ci.ID)
+			continue
+		}
+		imports = append(imports, si)
+	}
+
+	currentThresholds := s.anomalies.thresholdsSnapshot()
+	for _, rule := range anomalyRules {
+		t, ok := bundle.Anomalies[rule]
+		switch {
+		case !ok:
+			continue
+		case t != currentThresholds[rule]:
+			report.Anomalies.Updated = append(report.Anomalies.Updated, string(rule))
+		default:
+			report.Anomalies.Unchanged = append(report.Anomalies.Unchanged, string(rule))
+			continue
+		}
+		thresholds[rule] = t
+	}
+
+	if prune {
+		for _, wh := range s.webhooks.list() {
+			if !slices.ContainsFunc(bundle.Webhooks, func(cw configWebhook) bool { return cw.ID == wh.ID }) {
+				report.Webhooks.Removed = append(report.Webhooks.Removed, wh.ID)
+			}
+		}
+		for _, m := range s.importMappings.list() {
+			if _, ok := bundled[m.Source]; !ok {
+				report.ImportMappings.Removed = append(report.ImportMappings.Removed, m.Source)
+			}
+		}
+		for _, si := range s.imports.all() {
+			if !slices.ContainsFunc(bundle.ScheduledImports, func(ci configScheduledImport) bool { return ci.ID == si.ID }) {
+				report.ScheduledImports.Removed = append(report.ScheduledImports.Removed, si.ID)
+			}
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	for _, project := range projects {
+		s.projects.put(project)
+	}
+	for _, wh := range webhooks {
+		s.webhooks.put(wh)
+	}
+	for _, m := range mappings {
+		s.importMappings.put(m)
+	}
+	for _, si := range imports {
+		s.imports.configure(si)
+	}
+	for rule, t := range thresholds {
+		s.anomalies.setThreshold(rule, t)
+	}
+	// removing what is already gone is fine
+	for _, id := range report.Webhooks.Removed {
+		s.webhooks.remove(id)
+	}
+	for _, source := range report.ImportMappings.Removed {
+		s.importMappings.remove(source)
+	}
+	for _, id := range report.ScheduledImports.Removed {
+		s.imports.remove(id)
+	}
+	return report, nil
+}
+
+// GET /admin/config
+func (s *server) handleExportConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", `attachment; filename="todo-config.yaml"`)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(s.exportConfig()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	enc.Close()
+}
+
+// PUT /admin/config
+func (s *server) handleApplyConfig(w http.ResponseWriter, r *http.Request) {
+	var bundle configBundle
+	dec := yaml.NewDecoder(r.Body)
+	dec.KnownFields(true)
+	if err := dec.Decode(&bundle); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("empty config bundle")
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	report, err := s.applyConfig(bundle, actorFromRequest(r), query.Get("prune") == "true", query.Get("dry_run") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !report.DryRun {
+		log.Printf("config applied by %s: projects +%d ~%d, webhooks +%d ~%d -%d, import mappings +%d ~%d -%d, scheduled imports +%d ~%d -%d, anomaly thresholds ~%d", actorFromRequest(r),
+			len(report.Projects.Created), len(report.Projects.Updated),
+			len(report.Webhooks.Created), len(report.Webhooks.Updated), len(report.Webhooks.Removed),
+			len(report.ImportMappings.Created), len(report.ImportMappings.Updated), len(report.ImportMappings.Removed),
+			len(report.ScheduledImports.Created), len(report.ScheduledImports.Updated), len(report.ScheduledImports.Removed),
+			len(report.Anomalies.Updated))
+	}
+
+	if err := respondJSON(w, http.StatusOK, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
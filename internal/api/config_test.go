@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang-todo/internal/secrets"
+)
+
+func TestApplyConfigIsAllOrNothing(t *testing.T) {
+	admin := &secrets.Setting{}
+	admin.Set("adm1n")
+	srv := newTestServer(t, Options{AdminToken: admin})
+	h := srv.routes()
+	srv.projects.put(Project{ID: "p1", Name: "Home", CreatedAt: time.Now()})
+
+	// the secret of the second webhook can't be resolved, so neither the
+	// renamed project nor the first webhook may be applied
+	bundle := `version: 1
+projects:
+  - id: p1
+    name: House
+webhooks:
+  - id: wh1
+    url: http://example.com/one
+  - id: wh2
+    url: http://example.com/two
+    secret: env:TODO_TEST_UNSET_SECRET
+`
+	w := serve(h, "PUT", "/admin/config", bundle, "Authorization", "Bearer adm1n")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("applying a bundle with an unresolvable secret: %d %s, want 400", w.Code, w.Body)
+	}
+	if project, _ := srv.projects.get("p1"); project.Name != "Home" {
+		t.Errorf("project renamed to %q by a bundle that failed", project.Name)
+	}
+	if webhooks := srv.webhooks.list(); len(webhooks) != 0 {
+		t.Errorf("a bundle that failed registered webhooks %+v", webhooks)
+	}
+}
+
+func TestConfigKeepsImportSchedules(t *testing.T) {
+	admin := &secrets.Setting{}
+	admin.Set("adm1n")
+	srv := newTestServer(t, Options{AdminToken: admin})
+	h := srv.routes()
+	bundle := `version: 1
+import_mappings:
+  - source: jira
+    format: json
+    records: issues
+    fields:
+      - from: summary
+        to: title
+      - from: key
+        to: external_ref
+scheduled_imports:
+  - id: nightly
+    name: Nightly Jira
+    url: https://jira.example.com/export
+    mapping: jira
+    credentials:
+      bearer_token: t0ken
+    interval: 24h
+    paused: true
+`
+	w := serve(h, "PUT", "/admin/config", bundle, "Authorization", "Bearer adm1n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("apply config: %d %s", w.Code, w.Body)
+	}
+	if _, ok := srv.importMappings.get("jira"); !ok {
+		t.Fatal("the bundle's import mapping wasn't stored")
+	}
+	imports := srv.imports.all()
+	if len(imports) != 1 || imports[0].Format != "json" || imports[0].Credentials.BearerToken != "t0ken" || !imports[0].Paused {
+		t.Fatalf("scheduled imports = %+v", imports)
+	}
+
+	// the exported bundle leaves the plain-text token out, and applying it
+	// again keeps the token and changes nothing
+	w = serve(h, "GET", "/admin/config", "", "Authorization", "Bearer adm1n")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "t0ken") || !strings.Contains(w.Body.String(), "jira.example.com") {
+		t.Fatalf("export config: %d %s", w.Code, w.Body)
+	}
+	w = serve(h, "PUT", "/admin/config?prune=true", w.Body.String(), "Authorization", "Bearer adm1n")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "created") || strings.Contains(w.Body.String(), "updated") || strings.Contains(w.Body.String(), "removed") {
+		t.Fatalf("reapplying the export: %d %s, want nothing changed", w.Code, w.Body)
+	}
+	if imports := srv.imports.all(); len(imports) != 1 || imports[0].Credentials.BearerToken != "t0ken" {
+		t.Errorf("scheduled imports after reapplying = %+v", imports)
+	}
+
+	// a schedule needs its mapping, from the bundle or kept without prune
+	w = serve(h, "PUT", "/admin/config?prune=true", `version: 1
+scheduled_imports:
+  - id: nightly
+    name: Nightly Jira
+    url: https://jira.example.com/export
+    mapping: jira
+    interval: 24h
+`, "Authorization", "Bearer adm1n")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("pruning the mapping of a kept schedule: %d %s, want 400", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// dashboardTemplate is a monochrome page sized for small e-ink panels: no
+// colors, images, scripts or web fonts, just large high-contrast text
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if .Refresh}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>Todos: {{.Pending}} pending</title>
+<style>
+body{margin:0;padding:12px;background:#fff;color:#000;font:20px/1.3 serif}
+h1{margin:0 0 8px;font-size:28px;border-bottom:3px solid #000}
+p{margin:0 0 8px}
+ol{margin:0;padding-left:28px}
+li{margin:0 0 6px}
+small{font-size:14px}
+</style>
+</head>
+<body>
+<h1>{{.Pending}} pending, {{.Completed}} done</h1>
+{{if .Items}}<ol>
+{{range .Items}}<li>{{.Title}}</li>
+{{end}}</ol>{{else}}<p>Nothing pending.</p>{{end}}
+{{if .More}}<p>and {{.More}} more</p>{{end}}
+<small>Updated {{.GeneratedAt}}</small>
+</body>
+</html>
+`))
+
+// dashboardView is the data rendered by dashboardTemplate
+type dashboardView struct {
+	Pending     int
+	Completed   int
+	Items       []store.Todo
+	More        int
+	Refresh     int
+	GeneratedAt string
+}
+
+// GET /dashboard
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	limit := 5
+	if v := r.URL.Query().Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 50 {
+			http.Error(w, "n must be between 0 and 50", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	refresh := 0
+	if v := r.URL.Query().Get("refresh"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "refresh must be a number of seconds", http.StatusBadRequest)
+			return
+		}
+		refresh = n
+	}
+
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// the oldest pending items are the most pressing ones to show
+	var pending []store.Todo
+	view := dashboardView{Refresh: refresh}
+	var lastModified time.Time
+	for _, todo := range todos {
+		if todo.UpdatedAt.After(lastModified) {
+			lastModified = todo.UpdatedAt
+		}
+		if todo.Status == store.StatusCompleted {
+			view.Completed++
+			continue
+		}
+		pending = append(pending, todo)
+	}
+	slices.SortStableFunc(pending, func(a, b store.Todo) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	view.Pending = len(pending)
+	view.Items = pending[:min(limit, len(pending))]
+	view.More = len(pending) - len(view.Items)
+	if !lastModified.IsZero() {
+		view.GeneratedAt = lastModified.UTC().Format("2 Jan 15:04 UTC")
+	}
+
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, view); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// The body only changes when the data does, so a content hash makes a
+	// stable ETag and lets polling displays get cheap 304 responses
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
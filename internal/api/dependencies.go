@@ -0,0 +1,366 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang-todo/internal/store"
+)
+
+// blockedError reports a todo that can't be completed because some of its
+// blockers are still pending
+type blockedError struct {
+	Blockers []string
+}
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("todo is blocked by pending todos %s; set force to complete it anyway", strings.Join(e.Blockers, ", "))
+}
+
+// completionErrorStatus maps a checkCanComplete error to an HTTP status
+func completionErrorStatus(err error) int {
+	if errors.As(err, new(*blockedError)) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// pendingBlockers returns the IDs of todo's blockers that aren't completed.
+// Blockers that no longer exist don't block.
+func pendingBlockers(ctx context.Context, tx store.Tx, todo store.Todo) ([]string, error) {
+	var pending []string
+	for _, id := range todo.BlockedBy {
+		blocker, err := tx.Get(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blocker.Status != store.StatusCompleted {
+			pending = append(pending, id)
+		}
+	}
+	return pending, nil
+}
+
+// checkCanComplete refuses to complete a todo with pending blockers unless
+// forced; other status changes always pass
+func checkCanComplete(ctx context.Context, tx store.Tx, todo store.Todo, status store.TodoStatus, force bool) error {
+	if status != store.StatusCompleted || todo.Status == store.StatusCompleted || force {
+		return nil
+	}
+	pending, err := pendingBlockers(ctx, tx, todo)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return &blockedError{Blockers: pending}
+	}
+	return nil
+}
+
+// checkBlockedBy validates a new blocked_by list for todo id: every blocker
+// must exist, and none may already depend on id, which would form a cycle
+func checkBlockedBy(ctx context.Context, tx store.Tx, id string, blockedBy []string) error {
+	for _, blocker := range blockedBy {
+		if blocker == id {
+			return errors.New("a todo can't block itself")
+		}
+		if _, err := tx.Get(ctx, blocker); errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("unknown blocker %q", blocker)
+		} else if err != nil {
+			return err
+		}
+		if path, err := dependencyPath(ctx, tx, blocker, id); err != nil {
+			return err
+		} else if path != nil {
+			return fmt.Errorf("blocked_by would create a cycle: %s -> %s", id, strings.Join(path, " -> "))
+		}
+	}
+	return nil
+}
+
+// dependencyPath walks blocked_by links from "from" and returns the path
+// to "to" if one exists
+func dependencyPath(ctx context.Context, tx store.Tx, from, to string) ([]string, error) {
+	visited := map[string]bool{}
+	var walk func(id string) ([]string, error)
+	walk = func(id string) ([]string, error) {
+		if id == to {
+			return []string{id}, nil
+		}
+		if visited[id] {
+			return nil, nil
+		}
+		visited[id] = true
+		todo, err := tx.Get(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, next := range todo.BlockedBy {
+			path, err := walk(next)
+			if err != nil || path != nil {
+				return append([]string{id}, path...), err
+			}
+		}
+		return nil, nil
+	}
+	return walk(from)
+}
+
+// normalizeBlockedBy trims IDs and drops empty and duplicate ones
+func normalizeBlockedBy(ids []string) []string {
+	return normalizeTags(ids)
+}
+
+// dependencyNode is one todo in a dependency tree. A todo reachable along
+// several paths is expanded once; later occurrences set Repeated instead.
+type dependencyNode struct {
+	ID        string            `json:"id"`
+	Title     string            `json:"title,omitempty"`
+	Status    store.TodoStatus  `json:"status,omitempty"`
+	Missing   bool              `json:"missing,omitempty"`
+	Repeated  bool              `json:"repeated,omitempty"`
+	BlockedBy []*dependencyNode `json:"blocked_by,omitempty"`
+}
+
+// dependencyTree builds the tree of everything blocking id
+func dependencyTree(ctx context.Context, tx store.Tx, id string) (*dependencyNode, error) {
+	expanded := map[string]bool{}
+	var build func(id string) (*dependencyNode, error)
+	build = func(id string) (*dependencyNode, error) {
+		node := &dependencyNode{ID: id}
+		todo, err := tx.Get(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			node.Missing = true
+			return node, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.Title, node.Status = todo.Title, todo.Status
+		if expanded[id] {
+			node.Repeated = true
+			return node, nil
+		}
+		expanded[id] = true
+		for _, blocker := range todo.BlockedBy {
+			child, err := build(blocker)
+			if err != nil {
+				return nil, err
+			}
+			node.BlockedBy = append(node.BlockedBy, child)
+		}
+		return node, nil
+	}
+	return build(id)
+}
+
+// GET /todos/{id}/graph
+func (s *server) handleTodoGraph(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.store.Get(r.Context(), id); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	tree, err := dependencyTree(r.Context(), s.store, id)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// also list the todos this one directly blocks
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	blocks := []string{}
+	for _, todo := range todos {
+		if slices.Contains(todo.BlockedBy, id) {
+			blocks = append(blocks, todo.ID)
+		}
+	}
+
+	if err := respondJSON(w, http.StatusOK, map[string]any{"root": tree, "blocks": blocks}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// graphNode is a todo in an exported dependency graph. External nodes are
+// blockers from outside the project; missing ones no longer exist.
+type graphNode struct {
+	ID       string
+	Title    string
+	Status   store.TodoStatus
+	External bool
+	Missing  bool
+}
+
+// graphEdge means From blocks To
+type graphEdge struct {
+	From, To string
+}
+
+// projectGraph collects the blocked_by links of a project's todos, pulling
+// in blockers from elsewhere so chains that leave the project stay visible
+func projectGraph(todos []store.Todo, projectID string) ([]graphNode, []graphEdge) {
+	byID := map[string]store.Todo{}
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+	}
+	var nodes []graphNode
+	var edges []graphEdge
+	added := map[string]bool{}
+	for _, todo := range todos {
+		if todo.ProjectID != projectID {
+			continue
+		}
+		added[todo.ID] = true
+		nodes = append(nodes, graphNode{ID: todo.ID, Title: todo.Title, Status: todo.Status})
+	}
+	for _, todo := range todos {
+		if todo.ProjectID != projectID {
+			continue
+		}
+		for _, blocker := range todo.BlockedBy {
+			edges = append(edges, graphEdge{From: blocker, To: todo.ID})
+			if added[blocker] {
+				continue
+			}
+			added[blocker] = true
+			node := graphNode{ID: blocker, External: true}
+			if b, ok := byID[blocker]; ok {
+				node.Title, node.Status = b.Title, b.Status
+			} else {
+				node.Missing = true
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, edges
+}
+
+// dotQuote quotes s as a Graphviz ID
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// writeGraphDOT renders a graph in Graphviz DOT, left to right so chains
+// of blockers read in the order they need to be done
+func writeGraphDOT(w io.Writer, project Project, nodes []graphNode, edges []graphEdge) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(project.Name))
+	b.WriteString("  rankdir=LR;\n  node [shape=box, style=rounded];\n")
+	for _, node := range nodes {
+		label := node.Title
+		if node.Missing {
+			label = node.ID + "\n(deleted)"
+		} else {
+			label += "\n(" + string(node.Status) + ")"
+		}
+		style := "rounded"
+		switch {
+		case node.Missing || node.External:
+			style += ",dashed"
+		case node.Status == store.StatusCompleted:
+			style += ",filled"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, style=%s];\n", dotQuote(node.ID), dotQuote(label), dotQuote(style))
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(edge.From), dotQuote(edge.To))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// jsonGraphNode and jsonGraph follow the JSON Graph Format
+// (https://jsongraphformat.info) so existing viewers can load the export
+type jsonGraphNode struct {
+	Label    string         `json:"label"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+type jsonGraphEdge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Relation string `json:"relation"`
+}
+
+type jsonGraph struct {
+	ID       string                   `json:"id"`
+	Label    string                   `json:"label"`
+	Directed bool                     `json:"directed"`
+	Nodes    map[string]jsonGraphNode `json:"nodes"`
+	Edges    []jsonGraphEdge          `json:"edges"`
+}
+
+// GET /projects/{id}/graph
+func (s *server) handleProjectGraph(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projects.get(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "dot" {
+		http.Error(w, "format must be dot or json", http.StatusBadRequest)
+		return
+	}
+
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	nodes, edges := projectGraph(todos, project.ID)
+
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		if err := writeGraphDOT(w, project, nodes, edges); err != nil {
+			respondError(w, err)
+		}
+		return
+	}
+
+	graph := jsonGraph{ID: project.ID, Label: project.Name, Directed: true, Nodes: map[string]jsonGraphNode{}, Edges: []jsonGraphEdge{}}
+	for _, node := range nodes {
+		metadata := map[string]any{"status": node.Status}
+		if node.External {
+			metadata["external"] = true
+		}
+		if node.Missing {
+			metadata = map[string]any{"missing": true}
+		}
+		graph.Nodes[node.ID] = jsonGraphNode{Label: node.Title, Metadata: metadata}
+	}
+	for _, edge := range edges {
+		graph.Edges = append(graph.Edges, jsonGraphEdge{Source: edge.From, Target: edge.To, Relation: "blocks"})
+	}
+	if err := respondJSON(w, http.StatusOK, map[string]jsonGraph{"graph": graph}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang-todo/internal/metrics"
+)
+
+var deprecatedUsageTotal = metrics.Default.NewCounterVec("todo_deprecated_usage_total",
+	"Requests that used a deprecated endpoint or field.", "deprecation")
+
+// deprecationReportWindow is how far back the report looks by default when
+// deciding whether a deprecation is still in use
+const deprecationReportWindow = 30 * 24 * time.Hour
+
+// deprecation is an endpoint or request field kept only for old clients
+type deprecation struct {
+	ID string `json:"id"`
+	// Kind is "endpoint", "field" or "parameter"
+	Kind string `json:"kind"`
+	// Name is the route pattern for endpoints, or where the field appears
+	Name        string     `json:"name"`
+	Replacement string     `json:"replacement,omitempty"`
+	Since       time.Time  `json:"since"`
+	Sunset      *time.Time `json:"sunset,omitempty"`
+}
+
+// apiDeprecations lists everything deprecated. Endpoints are matched on
+// their route pattern by s.handle; fields and parameters are reported by
+// the handlers that accept them, through s.deprecatedUse.
+var apiDeprecations = []deprecation{
+	{
+		ID:          "calendar-token-without-key-id",
+		Kind:        "parameter",
+		Name:        "GET /todos/calendar.ics?token",
+		Replacement: "a feed URL from POST /calendar/tokens, whose token starts with a key ID",
+		Since:       time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+func findDeprecation(match func(deprecation) bool) (deprecation, bool) {
+	i := slices.IndexFunc(apiDeprecations, match)
+	if i < 0 {
+		return deprecation{}, false
+	}
+	return apiDeprecations[i], true
+}
+
+// deprecationClient is one caller of a deprecated endpoint or field
+type deprecationClient struct {
+	Actor     string    `json:"actor"`
+	Address   string    `json:"address"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// deprecationUsage is the report entry for one deprecation
+type deprecationUsage struct {
+	deprecation
+	Count    int                 `json:"count"`
+	LastSeen *time.Time          `json:"last_seen,omitempty"`
+	Clients  []deprecationClient `json:"clients"`
+	// Unused means no client used it within the report window, so it
+	// can likely be removed
+	Unused bool `json:"unused"`
+}
+
+// deprecationTracker records who still uses each deprecation. Clients are
+// told apart by actor, address and user agent, so one entry usually means
+// one deployment of one client.
+type deprecationTracker struct {
+	mu      sync.Mutex
+	clients map[string]map[deprecationClientKey]*deprecationClient
+}
+
+type deprecationClientKey struct {
+	actor, address, userAgent string
+}
+
+func newDeprecationTracker() *deprecationTracker {
+	return &deprecationTracker{clients: map[string]map[deprecationClientKey]*deprecationClient{}}
+}
+
+func (t *deprecationTracker) record(id string, r *http.Request, now time.Time) {
+	deprecatedUsageTotal.Inc(id)
+	key := deprecationClientKey{actor: actorFromRequest(r), address: clientAddress(r), userAgent: r.UserAgent()}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clients, ok := t.clients[id]
+	if !ok {
+		clients = map[deprecationClientKey]*deprecationClient{}
+		t.clients[id] = clients
+	}
+	c, ok := clients[key]
+	if !ok {
+		c = &deprecationClient{Actor: key.actor, Address: key.address, UserAgent: key.userAgent, FirstSeen: now}
+		clients[key] = c
+	}
+	c.Count++
+	c.LastSeen = now
+}
+
+// report describes the use of every deprecation since the given time;
+// clients last seen earlier are left out
+func (t *deprecationTracker) report(since time.Time) []deprecationUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := make([]deprecationUsage, 0, len(apiDeprecations))
+	for _, d := range apiDeprecations {
+		usage := deprecationUsage{deprecation: d, Clients: []deprecationClient{}}
+		for _, c := range t.clients[d.ID] {
+			if c.LastSeen.Before(since) {
+				continue
+			}
+			usage.Clients = append(usage.Clients, *c)
+			usage.Count += c.Count
+			if usage.LastSeen == nil || c.LastSeen.After(*usage.LastSeen) {
+				lastSeen := c.LastSeen
+				usage.LastSeen = &lastSeen
+			}
+		}
+		slices.SortFunc(usage.Clients, func(a, b deprecationClient) int { return b.LastSeen.Compare(a.LastSeen) })
+		usage.Unused = len(usage.Clients) == 0
+		report = append(report, usage)
+	}
+	return report
+}
+
+// deprecatedUse records a request relying on deprecation id and tells the
+// client so with Deprecation and Sunset headers (RFC 9745, RFC 8594)
+func (s *server) deprecatedUse(w http.ResponseWriter, r *http.Request, id string) {
+	d, ok := findDeprecation(func(d deprecation) bool { return d.ID == id })
+	if !ok {
+		return
+	}
+	s.deprecations.record(id, r, time.Now())
+	w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	if d.Sunset != nil {
+		w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
+// watchDeprecations reports every request to a deprecated endpoint
+func (s *server) watchDeprecations(pattern string, next http.Handler) http.Handler {
+	d, ok := findDeprecation(func(d deprecation) bool { return d.Kind == "endpoint" && d.Name == pattern })
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.deprecatedUse(w, r, d.ID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GET /admin/deprecations
+func (s *server) handleDeprecationReport(w http.ResponseWriter, r *http.Request) {
+	window := deprecationReportWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "window must be a positive duration such as 720h", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	if err := respondJSON(w, http.StatusOK, s.deprecations.report(time.Now().Add(-window))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+const (
+	// defaultEventPageSize and maxEventPageSize bound GET /events pages;
+	// see routePageLimits
+	defaultEventPageSize = 100
+	maxEventPageSize     = 1000
+	// maxEventWait caps how long GET /events long-polls for new events
+	maxEventWait = 60 * time.Second
+)
+
+// loggedEvent is an event with its position in the event log. Cursors are
+// written epoch.seq: sequence numbers only ever increase within an epoch,
+// and the log starts a new epoch, empty, each time the process starts.
+type loggedEvent struct {
+	Cursor string      `json:"cursor"`
+	Event  store.Event `json:"event"`
+	seq    uint64
+}
+
+// eventConsumer is a named reader of the event log and the last cursor it
+// acknowledged. Reads without an explicit cursor resume after it.
+type eventConsumer struct {
+	Name      string    `json:"name"`
+	Cursor    string    `json:"cursor"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// eventLog keeps every emitted event for a retention period so external
+// systems can replay changes and build their own projections. Delivery is
+// at least once: a consumer sees events again until it acknowledges them.
+type eventLog struct {
+	mu        sync.Mutex
+	retention time.Duration
+	maxEvents int
+	events    []loggedEvent
+	epoch     string
+	nextSeq   uint64
+	consumers map[string]eventConsumer
+	// appended is closed and replaced whenever events are appended, waking
+	// long-polling readers
+	appended chan struct{}
+}
+
+func newEventLog(retention time.Duration, maxEvents int) *eventLog {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &eventLog{
+		retention: retention,
+		maxEvents: maxEvents,
+		epoch:     hex.EncodeToString(b),
+		nextSeq:   1,
+		consumers: map[string]eventConsumer{},
+		appended:  make(chan struct{}),
+	}
+}
+
+// append is a server listener adding each emitted event to the log
+func (l *eventLog) append(evt store.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seq := l.nextSeq
+	l.nextSeq++
+	l.events = append(l.events, loggedEvent{Cursor: l.cursor(seq), Event: evt, seq: seq})
+	l.prune(time.Now())
+	close(l.appended)
+	l.appended = make(chan struct{})
+}
+
+// prune drops events past the retention period or beyond the size limit
+func (l *eventLog) prune(now time.Time) {
+	cutoff := now.Add(-l.retention)
+	drop := 0
+	for drop < len(l.events) && (len(l.events)-drop > l.maxEvents || l.events[drop].Event.OccurredAt.Before(cutoff)) {
+		drop++
+	}
+	l.events = slices.Delete(l.events, 0, drop)
+}
+
+// read returns up to limit events after the cursor that match, the cursor
+// to continue from, and whether events after the cursor have already been
+// pruned. The returned channel is closed once more events are appended.
+func (l *eventLog) read(after uint64, match func(store.Event) bool, limit int) (page []loggedEvent, next uint64, gap bool, wait <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(time.Now())
+	oldest := l.nextSeq
+	if len(l.events) > 0 {
+		oldest = l.events[0].seq
+	}
+	// starting from the beginning reads whatever is still retained
+	gap = after > 0 && after+1 < oldest
+	next = after
+	start, _ := slices.BinarySearchFunc(l.events, after+1, func(e loggedEvent, seq uint64) int {
+		switch {
+		case e.seq < seq:
+			return -1
+		case e.seq > seq:
+			return 1
+		}
+		return 0
+	})
+	for _, e := range l.events[start:] {
+		if len(page) == limit {
+			break
+		}
+		// skipped events still advance the cursor
+		next = e.seq
+		if match(e.Event) {
+			page = append(page, e)
+		}
+	}
+	return page, next, gap, l.appended
+}
+
+// ack records the cursor a consumer has processed up to
+func (l *eventLog) ack(name string, cursor uint64) (eventConsumer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cursor >= l.nextSeq {
+		return eventConsumer{}, errors.New("cursor is ahead of the event log")
+	}
+	consumer := eventConsumer{Name: name, Cursor: l.cursor(cursor), UpdatedAt: time.Now()}
+	l.consumers[name] = consumer
+	return consumer, nil
+}
+
+func (l *eventLog) consumer(name string) (eventConsumer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	consumer, ok := l.consumers[name]
+	return consumer, ok
+}
+
+func (l *eventLog) listConsumers() []eventConsumer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	consumers := make([]eventConsumer, 0, len(l.consumers))
+	for _, consumer := range l.consumers {
+		consumers = append(consumers, consumer)
+	}
+	slices.SortFunc(consumers, func(a, b eventConsumer) int { return strings.Compare(a.Name, b.Name) })
+	return consumers
+}
+
+// replaceConsumers swaps in a whole new set of consumers, as loading a
+// state file does. Their cursors are from the run that saved them, so
+// resuming from them answers 410 Gone.
+func (l *eventLog) replaceConsumers(consumers []eventConsumer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.consumers = make(map[string]eventConsumer, len(consumers))
+	for _, consumer := range consumers {
+		l.consumers[consumer.Name] = consumer
+	}
+}
+
+// errStaleCursor is returned for cursors from an earlier run of the server
+var errStaleCursor = errors.New("this cursor is from an earlier run of the server; resync and restart from the beginning")
+
+// cursor writes seq as a cursor of this epoch
+func (l *eventLog) cursor(seq uint64) string {
+	return fmt.Sprintf("%s.%d", l.epoch, seq)
+}
+
+// parseCursor reads a cursor; the empty cursor is the start of the log.
+// Cursors of another epoch, or past the newest event, fail with
+// errStaleCursor.
+func (l *eventLog) parseCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	epoch, n, found := strings.Cut(cursor, ".")
+	if !found {
+		return 0, errors.New("invalid cursor")
+	}
+	seq, err := strconv.ParseUint(n, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	if epoch != l.epoch || seq > l.head() {
+		return 0, errStaleCursor
+	}
+	return seq, nil
+}
+
+// head returns the cursor of the newest event, so readers starting there
+// only see what happens from now on
+func (l *eventLog) head() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextSeq - 1
+}
+
+// GET /events
+func (s *server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cursor := query.Get("after")
+	if name := query.Get("consumer"); name != "" && !query.Has("after") {
+		if consumer, ok := s.events.consumer(name); ok {
+			cursor = consumer.Cursor
+		}
+	}
+	after, err := s.events.parseCursor(cursor)
+	if cursor == "latest" {
+		after, err = s.events.head(), nil
+	}
+	if errors.Is(err, errStaleCursor) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var types []store.EventType
+	if v := query.Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			types = append(types, store.EventType(strings.TrimSpace(t)))
+		}
+	}
+	limit, err := s.pageSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if v := query.Get("wait"); v != "" {
+		if wait, err = time.ParseDuration(v); err != nil || wait < 0 || wait > maxEventWait {
+			http.Error(w, "wait must be a duration of at most 60s", http.StatusBadRequest)
+			return
+		}
+	}
+
+	humans := excludeServices(r)
+	match := func(evt store.Event) bool {
+		return (len(types) == 0 || slices.Contains(types, evt.Type)) && !(humans && isServiceActor(evt.Actor))
+	}
+	page, next, gap, appended := s.events.read(after, match, limit)
+	if gap {
+		http.Error(w, "events after this cursor are past retention; resync and restart from the beginning", http.StatusGone)
+		return
+	}
+	// long-poll until something new arrives
+	if len(page) == 0 && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-appended:
+			page, next, _, _ = s.events.read(after, match, limit)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if page == nil {
+		page = []loggedEvent{}
+	}
+
+	resp := map[string]any{"events": page, "next_cursor": s.events.cursor(next)}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /events/consumers
+func (s *server) handleListEventConsumers(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.events.listConsumers()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PUT /events/consumers/{name}
+func (s *server) handleAckEvents(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Cursor string `json:"cursor"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cursor, err := s.events.parseCursor(req.Cursor)
+	if errors.Is(err, errStaleCursor) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	consumer, err := s.events.ack(r.PathValue("name"), cursor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, consumer); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type eventPage struct {
+	Events     []loggedEvent `json:"events"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+// readEvents reads a page of events after cursor, failing unless it gets
+// one
+func readEvents(t *testing.T, h http.Handler, cursor string) eventPage {
+	t.Helper()
+	w := serve(h, "GET", "/events?after="+url.QueryEscape(cursor), "")
+	var page eventPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET /events after %q: %d %s", cursor, w.Code, w.Body)
+	}
+	return page
+}
+
+func TestEventCursorsResume(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	createTodo(t, h, `{"title":"a"}`)
+	first := readEvents(t, h, "")
+	if len(first.Events) != 1 || first.NextCursor != first.Events[0].Cursor {
+		t.Fatalf("first page = %+v, want the one event", first)
+	}
+	if w := serve(h, "PUT", "/events/consumers/indexer", `{"cursor":"`+first.NextCursor+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("ack: %d %s", w.Code, w.Body)
+	}
+	createTodo(t, h, `{"title":"b"}`)
+	if page := readEvents(t, h, first.NextCursor); len(page.Events) != 1 || page.Events[0].Event.Todo.Title != "b" {
+		t.Errorf("page after the first = %+v, want the second todo's event", page)
+	}
+	w := serve(h, "GET", "/events?consumer=indexer", "")
+	var page eventPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Events) != 1 {
+		t.Errorf("consumer resume: %d %s, want the event after its ack", w.Code, w.Body)
+	}
+}
+
+func TestEventCursorsAfterRestart(t *testing.T) {
+	srv := newTestServer(t, Options{})
+	h := srv.routes()
+	createTodo(t, h, `{"title":"a"}`)
+	cursor := readEvents(t, h, "").NextCursor
+
+	// a new run numbers its events from 1 again, so the old cursor would
+	// otherwise point into them
+	restarted := newTestHandler(t, Options{Store: srv.changes.Store})
+	createTodo(t, restarted, `{"title":"b"}`)
+	createTodo(t, restarted, `{"title":"c"}`)
+	if w := serve(restarted, "GET", "/events?after="+url.QueryEscape(cursor), ""); w.Code != http.StatusGone {
+		t.Errorf("GET /events with a cursor of the previous run: status = %d, want %d: %s", w.Code, http.StatusGone, w.Body)
+	}
+	if w := serve(restarted, "PUT", "/events/consumers/indexer", `{"cursor":"`+cursor+`"}`); w.Code != http.StatusGone {
+		t.Errorf("ack with a cursor of the previous run: status = %d, want %d: %s", w.Code, http.StatusGone, w.Body)
+	}
+	if page := readEvents(t, restarted, ""); len(page.Events) != 2 {
+		t.Errorf("reading the restarted log from the beginning = %+v, want its 2 events", page)
+	}
+	if w := serve(restarted, "GET", "/events?after=nonsense", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("GET /events with a malformed cursor: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEventCursorPastRetention(t *testing.T) {
+	h := newTestHandler(t, Options{EventLogSize: 2})
+	createTodo(t, h, `{"title":"a"}`)
+	cursor := readEvents(t, h, "").NextCursor
+	for _, title := range []string{"b", "c", "d"} {
+		createTodo(t, h, `{"title":"`+title+`"}`)
+	}
+	if w := serve(h, "GET", "/events?after="+url.QueryEscape(cursor), ""); w.Code != http.StatusGone {
+		t.Errorf("GET /events after pruned events: status = %d, want %d: %s", w.Code, http.StatusGone, w.Body)
+	}
+	if page := readEvents(t, h, ""); len(page.Events) != 2 || page.Events[0].Event.Todo.Title != "c" {
+		t.Errorf("reading from the beginning = %+v, want the 2 retained events", page)
+	}
+}
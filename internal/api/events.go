@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"golang-todo/internal/store"
+)
+
+// emit hands events to every in-process subscriber once the write that
+// produced them has been committed
+func (s *server) emit(events ...store.Event) {
+	s.emitFor(nil, events...)
+}
+
+// emitFor emits the events of a write made by request r, which can then
+// be undone from the request's undo session
+func (s *server) emitFor(r *http.Request, events ...store.Event) {
+	describeChanges(events)
+	if s.undo != nil {
+		s.undo.record(undoSession(r), events)
+	}
+	for _, evt := range events {
+		if s.webhooks != nil {
+			s.webhooks.dispatch(evt)
+		}
+		for _, listener := range s.listeners {
+			listener(evt)
+		}
+	}
+}
+
+// outboxEvents returns the events to record in the store's outbox alongside
+// a write; nothing is recorded unless an event publisher drains the outbox
+func (s *server) outboxEvents(events ...store.Event) []store.Event {
+	describeChanges(events)
+	if s.publisher == nil {
+		return nil
+	}
+	return events
+}
+
+// describeChanges fills in the field diff of update events that know the
+// todo's previous state
+func describeChanges(events []store.Event) {
+	for i := range events {
+		if events[i].Before != nil && events[i].Changes == nil {
+			events[i].Changes = diffTodos(*events[i].Before, events[i].Todo)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang-todo/internal/metrics"
+)
+
+var featureTripsTotal = metrics.Default.NewCounterVec("todo_feature_trips_total",
+	"Times a feature was switched off automatically to protect the error budget.", "feature")
+
+// feature is an optional, expensive part of the server that can be
+// switched off to shed load without affecting the core todo API
+type feature string
+
+const (
+	featureSearch      feature = "search"
+	featureAggregation feature = "aggregation"
+	featureWebhooks    feature = "webhooks"
+)
+
+// features lists every feature with a kill switch
+var features = []feature{featureSearch, featureAggregation, featureWebhooks}
+
+// featureRoutes maps the routes served only by a feature to it; while the
+// feature is off they answer 503. Webhooks have no routes of their own
+// to turn off: their deliveries are held back instead.
+var featureRoutes = map[string]feature{
+	"GET /todos/search": featureSearch,
+	"GET /stats":        featureAggregation,
+	"GET /stats/trends": featureAggregation,
+	"GET /dashboard":    featureAggregation,
+}
+
+// sloLatencyExempt are routes whose requests are long by design, such as
+// long polls and bulk transfers; only their errors count as bad
+var sloLatencyExempt = map[string]bool{
+	"GET /events":                  true,
+	"GET /export":                  true,
+	"POST /import":                 true,
+	"POST /todos/{id}/attachments": true,
+	"GET /todos/{id}/attachments/{attachment_id}": true,
+	"POST /admin/backup":                          true,
+	"POST /admin/restore":                         true,
+}
+
+// featureMode is how an operator set a feature's switch
+type featureMode string
+
+const (
+	// featureAuto turns the feature off while the error budget burns too
+	// fast and back on once it recovers
+	featureAuto featureMode = "auto"
+	featureOn   featureMode = "on"
+	featureOff  featureMode = "off"
+)
+
+var errUnknownFeature = errors.New("unknown feature")
+
+// SLOConfig is the service level objective kill switches protect
+type SLOConfig struct {
+	// Availability is the target share of good requests, e.g. 0.99
+	Availability float64
+	// Latency is how long a request may take and still count as good
+	Latency time.Duration
+	// Window is how far back the burn rate is measured
+	Window time.Duration
+	// TripBurnRate is the burn rate at which auto features switch off;
+	// they switch back on below half of it, once Window has passed
+	TripBurnRate float64
+	// MinRequests avoids tripping on a handful of requests
+	MinRequests int
+}
+
+func (c SLOConfig) validate() error {
+	switch {
+	case c.Availability <= 0 || c.Availability >= 1:
+		return errors.New("-slo-availability must be between 0 and 1, e.g. 0.99")
+	case c.Latency <= 0 || c.Window < time.Second:
+		return errors.New("-slo-latency and -slo-window must be positive")
+	case c.TripBurnRate <= 1:
+		return errors.New("-kill-switch-burn-rate must be above 1")
+	}
+	return nil
+}
+
+// sloBucket counts one second of requests
+type sloBucket struct {
+	second    int64
+	total     int
+	bad       int
+	slow      int
+	serverErr int
+}
+
+// featureSwitch is the state of one feature's kill switch
+type featureSwitch struct {
+	Name    feature     `json:"name"`
+	Mode    featureMode `json:"mode"`
+	Enabled bool        `json:"enabled"`
+	// Tripped means auto mode switched the feature off
+	Tripped   bool       `json:"tripped"`
+	TrippedAt *time.Time `json:"tripped_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// sloHealth summarizes the requests in the burn rate window
+type sloHealth struct {
+	Requests     int     `json:"requests"`
+	Bad          int     `json:"bad"`
+	Slow         int     `json:"slow"`
+	ServerErrors int     `json:"server_errors"`
+	BurnRate     float64 `json:"burn_rate"`
+}
+
+// killSwitches switches optional features off while the server burns its
+// error budget too fast: a request is bad if it fails with a 5xx or takes
+// longer than the latency objective, and the burn rate is the share of bad
+// requests divided by the share the objective allows.
+type killSwitches struct {
+	mu       sync.Mutex
+	slo      SLOConfig
+	buckets  []sloBucket
+	switches map[feature]*featureSwitch
+
+	// metrics holds the state of this server's switches, which other
+	// servers in the process must not overwrite
+	metrics        *metrics.Registry
+	featureEnabled *metrics.GaugeVec
+}
+
+func newKillSwitches(slo SLOConfig) *killSwitches {
+	k := &killSwitches{
+		slo:      slo,
+		buckets:  make([]sloBucket, int(slo.Window/time.Second)),
+		switches: map[feature]*featureSwitch{},
+		metrics:  &metrics.Registry{},
+	}
+	k.featureEnabled = k.metrics.NewGaugeVec("todo_feature_enabled",
+		"Whether an optional feature is currently enabled (1) or switched off (0).", "feature")
+	for _, f := range features {
+		k.switches[f] = &featureSwitch{Name: f, Mode: featureAuto, Enabled: true}
+		k.featureEnabled.Set(1, string(f))
+	}
+	return k
+}
+
+// enabled reports whether f is currently on; a nil killSwitches has every
+// feature on
+func (k *killSwitches) enabled(f feature) bool {
+	if k == nil {
+		return true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.switches[f].Enabled
+}
+
+// observe counts a finished request towards the burn rate
+func (k *killSwitches) observe(status int, took time.Duration, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	sec := now.Unix()
+	b := &k.buckets[sec%int64(len(k.buckets))]
+	if b.second != sec {
+		*b = sloBucket{second: sec}
+	}
+	b.total++
+	serverErr, slow := status >= 500, took > k.slo.Latency
+	if serverErr {
+		b.serverErr++
+	}
+	if slow {
+		b.slow++
+	}
+	if serverErr || slow {
+		b.bad++
+	}
+}
+
+// health sums the buckets within the window; the caller holds k.mu
+func (k *killSwitches) health(now time.Time) sloHealth {
+	var h sloHealth
+	oldest := now.Add(-k.slo.Window).Unix()
+	for _, b := range k.buckets {
+		if b.second <= oldest || b.second > now.Unix() {
+			continue
+		}
+		h.Requests += b.total
+		h.Bad += b.bad
+		h.Slow += b.slow
+		h.ServerErrors += b.serverErr
+	}
+	if h.Requests > 0 {
+		h.BurnRate = float64(h.Bad) / float64(h.Requests) / (1 - k.slo.Availability)
+	}
+	return h
+}
+
+// evaluate trips or restores the features in auto mode
+func (k *killSwitches) evaluate(now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	h := k.health(now)
+	burning := h.Requests >= k.slo.MinRequests && h.BurnRate >= k.slo.TripBurnRate
+	recovered := h.BurnRate < k.slo.TripBurnRate/2
+	for _, f := range features {
+		sw := k.switches[f]
+		if sw.Mode != featureAuto {
+			continue
+		}
+		switch {
+		case !sw.Tripped && burning:
+			at := now
+			sw.Tripped, sw.TrippedAt = true, &at
+			sw.Reason = fmt.Sprintf("error budget burning %.1fx too fast: %d of %d requests in the last %s were errors or slower than %s",
+				h.BurnRate, h.Bad, h.Requests, k.slo.Window, k.slo.Latency)
+			featureTripsTotal.Inc(string(f))
+			log.Printf("feature %s switched off: %s", f, sw.Reason)
+		case sw.Tripped && recovered && now.Sub(*sw.TrippedAt) >= k.slo.Window:
+			sw.Tripped, sw.TrippedAt, sw.Reason = false, nil, ""
+			log.Printf("feature %s switched back on: burn rate is %.1f", f, h.BurnRate)
+		}
+		k.refresh(sw)
+	}
+}
+
+// refresh derives Enabled from the mode; the caller holds k.mu
+func (k *killSwitches) refresh(sw *featureSwitch) {
+	sw.Enabled = sw.Mode == featureOn || (sw.Mode == featureAuto && !sw.Tripped)
+	enabled := 0.0
+	if sw.Enabled {
+		enabled = 1
+	}
+	k.featureEnabled.Set(enabled, string(sw.Name))
+}
+
+// setMode overrides a feature's switch. Going back to auto clears a trip;
+// the next evaluation trips it again if the budget is still burning.
+func (k *killSwitches) setMode(f feature, mode featureMode) (featureSwitch, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	sw, ok := k.switches[f]
+	if !ok {
+		return featureSwitch{}, errUnknownFeature
+	}
+	sw.Mode = mode
+	sw.Tripped, sw.TrippedAt, sw.Reason = false, nil, ""
+	k.refresh(sw)
+	return *sw, nil
+}
+
+func (k *killSwitches) list(now time.Time) ([]featureSwitch, sloHealth) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	switches := make([]featureSwitch, 0, len(features))
+	for _, f := range features {
+		switches = append(switches, *k.switches[f])
+	}
+	return switches, k.health(now)
+}
+
+// run evaluates the switches every interval until ctx is cancelled
+func (k *killSwitches) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			k.evaluate(now)
+		}
+	}
+}
+
+// withKillSwitch answers 503 on a feature's routes while it is off, and
+// otherwise counts the request towards the burn rate. Rejected requests
+// aren't counted so shedding load doesn't itself burn the budget.
+func (s *server) withKillSwitch(pattern string, next http.Handler) http.Handler {
+	if s.killSwitches == nil {
+		return next
+	}
+	f, gated := featureRoutes[pattern]
+	exempt := sloLatencyExempt[pattern]
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gated && !s.killSwitches.enabled(f) {
+			w.Header().Set("Retry-After", "60")
+			respondProblem(w, http.StatusServiceUnavailable, "Feature temporarily disabled",
+				fmt.Sprintf("%s is switched off while the server recovers; the core todo API is unaffected", f))
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		took := time.Since(start)
+		if exempt {
+			took = 0
+		}
+		s.killSwitches.observe(rec.status, took, time.Now())
+	})
+}
+
+// GET /admin/features
+func (s *server) handleListFeatures(w http.ResponseWriter, r *http.Request) {
+	switches, health := s.killSwitches.list(time.Now())
+	resp := struct {
+		Features []featureSwitch `json:"features"`
+		Health   sloHealth       `json:"health"`
+	}{switches, health}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PUT /admin/features/{name}
+func (s *server) handleSetFeature(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Mode featureMode `json:"mode"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains([]featureMode{featureAuto, featureOn, featureOff}, req.Mode) {
+		http.Error(w, "mode must be auto, on or off", http.StatusBadRequest)
+		return
+	}
+	sw, err := s.killSwitches.setMode(feature(r.PathValue("name")), req.Mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("feature %s set to %s by %s", sw.Name, sw.Mode, actorFromRequest(r))
+	if err := respondJSON(w, http.StatusOK, sw); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFeatureGaugePerServer(t *testing.T) {
+	tripped := newTestServer(t, Options{})
+	other := newTestServer(t, Options{})
+	if _, err := tripped.killSwitches.setMode(featureSearch, featureOff); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		srv  *server
+		want string
+	}{
+		{tripped, `todo_feature_enabled{feature="search"} 0`},
+		{other, `todo_feature_enabled{feature="search"} 1`},
+	}
+	for _, tt := range tests {
+		w := serve(tt.srv.routes(), "GET", "/metrics", "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("GET /metrics: %d, want %s in:\n%s", w.Code, tt.want, w.Body)
+		}
+	}
+}
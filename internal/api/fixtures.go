@@ -0,0 +1,312 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"golang-todo/internal/store"
+	"golang-todo/todo/demo"
+)
+
+// fixturesActor is recorded for fixture changes that name no user
+const fixturesActor = "fixtures"
+
+// FixtureFile is the declarative description of an environment loaded
+// with -fixtures. Every entry has a stable ID, so applying the same file
+// again converges on the same state instead of duplicating it.
+type FixtureFile struct {
+	Users    []FixtureUser    `json:"users" yaml:"users"`
+	Projects []FixtureProject `json:"projects" yaml:"projects"`
+	Todos    []FixtureTodo    `json:"todos" yaml:"todos"`
+}
+
+// FixtureUser, FixtureProject and FixtureTodo describe one entry each of
+// a fixture file
+type FixtureUser struct {
+	ID    string `json:"id" yaml:"id"`
+	Name  string `json:"name" yaml:"name"`
+	Email string `json:"email" yaml:"email"`
+}
+
+type FixtureProject struct {
+	ID          string `json:"id" yaml:"id"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+type FixtureTodo struct {
+	ID          string             `json:"id" yaml:"id"`
+	Title       string             `json:"title" yaml:"title"`
+	Description string             `json:"description" yaml:"description"`
+	Status      store.TodoStatus   `json:"status" yaml:"status"`
+	Priority    store.TodoPriority `json:"priority" yaml:"priority"`
+	ProjectID   string             `json:"project_id" yaml:"project_id"`
+	Tags        []string           `json:"tags" yaml:"tags"`
+	DueAt       *time.Time         `json:"due_at" yaml:"due_at"`
+	CreatedBy   string             `json:"created_by" yaml:"created_by"`
+}
+
+// fixtureReport counts what applying a fixture file changed
+type fixtureReport struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// LoadFixtures reads a fixture file; .json files are parsed as JSON and
+// anything else as YAML. Unknown fields are rejected to catch typos.
+func LoadFixtures(path string) (FixtureFile, error) {
+	var f FixtureFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&f)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(&f); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed to parse fixtures %s: %w", path, err)
+	}
+	return f, f.validate()
+}
+
+// validate checks IDs are present and unique and that references resolve
+// within the file
+func (f FixtureFile) validate() error {
+	users, projects, todos := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for i, u := range f.Users {
+		if u.ID == "" || users[u.ID] {
+			return fmt.Errorf("users[%d]: id is missing or duplicated", i)
+		}
+		users[u.ID] = true
+	}
+	for i, p := range f.Projects {
+		if p.ID == "" || projects[p.ID] {
+			return fmt.Errorf("projects[%d]: id is missing or duplicated", i)
+		}
+		if strings.TrimSpace(p.Name) == "" {
+			return fmt.Errorf("projects[%d]: name is required", i)
+		}
+		projects[p.ID] = true
+	}
+	for i, t := range f.Todos {
+		if t.ID == "" || todos[t.ID] {
+			return fmt.Errorf("todos[%d]: id is missing or duplicated", i)
+		}
+		todos[t.ID] = true
+		if err := validateNewTodo(store.Todo{Title: t.Title, Priority: t.Priority}); err != nil {
+			return fmt.Errorf("todos[%d]: %w", i, err)
+		}
+		if t.ProjectID != "" && !projects[t.ProjectID] {
+			return fmt.Errorf("todos[%d]: unknown project %q", i, t.ProjectID)
+		}
+		if t.CreatedBy != "" && !users[t.CreatedBy] {
+			return fmt.Errorf("todos[%d]: unknown user %q", i, t.CreatedBy)
+		}
+	}
+	return nil
+}
+
+// applyFixtures creates or updates everything described by f so the
+// server matches it, leaving anything not mentioned alone
+func (s *server) applyFixtures(ctx context.Context, f FixtureFile) (fixtureReport, error) {
+	var report fixtureReport
+	now := time.Now()
+	for i, t := range f.Todos {
+		if t.Status != "" && !s.workflow.valid(t.Status) {
+			return report, fmt.Errorf("todos[%d]: invalid status %q; want one of %s", i, t.Status, s.workflow.describe())
+		}
+	}
+
+	for _, fu := range f.Users {
+		user := User{ID: fu.ID, Name: fu.Name, Email: fu.Email, CreatedAt: now}
+		existing, ok := s.users.get(fu.ID)
+		if ok {
+			user.CreatedAt = existing.CreatedAt
+		}
+		switch {
+		case !ok:
+			report.Created++
+		case existing != user:
+			report.Updated++
+		default:
+			report.Unchanged++
+		}
+		s.users.put(user)
+	}
+
+	for _, fp := range f.Projects {
+		// fixtures only describe the name and description; keep the rest
+		project, err := s.projects.get(fp.ID)
+		if err != nil {
+			project = Project{ID: fp.ID, CreatedAt: now}
+		}
+		changed := project.Name != fp.Name || project.Description != fp.Description
+		project.Name, project.Description = fp.Name, fp.Description
+		switch {
+		case err != nil:
+			report.Created++
+		case changed:
+			report.Updated++
+		default:
+			report.Unchanged++
+		}
+		s.projects.put(project)
+	}
+
+	for _, ft := range f.Todos {
+		actor := ft.CreatedBy
+		if actor == "" {
+			actor = fixturesActor
+		}
+		status := ft.Status
+		if status == "" {
+			status = store.StatusPending
+		}
+
+		existing, err := s.store.Get(ctx, ft.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			todo := newTodo(store.Todo{
+				Title:       ft.Title,
+				Description: ft.Description,
+				Priority:    ft.Priority,
+				ProjectID:   ft.ProjectID,
+				Tags:        ft.Tags,
+				DueAt:       ft.DueAt,
+			}, now)
+			todo.ID = ft.ID
+			if status != store.StatusPending {
+				setStatus(&todo, status, now)
+			}
+			created := store.NewEvent(store.EventTodoCreated, actor, todo)
+			if err := s.store.Create(ctx, todo, s.outboxEvents(created)...); err != nil {
+				return report, fmt.Errorf("todo %s: %w", ft.ID, err)
+			}
+			s.emit(created)
+			report.Created++
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("todo %s: %w", ft.ID, err)
+		}
+
+		todo := existing
+		todo.Title, todo.Description = ft.Title, ft.Description
+		todo.Priority, todo.ProjectID = ft.Priority, ft.ProjectID
+		todo.Tags, todo.DueAt = normalizeTags(ft.Tags), ft.DueAt
+		if status != existing.Status {
+			todo.CompletedAt = nil
+			setStatus(&todo, status, now)
+		}
+		if len(diffTodos(existing, todo)) == 0 {
+			report.Unchanged++
+			continue
+		}
+		todo.UpdatedAt = now
+		todo.Version++
+		updated := store.NewEvent(store.EventTodoUpdated, fixturesActor, todo)
+		updated.Before = &existing
+		events := []store.Event{updated}
+		if status == store.StatusCompleted && existing.Status != store.StatusCompleted {
+			completed := store.NewEvent(store.EventTodoCompleted, fixturesActor, todo)
+			completed.Before = &existing
+			events = append(events, completed)
+		}
+		if err := s.store.Update(ctx, todo, s.outboxEvents(events...)...); err != nil {
+			return report, fmt.Errorf("todo %s: %w", ft.ID, err)
+		}
+		s.emit(events...)
+		report.Updated++
+	}
+	return report, nil
+}
+
+// defaultDemoSize and maxDemoSize bound the todos POST /admin/seed
+// generates
+const (
+	defaultDemoSize = 50
+	maxDemoSize     = 10000
+)
+
+// DemoFixtures generates demo data as fixtures for a server following
+// workflow, nil meaning the default one; see package demo. Applying them
+// again with the same seed converges on the same todos.
+func DemoFixtures(seed int64, size int, workflow *Workflow, now time.Time) FixtureFile {
+	if workflow == nil {
+		workflow = defaultWorkflow()
+	}
+	data := demo.Generate(seed, size, now)
+	var f FixtureFile
+	for _, u := range data.Users {
+		f.Users = append(f.Users, FixtureUser{ID: u.ID, Name: u.Name, Email: u.Email})
+	}
+	for _, p := range data.Projects {
+		f.Projects = append(f.Projects, FixtureProject{ID: p.ID, Name: p.Name, Description: p.Description})
+	}
+	for _, t := range data.Todos {
+		status := t.Status
+		if !workflow.valid(status) {
+			// a custom workflow may lack the default's middle states
+			status = store.StatusPending
+		}
+		f.Todos = append(f.Todos, FixtureTodo{
+			ID:          t.ID,
+			Title:       t.Title,
+			Description: t.Description,
+			Status:      status,
+			Priority:    t.Priority,
+			ProjectID:   t.ProjectID,
+			Tags:        t.Tags,
+			DueAt:       t.DueAt,
+			CreatedBy:   t.CreatedBy,
+		})
+	}
+	return f
+}
+
+// POST /admin/seed
+func (s *server) handleSeed(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Seed int64 `json:"seed"`
+		Size int   `json:"size"`
+	}](r)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Size == 0 {
+		req.Size = defaultDemoSize
+	}
+	if req.Size < 0 || req.Size > maxDemoSize {
+		http.Error(w, fmt.Sprintf("size must be between 1 and %d", maxDemoSize), http.StatusBadRequest)
+		return
+	}
+	report, err := s.applyFixtures(r.Context(), DemoFixtures(req.Seed, req.Size, s.workflow, time.Now()))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
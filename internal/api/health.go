@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// readinessTimeout bounds each dependency check, so a hung connection
+// fails the probe instead of stalling it
+const readinessTimeout = 2 * time.Second
+
+// dependencyStatus is the outcome of checking one dependency
+type dependencyStatus struct {
+	Status    string  `json:"status"` // ok or error
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// readiness is the body of a readiness probe
+type readiness struct {
+	Status       string                      `json:"status"` // ok or unavailable
+	Dependencies map[string]dependencyStatus `json:"dependencies"`
+	// WarmUp lists the subsystems the instance waits for before taking
+	// traffic, with -warm-up
+	WarmUp map[string]warmupStatus `json:"warm_up,omitempty"`
+}
+
+// dependencies returns the connections the server needs in order to serve
+// traffic, by name. Backends that live in process, such as the memory
+// store and the LRU cache, have nothing to check and are left out.
+func (s *server) dependencies() map[string]store.Pinger {
+	deps := map[string]store.Pinger{}
+	todos := s.store
+	if tracked, ok := todos.(*store.ChangeTracker); ok {
+		todos = tracked.Store
+	}
+	if cached, ok := s.cachedStore(); ok {
+		if pinger, ok := cached.Cache.(store.Pinger); ok {
+			deps["cache"] = pinger
+		}
+		todos = cached.Store
+	}
+	if pinger, ok := todos.(store.Pinger); ok {
+		deps["store"] = pinger
+	}
+	if pinger, ok := s.publisher.(store.Pinger); ok {
+		deps["broker"] = pinger
+	}
+	return deps
+}
+
+// checkReadiness checks every dependency concurrently
+func (s *server) checkReadiness(ctx context.Context) readiness {
+	result := readiness{Status: "ok", Dependencies: map[string]dependencyStatus{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, dep := range s.dependencies() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+			start := time.Now()
+			err := dep.Ping(ctx)
+			status := dependencyStatus{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				status.Status, status.Error = "error", err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			result.Dependencies[name] = status
+			if err != nil {
+				result.Status = "unavailable"
+			}
+		}()
+	}
+	wg.Wait()
+	if tasks, done := s.warmups.snapshot(); len(tasks) > 0 {
+		result.WarmUp = tasks
+		if !done {
+			result.Status = "unavailable"
+		}
+	}
+	return result
+}
+
+// GET /healthz
+func (s *server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	// the process is up and serving; dependencies are the readiness
+	// probe's business, so a database outage doesn't get pods restarted
+	w.WriteHeader(http.StatusOK)
+}
+
+// GET /readyz
+func (s *server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	result := s.checkReadiness(r.Context())
+	status := http.StatusOK
+	if result.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := respondJSON(w, status, result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+// haDueSoonItems caps how many due-soon todos are listed in sensor attributes
+const haDueSoonItems = 10
+
+// haSensor is a Home Assistant entity state, in the shape accepted by the
+// Home Assistant REST API (POST /api/states/<entity_id>)
+type haSensor struct {
+	EntityID   string         `json:"entity_id"`
+	State      string         `json:"state"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// haDueItem is a todo listed in the due-soon sensor attributes
+type haDueItem struct {
+	ID    string    `json:"id"`
+	Title string    `json:"title"`
+	DueAt time.Time `json:"due_at"`
+}
+
+// homeAssistantSensors computes the sensor states exposed to Home Assistant.
+// Overdue todos also count as due soon so automations don't miss them.
+func homeAssistantSensors(todos []store.Todo, now time.Time, window time.Duration) []haSensor {
+	pending, completed, overdue := 0, 0, 0
+	dueSoon := []haDueItem{}
+	for _, todo := range todos {
+		if todo.Status == store.StatusCompleted {
+			completed++
+			continue
+		}
+		pending++
+		if todo.DueAt == nil {
+			continue
+		}
+		if todo.DueAt.Before(now) {
+			overdue++
+		}
+		if todo.DueAt.Before(now.Add(window)) {
+			dueSoon = append(dueSoon, haDueItem{ID: todo.ID, Title: todo.Title, DueAt: *todo.DueAt})
+		}
+	}
+	slices.SortFunc(dueSoon, func(a, b haDueItem) int { return a.DueAt.Compare(b.DueAt) })
+
+	count := func(entity, name string, n int, icon string) haSensor {
+		return haSensor{
+			EntityID: entity,
+			State:    fmt.Sprint(n),
+			Attributes: map[string]any{
+				"friendly_name":       name,
+				"unit_of_measurement": "todos",
+				"state_class":         "measurement",
+				"icon":                icon,
+			},
+		}
+	}
+	dueSoonSensor := count("sensor.todo_due_soon", "Todos due soon", len(dueSoon), "mdi:clock-alert-outline")
+	dueSoonSensor.Attributes["window"] = window.String()
+	dueSoonSensor.Attributes["items"] = dueSoon[:min(len(dueSoon), haDueSoonItems)]
+
+	return []haSensor{
+		count("sensor.todo_pending", "Pending todos", pending, "mdi:format-list-checks"),
+		count("sensor.todo_completed", "Completed todos", completed, "mdi:check-all"),
+		count("sensor.todo_overdue", "Overdue todos", overdue, "mdi:alert-circle-outline"),
+		dueSoonSensor,
+	}
+}
+
+func (s *server) homeAssistantSensors(ctx context.Context) ([]haSensor, error) {
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return homeAssistantSensors(todos, time.Now(), s.haDueSoon), nil
+}
+
+// GET /integrations/homeassistant/sensors
+func (s *server) handleHASensors(w http.ResponseWriter, r *http.Request) {
+	sensors, err := s.homeAssistantSensors(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, sensors); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /integrations/homeassistant/sensors/{entity_id}
+func (s *server) handleHASensor(w http.ResponseWriter, r *http.Request) {
+	sensors, err := s.homeAssistantSensors(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	id := r.PathValue("entity_id")
+	for _, sensor := range sensors {
+		if sensor.EntityID == id || strings.TrimPrefix(sensor.EntityID, "sensor.") == id {
+			if err := respondJSON(w, http.StatusOK, sensor); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	http.Error(w, "Sensor not found", http.StatusNotFound)
+}
+
+// POST /integrations/homeassistant/services/{service}
+//
+// Home Assistant calls these through rest_command: add_todo takes the same
+// body as POST /todos, complete_todo takes an id or an exact title so voice
+// assistants can complete items by name.
+func (s *server) handleHAService(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("service") {
+	case "add_todo":
+		s.handleCreateTodo(w, r)
+	case "complete_todo":
+		req, err := decodeJSON[struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		}](r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		todo, err := s.findPendingTodo(r.Context(), req.ID, req.Title)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		if err := checkCanComplete(r.Context(), s.store, todo, store.StatusCompleted, false); err != nil {
+			http.Error(w, err.Error(), completionErrorStatus(err))
+			return
+		}
+		todo, events, err := s.applyStatus(todo, store.StatusCompleted, actorFromRequest(r), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), statusErrorCode(err))
+			return
+		}
+		if err := s.store.Update(r.Context(), todo, s.outboxEvents(events...)...); err != nil {
+			respondError(w, err)
+			return
+		}
+		s.emitFor(r, events...)
+		if err := respondJSON(w, http.StatusOK, todo); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	default:
+		http.Error(w, "unknown service; want add_todo or complete_todo", http.StatusNotFound)
+	}
+}
+
+// findPendingTodo looks a todo up by ID, or else by case-insensitive title
+// among pending todos
+func (s *server) findPendingTodo(ctx context.Context, id, title string) (store.Todo, error) {
+	if id != "" {
+		return s.store.Get(ctx, id)
+	}
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return store.Todo{}, err
+	}
+	for _, todo := range todos {
+		if todo.Status != store.StatusCompleted && strings.EqualFold(strings.TrimSpace(todo.Title), strings.TrimSpace(title)) {
+			return todo, nil
+		}
+	}
+	return store.Todo{}, store.ErrNotFound
+}
+
+// haPusher pushes sensor states into Home Assistant through its REST API,
+// shortly after every change and periodically so due-soon counts stay fresh
+type haPusher struct {
+	srv     *server
+	baseURL string
+	token   *secrets.Setting
+	client  *http.Client
+	changed chan struct{}
+}
+
+func newHAPusher(srv *server, baseURL string, token *secrets.Setting) *haPusher {
+	return &haPusher{
+		srv:     srv,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// notify schedules a push; bursts of events collapse into one push
+func (p *haPusher) notify(store.Event) {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (p *haPusher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.push(ctx); err != nil {
+			log.Printf("home assistant push failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.changed:
+		}
+	}
+}
+
+func (p *haPusher) push(ctx context.Context) error {
+	sensors, err := p.srv.homeAssistantSensors(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sensor := range sensors {
+		body, err := json.Marshal(map[string]any{"state": sensor.State, "attributes": sensor.Attributes})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/states/"+sensor.EntityID, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.token.Get())
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s: unexpected status %s", sensor.EntityID, resp.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// csvColumns is the header written by CSV exports and expected by CSV imports
+var csvColumns = []string{"id", "title", "description", "status", "priority", "project_id", "tags", "due_at", "created_at", "updated_at", "completed_at"}
+
+// GET /export
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	todos, err := s.listTodos(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	s.anomalies.observe(anomalyBulkExport, actorFromRequest(r), len(todos), time.Now())
+	s.checkExportedCanaries(r, todos)
+
+	filename := "todos-" + time.Now().UTC().Format("20060102") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writeTodosCSV(w, todos)
+		return
+	}
+
+	// Encode one todo at a time so large exports start streaming immediately
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	io.WriteString(w, "[")
+	for i, todo := range todos {
+		if i > 0 {
+			io.WriteString(w, ",")
+		}
+		if err := enc.Encode(todo); err != nil {
+			return
+		}
+	}
+	io.WriteString(w, "]\n")
+}
+
+func writeTodosCSV(w io.Writer, todos []store.Todo) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvColumns)
+	for i, todo := range todos {
+		dueAt, completedAt := "", ""
+		if todo.DueAt != nil {
+			dueAt = todo.DueAt.Format(time.RFC3339)
+		}
+		if todo.Status == store.StatusCompleted && todo.CompletedAt != nil {
+			completedAt = todo.CompletedAt.Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			todo.ID,
+			todo.Title,
+			todo.Description,
+			string(todo.Status),
+			string(todo.Priority),
+			todo.ProjectID,
+			strings.Join(todo.Tags, "|"),
+			dueAt,
+			todo.CreatedAt.Format(time.RFC3339),
+			todo.UpdatedAt.Format(time.RFC3339),
+			completedAt,
+		})
+		if i%100 == 99 {
+			cw.Flush()
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// importRow is one parsed record of an import file
+type importRow struct {
+	Row  int
+	Todo store.Todo
+	Skip string
+	Err  error
+}
+
+// importRowReport describes what happened to a row that was not created
+type importRowReport struct {
+	Row    int    `json:"row"`
+	ID     string `json:"id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// importReport summarizes an import run
+type importReport struct {
+	Format  string            `json:"format"`
+	Mapping string            `json:"mapping,omitempty"`
+	DryRun  bool              `json:"dry_run"`
+	Created int               `json:"created"`
+	Skipped []importRowReport `json:"skipped"`
+	Errored []importRowReport `json:"errored"`
+}
+
+// importParsers decode each supported import format into rows
+var importParsers = map[string]func(io.Reader) ([]importRow, error){
+	"json":    parseJSONImport,
+	"csv":     parseCSVImport,
+	"todoist": parseTodoistImport,
+	"things":  parseThingsImport,
+}
+
+// POST /import
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			format = "csv"
+		} else {
+			format = "json"
+		}
+	}
+	parse, ok := importParsers[format]
+	// a stored mapping says how to read exports of other tools
+	source := r.URL.Query().Get("mapping")
+	if source != "" {
+		mapping, found := s.importMappings.get(source)
+		if !found {
+			http.Error(w, fmt.Sprintf("no import mapping for %q; create one with PUT /import/mappings/%s", source, source), http.StatusNotFound)
+			return
+		}
+		parse, ok, format = mapping.parse, true, mapping.Format
+	}
+	if !ok {
+		http.Error(w, "format must be one of json, csv, todoist or things", http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	rows, err := parse(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.importRows(r.Context(), rows, dryRun, actorFromRequest(r))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	report.Format, report.Mapping = format, source
+
+	status := http.StatusOK
+	if !dryRun && report.Created > 0 {
+		status = http.StatusCreated
+	}
+	if err := respondJSON(w, status, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// importRows creates the valid rows, skipping IDs and external refs that
+// already exist, so importing the same export twice adds nothing. In a dry
+// run nothing is written but the report is the same.
+func (s *server) importRows(ctx context.Context, rows []importRow, dryRun bool, actor string) (importReport, error) {
+	report := importReport{DryRun: dryRun, Skipped: []importRowReport{}, Errored: []importRowReport{}}
+	seen := map[string]bool{}
+	refs, err := s.externalRefs(ctx, rows)
+	if err != nil {
+		return report, err
+	}
+	now := time.Now()
+	for _, row := range rows {
+		entry := importRowReport{Row: row.Row, ID: row.Todo.ID, Title: row.Todo.Title}
+		if row.Err == nil && row.Skip == "" {
+			if row.Err = s.checkImportedStatus(row.Todo.Status); row.Err == nil {
+				row.Err = s.checkNewTodo(row.Todo)
+			}
+		}
+		if row.Err != nil {
+			entry.Reason = row.Err.Error()
+			report.Errored = append(report.Errored, entry)
+			continue
+		}
+		if row.Skip != "" {
+			entry.Reason = row.Skip
+			report.Skipped = append(report.Skipped, entry)
+			continue
+		}
+
+		todo := importedTodo(row.Todo, now)
+		if row.Todo.ID != "" {
+			_, err := s.store.Get(ctx, todo.ID)
+			if err == nil || seen[todo.ID] {
+				entry.Reason = "a todo with this id already exists"
+				report.Skipped = append(report.Skipped, entry)
+				continue
+			}
+			if !errors.Is(err, store.ErrNotFound) {
+				return report, err
+			}
+		}
+		if todo.ExternalRef != "" {
+			if refs[todo.ExternalRef] {
+				entry.Reason = "a todo with this external_ref already exists"
+				report.Skipped = append(report.Skipped, entry)
+				continue
+			}
+			refs[todo.ExternalRef] = true
+		}
+		seen[todo.ID] = true
+
+		if !dryRun {
+			created := store.NewEvent(store.EventTodoCreated, actor, todo)
+			if err := s.store.Create(ctx, todo, s.outboxEvents(created)...); err != nil {
+				entry.Reason = err.Error()
+				report.Errored = append(report.Errored, entry)
+				continue
+			}
+			s.emit(created)
+		}
+		report.Created++
+	}
+	return report, nil
+}
+
+// externalRefs returns the external refs of existing todos when any of the
+// rows has one
+func (s *server) externalRefs(ctx context.Context, rows []importRow) (map[string]bool, error) {
+	refs := map[string]bool{}
+	if !slices.ContainsFunc(rows, func(row importRow) bool { return row.Todo.ExternalRef != "" }) {
+		return refs, nil
+	}
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, todo := range todos {
+		if todo.ExternalRef != "" {
+			refs[todo.ExternalRef] = true
+		}
+	}
+	return refs, nil
+}
+
+// importedTodo is like newTodo but keeps the ID, timestamps and status of
+// records exported from this or another instance
+func importedTodo(in store.Todo, now time.Time) store.Todo {
+	todo := newTodo(in, now)
+	if in.ID != "" {
+		todo.ID = in.ID
+	}
+	if !in.CreatedAt.IsZero() {
+		todo.CreatedAt = in.CreatedAt
+		todo.UpdatedAt = in.CreatedAt
+	}
+	if !in.UpdatedAt.IsZero() {
+		todo.UpdatedAt = in.UpdatedAt
+	}
+	if in.Status != "" && in.Status != store.StatusPending {
+		todo.Status = in.Status
+		todo.StatusChangedAt = map[store.TodoStatus]time.Time{in.Status: todo.UpdatedAt}
+	}
+	if in.Status == store.StatusCompleted {
+		todo.CompletedAt = in.CompletedAt
+		if todo.CompletedAt == nil {
+			todo.CompletedAt = &todo.UpdatedAt
+		}
+		todo.StatusChangedAt[store.StatusCompleted] = *todo.CompletedAt
+	}
+	return todo
+}
+
+// parseJSONImport reads an array of todos as produced by GET /export
+func parseJSONImport(r io.Reader) ([]importRow, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON import: %w", err)
+	}
+	rows := make([]importRow, len(raw))
+	for i, msg := range raw {
+		rows[i].Row = i + 1
+		if err := json.Unmarshal(msg, &rows[i].Todo); err != nil {
+			rows[i].Err = err
+			continue
+		}
+	}
+	return rows, nil
+}
+
+// parseCSVImport reads the CSV layout produced by GET /export?format=csv;
+// only the title column is required and columns may appear in any order
+func parseCSVImport(r io.Reader) ([]importRow, error) {
+	records, header, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := header["title"]; !ok {
+		return nil, errors.New("CSV import requires a title column")
+	}
+
+	rows := make([]importRow, len(records))
+	for i, record := range records {
+		field := func(name string) string {
+			if idx, ok := header[name]; ok && idx < len(record) {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+		row := importRow{Row: i + 2}
+		row.Todo = store.Todo{
+			ID:          field("id"),
+			Title:       field("title"),
+			Description: field("description"),
+			Status:      store.TodoStatus(field("status")),
+			Priority:    store.TodoPriority(field("priority")),
+			ProjectID:   field("project_id"),
+			Tags:        strings.Split(field("tags"), "|"),
+		}
+		for name, dst := range map[string]*time.Time{"created_at": &row.Todo.CreatedAt, "updated_at": &row.Todo.UpdatedAt} {
+			if v := field(name); v != "" && row.Err == nil {
+				*dst, row.Err = time.Parse(time.RFC3339, v)
+			}
+		}
+		for name, dst := range map[string]**time.Time{"due_at": &row.Todo.DueAt, "completed_at": &row.Todo.CompletedAt} {
+			if v := field(name); v != "" && row.Err == nil {
+				t, err := time.Parse(time.RFC3339, v)
+				*dst, row.Err = &t, err
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// parseTodoistImport reads Todoist's CSV project export. Only "task" rows
+// become todos; labels are written inline in the content as "@label".
+func parseTodoistImport(r io.Reader) ([]importRow, error) {
+	records, header, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range []string{"type", "content"} {
+		if _, ok := header[col]; !ok {
+			return nil, fmt.Errorf("Todoist import requires a %s column", strings.ToUpper(col))
+		}
+	}
+
+	rows := make([]importRow, len(records))
+	for i, record := range records {
+		field := func(name string) string {
+			if idx, ok := header[name]; ok && idx < len(record) {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+		rows[i].Row = i + 2
+		if kind := field("type"); kind != "task" {
+			if kind == "" {
+				kind = "blank"
+			}
+			rows[i].Skip = fmt.Sprintf("%s rows are not tasks", kind)
+			continue
+		}
+
+		var title []string
+		var tags []string
+		for _, word := range strings.Fields(field("content")) {
+			if label, ok := strings.CutPrefix(word, "@"); ok && label != "" {
+				tags = append(tags, label)
+				continue
+			}
+			title = append(title, word)
+		}
+		rows[i].Todo = store.Todo{Title: strings.Join(title, " "), Description: field("description"), Tags: tags}
+	}
+	return rows, nil
+}
+
+// thingsItem is an entry of a Things 3 JSON export (the things:///json format)
+type thingsItem struct {
+	Type       string `json:"type"`
+	Attributes struct {
+		Title     string       `json:"title"`
+		Notes     string       `json:"notes"`
+		Tags      []string     `json:"tags"`
+		Completed bool         `json:"completed"`
+		Canceled  bool         `json:"canceled"`
+		Deadline  string       `json:"deadline"`
+		Items     []thingsItem `json:"items"`
+	} `json:"attributes"`
+}
+
+// parseThingsImport reads a Things 3 JSON export. To-dos inside projects
+// and headings are flattened, tagged with the project title.
+func parseThingsImport(r io.Reader) ([]importRow, error) {
+	var items []thingsItem
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("failed to decode Things import: %w", err)
+	}
+	var rows []importRow
+	var walk func(items []thingsItem, project string)
+	walk = func(items []thingsItem, project string) {
+		for _, item := range items {
+			switch item.Type {
+			case "project":
+				walk(item.Attributes.Items, item.Attributes.Title)
+				continue
+			case "heading":
+				walk(item.Attributes.Items, project)
+				continue
+			}
+
+			row := importRow{Row: len(rows) + 1}
+			attrs := item.Attributes
+			row.Todo = store.Todo{Title: attrs.Title, Description: attrs.Notes, Tags: attrs.Tags}
+			if project != "" {
+				row.Todo.Tags = append(row.Todo.Tags, project)
+			}
+			switch {
+			case item.Type != "to-do":
+				row.Skip = fmt.Sprintf("%q items are not to-dos", item.Type)
+			case attrs.Canceled:
+				row.Skip = "canceled to-dos are not imported"
+			case attrs.Completed:
+				row.Todo.Status = store.StatusCompleted
+			}
+			if attrs.Deadline != "" && row.Skip == "" {
+				deadline, err := time.Parse(time.DateOnly, attrs.Deadline)
+				row.Todo.DueAt, row.Err = &deadline, err
+			}
+			rows = append(rows, row)
+		}
+	}
+	walk(items, "")
+	return rows, nil
+}
+
+// readCSV reads all records and maps lower-cased header names to indexes
+func readCSV(r io.Reader) ([][]string, map[string]int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV import: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("CSV import is empty")
+	}
+	header := map[string]int{}
+	for i, name := range records[0] {
+		header[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	return records[1:], header, nil
+}
+
+func (s *server) checkImportedStatus(status store.TodoStatus) error {
+	if status != "" && !s.workflow.valid(status) {
+		return fmt.Errorf("invalid status %q", status)
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// importMapping says how to turn the records of a CSV or JSON export from
+// some other tool into todos. Mappings are stored per source, so a
+// recurring import only needs POST /import?mapping=SOURCE.
+type importMapping struct {
+	Source string `json:"source"`
+	// Format is csv or json
+	Format string `json:"format"`
+	// Records is the dotted path to the array of records in a JSON export,
+	// e.g. "data.issues"; empty when the export is the array itself
+	Records string `json:"records,omitempty"`
+	// Timezone is the IANA zone of dates written without one; UTC by default
+	Timezone  string         `json:"timezone,omitempty"`
+	Fields    []fieldMapping `json:"fields"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	UpdatedBy string         `json:"updated_by"`
+	loc       *time.Location
+}
+
+// fieldMapping maps one source field to a todo field. Transforms apply in
+// order: Default, Values, Split, then DateFormat.
+type fieldMapping struct {
+	// From is a CSV column, matched case-insensitively, or a dotted path
+	// into a JSON record, e.g. "fields.summary"
+	From string `json:"from" yaml:"from"`
+	// To is title, description, status, priority, project_id, tags,
+	// due_at, completed_at, created_at, estimate_minutes, external_ref, id
+	// or metadata.KEY
+	To string `json:"to" yaml:"to"`
+	// Default is used when the source field is missing or empty
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+	// Values replaces source values, e.g. {"Done": "completed"}; a value
+	// mapped to "" is dropped
+	Values map[string]string `json:"values,omitempty" yaml:"values,omitempty"`
+	// Split cuts a value into several on a separator, e.g. "," for tags
+	Split string `json:"split,omitempty" yaml:"split,omitempty"`
+	// DateFormat is rfc3339 (the default), unix, unix_ms or a Go time
+	// layout such as "02/01/2006 15:04"
+	DateFormat string `json:"date_format,omitempty" yaml:"date_format,omitempty"`
+}
+
+// mappedStringFields are the todo fields a mapping sets from a single value
+var mappedStringFields = map[string]func(*store.Todo, string){
+	"status":       func(t *store.Todo, v string) { t.Status = store.TodoStatus(v) },
+	"priority":     func(t *store.Todo, v string) { t.Priority = store.TodoPriority(v) },
+	"project_id":   func(t *store.Todo, v string) { t.ProjectID = v },
+	"external_ref": func(t *store.Todo, v string) { t.ExternalRef = v },
+	"id":           func(t *store.Todo, v string) { t.ID = v },
+}
+
+// mappedDateFields are the todo fields a mapping sets from a date
+var mappedDateFields = map[string]func(*store.Todo, time.Time){
+	"due_at":       func(t *store.Todo, v time.Time) { t.DueAt = &v },
+	"completed_at": func(t *store.Todo, v time.Time) { t.CompletedAt = &v },
+	"created_at":   func(t *store.Todo, v time.Time) { t.CreatedAt = v },
+}
+
+var importSourceName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validate checks a mapping and resolves its timezone
+func (m *importMapping) validate() error {
+	if !importSourceName.MatchString(m.Source) {
+		return errors.New("source names are 1 to 64 letters, digits, dashes or underscores")
+	}
+	if m.Format != "csv" && m.Format != "json" {
+		return errors.New("format must be csv or json")
+	}
+	if m.Records != "" && m.Format != "json" {
+		return errors.New("records only applies to json mappings")
+	}
+	m.loc = time.UTC
+	if m.Timezone != "" {
+		var err error
+		if m.loc, err = time.LoadLocation(m.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", m.Timezone)
+		}
+	}
+	hasTitle := false
+	for i, f := range m.Fields {
+		name := fmt.Sprintf("fields[%d]", i)
+		if strings.TrimSpace(f.From) == "" {
+			return fmt.Errorf("%s: from is required", name)
+		}
+		_, isString := mappedStringFields[f.To]
+		_, isDate := mappedDateFields[f.To]
+		key, isMetadata := strings.CutPrefix(f.To, "metadata.")
+		switch {
+		case f.To == "title":
+			hasTitle = true
+		case isMetadata:
+			if !metadataKeyPattern.MatchString(key) {
+				return fmt.Errorf("%s: invalid metadata key %q", name, key)
+			}
+		case isString, isDate, f.To == "description", f.To == "tags", f.To == "estimate_minutes":
+		default:
+			return fmt.Errorf("%s: unknown target %q", name, f.To)
+		}
+		if f.DateFormat != "" && !isDate {
+			return fmt.Errorf("%s: date_format only applies to due_at, completed_at and created_at", name)
+		}
+	}
+	if !hasTitle {
+		return errors.New("a mapping needs a field mapped to title")
+	}
+	return nil
+}
+
+// values returns what a field mapping makes of a record's raw values
+func (f fieldMapping) values(raw []string) []string {
+	var values []string
+	for _, v := range raw {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 && f.Default != "" {
+		values = []string{f.Default}
+	}
+	if f.Values != nil {
+		mapped := values[:0]
+		for _, v := range values {
+			if replacement, ok := f.Values[v]; ok {
+				v = replacement
+			}
+			if v != "" {
+				mapped = append(mapped, v)
+			}
+		}
+		values = mapped
+	}
+	if f.Split != "" {
+		var split []string
+		for _, v := range values {
+			for _, part := range strings.Split(v, f.Split) {
+				if part = strings.TrimSpace(part); part != "" {
+					split = append(split, part)
+				}
+			}
+		}
+		values = split
+	}
+	return values
+}
+
+// parseDate reads a date in the field's format
+func (f fieldMapping) parseDate(v string, loc *time.Location) (time.Time, error) {
+	switch f.DateFormat {
+	case "", "rfc3339":
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		return time.ParseInLocation(time.DateOnly, v, loc)
+	case "unix", "unix_ms":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a unix timestamp", v)
+		}
+		if f.DateFormat == "unix_ms" {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	return time.ParseInLocation(f.DateFormat, v, loc)
+}
+
+// todo builds a todo from one record; lookup returns the raw values of a
+// source field
+func (m *importMapping) todo(lookup func(from string) []string) (store.Todo, error) {
+	var todo store.Todo
+	for _, f := range m.Fields {
+		values := f.values(lookup(f.From))
+		if len(values) == 0 {
+			continue
+		}
+		last := values[len(values)-1]
+		if set, ok := mappedStringFields[f.To]; ok {
+			set(&todo, last)
+			continue
+		}
+		if set, ok := mappedDateFields[f.To]; ok {
+			t, err := f.parseDate(last, m.loc)
+			if err != nil {
+				return todo, fmt.Errorf("%s: %w", f.From, err)
+			}
+			set(&todo, t)
+			continue
+		}
+		if key, ok := strings.CutPrefix(f.To, "metadata."); ok {
+			if todo.Metadata == nil {
+				todo.Metadata = map[string]any{}
+			}
+			todo.Metadata[key] = strings.Join(values, ", ")
+			continue
+		}
+		switch f.To {
+		case "title":
+			todo.Title = strings.TrimSpace(todo.Title + " " + strings.Join(values, " "))
+		case "description":
+			if todo.Description != "" {
+				todo.Description += "\n\n"
+			}
+			todo.Description += strings.Join(values, "\n")
+		case "tags":
+			todo.Tags = append(todo.Tags, values...)
+		case "estimate_minutes":
+			n, err := strconv.Atoi(last)
+			if err != nil {
+				return todo, fmt.Errorf("%s: %q is not a number of minutes", f.From, last)
+			}
+			todo.EstimateMinutes = n
+		}
+	}
+	return todo, nil
+}
+
+// parse reads an export into import rows
+func (m *importMapping) parse(r io.Reader) ([]importRow, error) {
+	if m.Format == "csv" {
+		records, header, err := readCSV(r)
+		if err != nil {
+			return nil, err
+		}
+		rows := make([]importRow, len(records))
+		for i, record := range records {
+			rows[i].Row = i + 2
+			rows[i].Todo, rows[i].Err = m.todo(func(from string) []string {
+				if idx, ok := header[strings.ToLower(from)]; ok && idx < len(record) {
+					return []string{record[idx]}
+				}
+				return nil
+			})
+		}
+		return rows, nil
+	}
+
+	var doc any
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON import: %w", err)
+	}
+	records, ok := jsonPath(doc, m.Records).([]any)
+	if !ok {
+		if m.Records == "" {
+			return nil, errors.New("JSON import must be an array of records; set records to the path of the array")
+		}
+		return nil, fmt.Errorf("JSON import has no array of records at %q", m.Records)
+	}
+	rows := make([]importRow, len(records))
+	for i, record := range records {
+		rows[i].Row = i + 1
+		rows[i].Todo, rows[i].Err = m.todo(func(from string) []string {
+			return jsonValues(jsonPath(record, from))
+		})
+	}
+	return rows, nil
+}
+
+// jsonPath follows a dotted path of object keys into a decoded document
+func jsonPath(doc any, path string) any {
+	if path == "" {
+		return doc
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil
+		}
+		doc = obj[key]
+	}
+	return doc
+}
+
+// jsonValues flattens a decoded JSON value into strings; arrays give one
+// value per element
+func jsonValues(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case []any:
+		var values []string
+		for _, elem := range v {
+			values = append(values, jsonValues(elem)...)
+		}
+		return values
+	}
+	// objects don't map to a single field
+	return nil
+}
+
+// importMappingRegistry holds the stored mappings by source
+type importMappingRegistry struct {
+	mu       sync.RWMutex
+	mappings map[string]*importMapping
+}
+
+func (reg *importMappingRegistry) get(source string) (*importMapping, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	m, ok := reg.mappings[source]
+	return m, ok
+}
+
+// put stores m, reporting whether it replaced a mapping
+func (reg *importMappingRegistry) put(m *importMapping) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.mappings == nil {
+		reg.mappings = map[string]*importMapping{}
+	}
+	_, replaced := reg.mappings[m.Source]
+	reg.mappings[m.Source] = m
+	return replaced
+}
+
+func (reg *importMappingRegistry) list() []*importMapping {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	list := make([]*importMapping, 0, len(reg.mappings))
+	for _, m := range reg.mappings {
+		list = append(list, m)
+	}
+	slices.SortFunc(list, func(a, b *importMapping) int { return strings.Compare(a.Source, b.Source) })
+	return list
+}
+
+// replace swaps in a whole new set of mappings, as loading a state file
+// does
+func (reg *importMappingRegistry) replace(mappings []*importMapping) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.mappings = make(map[string]*importMapping, len(mappings))
+	for _, m := range mappings {
+		reg.mappings[m.Source] = m
+	}
+}
+
+func (reg *importMappingRegistry) remove(source string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	_, ok := reg.mappings[source]
+	delete(reg.mappings, source)
+	return ok
+}
+
+// GET /import/mappings
+func (s *server) handleListImportMappings(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.importMappings.list()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /import/mappings/{source}
+func (s *server) handleGetImportMapping(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.importMappings.get(r.PathValue("source"))
+	if !ok {
+		http.Error(w, "Mapping not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, m); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PUT /import/mappings/{source}
+func (s *server) handlePutImportMapping(w http.ResponseWriter, r *http.Request) {
+	m, err := decodeJSON[importMapping](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.Source = r.PathValue("source")
+	if err := m.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.UpdatedAt, m.UpdatedBy = time.Now(), actorFromRequest(r)
+	status := http.StatusCreated
+	if s.importMappings.put(&m) {
+		status = http.StatusOK
+	}
+	if err := respondJSON(w, status, m); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /import/mappings/{source}
+func (s *server) handleDeleteImportMapping(w http.ResponseWriter, r *http.Request) {
+	if !s.importMappings.remove(r.PathValue("source")) {
+		http.Error(w, "Mapping not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Caps on what jobs keep: the most recent jobs, and the first errors of
+// each
+const (
+	maxJobs      = 100
+	maxJobErrors = 100
+)
+
+// adminJob is an admin operation too big to finish within a request, such
+// as an ownership transfer. It runs in the background; clients poll
+// GET /admin/jobs/{id} for its progress.
+type adminJob struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Status is running, done, or failed when the job stopped on an error
+	Status     string     `json:"status"`
+	Actor      string     `json:"actor"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Total is how many items the job goes through; Done and Failed count
+	// those it has been through so far
+	Total  int `json:"total"`
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+	// Errors describes the failed items, up to maxJobErrors of them
+	Errors []string `json:"errors,omitempty"`
+	// Error says why a failed job stopped
+	Error string `json:"error,omitempty"`
+}
+
+// jobRegistry holds the recent admin jobs, oldest first
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs []*adminJob
+}
+
+// jobProgress is how a running job reports on itself
+type jobProgress struct {
+	jobs *jobRegistry
+	job  *adminJob
+}
+
+func (p jobProgress) update(fn func(*adminJob)) {
+	p.jobs.mu.Lock()
+	defer p.jobs.mu.Unlock()
+	fn(p.job)
+}
+
+// total sets how many items the job has to go through
+func (p jobProgress) total(n int) {
+	p.update(func(job *adminJob) { job.Total = n })
+}
+
+// done counts an item as handled, or as failed when err isn't nil
+func (p jobProgress) done(item string, err error) {
+	p.update(func(job *adminJob) {
+		if err == nil {
+			job.Done++
+			return
+		}
+		job.Failed++
+		if len(job.Errors) < maxJobErrors {
+			job.Errors = append(job.Errors, fmt.Sprintf("%s: %v", item, err))
+		}
+	})
+}
+
+// start runs fn as a new job of kind in the background and returns the
+// job as it starts
+func (j *jobRegistry) start(ctx context.Context, kind, actor string, fn func(context.Context, jobProgress) error) adminJob {
+	job := &adminJob{ID: uuid.New().String(), Kind: kind, Status: "running", Actor: actor, StartedAt: time.Now()}
+	j.mu.Lock()
+	j.jobs = append(j.jobs, job)
+	// drop the oldest finished jobs past the cap
+	for i := 0; len(j.jobs) > maxJobs && i < len(j.jobs); {
+		if j.jobs[i].Status == "running" {
+			i++
+			continue
+		}
+		j.jobs = slices.Delete(j.jobs, i, i+1)
+	}
+	started := *job
+	j.mu.Unlock()
+
+	progress := jobProgress{jobs: j, job: job}
+	go func() {
+		err := fn(ctx, progress)
+		progress.update(func(job *adminJob) {
+			now := time.Now()
+			job.FinishedAt = &now
+			job.Status = "done"
+			if err != nil {
+				job.Status, job.Error = "failed", err.Error()
+			}
+		})
+		if err != nil {
+			log.Printf("%s job %s failed: %v", kind, job.ID, err)
+		}
+	}()
+	return started
+}
+
+// get returns a copy of the job with id
+func (j *jobRegistry) get(id string) (adminJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, job := range j.jobs {
+		if job.ID == id {
+			c := *job
+			c.Errors = slices.Clone(job.Errors)
+			return c, true
+		}
+	}
+	return adminJob{}, false
+}
+
+// list returns copies of the jobs, newest first
+func (j *jobRegistry) list() []adminJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]adminJob, 0, len(j.jobs))
+	for i := len(j.jobs) - 1; i >= 0; i-- {
+		c := *j.jobs[i]
+		c.Errors = slices.Clone(j.jobs[i].Errors)
+		jobs = append(jobs, c)
+	}
+	return jobs
+}
+
+// respondJob answers a request that started job with 202 Accepted and
+// where to follow it
+func respondJob(w http.ResponseWriter, job adminJob) {
+	w.Header().Set("Location", "/admin/jobs/"+job.ID)
+	if err := respondJSON(w, http.StatusAccepted, job); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/jobs
+func (s *server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.jobs.list()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/jobs/{id}
+func (s *server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, job); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errKeyRingNotFound = errors.New("key ring not found")
+	errKeyNotFound     = errors.New("key not found")
+	errRevokeSigning   = errors.New("the signing key can't be revoked; rotate first")
+)
+
+// signingKey is one key of a keyRing. Its ID is derived from the secret,
+// so a configured key keeps its ID across restarts.
+type signingKey struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Signing   bool       `json:"signing"`
+	// Configured keys come from settings rather than rotation
+	Configured bool `json:"configured"`
+	secret     []byte
+}
+
+func keyID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:4])
+}
+
+// keyRing holds one signing key and any number of older keys that still
+// verify until they expire, so keys can be rotated without invalidating
+// everything signed with the previous one at once
+type keyRing struct {
+	mu sync.RWMutex
+	// keys are oldest first; the last one signs
+	keys []signingKey
+	// grace is how long a replaced signing key keeps verifying by default
+	grace time.Duration
+}
+
+func newKeyRing(grace time.Duration) *keyRing {
+	return &keyRing{grace: grace}
+}
+
+// add makes secret the signing key; the caller holds k.mu
+func (k *keyRing) add(secret []byte, configured bool, now time.Time) signingKey {
+	key := signingKey{ID: keyID(secret), CreatedAt: now, Configured: configured, secret: secret}
+	k.keys = slices.DeleteFunc(k.keys, func(existing signingKey) bool { return existing.ID == key.ID })
+	k.keys = append(k.keys, key)
+	return key
+}
+
+// prune drops expired keys; the caller holds k.mu
+func (k *keyRing) prune(now time.Time) {
+	k.keys = slices.DeleteFunc(k.keys, func(key signingKey) bool {
+		return key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)
+	})
+}
+
+// sync makes the ring match configured secrets, listed newest first as in
+// "new,old". Newly configured keys are added, the newest becoming the
+// signing key; keys dropped from the configuration keep verifying for the
+// grace period. Keys added by rotation are left alone.
+func (k *keyRing) sync(secrets [][]byte, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	wanted := map[string]bool{}
+	for _, secret := range secrets {
+		wanted[keyID(secret)] = true
+	}
+	for i := range k.keys {
+		if k.keys[i].Configured && !wanted[k.keys[i].ID] && k.keys[i].ExpiresAt == nil {
+			expires := now.Add(k.grace)
+			k.keys[i].ExpiresAt = &expires
+		}
+	}
+	for i := len(secrets) - 1; i >= 0; i-- {
+		id := keyID(secrets[i])
+		if !slices.ContainsFunc(k.keys, func(key signingKey) bool { return key.ID == id }) {
+			k.add(secrets[i], true, now)
+		}
+	}
+}
+
+// rotate replaces the signing key with a new random one. The old key
+// keeps verifying for grace, or the ring's default if grace is zero.
+func (k *keyRing) rotate(grace time.Duration, now time.Time) (signingKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return signingKey{}, err
+	}
+	if grace <= 0 {
+		grace = k.grace
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.prune(now)
+	if n := len(k.keys); n > 0 {
+		expires := now.Add(grace)
+		k.keys[n-1].ExpiresAt = &expires
+	}
+	return k.add(secret, false, now), nil
+}
+
+// revoke stops a key verifying right away
+func (k *keyRing) revoke(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	i := slices.IndexFunc(k.keys, func(key signingKey) bool { return key.ID == id })
+	switch {
+	case i < 0:
+		return errKeyNotFound
+	case i == len(k.keys)-1:
+		return errRevokeSigning
+	}
+	k.keys = slices.Delete(k.keys, i, i+1)
+	return nil
+}
+
+// signer returns the current signing key
+func (k *keyRing) signer() (signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.keys) == 0 {
+		return signingKey{}, false
+	}
+	return k.keys[len(k.keys)-1], true
+}
+
+// verifiers returns the keys that still verify, newest first
+func (k *keyRing) verifiers(now time.Time) []signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var keys []signingKey
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if key := k.keys[i]; key.ExpiresAt == nil || now.Before(*key.ExpiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// list describes the keys without their secrets, newest first
+func (k *keyRing) list(now time.Time) []signingKey {
+	keys := k.verifiers(now)
+	for i := range keys {
+		keys[i].Signing = i == 0
+	}
+	if keys == nil {
+		keys = []signingKey{}
+	}
+	return keys
+}
+
+// splitKeys parses a setting listing secrets newest first, separated by
+// commas
+func splitKeys(setting string) [][]byte {
+	var secrets [][]byte
+	for _, s := range strings.Split(setting, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			secrets = append(secrets, []byte(s))
+		}
+	}
+	return secrets
+}
+
+func (s *server) keyRing(name string) (*keyRing, error) {
+	ring, ok := s.keyRings[name]
+	if !ok {
+		return nil, errKeyRingNotFound
+	}
+	return ring, nil
+}
+
+// GET /admin/keys/{ring}
+func (s *server) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	ring, err := s.keyRing(r.PathValue("ring"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, ring.list(time.Now())); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/keys/{ring}/rotate
+func (s *server) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	ring, err := s.keyRing(r.PathValue("ring"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	grace, err := parseGrace(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, err := ring.rotate(grace, time.Now())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	key.Signing = true
+	if err := respondJSON(w, http.StatusCreated, key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /admin/keys/{ring}/{id}
+func (s *server) handleRevokeKey(w http.ResponseWriter, r *http.Request) {
+	ring, err := s.keyRing(r.PathValue("ring"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	switch err := ring.revoke(r.PathValue("id")); {
+	case errors.Is(err, errKeyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseGrace reads the optional grace period of a rotation request, e.g.
+// {"grace": "72h"}; an empty body uses the default
+func parseGrace(r *http.Request) (time.Duration, error) {
+	if r.ContentLength == 0 {
+		return 0, nil
+	}
+	req, err := decodeJSON[struct {
+		Grace string `json:"grace"`
+	}](r)
+	if err != nil || req.Grace == "" {
+		return 0, err
+	}
+	grace, err := time.ParseDuration(req.Grace)
+	if err != nil || grace < 0 {
+		return 0, errors.New("grace must be a non-negative duration such as 72h")
+	}
+	return grace, nil
+}
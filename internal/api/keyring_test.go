@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"golang-todo/internal/secrets"
+)
+
+// keyIDs returns the IDs of the keys that verify at now, newest first
+func keyIDs(ring *keyRing, now time.Time) []string {
+	var ids []string
+	for _, key := range ring.verifiers(now) {
+		ids = append(ids, key.ID)
+	}
+	return ids
+}
+
+func TestKeyRingRotate(t *testing.T) {
+	now := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	ring := newKeyRing(time.Hour)
+	first, err := ring.rotate(0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ring.rotate(0, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer, _ := ring.signer(); signer.ID != second.ID {
+		t.Fatalf("signer = %s, want the rotated-in %s", signer.ID, second.ID)
+	}
+
+	// the replaced key verifies for the ring's grace period, then stops
+	if got := keyIDs(ring, now.Add(time.Hour)); !slices.Equal(got, []string{second.ID, first.ID}) {
+		t.Errorf("verifiers within the grace period = %v, want %s then %s", got, second.ID, first.ID)
+	}
+	if got := keyIDs(ring, now.Add(time.Minute+time.Hour)); !slices.Equal(got, []string{second.ID}) {
+		t.Errorf("verifiers after the grace period = %v, want only %s", got, second.ID)
+	}
+
+	// a rotation's own grace overrides the default, and expired keys are
+	// dropped on the next rotation
+	third, err := ring.rotate(10*time.Hour, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keyIDs(ring, now.Add(11*time.Hour)); !slices.Equal(got, []string{third.ID, second.ID}) {
+		t.Errorf("verifiers within a 10h grace = %v, want %s then %s", got, third.ID, second.ID)
+	}
+	if len(ring.keys) != 2 {
+		t.Errorf("ring keeps %d keys, want the expired first key pruned", len(ring.keys))
+	}
+
+	if err := ring.revoke(third.ID); !errors.Is(err, errRevokeSigning) {
+		t.Errorf("revoke the signing key = %v, want %v", err, errRevokeSigning)
+	}
+	if err := ring.revoke("missing"); !errors.Is(err, errKeyNotFound) {
+		t.Errorf("revoke a missing key = %v, want %v", err, errKeyNotFound)
+	}
+	if err := ring.revoke(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := keyIDs(ring, now.Add(3*time.Hour)); !slices.Equal(got, []string{third.ID}) {
+		t.Errorf("verifiers after revoking %s = %v", second.ID, got)
+	}
+}
+
+func TestKeyRingSync(t *testing.T) {
+	now := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	ring := newKeyRing(time.Hour)
+	a, b := keyID([]byte("alpha")), keyID([]byte("bravo"))
+	ring.sync(splitKeys("alpha"), now)
+
+	// a new key listed first takes over signing; the old one keeps
+	// verifying for as long as it stays configured
+	ring.sync(splitKeys("bravo, alpha"), now.Add(time.Minute))
+	if signer, _ := ring.signer(); signer.ID != b || !signer.Configured {
+		t.Errorf("signer = %+v, want the configured %s", signer, b)
+	}
+	if got := keyIDs(ring, now.Add(48*time.Hour)); !slices.Equal(got, []string{b, a}) {
+		t.Errorf("verifiers while both are configured = %v, want %s then %s", got, b, a)
+	}
+
+	// dropping a key from the configuration starts its grace period
+	ring.sync(splitKeys("bravo"), now.Add(2*time.Hour))
+	if got := keyIDs(ring, now.Add(2*time.Hour+time.Minute)); !slices.Equal(got, []string{b, a}) {
+		t.Errorf("verifiers just after dropping %s = %v", a, got)
+	}
+	if got := keyIDs(ring, now.Add(3*time.Hour)); !slices.Equal(got, []string{b}) {
+		t.Errorf("verifiers after the grace period = %v, want only %s", got, b)
+	}
+
+	// syncing the same configuration again keeps a rotated-in key signing
+	rotated, err := ring.rotate(0, now.Add(4*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring.sync(splitKeys("bravo"), now.Add(5*time.Hour))
+	if signer, _ := ring.signer(); signer.ID != rotated.ID {
+		t.Errorf("signer after syncing = %s, want the rotated-in %s", signer.ID, rotated.ID)
+	}
+}
+
+func TestCalendarTokensAcrossRotation(t *testing.T) {
+	admin := &secrets.Setting{}
+	admin.Set("adm1n")
+	calendar := &secrets.Setting{}
+	calendar.Set("alpha")
+	h := newTestHandler(t, Options{AdminToken: admin, CalendarSecret: calendar})
+	feed := func() string {
+		t.Helper()
+		w := serve(h, "POST", "/calendar/tokens", `{}`)
+		var created map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("create calendar token: %d %s", w.Code, w.Body)
+		}
+		u, err := url.Parse(created["url"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.RequestURI()
+	}
+	old := feed()
+
+	w := serve(h, "POST", "/admin/keys/calendar/rotate", "", "Authorization", "Bearer adm1n")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("rotate: %d %s", w.Code, w.Body)
+	}
+	current := feed()
+	for name, target := range map[string]string{"old": old, "current": current} {
+		if w := serve(h, "GET", target, ""); w.Code != http.StatusOK {
+			t.Errorf("%s feed within the grace period: %d %s", name, w.Code, w.Body)
+		}
+	}
+
+	// revoking the configured key ends the old feed right away
+	if w := serve(h, "DELETE", "/admin/keys/calendar/"+keyID([]byte("alpha")), "", "Authorization", "Bearer adm1n"); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", old, ""); w.Code != http.StatusForbidden {
+		t.Errorf("old feed after revoking its key: %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serve(h, "GET", current, ""); w.Code != http.StatusOK {
+		t.Errorf("current feed after revoking the old key: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+const (
+	// defaultLockTTL is how long a lock lasts unless the holder asks otherwise
+	defaultLockTTL = 2 * time.Minute
+	// maxLockTTL caps requested lock lifetimes so abandoned locks clear quickly
+	maxLockTTL = 15 * time.Minute
+)
+
+// errLockHeld is returned when another user holds an unexpired lock
+var errLockHeld = errors.New("todo is locked by another user")
+
+// lockTable holds the current edit locks by todo ID
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[string]store.EditLock
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{locks: map[string]store.EditLock{}}
+}
+
+// acquire takes or refreshes the lock on a todo for holder, failing with
+// the current lock if someone else holds it
+func (l *lockTable) acquire(todoID, holder string, ttl time.Duration, now time.Time) (store.EditLock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[todoID]
+	if ok && now.Before(lock.ExpiresAt) {
+		if lock.Holder != holder {
+			return lock, errLockHeld
+		}
+	} else {
+		lock = store.EditLock{Holder: holder, AcquiredAt: now}
+	}
+	lock.ExpiresAt = now.Add(ttl)
+	l.locks[todoID] = lock
+	return lock, nil
+}
+
+// release drops the lock on a todo if holder owns it or force is set
+func (l *lockTable) release(todoID, holder string, force bool, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[todoID]
+	if ok && now.Before(lock.ExpiresAt) && lock.Holder != holder && !force {
+		return errLockHeld
+	}
+	delete(l.locks, todoID)
+	return nil
+}
+
+// releaseHolder drops every lock holder has
+func (l *lockTable) releaseHolder(holder string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for todoID, lock := range l.locks {
+		if lock.Holder == holder {
+			delete(l.locks, todoID)
+		}
+	}
+}
+
+// current returns the unexpired lock on a todo, if any
+func (l *lockTable) current(todoID string, now time.Time) *store.EditLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[todoID]
+	if !ok {
+		return nil
+	}
+	if !now.Before(lock.ExpiresAt) {
+		delete(l.locks, todoID)
+		return nil
+	}
+	return &lock
+}
+
+// POST /todos/{id}/lock
+func (s *server) handleLockTodo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.store.Get(r.Context(), id); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	ttl := defaultLockTTL
+	if r.ContentLength != 0 {
+		req, err := decodeJSON[struct {
+			TTLSeconds int `json:"ttl_seconds"`
+		}](r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.TTLSeconds < 0 || time.Duration(req.TTLSeconds)*time.Second > maxLockTTL {
+			http.Error(w, "ttl_seconds must be between 1 and 900", http.StatusBadRequest)
+			return
+		}
+		if req.TTLSeconds > 0 {
+			ttl = time.Duration(req.TTLSeconds) * time.Second
+		}
+	}
+
+	lock, err := s.locks.acquire(id, actorFromRequest(r), ttl, time.Now())
+	status := http.StatusOK
+	if errors.Is(err, errLockHeld) {
+		status = http.StatusConflict
+	}
+	if err := respondJSON(w, status, lock); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /todos/{id}/lock
+func (s *server) handleUnlockTodo(w http.ResponseWriter, r *http.Request) {
+	force := r.URL.Query().Get("force") == "true"
+	if force && !s.isAdmin(r) {
+		http.Error(w, "only admins can break another user's lock", http.StatusForbidden)
+		return
+	}
+	if err := s.locks.release(r.PathValue("id"), actorFromRequest(r), force, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang-todo/internal/store"
+)
+
+// maxMergeLines bounds each side of a three-way merge; the line diff is
+// quadratic in the input
+const maxMergeLines = 2000
+
+// mergeConflict is a region that both sides changed differently. Line is
+// where its conflict markers start in the merged text, 1-based.
+type mergeConflict struct {
+	Line   int    `json:"line"`
+	Base   string `json:"base"`
+	Theirs string `json:"theirs"`
+	Mine   string `json:"mine"`
+}
+
+// mergeResult is a three-way merge. When it isn't clean, Merged holds
+// every conflict between markers as git writes them, so a client can show
+// the text for manual resolution.
+type mergeResult struct {
+	Clean     bool            `json:"clean"`
+	Merged    string          `json:"merged"`
+	Conflicts []mergeConflict `json:"conflicts"`
+}
+
+// splitLines splits text after each newline, so joining the lines gives
+// the text back exactly
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineMatches pairs up the lines of base and other along their longest
+// common subsequence: match[i] is the line of other equal to base line i,
+// or -1. Matched lines are in increasing order on both sides.
+func lineMatches(base, other []string) []int {
+	n, m := len(base), len(other)
+	// lcs[i][j] is the length of the LCS of base[i:] and other[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if base[i] == other[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	match := make([]int, n)
+	for i, j := 0, 0; i < n; {
+		switch {
+		case j < m && base[i] == other[j]:
+			match[i] = j
+			i, j = i+1, j+1
+		case j < m && lcs[i][j+1] >= lcs[i+1][j]:
+			j++
+		default:
+			match[i] = -1
+			i++
+		}
+	}
+	return match
+}
+
+// merge3 merges the changes theirs and mine each made to base, line by
+// line. Regions only one side changed take that side; regions both sides
+// changed the same way are taken once; anything else is a conflict.
+func merge3(base, theirs, mine string) mergeResult {
+	o, a, b := splitLines(base), splitLines(theirs), splitLines(mine)
+	matchA, matchB := lineMatches(o, a), lineMatches(o, b)
+
+	var merged []string
+	result := mergeResult{Clean: true, Conflicts: []mergeConflict{}}
+	emit := func(lines []string) { merged = append(merged, lines...) }
+	// io, ia and ib are positions in base, theirs and mine
+	io, ia, ib := 0, 0, 0
+	for io < len(o) || ia < len(a) || ib < len(b) {
+		// a line all three agree on is kept as is
+		if io < len(o) && matchA[io] == ia && matchB[io] == ib {
+			emit(o[io : io+1])
+			io, ia, ib = io+1, ia+1, ib+1
+			continue
+		}
+		// otherwise the chunk runs up to the next base line both sides kept
+		end := io
+		for end < len(o) && (matchA[end] < 0 || matchB[end] < 0) {
+			end++
+		}
+		endA, endB := len(a), len(b)
+		if end < len(o) {
+			endA, endB = matchA[end], matchB[end]
+		}
+		chunkO, chunkA, chunkB := o[io:end], a[ia:endA], b[ib:endB]
+		switch {
+		case slices.Equal(chunkA, chunkO):
+			emit(chunkB)
+		case slices.Equal(chunkB, chunkO), slices.Equal(chunkA, chunkB):
+			emit(chunkA)
+		default:
+			result.Clean = false
+			result.Conflicts = append(result.Conflicts, mergeConflict{
+				Line:   len(merged) + 1,
+				Base:   strings.Join(chunkO, ""),
+				Theirs: strings.Join(chunkA, ""),
+				Mine:   strings.Join(chunkB, ""),
+			})
+			emit([]string{"<<<<<<< theirs\n"})
+			emit(terminated(chunkA))
+			emit([]string{"||||||| base\n"})
+			emit(terminated(chunkO))
+			emit([]string{"=======\n"})
+			emit(terminated(chunkB))
+			emit([]string{">>>>>>> mine\n"})
+		}
+		io, ia, ib = end, endA, endB
+	}
+	result.Merged = strings.Join(merged, "")
+	return result
+}
+
+// terminated ends the last line with a newline, so a conflict marker after
+// it starts a line of its own
+func terminated(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	lines = slices.Clone(lines)
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// POST /todos/{id}/merge
+func (s *server) handleMergeDescription(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Base        *string `json:"base"`
+		BaseVersion int     `json:"base_version"`
+		Theirs      *string `json:"theirs"`
+		Mine        string  `json:"mine"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (req.Base == nil) == (req.BaseVersion == 0) {
+		http.Error(w, "exactly one of base or base_version is required", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// theirs defaults to the description as it is now
+	theirs := todo.Description
+	if req.Theirs != nil {
+		theirs = *req.Theirs
+	}
+	var base string
+	if req.Base != nil {
+		base = *req.Base
+	} else {
+		snapshot, _ := s.audit.revision(todo.ID, req.BaseVersion)
+		if snapshot == nil {
+			http.Error(w, fmt.Sprintf("todo has no version %d in its history; send base instead", req.BaseVersion), http.StatusNotFound)
+			return
+		}
+		base = snapshot.Description
+	}
+	for _, text := range []string{base, theirs, req.Mine} {
+		if strings.Count(text, "\n") >= maxMergeLines {
+			http.Error(w, fmt.Sprintf("texts longer than %d lines can't be merged", maxMergeLines), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	// the version lets the client save the result with If-Match
+	resp := struct {
+		mergeResult
+		Version int `json:"version"`
+	}{merge3(base, theirs, req.Mine), todo.Version}
+	w.Header().Set("ETag", todoETag(todo))
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		theirs    string
+		mine      string
+		merged    string
+		conflicts []mergeConflict
+	}{
+		{"only theirs changed", "a\nb\nc\n", "a\nB\nc\n", "a\nb\nc\n", "a\nB\nc\n", nil},
+		{"only mine changed", "a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\nd\n", "a\nb\nc\nd\n", nil},
+		{"different lines changed", "a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n", nil},
+		{"same change on both sides", "a\nb\nc\n", "a\nX\nc\n", "a\nX\nc\n", "a\nX\nc\n", nil},
+		{"line removed on one side", "a\nb\nc\n", "a\nc\n", "a\nb\nc\n", "a\nc\n", nil},
+		{"same line changed differently", "a\nb\nc\n", "a\nT\nc\n", "a\nM\nc\n",
+			"a\n<<<<<<< theirs\nT\n||||||| base\nb\n=======\nM\n>>>>>>> mine\nc\n",
+			[]mergeConflict{{Line: 2, Base: "b\n", Theirs: "T\n", Mine: "M\n"}}},
+		// as in git, changes to adjacent lines conflict
+		{"adjacent lines changed", "a\nb\nc\n", "a\nB\nc\n", "a\nb\nC\n",
+			"a\n<<<<<<< theirs\nB\nc\n||||||| base\nb\nc\n=======\nb\nC\n>>>>>>> mine\n",
+			[]mergeConflict{{Line: 2, Base: "b\nc\n", Theirs: "B\nc\n", Mine: "b\nC\n"}}},
+		{"removed on one side, changed on the other", "a\nb\n", "a\n", "a\nB\n",
+			"a\n<<<<<<< theirs\n||||||| base\nb\n=======\nB\n>>>>>>> mine\n",
+			[]mergeConflict{{Line: 2, Base: "b\n", Mine: "B\n"}}},
+		{"both added to an empty base", "", "x\n", "y\n",
+			"<<<<<<< theirs\nx\n||||||| base\n=======\ny\n>>>>>>> mine\n",
+			[]mergeConflict{{Line: 1, Theirs: "x\n", Mine: "y\n"}}},
+		{"no trailing newlines", "a", "b", "c",
+			"<<<<<<< theirs\nb\n||||||| base\na\n=======\nc\n>>>>>>> mine\n",
+			[]mergeConflict{{Line: 1, Base: "a", Theirs: "b", Mine: "c"}}},
+		{"two conflicts", "1\n2\n3\n", "x\n2\ny\n", "p\n2\nq\n",
+			"<<<<<<< theirs\nx\n||||||| base\n1\n=======\np\n>>>>>>> mine\n2\n<<<<<<< theirs\ny\n||||||| base\n3\n=======\nq\n>>>>>>> mine\n",
+			[]mergeConflict{{Line: 1, Base: "1\n", Theirs: "x\n", Mine: "p\n"}, {Line: 9, Base: "3\n", Theirs: "y\n", Mine: "q\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := merge3(tt.base, tt.theirs, tt.mine)
+			if got.Merged != tt.merged {
+				t.Errorf("merged = %q, want %q", got.Merged, tt.merged)
+			}
+			if got.Clean != (len(tt.conflicts) == 0) || !slices.Equal(got.Conflicts, tt.conflicts) {
+				t.Errorf("clean = %v, conflicts = %+v; want %+v", got.Clean, got.Conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeDescription(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	todo := createTodo(t, h, `{"title":"a","description":"a\nb\nc\nd\n"}`)
+	if w := serve(h, "PATCH", "/todos/"+todo.ID, `{"description":"a\nT\nc\nd\n"}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+
+	// theirs is the description as it is now, base the version mine
+	// started from
+	w := serve(h, "POST", "/todos/"+todo.ID+"/merge", `{"base_version":1,"mine":"a\nb\nc\nD\n"}`)
+	var got struct {
+		mergeResult
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("merge: %d %s", w.Code, w.Body)
+	}
+	if !got.Clean || got.Merged != "a\nT\nc\nD\n" || got.Version != 2 || w.Header().Get("ETag") == "" {
+		t.Errorf("merge = %+v with ETag %q, want a clean a T c D at version 2", got, w.Header().Get("ETag"))
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"base and base_version", `{"base":"a\n","base_version":1,"mine":""}`, http.StatusBadRequest},
+		{"neither base nor base_version", `{"mine":""}`, http.StatusBadRequest},
+		{"unknown version", `{"base_version":99,"mine":""}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h, "POST", "/todos/"+todo.ID+"/merge", tt.body); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on a todo's metadata, to keep it to references and labels
+// rather than a document store
+const (
+	maxMetadataKeys   = 50
+	maxMetadataString = 1000
+)
+
+// metadataKeyPattern allows keys that can be written unquoted in queries
+// and query parameters, as in meta.jira:PROJ-123
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateMetadata checks a todo's custom fields: values are strings,
+// numbers or booleans, so they can be filtered on
+func validateMetadata(metadata map[string]any) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("metadata has %d keys; at most %d are allowed", len(metadata), maxMetadataKeys)
+	}
+	for key, value := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q; use up to 64 letters, digits, _ and -", key)
+		}
+		switch v := value.(type) {
+		case string:
+			if len(v) > maxMetadataString {
+				return fmt.Errorf("metadata %s is longer than %d bytes", key, maxMetadataString)
+			}
+		case float64, bool:
+		default:
+			return fmt.Errorf("metadata %s must be a string, number or boolean", key)
+		}
+	}
+	return nil
+}
+
+// mergeMetadata applies a patch to metadata as a JSON merge patch does:
+// keys set to null are removed and all others are set
+func mergeMetadata(metadata, patch map[string]any) map[string]any {
+	merged := maps.Clone(metadata)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// metadataString is how a metadata value compares against query values
+func metadataString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// compareMetadata compares a metadata value with a query value, as numbers
+// when both are numeric and as strings otherwise
+func compareMetadata(value any, want string) int {
+	if n, ok := value.(float64); ok {
+		if w, err := strconv.ParseFloat(want, 64); err == nil {
+			switch {
+			case n < w:
+				return -1
+			case n > w:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(metadataString(value), want)
+}
+
+// metadataParams turns meta.KEY=VALUE query parameters into query terms,
+// so GET /todos?meta.jira=PROJ-123 filters like query=meta.jira:PROJ-123
+func metadataParams(params url.Values, workflow *Workflow) ([]todoPredicate, error) {
+	var preds []todoPredicate
+	for name, values := range params {
+		if !strings.HasPrefix(name, "meta.") {
+			continue
+		}
+		for _, value := range values {
+			pred, err := compileTerm(queryToken{field: strings.ToLower(name), op: "=", value: value}, workflow, time.Now())
+			if err != nil {
+				return nil, &queryError{Msg: fmt.Sprintf("%s parameter: %s", name, err)}
+			}
+			preds = append(preds, pred)
+		}
+	}
+	return preds, nil
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-todo/internal/metrics"
+)
+
+var (
+	httpRequestsTotal = metrics.Default.NewCounterVec("todo_http_requests_total",
+		"Total HTTP requests handled, by route and status code.", "route", "code")
+	httpRequestDuration = metrics.Default.NewHistogramVec("todo_http_request_duration_seconds",
+		"HTTP request latency in seconds, by route.", []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}, "route")
+	latencyBudgetExceededTotal = metrics.Default.NewCounterVec("todo_latency_budget_exceeded_total",
+		"Requests cancelled because they exceeded their route's latency budget.", "route")
+)
+
+// LatencyBudgets maps a route pattern such as "GET /todos" to the longest
+// time a request on it may take; the "*" key applies to all other routes
+type LatencyBudgets map[string]time.Duration
+
+// ParseLatencyBudgets parses "PATTERN=DURATION" pairs separated by commas,
+// e.g. "GET /todos=200ms,*=2s"
+func ParseLatencyBudgets(spec string) (LatencyBudgets, error) {
+	budgets := LatencyBudgets{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid latency budget %q: want PATTERN=DURATION", pair)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid latency budget duration %q for %q", value, pattern)
+		}
+		budgets[strings.TrimSpace(pattern)] = d
+	}
+	return budgets, nil
+}
+
+// streamingRoutes send responses too large to hold back in memory, which
+// a latency budget would do; they only get a budget when one is set for
+// the route itself rather than through "*"
+var streamingRoutes = map[string]bool{
+	"GET /todos/stream":                           true,
+	"GET /todos/{id}/attachments.zip":             true,
+	"GET /todos/{id}/attachments/{attachment_id}": true,
+	"GET /projects/{id}/attachments.zip":          true,
+}
+
+// streamsResponse reports whether a request on a route that isn't among
+// streamingRoutes streams its response all the same, as GET /todos does
+// when asked for NDJSON. Those requests are treated like streaming ones.
+func streamsResponse(pattern string, r *http.Request) bool {
+	return pattern == "GET /todos" && negotiate(r, "application/json", "text/plain", ndjsonType) == ndjsonType
+}
+
+// longRunningRoutes move whole datasets or wait for news on purpose, so
+// the default read and write timeouts don't apply to them
+var longRunningRoutes = map[string]bool{
+	"GET /events":                  true,
+	"GET /export":                  true,
+	"POST /import":                 true,
+	"POST /todos/{id}/attachments": true,
+	"POST /admin/backup":           true,
+	"POST /admin/restore":          true,
+	"POST /admin/seed":             true,
+	"POST /admin/imports/{id}/run": true,
+}
+
+// forRoute returns the budget for a route pattern, if any
+func (b LatencyBudgets) forRoute(pattern string) (time.Duration, bool) {
+	if d, ok := b[pattern]; ok {
+		return d, true
+	}
+	if streamingRoutes[pattern] {
+		return 0, false
+	}
+	d, ok := b["*"]
+	return d, ok
+}
+
+// routeTimeout returns how long a request on a route may take: its latency
+// budget, else the default timeout for reads (GET and HEAD) or writes
+func (s *server) routeTimeout(pattern string) (time.Duration, bool) {
+	if d, ok := s.budgets.forRoute(pattern); ok || streamingRoutes[pattern] || longRunningRoutes[pattern] {
+		return d, ok
+	}
+	timeout := s.writeTimeout
+	if method, _, _ := strings.Cut(pattern, " "); method == http.MethodGet || method == http.MethodHead {
+		timeout = s.readTimeout
+	}
+	return timeout, timeout > 0
+}
+
+// handle registers h on the mux wrapped with the server's middleware chain
+func (s *server) handle(mux *http.ServeMux, pattern string, h http.HandlerFunc) {
+	var handler http.Handler = s.scopeProjectTokens(pattern, s.authenticateUsers(pattern, s.watchDeprecations(pattern, s.watchCanaries(pattern, h))))
+	if budget, ok := s.routeTimeout(pattern); ok {
+		unbudgeted, budgeted := handler, withLatencyBudget(pattern, budget, handler)
+		_, own := s.budgets[pattern]
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !own && streamsResponse(pattern, r) {
+				unbudgeted.ServeHTTP(w, r)
+				return
+			}
+			budgeted.ServeHTTP(w, r)
+		})
+	}
+	handler = s.withKillSwitch(pattern, handler)
+	if limit := s.bodyLimit(pattern); limit > 0 {
+		handler = withBodyLimit(limit, handler)
+	}
+	mux.Handle(pattern, instrument(pattern, withCompression(handler)))
+}
+
+// bodyLimit returns the largest request body a route accepts. Imports and
+// restores carry whole datasets. Attachment uploads may carry files up to
+// the attachment limit, together, plus what any other request may for the
+// form around them; each file is also checked against the limit while
+// streaming.
+func (s *server) bodyLimit(pattern string) int64 {
+	switch pattern {
+	case "POST /todos/{id}/attachments":
+		return s.attachments.maxSize + s.maxBodySize
+	case "POST /import", "POST /admin/restore":
+		return s.maxImportSize
+	}
+	return s.maxBodySize
+}
+
+// withBodyLimit rejects request bodies over limit bytes: up front when the
+// Content-Length says so, otherwise by failing reads past the limit
+func withBodyLimit(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("request body is larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes on to streaming handlers' connections
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// instrument records request counts and latencies for a route
+func instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		httpRequestDuration.Observe(time.Since(start).Seconds(), route)
+		httpRequestsTotal.Inc(route, strconv.Itoa(rec.status))
+	})
+}
+
+// withLatencyBudget cancels the request context once the budget is spent and
+// answers 504 with a problem+json body. The handler writes into a buffer so
+// a late response can be discarded instead of racing the timeout reply.
+func withLatencyBudget(route string, budget time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+
+		bw := &budgetWriter{header: http.Header{}}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(bw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			// a handler that returned because its deadline just passed has
+			// timed out all the same
+			if ctx.Err() != context.DeadlineExceeded {
+				bw.mu.Lock()
+				defer bw.mu.Unlock()
+				for k, v := range bw.header {
+					w.Header()[k] = v
+				}
+				if bw.status == 0 {
+					bw.status = http.StatusOK
+				}
+				w.WriteHeader(bw.status)
+				w.Write(bw.buf.Bytes())
+				return
+			}
+		case <-ctx.Done():
+		}
+		bw.mu.Lock()
+		defer bw.mu.Unlock()
+		bw.timedOut = true
+		if ctx.Err() == context.DeadlineExceeded {
+			latencyBudgetExceededTotal.Inc(route)
+			respondProblem(w, http.StatusGatewayTimeout, "Latency budget exceeded",
+				fmt.Sprintf("%s did not complete within its %s budget", route, budget))
+		}
+	})
+}
+
+// budgetWriter buffers a handler's response until it finishes in time
+type budgetWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (bw *budgetWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *budgetWriter) Write(b []byte) (int, error) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	if bw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.buf.Write(b)
+}
+
+func (bw *budgetWriter) WriteHeader(status int) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	if bw.timedOut || bw.status != 0 {
+		return
+	}
+	bw.status = status
+}
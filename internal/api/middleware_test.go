@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStreamingSkipsDefaultTimeout(t *testing.T) {
+	h := newTestHandler(t, Options{ReadTimeout: time.Nanosecond})
+	if w := serve(h, "POST", "/todos", `{"title":"a"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+
+	// buffered responses run out of time at once
+	if w := serve(h, "GET", "/todos", ""); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("JSON list: status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+	// streamed ones aren't held to the default timeout
+	w := serve(h, "GET", "/todos", "", "Accept", ndjsonType)
+	if w.Code != http.StatusOK {
+		t.Errorf("NDJSON list: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	s := &server{readTimeout: 2 * time.Second, writeTimeout: 5 * time.Second, budgets: LatencyBudgets{}}
+	tests := []struct {
+		pattern string
+		want    time.Duration
+		ok      bool
+	}{
+		{"GET /todos", 2 * time.Second, true},
+		{"POST /todos", 5 * time.Second, true},
+		{"GET /todos/{id}/attachments/{attachment_id}", 0, false},
+		{"POST /todos/{id}/attachments", 0, false},
+		{"GET /events", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := s.routeTimeout(tt.pattern)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("routeTimeout(%q) = %v, %v; want %v, %v", tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/metrics"
+	"golang-todo/internal/secrets"
+)
+
+var notificationsTotal = metrics.Default.NewCounterVec("todo_notifications_total",
+	"Notifications by delivery channel and outcome.", "channel", "status")
+
+// maxDeliveries is how many deliveries the delivery log keeps
+const maxDeliveries = 1000
+
+// Notification channels
+const (
+	channelEmail = "email"
+	channelSlack = "slack"
+)
+
+// SMTPConfig is the mail server email notifications are sent through
+type SMTPConfig struct {
+	// Addr is host:port; email notifications are off when it is empty
+	Addr     string
+	From     string
+	Username string
+	Password *secrets.Setting
+}
+
+// notification is a message for one user, independent of the channel
+type notification struct {
+	TodoID  string
+	Subject string
+	Text    string
+}
+
+// notifier delivers notifications over one channel to a recipient, which
+// is an email address or a Slack webhook URL
+type notifier interface {
+	send(ctx context.Context, recipient string, n notification) error
+}
+
+// emailNotifier sends plain-text mail through an SMTP server
+type emailNotifier struct {
+	config SMTPConfig
+}
+
+func (e *emailNotifier) send(ctx context.Context, recipient string, n notification) error {
+	var auth smtp.Auth
+	if e.config.Username != "" {
+		host, _, _ := strings.Cut(e.config.Addr, ":")
+		auth = smtp.PlainAuth("", e.config.Username, e.config.Password.Get(), host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", e.config.From, recipient, headerSafe(n.Subject), time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text, "\n", "\r\n"))
+	return smtp.SendMail(e.config.Addr, auth, e.config.From, []string{recipient}, msg.Bytes())
+}
+
+// headerSafe keeps user text from adding mail headers
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// slackNotifier posts to Slack incoming webhooks, or anything accepting
+// the same {"text": ...} payload
+type slackNotifier struct {
+	client *http.Client
+}
+
+func (n *slackNotifier) send(ctx context.Context, recipient string, msg notification) error {
+	body, err := json.Marshal(map[string]string{"text": "*" + msg.Subject + "*\n" + msg.Text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, recipient, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// NotificationPrefs are how a user wants to be notified. Users who never
+// set any get email at their user address, when email is configured.
+type NotificationPrefs struct {
+	// Channels lists email and/or slack; empty turns notifications off
+	Channels []string `json:"channels"`
+	// Email overrides the address from the user's profile
+	Email           string    `json:"email,omitempty"`
+	SlackWebhookURL string    `json:"slack_webhook_url,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Delivery records one attempt to notify a user
+type Delivery struct {
+	ID      string    `json:"id"`
+	TodoID  string    `json:"todo_id"`
+	UserID  string    `json:"user_id"`
+	Channel string    `json:"channel"`
+	Subject string    `json:"subject"`
+	Status  string    `json:"status"` // sent or failed
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// notificationCenter holds notification preferences and the delivery log,
+// and sends notifications over the configured channels
+type notificationCenter struct {
+	mu         sync.RWMutex
+	prefs      map[string]NotificationPrefs
+	deliveries []Delivery
+	channels   map[string]notifier
+}
+
+func newNotificationCenter(smtpConfig SMTPConfig) *notificationCenter {
+	n := &notificationCenter{
+		prefs: map[string]NotificationPrefs{},
+		channels: map[string]notifier{
+			channelSlack: &slackNotifier{client: &http.Client{Timeout: 10 * time.Second}},
+		},
+	}
+	if smtpConfig.Addr != "" {
+		if smtpConfig.Password == nil {
+			smtpConfig.Password = &secrets.Setting{}
+		}
+		n.channels[channelEmail] = &emailNotifier{config: smtpConfig}
+	}
+	return n
+}
+
+func (n *notificationCenter) preferences(userID string) (NotificationPrefs, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	prefs, ok := n.prefs[userID]
+	return prefs, ok
+}
+
+func (n *notificationCenter) setPreferences(userID string, prefs NotificationPrefs) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.prefs[userID] = prefs
+}
+
+// allPreferences returns the preferences of every user who set any
+func (n *notificationCenter) allPreferences() map[string]NotificationPrefs {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return maps.Clone(n.prefs)
+}
+
+// replacePreferences swaps in a whole new set of preferences, as loading a
+// state file does
+func (n *notificationCenter) replacePreferences(prefs map[string]NotificationPrefs) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.prefs = maps.Clone(prefs)
+	if n.prefs == nil {
+		n.prefs = map[string]NotificationPrefs{}
+	}
+}
+
+// validate checks preferences against the channels this server has
+func (n *notificationCenter) validate(prefs NotificationPrefs) error {
+	for _, channel := range prefs.Channels {
+		switch channel {
+		case channelEmail:
+			if n.channels[channelEmail] == nil {
+				return errors.New("email notifications aren't configured on this server")
+			}
+		case channelSlack:
+			u, err := url.Parse(prefs.SlackWebhookURL)
+			if err != nil || u.Scheme != "https" || u.Host == "" {
+				return errors.New("the slack channel needs an https slack_webhook_url")
+			}
+		default:
+			return fmt.Errorf("unknown channel %q; want email or slack", channel)
+		}
+	}
+	if prefs.Email != "" && !strings.Contains(prefs.Email, "@") {
+		return fmt.Errorf("invalid email %q", prefs.Email)
+	}
+	return nil
+}
+
+// notify sends n to user over each of their channels and logs every
+// attempt
+func (n *notificationCenter) notify(ctx context.Context, user User, msg notification) {
+	prefs, ok := n.preferences(user.ID)
+	if !ok {
+		prefs = NotificationPrefs{Channels: []string{channelEmail}}
+	}
+	for _, channel := range prefs.Channels {
+		sender := n.channels[channel]
+		recipient := prefs.SlackWebhookURL
+		if channel == channelEmail {
+			recipient = cmp.Or(prefs.Email, user.Email)
+		}
+		if sender == nil || recipient == "" {
+			continue
+		}
+		delivery := Delivery{
+			ID:      uuid.New().String(),
+			TodoID:  msg.TodoID,
+			UserID:  user.ID,
+			Channel: channel,
+			Subject: msg.Subject,
+			Status:  "sent",
+			At:      time.Now(),
+		}
+		if err := sender.send(ctx, recipient, msg); err != nil {
+			delivery.Status, delivery.Error = "failed", err.Error()
+		}
+		notificationsTotal.Inc(channel, delivery.Status)
+		n.logDelivery(delivery)
+	}
+}
+
+func (n *notificationCenter) logDelivery(d Delivery) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries = append(n.deliveries, d)
+	if len(n.deliveries) > maxDeliveries {
+		n.deliveries = slices.Delete(n.deliveries, 0, len(n.deliveries)-maxDeliveries)
+	}
+}
+
+// listDeliveries returns the logged deliveries matching the filters, newest
+// first; empty filters match everything
+func (n *notificationCenter) listDeliveries(userID, todoID string) []Delivery {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	matches := []Delivery{}
+	for i := len(n.deliveries) - 1; i >= 0; i-- {
+		d := n.deliveries[i]
+		if (userID == "" || d.UserID == userID) && (todoID == "" || d.TodoID == todoID) {
+			matches = append(matches, d)
+		}
+	}
+	return matches
+}
+
+// canManageUser reports whether the request may see or change user id's
+// settings: the user themselves or an admin
+func (s *server) canManageUser(r *http.Request, id string) bool {
+	return actorFromRequest(r) == id || s.isAdmin(r)
+}
+
+// GET /users/{id}/notifications
+func (s *server) handleGetNotificationPrefs(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.canManageUser(r, id) {
+		http.Error(w, "only the user or an admin may see notification settings", http.StatusForbidden)
+		return
+	}
+	user, ok := s.users.get(id)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	prefs, ok := s.notifications.preferences(user.ID)
+	if !ok {
+		prefs = NotificationPrefs{Channels: []string{}}
+		if s.notifications.channels[channelEmail] != nil && user.Email != "" {
+			prefs.Channels = []string{channelEmail}
+		}
+	}
+	if err := respondJSON(w, http.StatusOK, prefs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PUT /users/{id}/notifications
+func (s *server) handleSetNotificationPrefs(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.canManageUser(r, id) {
+		http.Error(w, "only the user or an admin may change notification settings", http.StatusForbidden)
+		return
+	}
+	if _, ok := s.users.get(id); !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	prefs, err := decodeJSON[NotificationPrefs](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if prefs.Channels == nil {
+		prefs.Channels = []string{}
+	}
+	slices.Sort(prefs.Channels)
+	prefs.Channels = slices.Compact(prefs.Channels)
+	if err := s.notifications.validate(prefs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefs.UpdatedAt = time.Now()
+	s.notifications.setPreferences(id, prefs)
+	if err := respondJSON(w, http.StatusOK, prefs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/notifications/deliveries
+func (s *server) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	deliveries := s.notifications.listDeliveries(query.Get("user"), query.Get("todo"))
+	if err := respondJSON(w, http.StatusOK, deliveries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+// Options configures a server built by New. Every field is optional: zero
+// values select the defaults the server binary uses, or leave the feature
+// they configure off.
+type Options struct {
+	// Store keeps the todos; an in-memory store is used by default
+	Store store.Store
+	// StateFile keeps what the server holds besides the todos across
+	// restarts: projects, users, comments, time entries, attachments,
+	// keys, tokens, service accounts, webhooks, the audit log, import
+	// mappings and schedules, notification preferences, reviews, touches
+	// and event consumers. Locks, presence, undo history, the event log,
+	// jobs, delivery logs and kill switches start afresh. It is saved every
+	// StateFlush and on shutdown; without it all of that lives in memory
+	// only.
+	StateFile  string
+	StateFlush time.Duration
+	// Cold is the cold storage tier completed todos move to after
+	// ColdAfter, checked every TierInterval
+	Cold         store.ColdStore
+	ColdAfter    time.Duration
+	TierInterval time.Duration
+	// Blobs keeps attachment contents and the daily stats snapshots, in
+	// the attachments directory by default
+	Blobs store.BlobStore
+	// AttachmentMaxSize caps each uploaded file, and the files of one
+	// upload together
+	AttachmentMaxSize int64
+	// Publisher receives every event relayed from the store's outbox
+	Publisher EventPublisher
+	// Backups receives a backup every BackupSchedule
+	Backups        store.BlobStore
+	BackupSchedule time.Duration
+
+	AdminToken     *secrets.Setting
+	CalendarSecret *secrets.Setting
+	// Secrets, if set, gets hooks re-reading rotated secrets on reload
+	Secrets *secrets.Settings
+
+	// HAURL is a Home Assistant instance to push sensor states to
+	HAURL     string
+	HAToken   *secrets.Setting
+	HADueSoon time.Duration
+
+	// SMTP sends email notifications, such as reminders; Slack
+	// notifications need no server-side configuration
+	SMTP SMTPConfig
+
+	Workflow *Workflow
+	// TitleLinter, if set, suggests fixes to titles in TitleStyles, or in
+	// no particular style by default
+	TitleLinter TitleLinter
+	TitleStyles *TitleStyles
+	// Fixtures are applied before New returns
+	Fixtures *FixtureFile
+	// Location is the timezone of users without a preference; UTC by
+	// default
+	Location *time.Location
+	// WarmUp names the subsystems, search and cache, that warm up in the
+	// background after New returns; the readiness probe fails until they
+	// have. Without it the search index is built before New returns.
+	WarmUp []string
+
+	Budgets         LatencyBudgets
+	PageLimits      PageLimits
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	SLO             SLOConfig
+	UndoWindow      time.Duration
+	EventRetention  time.Duration
+	EventLogSize    int
+	SyncRetention   time.Duration
+	ArchiveAfter    time.Duration
+	ArchiveInterval time.Duration
+	MaxBodySize     int64
+	MaxImportSize   int64
+	WebhookWorkers  int
+}
+
+// setDefaults fills in the fields left at their zero value
+func (o *Options) setDefaults() error {
+	defaultDuration := func(d *time.Duration, v time.Duration) {
+		if *d == 0 {
+			*d = v
+		}
+	}
+	if o.Workflow == nil {
+		o.Workflow = defaultWorkflow()
+	}
+	defaultDuration(&o.ColdAfter, 90*24*time.Hour)
+	defaultDuration(&o.TierInterval, time.Hour)
+	defaultDuration(&o.HADueSoon, 24*time.Hour)
+	defaultDuration(&o.StateFlush, 5*time.Second)
+	defaultDuration(&o.UndoWindow, 5*time.Minute)
+	defaultDuration(&o.ReadTimeout, 2*time.Second)
+	defaultDuration(&o.WriteTimeout, 5*time.Second)
+	defaultDuration(&o.EventRetention, 24*time.Hour)
+	defaultDuration(&o.SyncRetention, 30*24*time.Hour)
+	defaultDuration(&o.ArchiveInterval, time.Hour)
+	defaultDuration(&o.SLO.Latency, time.Second)
+	defaultDuration(&o.SLO.Window, 5*time.Minute)
+	if err := checkWarmUp(o.WarmUp); err != nil {
+		return err
+	}
+	if o.TitleStyles == nil {
+		o.TitleStyles = &TitleStyles{}
+	}
+	if o.Store == nil {
+		o.Store = store.NewMemoryStore()
+	}
+	if o.Blobs == nil {
+		blobs, err := store.NewBlobStore("disk", "attachments", "")
+		if err != nil {
+			return err
+		}
+		o.Blobs = blobs
+	}
+	for _, setting := range []**secrets.Setting{&o.AdminToken, &o.CalendarSecret, &o.HAToken} {
+		if *setting == nil {
+			*setting = &secrets.Setting{}
+		}
+	}
+	if o.AttachmentMaxSize == 0 {
+		o.AttachmentMaxSize = 25 << 20
+	}
+	if o.EventLogSize == 0 {
+		o.EventLogSize = 100000
+	}
+	if o.MaxBodySize == 0 {
+		o.MaxBodySize = 1 << 20
+	}
+	if o.MaxImportSize == 0 {
+		o.MaxImportSize = 64 << 20
+	}
+	if o.WebhookWorkers == 0 {
+		o.WebhookWorkers = 4
+	}
+	if o.SLO.Availability == 0 {
+		o.SLO.Availability = 0.99
+	}
+	if o.SLO.TripBurnRate == 0 {
+		o.SLO.TripBurnRate = 10
+	}
+	if o.SLO.MinRequests == 0 {
+		o.SLO.MinRequests = 20
+	}
+	return o.SLO.validate()
+}
+
+// Server is the todo API built by New
+type Server struct {
+	http.Handler
+	srv *server
+}
+
+// Wait blocks until the background jobs that write on the way out, such
+// as the final save of StateFile, are done after New's ctx is cancelled
+func (s *Server) Wait() {
+	s.srv.stopping.Wait()
+}
+
+// New builds the todo API described by opts and starts its background
+// jobs, which run until ctx is cancelled
+func New(ctx context.Context, opts Options) (*Server, error) {
+	srv, err := newServer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Handler: srv.routes(), srv: srv}, nil
+}
+
+// newServer builds the server behind New and starts its background jobs
+func newServer(ctx context.Context, opts Options) (*server, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	// every write goes through the change tracker, so sync sees them all
+	changes := store.NewChangeTracker(opts.Store, opts.SyncRetention)
+	srv := &server{
+		store:          changes,
+		changes:        changes,
+		cold:           opts.Cold,
+		publisher:      opts.Publisher,
+		webhooks:       newWebhookDispatcher(opts.WebhookWorkers),
+		budgets:        opts.Budgets,
+		readTimeout:    opts.ReadTimeout,
+		writeTimeout:   opts.WriteTimeout,
+		haDueSoon:      opts.HADueSoon,
+		audit:          &auditLog{},
+		undo:           &undoLog{window: opts.UndoWindow},
+		events:         newEventLog(opts.EventRetention, opts.EventLogSize),
+		search:         newSearchIndex(),
+		attachments:    newAttachmentRegistry(opts.Blobs, opts.AttachmentMaxSize),
+		projects:       &projectRegistry{},
+		presence:       newPresenceTracker(),
+		locks:          newLockTable(),
+		comments:       newCommentRegistry(),
+		timeEntries:    newTimeRegistry(),
+		reviews:        &reviewRegistry{},
+		touches:        newTouchRegistry(),
+		users:          &userRegistry{},
+		anomalies:      newAnomalyDetector(),
+		canaries:       &canaryRegistry{},
+		deprecations:   newDeprecationTracker(),
+		killSwitches:   newKillSwitches(opts.SLO),
+		notifications:  newNotificationCenter(opts.SMTP),
+		reminders:      &reminderScheduler{},
+		titleLinter:    opts.TitleLinter,
+		titleStyles:    opts.TitleStyles,
+		projectTokens:  &projectTokenRegistry{},
+		importMappings: &importMappingRegistry{},
+		apiKeys:        &apiKeyRegistry{},
+		imports:        &importScheduler{client: &http.Client{Timeout: importFetchTimeout}},
+		jobs:           &jobRegistry{},
+		services:       &serviceAccountRegistry{},
+		snapshots:      newSnapshotStore(opts.Blobs),
+		adminToken:     opts.AdminToken,
+		location:       opts.Location,
+		maxBodySize:    opts.MaxBodySize,
+		maxImportSize:  opts.MaxImportSize,
+		pageLimits:     opts.PageLimits,
+		workflow:       opts.Workflow,
+	}
+	if srv.location == nil {
+		srv.location = time.UTC
+	}
+	srv.webhooks.paused = func() bool { return !srv.killSwitches.enabled(featureWebhooks) }
+	go srv.killSwitches.run(ctx, 10*time.Second)
+	srv.listeners = append(srv.listeners, srv.audit.record, srv.search.observe, srv.events.append, srv.anomalies.observeEvent, srv.touches.observe, srv.cascadeTodoDeleted)
+	if !slices.Contains(opts.WarmUp, warmSearch) {
+		todos, err := srv.store.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		srv.search.rebuild(todos)
+	}
+	if err := srv.warmUp(ctx, opts.WarmUp); err != nil {
+		return nil, err
+	}
+	if err := srv.snapshots.load(ctx); err != nil {
+		return nil, err
+	}
+	if opts.StateFile != "" {
+		if err := srv.loadState(ctx, opts.StateFile); err != nil {
+			return nil, err
+		}
+		srv.stopping.Add(1)
+		go func() {
+			defer srv.stopping.Done()
+			srv.runStateSaver(ctx, opts.StateFile, opts.StateFlush)
+		}()
+	}
+
+	// Apply fixtures before serving so the environment is ready on start
+	if opts.Fixtures != nil {
+		report, err := srv.applyFixtures(ctx, *opts.Fixtures)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Applied fixtures: %d created, %d updated, %d unchanged", report.Created, report.Updated, report.Unchanged)
+	}
+
+	// Calendar feed tokens only survive restarts with a configured secret.
+	// It may list several keys, newest first, to rotate across restarts.
+	calendarSecret := opts.CalendarSecret
+	calendarKeys := newKeyRing(30 * 24 * time.Hour)
+	srv.calendar.keys = calendarKeys
+	srv.keyRings = map[string]*keyRing{"calendar": calendarKeys}
+	if calendarSecret.Get() != "" {
+		calendarKeys.sync(splitKeys(calendarSecret.Get()), time.Now())
+	} else {
+		if _, err := calendarKeys.rotate(0, time.Now()); err != nil {
+			return nil, err
+		}
+		log.Print("no calendar secret is configured; calendar feed URLs will stop working after a restart")
+	}
+	if opts.Secrets != nil {
+		opts.Secrets.OnReload = append(opts.Secrets.OnReload, srv.webhooks.rotateSecrets, func(ctx context.Context) {
+			if calendarSecret.Get() != "" {
+				calendarKeys.sync(splitKeys(calendarSecret.Get()), time.Now())
+			}
+		})
+	}
+
+	// Send reminders as they come due
+	go srv.runReminders(ctx, 30*time.Second)
+	go srv.runImportSchedules(ctx, 15*time.Second)
+
+	// Delete attachment contents no attachment refers to any more
+	go srv.attachments.runGC(ctx, time.Minute)
+
+	// Purge what deleted todos leave behind once they can't be undone
+	go srv.runPurger(ctx, time.Minute)
+
+	// Keep today's stats snapshot current, for GET /stats/trends
+	go srv.runStatsSnapshots(ctx, time.Hour)
+
+	// Start the auto-archiving job when a retention period is configured
+	if opts.ArchiveAfter > 0 {
+		go srv.runArchiver(ctx, opts.ArchiveAfter, opts.ArchiveInterval)
+	}
+
+	// Start the cold tiering job when a cold tier is configured
+	if opts.Cold != nil {
+		t := &store.Tierer{Hot: srv.store, Cold: opts.Cold, After: opts.ColdAfter}
+		go t.Run(ctx, opts.TierInterval)
+	}
+
+	// Relay outbox events to the broker when one is configured
+	if opts.Publisher != nil {
+		relay := &eventRelay{outbox: srv.store, publisher: opts.Publisher, batchSize: 100}
+		go relay.run(ctx, 500*time.Millisecond)
+	}
+
+	// Write periodic backups when a schedule is configured
+	if opts.Backups != nil && opts.BackupSchedule > 0 {
+		go srv.runBackups(ctx, opts.Backups, opts.BackupSchedule)
+	}
+
+	// Push sensor states to Home Assistant when an instance is configured
+	if opts.HAURL != "" {
+		pusher := newHAPusher(srv, opts.HAURL, opts.HAToken)
+		srv.listeners = append(srv.listeners, pusher.notify)
+		go pusher.run(ctx, 5*time.Minute)
+	}
+
+	return srv, nil
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// positionGap spaces out assigned positions so most moves only touch the
+// moved todo; a list is renumbered once a gap runs out
+const positionGap = 1024
+
+// comparePositions orders todos manually: positioned todos first by
+// position, then any never moved in their existing order
+func comparePositions(a, b store.Todo) int {
+	switch {
+	case a.Position == 0 && b.Position == 0:
+		return 0
+	case a.Position == 0:
+		return 1
+	case b.Position == 0:
+		return -1
+	}
+	return cmp.Compare(a.Position, b.Position)
+}
+
+// sortByPosition sorts todos into their manual order
+func sortByPosition(todos []store.Todo) {
+	slices.SortStableFunc(todos, comparePositions)
+}
+
+// moveRequest places a todo before or after another todo in the same list,
+// or at an index within it. Lists are the todos of one project, or those
+// without a project.
+type moveRequest struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+	Index  *int   `json:"index,omitempty"`
+}
+
+// moveTodo repositions a todo within its list and returns the todos whose
+// position changed, the moved one first, along with their events. A move
+// the request can't make comes with the status to refuse it with.
+func moveTodo(ctx context.Context, tx store.Tx, id string, req moveRequest, actor string, now time.Time) ([]store.Todo, []store.Event, int, error) {
+	todo, err := tx.Get(ctx, id)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	todos, err := tx.List(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	list := slices.DeleteFunc(todos, func(t store.Todo) bool { return t.ProjectID != todo.ProjectID || t.ID == id })
+	sortByPosition(list)
+
+	// work out where the todo goes in the list without it
+	index := len(list)
+	if ref := req.Before + req.After; ref != "" {
+		if ref == id {
+			return nil, nil, http.StatusBadRequest, errors.New("a todo can't be moved relative to itself")
+		}
+		index = slices.IndexFunc(list, func(t store.Todo) bool { return t.ID == ref })
+		if index < 0 {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("todo %q is not in the same list", ref)
+		}
+		if req.After != "" {
+			index++
+		}
+	} else if req.Index != nil {
+		index = min(max(*req.Index, 0), len(list))
+	}
+
+	// take the midpoint of the neighbours when there's room, otherwise
+	// renumber the whole list
+	lo, hi := int64(0), int64(0)
+	roomy := true
+	if index > 0 {
+		lo = list[index-1].Position
+		roomy = lo != 0
+	}
+	if index < len(list) {
+		hi = list[index].Position
+		roomy = roomy && hi != 0
+	} else {
+		hi = lo + 2*positionGap
+	}
+	var moved []store.Todo
+	var events []store.Event
+	if roomy && hi-lo >= 2 {
+		position := lo + (hi-lo)/2
+		updated, evts := applyUpdate(todo, actor, now, func(t *store.Todo) { t.Position = position })
+		return []store.Todo{updated}, evts, 0, nil
+	}
+
+	list = slices.Insert(list, index, todo)
+	for i, t := range list {
+		position := int64(i+1) * positionGap
+		if t.Position == position && t.ID != id {
+			continue
+		}
+		updated, evts := applyUpdate(t, actor, now, func(t *store.Todo) { t.Position = position })
+		if t.ID == id {
+			moved = append([]store.Todo{updated}, moved...)
+		} else {
+			moved = append(moved, updated)
+		}
+		events = append(events, evts...)
+	}
+	return moved, events, 0, nil
+}
+
+// POST /todos/{id}/move
+func (s *server) handleMoveTodo(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[moveRequest](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	set := 0
+	for _, ok := range []bool{req.Before != "", req.After != "", req.Index != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		http.Error(w, "exactly one of before, after or index is required", http.StatusBadRequest)
+		return
+	}
+
+	var moved []store.Todo
+	var events []store.Event
+	var rejected int
+	err = s.store.Atomically(r.Context(), func(tx store.Tx) error {
+		var err error
+		moved, events, rejected, err = moveTodo(r.Context(), tx, r.PathValue("id"), req, actorFromRequest(r), time.Now())
+		if err != nil {
+			return err
+		}
+		for _, todo := range moved {
+			if err := tx.Update(r.Context(), todo, s.outboxEvents(eventsFor(events, todo.ID)...)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil && rejected != 0 {
+		http.Error(w, err.Error(), rejected)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	s.emitFor(r, events...)
+
+	if err := respondJSON(w, http.StatusOK, s.decorate(moved[0])[0]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// eventsFor picks the events about one todo
+func eventsFor(events []store.Event, id string) []store.Event {
+	var out []store.Event
+	for _, evt := range events {
+		if evt.Todo.ID == id {
+			out = append(out, evt)
+		}
+	}
+	return out
+}
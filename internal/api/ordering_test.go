@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"golang-todo/internal/store"
+)
+
+func TestMoveTodoErrors(t *testing.T) {
+	backend := &failingStore{Store: store.NewMemoryStore()}
+	srv := newTestServer(t, Options{Store: backend})
+	srv.projects.put(Project{ID: "elsewhere", Name: "Elsewhere"})
+	h := srv.routes()
+	a := createTodo(t, h, `{"title":"a"}`)
+	b := createTodo(t, h, `{"title":"b","project_id":"elsewhere"}`)
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+	}{
+		{"before itself", a.ID, `{"before":"` + a.ID + `"}`, http.StatusBadRequest},
+		{"after a todo in another list", a.ID, `{"after":"` + b.ID + `"}`, http.StatusBadRequest},
+		{"no such todo", "missing", `{"index":0}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h, "POST", "/todos/"+tt.target+"/move", tt.body); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+
+	// the store failing is the server's problem, not the request's
+	backend.fail.Store(true)
+	if w := serve(h, "POST", "/todos/"+a.ID+"/move", `{"index":0}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("move on a failing store: status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+}
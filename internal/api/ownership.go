@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// todoOwner returns who owns a todo: whoever it was transferred to, or its
+// creator if the audit log saw it created
+func (s *server) todoOwner(todo store.Todo) (string, bool) {
+	if todo.Owner != "" {
+		return todo.Owner, true
+	}
+	return s.audit.creator(todo.ID)
+}
+
+// higherRole returns the role of a and b giving more access
+func higherRole(a, b string) string {
+	if slices.Index(collaboratorRoles, a) >= slices.Index(collaboratorRoles, b) {
+		return a
+	}
+	return b
+}
+
+// POST /admin/transfers
+func (s *server) handleTransferOwnership(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to := strings.TrimSpace(req.From), strings.TrimSpace(req.To)
+	if from == "" || to == "" {
+		http.Error(w, "from and to are required", http.StatusBadRequest)
+		return
+	}
+	if from == to {
+		http.Error(w, "from and to must be different users", http.StatusBadRequest)
+		return
+	}
+	// the new owner has to be someone who can act on what they get
+	if user, ok := s.users.get(to); !ok {
+		http.Error(w, fmt.Sprintf("unknown user %q", to), http.StatusBadRequest)
+		return
+	} else if user.DisabledAt != nil {
+		http.Error(w, fmt.Sprintf("user %q is disabled", to), http.StatusBadRequest)
+		return
+	}
+
+	actor := actorFromRequest(r)
+	job := s.jobs.start(context.WithoutCancel(r.Context()), "transfer", actor, func(ctx context.Context, progress jobProgress) error {
+		return s.transferOwnership(ctx, progress, from, to, actor)
+	})
+	respondJob(w, job)
+}
+
+// transferOwnership moves the projects and todos from owns to to, along
+// with from's collaborator roles; to keeps a role of their own if it gives
+// more access. Each project change is audited, as the todo updates are.
+func (s *server) transferOwnership(ctx context.Context, progress jobProgress, from, to, actor string) error {
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	created := s.audit.createdBy(from)
+	owned := func(todo store.Todo) bool {
+		return todo.Owner == from || todo.Owner == "" && created[todo.ID]
+	}
+	todos = slices.DeleteFunc(todos, func(todo store.Todo) bool { return !owned(todo) })
+	projects := slices.DeleteFunc(s.projects.list(), func(p Project) bool {
+		_, collaborates := p.Collaborators[from]
+		return p.Owner != from && !collaborates
+	})
+	progress.total(len(projects) + len(todos))
+
+	for _, p := range projects {
+		now := time.Now()
+		before, after, err := s.projects.update(p.ID, func(project *Project) {
+			if project.Owner == from {
+				project.Owner = to
+			}
+			if role, ok := project.Collaborators[from]; ok {
+				delete(project.Collaborators, from)
+				project.Collaborators[to] = higherRole(project.Collaborators[to], role)
+			}
+		})
+		if err == nil {
+			s.audit.recordProject(before, after, actor, now)
+		}
+		progress.done("project "+p.ID, err)
+	}
+
+	for _, candidate := range todos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// recheck inside the transaction in case the todo changed meanwhile
+		var events []store.Event
+		err := s.store.Atomically(ctx, func(tx store.Tx) error {
+			todo, err := tx.Get(ctx, candidate.ID)
+			if err != nil || !owned(todo) {
+				return err
+			}
+			todo, events = applyUpdate(todo, actor, time.Now(), func(t *store.Todo) { t.Owner = to })
+			return tx.Update(ctx, todo, s.outboxEvents(events...)...)
+		})
+		if errors.Is(err, store.ErrNotFound) {
+			// deleted meanwhile; there's nothing left to transfer
+			err = nil
+		}
+		if err == nil {
+			s.emit(events...)
+		}
+		progress.done("todo "+candidate.ID, err)
+	}
+	return nil
+}
+
+// roleChange sets a collaborator's role on a project, or on every project
+// they collaborate on when ProjectID is empty. An empty role removes them.
+type roleChange struct {
+	User      string `json:"user"`
+	ProjectID string `json:"project_id"`
+	Role      string `json:"role"`
+}
+
+// POST /admin/roles
+func (s *server) handleChangeRoles(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Changes []roleChange `json:"changes"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Changes) == 0 {
+		http.Error(w, "changes are required", http.StatusBadRequest)
+		return
+	}
+	for i, c := range req.Changes {
+		switch {
+		case strings.TrimSpace(c.User) == "":
+			err = errors.New("user is required")
+		case c.Role != "":
+			err = checkRole(c.Role)
+		}
+		if err == nil && c.ProjectID != "" {
+			_, err = s.projects.get(c.ProjectID)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("changes[%d]: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	actor := actorFromRequest(r)
+	job := s.jobs.start(context.WithoutCancel(r.Context()), "roles", actor, func(ctx context.Context, progress jobProgress) error {
+		return s.changeRoles(ctx, progress, req.Changes, actor)
+	})
+	respondJob(w, job)
+}
+
+// changeRoles applies role changes one project at a time, auditing each
+func (s *server) changeRoles(ctx context.Context, progress jobProgress, changes []roleChange, actor string) error {
+	// expand changes to every project they apply to
+	type item struct {
+		projectID string
+		change    roleChange
+	}
+	var items []item
+	projects := s.projects.list()
+	for _, c := range changes {
+		for _, p := range projects {
+			if _, collaborates := p.Collaborators[c.User]; p.ID == c.ProjectID || c.ProjectID == "" && collaborates {
+				items = append(items, item{p.ID, c})
+			}
+		}
+	}
+	progress.total(len(items))
+
+	for _, it := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		now := time.Now()
+		before, after, err := s.projects.update(it.projectID, func(project *Project) {
+			if it.change.Role == "" {
+				delete(project.Collaborators, it.change.User)
+				return
+			}
+			if project.Collaborators == nil {
+				project.Collaborators = map[string]string{}
+			}
+			project.Collaborators[it.change.User] = it.change.Role
+		})
+		if err == nil {
+			s.audit.recordProject(before, after, actor, now)
+		}
+		progress.done(fmt.Sprintf("%s on project %s", it.change.User, it.projectID), err)
+	}
+	return nil
+}
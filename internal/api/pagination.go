@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// clientClassHeader names the class of client making a request, such as
+// mobile or export, which sets the page sizes it gets. Requests made with
+// an API key or service account token are of the class given to it,
+// whatever they send.
+const clientClassHeader = "X-Client-Class"
+
+// PageLimit is the page size a client gets when it doesn't ask for one,
+// and the largest it may ask for
+type PageLimit struct {
+	Default int
+	Max     int
+}
+
+// PageLimits are the page limits by client class. "*" applies to clients
+// without a class, or of a class that isn't listed.
+type PageLimits map[string]PageLimit
+
+// ParsePageLimits parses "CLASS=DEFAULT/MAX" pairs separated by commas,
+// e.g. "mobile=50/200,*=100/1000"
+func ParsePageLimits(spec string) (PageLimits, error) {
+	limits := PageLimits{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		class, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid page limit %q: want CLASS=DEFAULT/MAX", pair)
+		}
+		defaultSize, maxSize, ok := strings.Cut(value, "/")
+		d, derr := strconv.Atoi(defaultSize)
+		m, merr := strconv.Atoi(maxSize)
+		if !ok || derr != nil || merr != nil || d < 1 || d > m {
+			return nil, fmt.Errorf("invalid page limit %q for %q: want DEFAULT/MAX with 1 <= DEFAULT <= MAX", value, class)
+		}
+		limits[strings.TrimSpace(class)] = PageLimit{Default: d, Max: m}
+	}
+	return limits, nil
+}
+
+// routePageLimits are the page limits of the paginated routes. Their Max
+// is a ceiling: client classes can only lower it, so however a class is
+// configured, no client gets pages bigger than a route was built to serve.
+var routePageLimits = map[string]PageLimit{
+	"GET /todos":        {Default: defaultTodoPageSize, Max: maxTodoPageSize},
+	"GET /todos.txt":    {Default: defaultTodoPageSize, Max: maxTodoPageSize},
+	"GET /events":       {Default: defaultEventPageSize, Max: maxEventPageSize},
+	"GET /sync":         {Default: defaultSyncPageSize, Max: maxSyncPageSize},
+	"GET /todos/search": {Default: defaultSearchPageSize, Max: maxSearchPageSize},
+	"GET /admin/audit":  {Default: defaultAuditPageSize, Max: maxAuditPageSize},
+}
+
+// pageLimit returns the page limit of r's route for the class of its
+// client
+func (s *server) pageLimit(r *http.Request) PageLimit {
+	limit := routePageLimits[r.Pattern]
+	class, ok := s.pageLimits[r.Header.Get(clientClassHeader)]
+	if !ok {
+		class, ok = s.pageLimits["*"]
+	}
+	if ok {
+		limit.Max = min(limit.Max, class.Max)
+		limit.Default = min(class.Default, limit.Max)
+	}
+	return limit
+}
+
+// pageSize returns how many items a page of r holds: as many as its limit
+// query parameter asks for, within the page limit of its route and client
+func (s *server) pageSize(r *http.Request) (int, error) {
+	limit := s.pageLimit(r)
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return limit.Default, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > limit.Max {
+		return 0, fmt.Errorf("limit must be between 1 and %d", limit.Max)
+	}
+	return n, nil
+}
+
+// checkClientClass validates the class given to an API key or service
+// account: empty, or one the page limits are configured for
+func (s *server) checkClientClass(class string) error {
+	if _, ok := s.pageLimits[class]; class != "" && (class == "*" || !ok) {
+		return fmt.Errorf("unknown client class %q", class)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang-todo/internal/secrets"
+)
+
+func TestParsePageLimits(t *testing.T) {
+	limits, err := ParsePageLimits("mobile=50/200, *=100/1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits["mobile"] != (PageLimit{50, 200}) || limits["*"] != (PageLimit{100, 1000}) {
+		t.Errorf("got %v", limits)
+	}
+	for _, spec := range []string{"mobile", "mobile=50", "mobile=0/10", "mobile=20/10", "mobile=a/b"} {
+		if _, err := ParsePageLimits(spec); err == nil {
+			t.Errorf("ParsePageLimits(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestListTodosPageLimits(t *testing.T) {
+	h := newTestHandler(t, Options{PageLimits: PageLimits{"mobile": {Default: 2, Max: 3}}})
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		createTodo(t, h, `{"title":"`+title+`"}`)
+	}
+	tests := []struct {
+		target string
+		class  string
+		status int
+		titles string
+		next   string
+	}{
+		{"/todos", "", http.StatusOK, "abcde", ""},
+		{"/todos", "mobile", http.StatusOK, "ab", "offset=2"},
+		{"/todos?limit=3", "mobile", http.StatusOK, "abc", "offset=3"},
+		{"/todos?offset=4", "mobile", http.StatusOK, "e", ""},
+		{"/todos?offset=9", "mobile", http.StatusOK, "", ""},
+		{"/todos?limit=4", "mobile", http.StatusBadRequest, "", ""},
+		{"/todos?limit=4", "", http.StatusOK, "abcd", "offset=4"},
+		{"/todos?offset=-1", "", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		w := serve(h, "GET", tt.target, "", clientClassHeader, tt.class)
+		if w.Code != tt.status {
+			t.Errorf("%s as %q: status = %d, want %d: %s", tt.target, tt.class, w.Code, tt.status, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var todos []struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &todos); err != nil {
+			t.Fatal(err)
+		}
+		var titles string
+		for _, todo := range todos {
+			titles += todo.Title
+		}
+		if titles != tt.titles {
+			t.Errorf("%s as %q: got %q, want %q", tt.target, tt.class, titles, tt.titles)
+		}
+		if link := w.Header().Get("Link"); (tt.next == "") != (link == "") || !strings.Contains(link, tt.next) {
+			t.Errorf("%s as %q: Link = %q, want one to %s", tt.target, tt.class, link, tt.next)
+		}
+	}
+
+	// streamed lists aren't paged
+	if w := serve(h, "GET", "/todos", "", "Accept", ndjsonType, clientClassHeader, "mobile"); strings.Count(w.Body.String(), "\n") != 5 {
+		t.Errorf("NDJSON list as mobile: got %q, want all 5 todos", w.Body)
+	}
+}
+
+func TestAuditPageLimits(t *testing.T) {
+	admin := &secrets.Setting{}
+	admin.Set("adm1n")
+	h := newTestHandler(t, Options{AdminToken: admin, PageLimits: PageLimits{"mobile": {Default: 2, Max: 3}}})
+	for _, title := range []string{"a", "b", "c", "d"} {
+		createTodo(t, h, `{"title":"`+title+`"}`)
+	}
+	tests := []struct {
+		target string
+		class  string
+		status int
+		count  int
+	}{
+		{"/admin/audit", "", http.StatusOK, 4},
+		{"/admin/audit", "mobile", http.StatusOK, 2},
+		{"/admin/audit?limit=3", "mobile", http.StatusOK, 3},
+		{"/admin/audit?limit=4", "mobile", http.StatusBadRequest, 0},
+		{"/admin/audit?limit=0", "", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := serve(h, "GET", tt.target, "", "Authorization", "Bearer adm1n", clientClassHeader, tt.class)
+		if w.Code != tt.status {
+			t.Errorf("%s as %q: status = %d, want %d: %s", tt.target, tt.class, w.Code, tt.status, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var entries []json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != tt.count {
+			t.Errorf("%s as %q: got %d entries, want %d", tt.target, tt.class, len(entries), tt.count)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// negotiate picks the offered media type the client accepts with the highest
+// quality, falling back to the first offer when there is no Accept header or
+// nothing acceptable is offered
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+	best, bestQ := offers[0], 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		for _, offer := range offers {
+			if q > bestQ && mediaMatches(mediaType, offer) {
+				best, bestQ = offer, q
+			}
+		}
+	}
+	return best
+}
+
+// mediaMatches reports whether an Accept range such as "text/*" covers offer
+func mediaMatches(accepted, offer string) bool {
+	if accepted == "*/*" || accepted == offer {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(accepted, "/*")
+	return ok && strings.HasPrefix(offer, prefix+"/")
+}
+
+// respondText is a helper function that writes a plain-text response
+func respondText(w http.ResponseWriter, status int, text string) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := w.Write([]byte(text))
+	return err
+}
+
+// renderTodosText renders a list as plain sentences and labeled lines, with
+// no tables or box drawing, so it reads well in a terminal, on an e-ink
+// display or through a screen reader
+func (s *server) renderTodosText(r *http.Request, todos []store.Todo) string {
+	// listing has already rejected a bad X-Timezone
+	loc, _ := s.requestLocation(r)
+	var b strings.Builder
+	pending, completed := 0, 0
+	for _, todo := range todos {
+		if todo.Status == store.StatusCompleted {
+			completed++
+		} else {
+			pending++
+		}
+	}
+	fmt.Fprintf(&b, "%s: %d pending, %d completed.\n", plural(len(todos), "todo", "todos"), pending, completed)
+	for i, todo := range todos {
+		b.WriteString("\n")
+		writeTodoText(&b, fmt.Sprintf("%d. ", i+1), todo, loc)
+	}
+	return b.String()
+}
+
+// renderTodoText renders a single todo as plain text, with times as the
+// clock reads in loc
+func renderTodoText(todo store.Todo, loc *time.Location) string {
+	var b strings.Builder
+	writeTodoText(&b, "", todo, loc)
+	return b.String()
+}
+
+func writeTodoText(b *strings.Builder, prefix string, todo store.Todo, loc *time.Location) {
+	indent := strings.Repeat(" ", len(prefix))
+	title := todo.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	fmt.Fprintf(b, "%s%s\n", prefix, title)
+	fmt.Fprintf(b, "%sStatus: %s.\n", indent, todo.Status)
+	if todo.Priority != "" {
+		fmt.Fprintf(b, "%sPriority: %s.\n", indent, todo.Priority)
+	}
+	if todo.Description != "" {
+		fmt.Fprintf(b, "%sDescription: %s\n", indent, strings.Join(strings.Fields(todo.Description), " "))
+	}
+	if len(todo.Tags) > 0 {
+		fmt.Fprintf(b, "%sTags: %s.\n", indent, strings.Join(todo.Tags, ", "))
+	}
+	if todo.DueAt != nil {
+		fmt.Fprintf(b, "%sDue: %s.\n", indent, spokenTime(*todo.DueAt, loc))
+	}
+	fmt.Fprintf(b, "%sCreated: %s.\n", indent, spokenTime(todo.CreatedAt, loc))
+	if todo.Status == store.StatusCompleted && todo.CompletedAt != nil {
+		fmt.Fprintf(b, "%sCompleted: %s.\n", indent, spokenTime(*todo.CompletedAt, loc))
+	}
+	fmt.Fprintf(b, "%sID: %s\n", indent, todo.ID)
+}
+
+// spokenTime formats a time with words rather than numeric dates, which
+// screen readers pronounce unambiguously
+func spokenTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("Monday 2 January 2006 at 15:04 MST")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
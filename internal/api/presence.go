@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// presenceTTL is how long a heartbeat keeps a collaborator present; clients
+// should send one at least every presenceTTL/2
+const presenceTTL = 30 * time.Second
+
+// Presence is one collaborator who currently has a project open
+type Presence struct {
+	User      string    `json:"user"`
+	State     string    `json:"state"`
+	TodoID    string    `json:"todo_id,omitempty"`
+	Since     time.Time `json:"since"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// presenceTracker records heartbeats per project and forgets collaborators
+// whose heartbeats stop
+type presenceTracker struct {
+	mu       sync.Mutex
+	projects map[string]map[string]Presence // project ID -> user -> presence
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{projects: map[string]map[string]Presence{}}
+}
+
+// heartbeat marks user as present in a project, keeping the time they
+// first arrived
+func (p *presenceTracker) heartbeat(projectID string, presence Presence, now time.Time) Presence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	users := p.projects[projectID]
+	if users == nil {
+		users = map[string]Presence{}
+		p.projects[projectID] = users
+	}
+	presence.Since = now
+	if prev, ok := users[presence.User]; ok && now.Before(prev.ExpiresAt) {
+		presence.Since = prev.Since
+	}
+	presence.LastSeen = now
+	presence.ExpiresAt = now.Add(presenceTTL)
+	users[presence.User] = presence
+	return presence
+}
+
+// clear forgets everyone present in a project
+func (p *presenceTracker) clear(projectID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.projects, projectID)
+}
+
+func (p *presenceTracker) leave(projectID, user string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.projects[projectID], user)
+}
+
+// present returns the unexpired collaborators of a project, longest present
+// first, dropping expired ones
+func (p *presenceTracker) present(projectID string, now time.Time) []Presence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := []Presence{}
+	for user, presence := range p.projects[projectID] {
+		if !now.Before(presence.ExpiresAt) {
+			delete(p.projects[projectID], user)
+			continue
+		}
+		out = append(out, presence)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Since.Equal(out[j].Since) {
+			return out[i].Since.Before(out[j].Since)
+		}
+		return out[i].User < out[j].User
+	})
+	return out
+}
+
+// POST /projects/{id}/presence
+func (s *server) handlePresenceHeartbeat(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.projects.active(id); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	req, err := decodeJSON[struct {
+		State  string `json:"state"`
+		TodoID string `json:"todo_id"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch req.State {
+	case "":
+		req.State = "viewing"
+	case "viewing", "editing":
+	default:
+		http.Error(w, "state must be viewing or editing", http.StatusBadRequest)
+		return
+	}
+
+	presence := s.presence.heartbeat(id, Presence{User: actorFromRequest(r), State: req.State, TodoID: req.TodoID}, time.Now())
+	if err := respondJSON(w, http.StatusOK, presence); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /projects/{id}/presence
+func (s *server) handlePresenceLeave(w http.ResponseWriter, r *http.Request) {
+	s.presence.leave(r.PathValue("id"), actorFromRequest(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /projects/{id}/presence
+func (s *server) handleGetPresence(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.projects.get(id); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.presence.present(id, time.Now())); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
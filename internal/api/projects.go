@@ -0,0 +1,236 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errProjectNotFound = errors.New("project not found")
+	errProjectDeleted  = errors.New("project is deleted")
+)
+
+// Project groups todos that a team works on together
+type Project struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Owner is the user responsible for the project, its creator unless
+	// ownership was transferred
+	Owner string `json:"owner,omitempty"`
+	// Collaborators maps the users working on the project to their role
+	Collaborators map[string]string `json:"collaborators,omitempty"`
+	// DeletedAt is set while the project is deleted; see cascade.go for
+	// what that means for its todos and tokens
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Collaborator roles, from least to most access
+const (
+	roleViewer     = "viewer"
+	roleEditor     = "editor"
+	roleMaintainer = "maintainer"
+)
+
+var collaboratorRoles = []string{roleViewer, roleEditor, roleMaintainer}
+
+// checkRole validates a collaborator role
+func checkRole(role string) error {
+	if !slices.Contains(collaboratorRoles, role) {
+		return fmt.Errorf("invalid role %q; want one of %s", role, strings.Join(collaboratorRoles, ", "))
+	}
+	return nil
+}
+
+// projectRegistry holds the known projects in creation order
+type projectRegistry struct {
+	mu       sync.RWMutex
+	projects []Project
+}
+
+// put adds a project or replaces the one with the same ID
+func (p *projectRegistry) put(project Project) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.projects {
+		if p.projects[i].ID == project.ID {
+			p.projects[i] = project
+			return
+		}
+	}
+	p.projects = append(p.projects, project)
+}
+
+func (p *projectRegistry) list() []Project {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]Project{}, p.projects...)
+}
+
+// replace swaps in a whole new set of projects, as restoring a backup does
+func (p *projectRegistry) replace(projects []Project) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.projects = append([]Project{}, projects...)
+}
+
+// update applies fn to the project with id and returns it before and after
+func (p *projectRegistry) update(id string, fn func(*Project)) (Project, Project, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.projects {
+		if p.projects[i].ID == id {
+			// copies handed out share the old map, so it is never modified
+			before := p.projects[i]
+			p.projects[i].Collaborators = maps.Clone(before.Collaborators)
+			fn(&p.projects[i])
+			return before, p.projects[i], nil
+		}
+	}
+	return Project{}, Project{}, errProjectNotFound
+}
+
+// setDeleted deletes or restores the project with id
+func (p *projectRegistry) setDeleted(id string, deleted bool, now time.Time) (Project, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.projects {
+		if p.projects[i].ID == id {
+			p.projects[i].DeletedAt = nil
+			if deleted {
+				p.projects[i].DeletedAt = &now
+			}
+			return p.projects[i], nil
+		}
+	}
+	return Project{}, errProjectNotFound
+}
+
+// active returns the project with id unless it is missing or deleted, for
+// new references to it
+func (p *projectRegistry) active(id string) (Project, error) {
+	project, err := p.get(id)
+	if err == nil && project.DeletedAt != nil {
+		return Project{}, errProjectDeleted
+	}
+	return project, err
+}
+
+func (p *projectRegistry) get(id string) (Project, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, project := range p.projects {
+		if project.ID == id {
+			return project, nil
+		}
+	}
+	return Project{}, errProjectNotFound
+}
+
+// find returns the project with an ID or, failing that, a name matching
+// name in any case
+func (p *projectRegistry) find(name string) (Project, bool) {
+	if project, err := p.get(name); err == nil {
+		return project, true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, project := range p.projects {
+		if strings.EqualFold(project.Name, name) {
+			return project, true
+		}
+	}
+	return Project{}, false
+}
+
+// POST /projects
+func (s *server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
+	project, err := decodeJSON[Project](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(project.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	project.ID = uuid.New().String()
+	project.CreatedAt = time.Now()
+	project.DeletedAt = nil
+	if project.Owner == "" {
+		project.Owner = actorFromRequest(r)
+	}
+	for user, role := range project.Collaborators {
+		if err := checkRole(role); err != nil {
+			http.Error(w, fmt.Sprintf("collaborator %s: %v", user, err), http.StatusBadRequest)
+			return
+		}
+	}
+	s.projects.put(project)
+
+	if err := respondJSON(w, http.StatusCreated, project); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /projects
+func (s *server) handleListProjects(w http.ResponseWriter, r *http.Request) {
+	// deleted projects are listed only on request, and then on their own
+	deleted := r.URL.Query().Get("deleted") == "true"
+	projects := slices.DeleteFunc(s.projects.list(), func(p Project) bool { return (p.DeletedAt != nil) != deleted })
+	if err := respondJSON(w, http.StatusOK, projects); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /projects/{id}
+func (s *server) handleGetProject(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projects.get(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, project); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /projects/{id}
+func (s *server) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.projects.active(id); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if _, err := s.projects.setDeleted(id, true, time.Now()); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	s.cascadeProjectDeleted(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /projects/{id}/restore
+func (s *server) handleRestoreProject(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projects.setDeleted(r.PathValue("id"), false, time.Now())
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, project); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// projectTokenPrefix starts every project token, so they can be told apart
+// from other bearer tokens without a lookup
+const projectTokenPrefix = "tdp_"
+
+// Project token scopes
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// ProjectToken lets an integration such as a CI pipeline use the todos of
+// one project and nothing else. Only a hash of the secret is kept; the
+// token itself is shown once, when it is issued.
+type ProjectToken struct {
+	ID         string     `json:"id"`
+	ProjectID  string     `json:"project_id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	hash       string
+}
+
+// actor is who changes made with the token are attributed to
+func (t ProjectToken) actor() string {
+	return "token:" + t.ID
+}
+
+// projectTokenRegistry holds the issued project tokens
+type projectTokenRegistry struct {
+	mu     sync.RWMutex
+	tokens []*ProjectToken
+}
+
+// hashSecret is how issued secrets are kept: only their hash is stored
+func hashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue creates a token and returns it along with its secret
+func (p *projectTokenRegistry) issue(projectID, name, scope, actor string, now time.Time) (ProjectToken, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return ProjectToken{}, "", err
+	}
+	secret := projectTokenPrefix + hex.EncodeToString(b)
+	token := &ProjectToken{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Name:      name,
+		Scope:     scope,
+		CreatedAt: now,
+		CreatedBy: actor,
+		hash:      hashSecret(secret),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens = append(p.tokens, token)
+	return *token, secret, nil
+}
+
+// authenticate looks up the token with secret and records its use
+func (p *projectTokenRegistry) authenticate(secret string, now time.Time) (ProjectToken, bool) {
+	hash := hashSecret(secret)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, token := range p.tokens {
+		if token.hash == hash {
+			token.LastUsedAt = &now
+			return *token, true
+		}
+	}
+	return ProjectToken{}, false
+}
+
+// find returns the token with secret without recording a use
+func (p *projectTokenRegistry) find(secret string) (ProjectToken, bool) {
+	hash := hashSecret(secret)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, token := range p.tokens {
+		if token.hash == hash {
+			return *token, true
+		}
+	}
+	return ProjectToken{}, false
+}
+
+func (p *projectTokenRegistry) list(projectID string) []ProjectToken {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	tokens := []ProjectToken{}
+	for _, token := range p.tokens {
+		if token.ProjectID == projectID {
+			tokens = append(tokens, *token)
+		}
+	}
+	return tokens
+}
+
+// all returns the tokens of every project
+func (p *projectTokenRegistry) all() []ProjectToken {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	tokens := make([]ProjectToken, 0, len(p.tokens))
+	for _, token := range p.tokens {
+		tokens = append(tokens, *token)
+	}
+	return tokens
+}
+
+// replace swaps in a whole new set of tokens, as loading a state file does
+func (p *projectTokenRegistry) replace(tokens []ProjectToken) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens = make([]*ProjectToken, len(tokens))
+	for i := range tokens {
+		token := tokens[i]
+		p.tokens[i] = &token
+	}
+}
+
+// revoke removes a token of the project, reporting whether it existed
+func (p *projectTokenRegistry) revoke(projectID, id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.tokens)
+	p.tokens = slices.DeleteFunc(p.tokens, func(t *ProjectToken) bool { return t.ID == id && t.ProjectID == projectID })
+	return len(p.tokens) < n
+}
+
+// projectToken returns the project token a request carries, if any
+func (s *server) projectToken(r *http.Request) (ProjectToken, bool) {
+	secret := bearerToken(r)
+	if !strings.HasPrefix(secret, projectTokenPrefix) {
+		return ProjectToken{}, false
+	}
+	return s.projectTokens.find(secret)
+}
+
+// projectTokenAccess says how a route decides whether a project token may
+// use it
+type projectTokenAccess int
+
+const (
+	// the route filters what it returns by the token's project
+	accessFiltered projectTokenAccess = iota + 1
+	// {id} is a todo that must be in the token's project
+	accessTodo
+	// {id} must be the token's project
+	accessProject
+)
+
+// projectTokenRoutes are the routes project tokens may use; every other
+// route rejects them
+var projectTokenRoutes = map[string]projectTokenAccess{
+	"GET /todos":                                     accessFiltered,
+	"GET /todos.txt":                                 accessFiltered,
+	"GET /todos/stream":                              accessFiltered,
+	"GET /sync":                                      accessFiltered,
+	"POST /sync":                                     accessFiltered,
+	"GET /tags":                                      accessFiltered,
+	"POST /tags/suggestions":                         accessFiltered,
+	"POST /todos":                                    accessFiltered,
+	"POST /todos/batch":                              accessFiltered,
+	"POST /todos/quickadd":                           accessFiltered,
+	"POST /integrations/ci":                          accessFiltered,
+	"GET /todos/{id}":                                accessTodo,
+	"PATCH /todos/{id}":                              accessTodo,
+	"DELETE /todos/{id}":                             accessTodo,
+	"GET /todos/{id}/history":                        accessTodo,
+	"GET /todos/{id}/touches":                        accessTodo,
+	"GET /todos/{id}/comments":                       accessTodo,
+	"POST /todos/{id}/comments":                      accessTodo,
+	"DELETE /todos/{id}/comments/{comment_id}":       accessTodo,
+	"POST /todos/{id}/timer/start":                   accessTodo,
+	"POST /todos/{id}/timer/stop":                    accessTodo,
+	"POST /todos/{id}/time":                          accessTodo,
+	"GET /todos/{id}/time":                           accessTodo,
+	"DELETE /todos/{id}/time/{entry_id}":             accessTodo,
+	"GET /todos/{id}/attachments":                    accessTodo,
+	"POST /todos/{id}/attachments":                   accessTodo,
+	"GET /todos/{id}/attachments.zip":                accessTodo,
+	"GET /todos/{id}/attachments/{attachment_id}":    accessTodo,
+	"DELETE /todos/{id}/attachments/{attachment_id}": accessTodo,
+	"GET /projects/{id}":                             accessProject,
+	"GET /projects/{id}/attachments.zip":             accessProject,
+}
+
+// scopeProjectTokens confines requests made with a project token to the
+// token's project and, for read tokens, to reads. Changes are attributed
+// to the token rather than to any X-User-ID the request sends.
+func (s *server) scopeProjectTokens(pattern string, next http.Handler) http.Handler {
+	access := projectTokenRoutes[pattern]
+	method, _, _ := strings.Cut(pattern, " ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := bearerToken(r)
+		if !strings.HasPrefix(secret, projectTokenPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := s.projectTokens.authenticate(secret, time.Now())
+		if !ok {
+			s.authFailed(r)
+			http.Error(w, "invalid or revoked project token", http.StatusUnauthorized)
+			return
+		}
+		if _, err := s.projects.active(token.ProjectID); errors.Is(err, errProjectDeleted) {
+			http.Error(w, "this project token's project is deleted", http.StatusForbidden)
+			return
+		}
+		if access == 0 {
+			http.Error(w, "project tokens can't use "+pattern, http.StatusForbidden)
+			return
+		}
+		if token.Scope == scopeRead && method != http.MethodGet {
+			http.Error(w, "this project token is read-only", http.StatusForbidden)
+			return
+		}
+		switch access {
+		case accessTodo:
+			if project, ok := s.todoProject(r.Context(), r.PathValue("id")); ok && project != token.ProjectID {
+				// another project's todos don't exist as far as the token knows
+				http.Error(w, "Todo not found", http.StatusNotFound)
+				return
+			}
+		case accessProject:
+			if r.PathValue("id") != token.ProjectID {
+				http.Error(w, "Project not found", http.StatusNotFound)
+				return
+			}
+		}
+		r.Header.Set("X-User-ID", token.actor())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// todoProject returns the project of the todo with id, looking in the cold
+// tier too
+func (s *server) todoProject(ctx context.Context, id string) (string, bool) {
+	todo, err := s.store.Get(ctx, id)
+	if errors.Is(err, store.ErrNotFound) && s.cold != nil {
+		todo, err = s.cold.Get(ctx, id)
+	}
+	if err != nil {
+		return "", false
+	}
+	return todo.ProjectID, true
+}
+
+// POST /projects/{id}/tokens
+func (s *server) handleCreateProjectToken(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projects.active(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	req, err := decodeJSON[struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required, e.g. the pipeline the token is for", http.StatusBadRequest)
+		return
+	}
+	if req.Scope != scopeRead && req.Scope != scopeWrite {
+		http.Error(w, "scope must be read or write", http.StatusBadRequest)
+		return
+	}
+	token, secret, err := s.projectTokens.issue(project.ID, strings.TrimSpace(req.Name), req.Scope, actorFromRequest(r), time.Now())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	resp := struct {
+		ProjectToken
+		Token string `json:"token"`
+	}{token, secret}
+	if err := respondJSON(w, http.StatusCreated, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /projects/{id}/tokens
+func (s *server) handleListProjectTokens(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projects.get(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.projectTokens.list(project.ID)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /projects/{id}/tokens/{token_id}
+func (s *server) handleRevokeProjectToken(w http.ResponseWriter, r *http.Request) {
+	if !s.projectTokens.revoke(r.PathValue("id"), r.PathValue("token_id")) {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+func TestProjectTokenRoutes(t *testing.T) {
+	srv := newTestServer(t, Options{})
+	srv.projects.put(Project{ID: "home", Name: "Home"})
+	srv.projects.put(Project{ID: "work", Name: "Work"})
+	h := srv.routes()
+	mine := createTodo(t, h, `{"title":"mine","project_id":"home"}`)
+	theirs := createTodo(t, h, `{"title":"theirs","project_id":"work"}`)
+	createTodo(t, h, `{"title":"loose"}`)
+	bearer := func(scope string) []string {
+		t.Helper()
+		_, secret, err := srv.projectTokens.issue("home", scope, scope, "al", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []string{"Authorization", "Bearer " + secret}
+	}
+	write, read := bearer(scopeWrite), bearer(scopeRead)
+	token, secret, err := srv.projectTokens.issue("home", "revoked", scopeWrite, "al", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.projectTokens.revoke("home", token.ID)
+	revoked := []string{"Authorization", "Bearer " + secret}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		header []string
+		status int
+	}{
+		{"own todo", "GET", "/todos/" + mine.ID, "", read, http.StatusOK},
+		{"another project's todo", "GET", "/todos/" + theirs.ID, "", read, http.StatusNotFound},
+		{"update another project's todo", "PATCH", "/todos/" + theirs.ID, `{"description":"x"}`, write, http.StatusNotFound},
+		{"delete another project's todo", "DELETE", "/todos/" + theirs.ID, "", write, http.StatusNotFound},
+		{"comment on another project's todo", "POST", "/todos/" + theirs.ID + "/comments", `{"body":"x"}`, write, http.StatusNotFound},
+		{"update with a read token", "PATCH", "/todos/" + mine.ID, `{"description":"x"}`, read, http.StatusForbidden},
+		{"create with a read token", "POST", "/todos", `{"title":"x"}`, read, http.StatusForbidden},
+		{"create in another project", "POST", "/todos", `{"title":"x","project_id":"work"}`, write, http.StatusForbidden},
+		{"own project", "GET", "/projects/home", "", read, http.StatusOK},
+		{"another project", "GET", "/projects/work", "", read, http.StatusNotFound},
+		{"route outside any project", "GET", "/stats", "", write, http.StatusForbidden},
+		{"revoked token", "GET", "/todos", "", revoked, http.StatusUnauthorized},
+		{"unknown token", "GET", "/todos", "", []string{"Authorization", "Bearer " + projectTokenPrefix + "nope"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h, tt.method, tt.target, tt.body, tt.header...); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+
+	// lists only show the token's project, and what the token creates goes
+	// there, attributed to the token rather than the X-User-ID sent
+	w := serve(h, "GET", "/todos", "", read...)
+	var listed []store.Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || len(listed) != 1 || listed[0].ID != mine.ID {
+		t.Errorf("list: %d %s, want only %s", w.Code, w.Body, mine.ID)
+	}
+	created := createTodo(t, h, `{"title":"made by the token"}`, write...)
+	if created.ProjectID != "home" {
+		t.Errorf("created todo's project = %q, want home", created.ProjectID)
+	}
+	if entries := srv.audit.all(); entries[len(entries)-1].Actor == "al" {
+		t.Errorf("creation attributed to %q, want the token", entries[len(entries)-1].Actor)
+	}
+
+	// once the project is deleted its tokens stop working
+	if _, err := srv.projects.setDeleted("home", true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(h, "GET", "/todos/"+mine.ID, "", read...); w.Code != http.StatusForbidden {
+		t.Errorf("token of a deleted project: %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestProjectTokenSync(t *testing.T) {
+	srv := newTestServer(t, Options{})
+	srv.projects.put(Project{ID: "home", Name: "Home"})
+	srv.projects.put(Project{ID: "work", Name: "Work"})
+	h := srv.routes()
+	mine := createTodo(t, h, `{"title":"mine","project_id":"home"}`)
+	theirs := createTodo(t, h, `{"title":"theirs","project_id":"work"}`)
+	_, secret, err := srv.projectTokens.issue("home", "phone", scopeWrite, "al", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := []string{"Authorization", "Bearer " + secret}
+	first := pull(t, h, "", token...)
+	if len(first.Todos) != 1 || first.Todos[0].ID != mine.ID {
+		t.Fatalf("first pull = %+v, want only %s", first, mine.ID)
+	}
+
+	// a todo moved out of the project is dropped without being deleted
+	later := time.Now().Add(time.Second).UTC().Format(time.RFC3339Nano)
+	moved := push(t, h, `[{"op":"upsert","id":"`+mine.ID+`","base_version":1,"updated_at":"`+later+`","project_id":"work"}]`)
+	if moved[0].Result != syncApplied {
+		t.Fatalf("move to another project = %+v", moved)
+	}
+	next := pull(t, h, first.Cursor, token...)
+	if len(next.Todos) != 0 || len(next.Tombstones) != 1 || next.Tombstones[0].ID != mine.ID || next.Tombstones[0].DeletedAt != nil {
+		t.Errorf("pull after the move = %+v, want a tombstone for %s without deleted_at", next, mine.ID)
+	}
+
+	results := push(t, h, `[{"op":"upsert","id":"`+theirs.ID+`","base_version":1,"updated_at":"`+later+`","title":"x"},
+		{"op":"upsert","id":"`+uuid.New().String()+`","updated_at":"`+later+`","title":"x","project_id":"work"},
+		{"op":"upsert","id":"`+uuid.New().String()+`","updated_at":"`+later+`","title":"offline"}]`, token...)
+	if results[0].Result != syncRejected || results[1].Result != syncRejected {
+		t.Errorf("pushes outside the project = %+v, want them rejected", results[:2])
+	}
+	if results[2].Result != syncApplied || results[2].Todo.ProjectID != "home" {
+		t.Errorf("offline creation = %+v, want it applied in home", results[2])
+	}
+}
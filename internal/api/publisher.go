@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+
+	"golang-todo/internal/store"
+)
+
+// EventPublisher is the interface implemented by message brokers that
+// receive todo events relayed from the outbox
+type EventPublisher interface {
+	Publish(ctx context.Context, evt store.Event, payload []byte) error
+	Close() error
+}
+
+// NewEventPublisher creates a publisher for the named broker
+func NewEventPublisher(broker, url, topic string) (EventPublisher, error) {
+	switch broker {
+	case "nats":
+		return newNATSPublisher(url, topic)
+	case "kafka":
+		return newKafkaPublisher(url, topic), nil
+	default:
+		return nil, fmt.Errorf("unknown event broker %q (want nats or kafka)", broker)
+	}
+}
+
+// natsPublisher publishes each event on a subject named after its type,
+// e.g. "todo.created", optionally behind a prefix
+type natsPublisher struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+func newNATSPublisher(url, prefix string) (*natsPublisher, error) {
+	// Keep reconnecting forever; the outbox holds events while the broker is down
+	conn, err := nats.Connect(url, nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return &natsPublisher{conn: conn, prefix: prefix}, nil
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, evt store.Event, payload []byte) error {
+	subject := string(evt.Type)
+	if p.prefix != "" {
+		subject = p.prefix + "." + subject
+	}
+	if !p.conn.IsConnected() {
+		return nats.ErrConnectionClosed
+	}
+	if err := p.conn.Publish(subject, payload); err != nil {
+		return err
+	}
+	// Flush so a publish only counts once the server has received it
+	return p.conn.FlushWithContext(ctx)
+}
+
+// Ping round-trips to the NATS server
+func (p *natsPublisher) Ping(ctx context.Context) error {
+	if !p.conn.IsConnected() {
+		return nats.ErrConnectionClosed
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+// kafkaPublisher writes events to a single topic keyed by todo ID, so all
+// events of a todo land on the same partition in order
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(brokers, topic string) *kafkaPublisher {
+	if topic == "" {
+		topic = "todo-events"
+	}
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, evt store.Event, payload []byte) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(evt.Todo.ID),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "event_type", Value: []byte(evt.Type)},
+			{Key: "event_id", Value: []byte(evt.ID)},
+		},
+	})
+}
+
+// Ping connects to one of the brokers; the writer itself only connects
+// when it has messages to send
+func (p *kafkaPublisher) Ping(ctx context.Context) error {
+	var d kafka.Dialer
+	var err error
+	for _, addr := range strings.Split(p.writer.Addr.String(), ",") {
+		conn, dialErr := d.DialContext(ctx, "tcp", addr)
+		if dialErr == nil {
+			return conn.Close()
+		}
+		err = dialErr
+	}
+	return err
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// eventRelay drains the store's outbox into a publisher. Entries are only
+// removed after a successful publish, so a broker outage delays events
+// instead of dropping them (delivery is at-least-once).
+type eventRelay struct {
+	outbox    store.Outbox
+	publisher EventPublisher
+	batchSize int
+}
+
+// run relays pending events every interval until ctx is cancelled
+func (r *eventRelay) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := r.relayOnce(ctx); err != nil {
+			log.Printf("event relay failed after publishing %d events: %v", n, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayOnce publishes pending events in order and returns how many succeeded
+func (r *eventRelay) relayOnce(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		entries, err := r.outbox.PendingEvents(ctx, r.batchSize)
+		if err != nil || len(entries) == 0 {
+			return published, err
+		}
+		for _, entry := range entries {
+			payload, err := json.Marshal(entry.Event)
+			if err != nil {
+				return published, err
+			}
+			pubCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err = r.publisher.Publish(pubCtx, entry.Event, payload)
+			cancel()
+			if err != nil {
+				// stop at the first failure to preserve ordering; retry next tick
+				return published, err
+			}
+			if err := r.outbox.MarkPublished(ctx, entry.Seq); err != nil {
+				return published, err
+			}
+			published++
+		}
+	}
+}
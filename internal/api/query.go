@@ -0,0 +1,427 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang-todo/internal/store"
+)
+
+// A todo query is a space-separated list of terms that must all match,
+// for example:
+//
+//	status:pending tag:work due:<2025-07-01 priority:>=high "weekly report"
+//	meta.jira:PROJ-123 meta.hours:>2
+//
+// A term is either field:value, where the value may start with one of the
+// comparison operators = < <= > >=, or free text matched against the title
+// and description. Values containing spaces or parentheses can be
+// double-quoted, and a leading "-" negates a term. tag:work/* matches work
+// and any tag nested under it.
+//
+// Terms can also be joined with OR and grouped with parentheses:
+//
+//	status:pending (tag:work OR tag:home) -(priority:low OR due:none)
+//
+// Negation binds tightest, then the implicit AND, which may also be
+// written out, then OR; so a b OR c means (a b) OR c. AND and OR are
+// operators only in upper case.
+
+// queryError describes an invalid query and where in it the problem is
+type queryError struct {
+	Pos int // 1-based rune offset of the offending term; 0 for parameters
+	Msg string
+}
+
+func (e *queryError) Error() string {
+	if e.Pos == 0 {
+		return "invalid query: " + e.Msg
+	}
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos, e.Msg)
+}
+
+// queryTokenKind tells terms apart from the operators joining them
+type queryTokenKind int
+
+const (
+	tokenTerm queryTokenKind = iota
+	tokenOpen
+	tokenClose
+	tokenAnd
+	tokenOr
+)
+
+// queryToken is a lexed term before its field and operator are interpreted,
+// or an operator
+type queryToken struct {
+	pos    int
+	kind   queryTokenKind
+	negate bool   // on terms and opening parentheses
+	field  string // empty for free text
+	op     string
+	value  string
+}
+
+// queryOps are the comparison operators, longest first so "<=" isn't read
+// as "<" followed by "="
+var queryOps = []string{">=", "<=", ">", "<", "="}
+
+// lexQuery splits a query into tokens, honouring double quotes
+func lexQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	var tokens []queryToken
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		tok := queryToken{pos: i + 1}
+		if runes[i] == '-' {
+			tok.negate = true
+			i++
+		}
+		if i < len(runes) && runes[i] == '(' {
+			tok.kind = tokenOpen
+			tokens = append(tokens, tok)
+			i++
+			continue
+		}
+		if i < len(runes) && runes[i] == ')' && !tok.negate {
+			tok.kind = tokenClose
+			tokens = append(tokens, tok)
+			i++
+			continue
+		}
+
+		// read the raw term, keeping quoted sections together; a closing
+		// parenthesis ends it unless quoted
+		var raw strings.Builder
+		quoted, quoteStart := false, 0
+		for ; i < len(runes) && (quoted || !unicode.IsSpace(runes[i]) && runes[i] != ')'); i++ {
+			if runes[i] == '"' {
+				quoted, quoteStart = !quoted, i+1
+			}
+			raw.WriteRune(runes[i])
+		}
+		if quoted {
+			return nil, &queryError{Pos: quoteStart, Msg: "unterminated quote"}
+		}
+
+		term := raw.String()
+		if !tok.negate && (term == "AND" || term == "OR") {
+			tok.kind = tokenAnd
+			if term == "OR" {
+				tok.kind = tokenOr
+			}
+			tokens = append(tokens, tok)
+			continue
+		}
+		if field, rest, ok := strings.Cut(term, ":"); ok && field != "" && !strings.Contains(field, `"`) {
+			tok.field = strings.ToLower(field)
+			for _, op := range queryOps {
+				if strings.HasPrefix(rest, op) {
+					tok.op, rest = op, rest[len(op):]
+					break
+				}
+			}
+			if tok.op == "" {
+				tok.op = "="
+			}
+			term = rest
+		}
+		tok.value = strings.ReplaceAll(term, `"`, "")
+		if tok.value == "" {
+			msg := "empty term"
+			if tok.field != "" {
+				msg = fmt.Sprintf("%s needs a value", tok.field)
+			}
+			return nil, &queryError{Pos: tok.pos, Msg: msg}
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens, nil
+}
+
+// todoPredicate reports whether a todo matches a query term
+type todoPredicate func(store.Todo) bool
+
+// parseQuery compiles a query into a predicate matching the todos it
+// describes, whose statuses are those of workflow; an empty query matches
+// everything
+func parseQuery(query string, workflow *Workflow, now time.Time) (todoPredicate, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return func(store.Todo) bool { return true }, nil
+	}
+	p := &queryParser{tokens: tokens, workflow: workflow, now: now}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	// only an unmatched closing parenthesis stops parseOr early
+	if p.i < len(tokens) {
+		return nil, &queryError{Pos: tokens[p.i].pos, Msg: "unexpected )"}
+	}
+	return pred, nil
+}
+
+// queryParser compiles tokens by recursive descent, one precedence level
+// per method
+type queryParser struct {
+	tokens   []queryToken
+	i        int
+	workflow *Workflow
+	now      time.Time
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i], true
+	}
+	return queryToken{}, false
+}
+
+// parseOr reads terms joined by OR
+func (p *queryParser) parseOr() (todoPredicate, error) {
+	var alternatives []todoPredicate
+	for {
+		start := p.i
+		pred, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if pred == nil {
+			return nil, p.missingTerm(start)
+		}
+		alternatives = append(alternatives, pred)
+		if tok, ok := p.peek(); !ok || tok.kind != tokenOr {
+			break
+		}
+		p.i++
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return func(t store.Todo) bool {
+		for _, pred := range alternatives {
+			if pred(t) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseAnd reads terms that must all match, up to the next OR or closing
+// parenthesis; it returns nil if there are none
+func (p *queryParser) parseAnd() (todoPredicate, error) {
+	var preds []todoPredicate
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenOr || tok.kind == tokenClose {
+			break
+		}
+		if tok.kind == tokenAnd {
+			p.i++
+			if next, ok := p.peek(); len(preds) == 0 || !ok || next.kind != tokenTerm && next.kind != tokenOpen {
+				return nil, &queryError{Pos: tok.pos, Msg: "AND needs a term on each side"}
+			}
+			continue
+		}
+		pred, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+	switch len(preds) {
+	case 0:
+		return nil, nil
+	case 1:
+		return preds[0], nil
+	}
+	return func(t store.Todo) bool {
+		for _, pred := range preds {
+			if !pred(t) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// parseUnary reads a term or a parenthesized group, either maybe negated
+func (p *queryParser) parseUnary() (todoPredicate, error) {
+	tok := p.tokens[p.i]
+	p.i++
+	var pred todoPredicate
+	if tok.kind == tokenOpen {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != tokenClose {
+			return nil, &queryError{Pos: tok.pos, Msg: "unclosed parenthesis"}
+		}
+		p.i++
+		pred = inner
+	} else {
+		compiled, err := compileTerm(tok, p.workflow, p.now)
+		if err != nil {
+			return nil, &queryError{Pos: tok.pos, Msg: err.Error()}
+		}
+		pred = compiled
+	}
+	if tok.negate {
+		inner := pred
+		pred = func(t store.Todo) bool { return !inner(t) }
+	}
+	return pred, nil
+}
+
+// missingTerm explains why no terms were found from tokens[i] on
+func (p *queryParser) missingTerm(i int) error {
+	switch {
+	case i < len(p.tokens) && p.tokens[i].kind == tokenOr:
+		return &queryError{Pos: p.tokens[i].pos, Msg: "OR needs a term on each side"}
+	case i > 0 && p.tokens[i-1].kind == tokenOr:
+		return &queryError{Pos: p.tokens[i-1].pos, Msg: "OR needs a term on each side"}
+	case i > 0 && p.tokens[i-1].kind == tokenOpen:
+		return &queryError{Pos: p.tokens[i-1].pos, Msg: "empty parentheses"}
+	}
+	return &queryError{Pos: p.tokens[i].pos, Msg: "unexpected )"}
+}
+
+func compileTerm(tok queryToken, workflow *Workflow, now time.Time) (todoPredicate, error) {
+	if key, ok := strings.CutPrefix(tok.field, "meta."); ok {
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid metadata key %q", key)
+		}
+		return func(t store.Todo) bool {
+			// query fields are lowercased, so keys match in any case
+			for k, v := range t.Metadata {
+				if strings.EqualFold(k, key) {
+					return compareOp(tok.op, compareMetadata(v, tok.value))
+				}
+			}
+			return false
+		}, nil
+	}
+	switch tok.field {
+	case "":
+		text := strings.ToLower(tok.value)
+		return func(t store.Todo) bool {
+			return strings.Contains(strings.ToLower(t.Title), text) || strings.Contains(strings.ToLower(t.Description), text)
+		}, nil
+
+	case "status":
+		if tok.op != "=" {
+			return nil, fmt.Errorf("status only supports equality, not %q", tok.op)
+		}
+		status := store.TodoStatus(strings.ToLower(tok.value))
+		if !workflow.valid(status) {
+			return nil, fmt.Errorf("unknown status %q; want one of %s", tok.value, workflow.describe())
+		}
+		return func(t store.Todo) bool { return t.Status == status }, nil
+
+	case "tag":
+		if tok.op != "=" {
+			return nil, fmt.Errorf("tag only supports equality, not %q", tok.op)
+		}
+		matches := tagMatcher(tok.value)
+		return func(t store.Todo) bool { return matches(t.Tags) }, nil
+
+	case "priority":
+		if strings.EqualFold(tok.value, "none") {
+			if tok.op != "=" {
+				return nil, fmt.Errorf("priority:none only supports equality")
+			}
+			return func(t store.Todo) bool { return t.Priority == "" }, nil
+		}
+		want := priorityRank(store.TodoPriority(strings.ToLower(tok.value)))
+		if want == 0 {
+			return nil, fmt.Errorf("unknown priority %q; want low, medium, high, urgent or none", tok.value)
+		}
+		return func(t store.Todo) bool {
+			// todos without a priority never satisfy a comparison
+			rank := priorityRank(t.Priority)
+			return rank != 0 && compareOp(tok.op, rank-want)
+		}, nil
+
+	case "due", "created":
+		get := func(t store.Todo) *time.Time { return t.DueAt }
+		if tok.field == "created" {
+			get = func(t store.Todo) *time.Time { return &t.CreatedAt }
+		}
+		if strings.EqualFold(tok.value, "none") {
+			if tok.field != "due" || tok.op != "=" {
+				return nil, fmt.Errorf("only due:none is supported")
+			}
+			return func(t store.Todo) bool { return t.DueAt == nil }, nil
+		}
+		start, end, err := parseQueryDate(tok.value, now)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tok.field, err)
+		}
+		return func(t store.Todo) bool {
+			at := get(t)
+			if at == nil {
+				return false
+			}
+			switch tok.op {
+			case "<":
+				return at.Before(start)
+			case "<=":
+				return at.Before(end)
+			case ">":
+				return !at.Before(end)
+			case ">=":
+				return !at.Before(start)
+			}
+			return !at.Before(start) && at.Before(end)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q; want status, tag, priority, due, created or meta.KEY", tok.field)
+}
+
+// compareOp applies a comparison operator to the sign of a difference
+func compareOp(op string, diff int) bool {
+	switch op {
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	case ">":
+		return diff > 0
+	case ">=":
+		return diff >= 0
+	}
+	return diff == 0
+}
+
+// parseQueryDate turns a date value into the half-open interval it covers:
+// a whole day in now's location for YYYY-MM-DD, today and tomorrow, or a
+// single instant for now and RFC 3339 timestamps
+func parseQueryDate(value string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch strings.ToLower(value) {
+	case "today":
+		return today, today.AddDate(0, 0, 1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), today.AddDate(0, 0, 2), nil
+	case "now":
+		return now, now.Add(time.Nanosecond), nil
+	}
+	if day, err := time.ParseInLocation(time.DateOnly, value, now.Location()); err == nil {
+		return day, day.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t.Add(time.Nanosecond), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q; want YYYY-MM-DD, an RFC 3339 timestamp, today, tomorrow or now", value)
+}
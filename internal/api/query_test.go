@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+func queryTodos() []store.Todo {
+	at := func(s string) *time.Time {
+		t, _ := time.Parse(time.DateOnly, s)
+		return &t
+	}
+	created := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	return []store.Todo{
+		{ID: "a", Title: "Plan sprint", Status: store.StatusPending, Tags: []string{"work"}, Priority: store.PriorityHigh, DueAt: at("2025-06-15"), CreatedAt: created},
+		{ID: "b", Title: "Water plants", Status: store.StatusPending, Tags: []string{"home"}, Priority: store.PriorityLow, CreatedAt: created.AddDate(0, 0, 10)},
+		{ID: "c", Title: "Weekly report", Description: "send (draft) to the team", Status: store.StatusCompleted, Tags: []string{"work"}, Priority: store.PriorityUrgent, CreatedAt: created},
+		{ID: "d", Title: "Fix login", Status: "in_progress", Tags: []string{"work/backend"}, Metadata: map[string]any{"jira": "PROJ-1", "hours": 3.0}, DueAt: at("2025-07-01"), CreatedAt: created},
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"a", "b", "c", "d"}},
+
+		// single terms and comparison operators
+		{"status:pending", []string{"a", "b"}},
+		{"STATUS:Pending", []string{"a", "b"}},
+		{"tag:work", []string{"a", "c"}},
+		{"tag:work/*", []string{"a", "c", "d"}},
+		{"priority:>=high", []string{"a", "c"}},
+		{"priority:<high", []string{"b"}},
+		{"priority:none", []string{"d"}},
+		{"due:<2025-07-01", []string{"a"}},
+		{"due:<=2025-07-01", []string{"a", "d"}},
+		{"due:>2025-06-15", []string{"d"}},
+		{"due:none", []string{"b", "c"}},
+		{"created:>=2025-06-05", []string{"b"}},
+		{"meta.jira:PROJ-1", []string{"d"}},
+		{"meta.hours:>2", []string{"d"}},
+		{"meta.hours:>5", nil},
+		{"plants", []string{"b"}},
+
+		// AND, explicit or implicit
+		{"status:pending tag:work", []string{"a"}},
+		{"status:pending AND tag:work", []string{"a"}},
+		{"tag:work priority:>=high due:none", []string{"c"}},
+
+		// NOT
+		{"-status:completed", []string{"a", "b", "d"}},
+		{"tag:work -priority:urgent", []string{"a"}},
+		{"-tag:work/* -due:none", nil},
+
+		// OR, and its precedence below AND
+		{"tag:home OR tag:work", []string{"a", "b", "c"}},
+		{"status:pending tag:work OR status:completed", []string{"a", "c"}},
+		{"status:completed OR status:pending tag:home", []string{"b", "c"}},
+		{"tag:home OR tag:work AND priority:urgent", []string{"b", "c"}},
+		{"-tag:work OR priority:urgent", []string{"b", "c", "d"}},
+
+		// grouping and nesting
+		{"status:pending (tag:work OR tag:home)", []string{"a", "b"}},
+		{"(status:pending tag:work) OR (status:completed)", []string{"a", "c"}},
+		{"tag:work/* -(priority:low OR due:none)", []string{"a", "d"}},
+		{"-(tag:home OR (status:completed priority:urgent))", []string{"a", "d"}},
+		{"((tag:home))", []string{"b"}},
+		{"(tag:work OR tag:home)(priority:low OR priority:urgent)", []string{"b", "c"}},
+
+		// quoting
+		{`"weekly report"`, []string{"c"}},
+		{`"(draft)"`, []string{"c"}},
+		{`tag:"work"`, []string{"a", "c"}},
+		{`"OR"`, []string{"c"}},
+		{"or", []string{"c"}},
+		{`-"plan sprint"`, []string{"b", "c", "d"}},
+	}
+	todos := queryTodos()
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			match, err := parseQuery(tt.query, defaultWorkflow(), now)
+			if err != nil {
+				t.Fatalf("parseQuery(%q): %v", tt.query, err)
+			}
+			var got []string
+			for _, todo := range todos {
+				if match(todo) {
+					got = append(got, todo.ID)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseQuery(%q) matches %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"colour:red", 1, `unknown field "colour"; want status, tag, priority, due, created or meta.KEY`},
+		{"status:pending colour:red", 16, `unknown field "colour"; want status, tag, priority, due, created or meta.KEY`},
+		{"status:done", 1, `unknown status "done"; want one of pending, in_progress, review, completed`},
+		{"status:>pending", 1, `status only supports equality, not ">"`},
+		{"tag:<work", 1, `tag only supports equality, not "<"`},
+		{"priority:huge", 1, `unknown priority "huge"; want low, medium, high, urgent or none`},
+		{"priority:>none", 1, "priority:none only supports equality"},
+		{"created:none", 1, "only due:none is supported"},
+		{"due:soon", 1, `due: invalid date "soon"; want YYYY-MM-DD, an RFC 3339 timestamp, today, tomorrow or now`},
+		{"meta.bad-key!:1", 1, `invalid metadata key "bad-key!"`},
+		{"tag:", 1, "tag needs a value"},
+		{"a -", 3, "empty term"},
+		{`"weekly report`, 1, "unterminated quote"},
+		{"tag:work OR", 10, "OR needs a term on each side"},
+		{"OR tag:work", 1, "OR needs a term on each side"},
+		{"tag:a OR OR tag:b", 10, "OR needs a term on each side"},
+		{"AND tag:work", 1, "AND needs a term on each side"},
+		{"tag:work AND", 10, "AND needs a term on each side"},
+		{"tag:a AND OR tag:b", 7, "AND needs a term on each side"},
+		{"(tag:work", 1, "unclosed parenthesis"},
+		{"((tag:work)", 1, "unclosed parenthesis"},
+		{"tag:work)", 9, "unexpected )"},
+		{")", 1, "unexpected )"},
+		{"()", 1, "empty parentheses"},
+		{"tag:a (OR tag:b)", 8, "OR needs a term on each side"},
+		{"(tag:a OR colour:red)", 11, `unknown field "colour"; want status, tag, priority, due, created or meta.KEY`},
+	}
+	now := time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := parseQuery(tt.query, defaultWorkflow(), now)
+			var qerr *queryError
+			if !errors.As(err, &qerr) {
+				t.Fatalf("parseQuery(%q) error = %v, want a queryError", tt.query, err)
+			}
+			if qerr.Pos != tt.pos || qerr.Msg != tt.msg {
+				t.Errorf("parseQuery(%q) error at %d: %q; want at %d: %q", tt.query, qerr.Pos, qerr.Msg, tt.pos, tt.msg)
+			}
+		})
+	}
+}
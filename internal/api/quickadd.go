@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"golang-todo/internal/quickadd"
+	"golang-todo/internal/store"
+)
+
+// POST /todos/quickadd
+func (s *server) handleQuickAdd(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Text string `json:"text"`
+		// Timezone is the IANA zone dates and times are meant in; the
+		// request's by default, see requestLocation
+		Timezone string `json:"timezone"`
+		// ProjectID wins over a project named in the text
+		ProjectID string `json:"project_id"`
+		// Preview returns the parsed todo without creating it
+		Preview bool `json:"preview"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc, err := s.requestLocation(r)
+	if req.Timezone != "" {
+		loc, err = loadTimezone(req.Timezone)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parsed := quickadd.Parse(req.Text, time.Now().In(loc))
+	if strings.TrimSpace(parsed.Title) == "" {
+		http.Error(w, "text needs a title besides dates, tags, priority and project", http.StatusBadRequest)
+		return
+	}
+	if req.ProjectID == "" && parsed.Project != "" {
+		project, ok := s.projects.find(parsed.Project)
+		if !ok {
+			http.Error(w, "unknown project +"+parsed.Project, http.StatusBadRequest)
+			return
+		}
+		req.ProjectID = project.ID
+	}
+	todo := store.Todo{
+		Title:     parsed.Title,
+		Tags:      parsed.Tags,
+		Priority:  store.TodoPriority(parsed.Priority),
+		ProjectID: req.ProjectID,
+		DueAt:     parsed.Due,
+	}
+	if todo.DueAt != nil {
+		todo.DueTimezone = loc.String()
+	}
+	if !req.Preview {
+		s.createTodo(w, r, todo)
+		return
+	}
+	if err := s.checkNewTodo(todo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, todo); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestQuickAddProject(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	w := serve(h, "POST", "/projects", `{"name":"Household"}`)
+	var project Project
+	if err := json.Unmarshal(w.Body.Bytes(), &project); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create project: %d %s", w.Code, w.Body)
+	}
+	tests := []struct {
+		body    string
+		status  int
+		project string
+	}{
+		{`{"text":"Pay rent +household","preview":true}`, http.StatusOK, project.ID},
+		{`{"text":"Pay rent +elsewhere","project_id":"` + project.ID + `","preview":true}`, http.StatusOK, project.ID},
+		{`{"text":"Pay rent +nowhere","preview":true}`, http.StatusBadRequest, ""},
+		{`{"text":"+household","preview":true}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := serve(h, "POST", "/todos/quickadd", tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.body, w.Code, tt.status, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var todo struct {
+			Title     string `json:"title"`
+			ProjectID string `json:"project_id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+			t.Fatal(err)
+		}
+		if todo.ProjectID != tt.project || todo.Title != "Pay rent" {
+			t.Errorf("%s: got %+v, want Pay rent in %s", tt.body, todo, tt.project)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// reminderMaxLate is how late a reminder may still be sent, e.g. after
+// the server was down when it was due; older ones are dropped
+const reminderMaxLate = time.Hour
+
+// reminderTime is when a todo's reminder is due, if it has one
+func reminderTime(todo store.Todo) (time.Time, bool) {
+	switch {
+	case todo.RemindAt != nil:
+		return *todo.RemindAt, true
+	case todo.RemindBeforeMinutes > 0 && todo.DueAt != nil:
+		return todo.DueAt.Add(-time.Duration(todo.RemindBeforeMinutes) * time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// optionalTime is a PATCH field that can be set to a time or cleared with
+// null, unlike a *time.Time, which can't tell null from absent
+type optionalTime struct {
+	set   bool
+	value *time.Time
+}
+
+func (o *optionalTime) UnmarshalJSON(data []byte) error {
+	o.set = true
+	return json.Unmarshal(data, &o.value)
+}
+
+// reminderScheduler remembers which reminders were sent, so each fires
+// once; changing a todo's reminder time arms it again
+type reminderScheduler struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+// due returns the todos whose reminders should be sent now and marks them
+// sent
+func (rs *reminderScheduler) due(todos []store.Todo, now time.Time) []store.Todo {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	sent := map[string]time.Time{}
+	var due []store.Todo
+	for _, todo := range todos {
+		at, ok := reminderTime(todo)
+		if !ok || todo.Status == store.StatusCompleted || todo.ArchivedAt != nil {
+			continue
+		}
+		if last, ok := rs.sent[todo.ID]; ok && last.Equal(at) {
+			sent[todo.ID] = at
+			continue
+		}
+		if at.After(now) {
+			continue
+		}
+		sent[todo.ID] = at
+		if now.Sub(at) <= reminderMaxLate {
+			due = append(due, todo)
+		}
+	}
+	// forgetting todos without reminders keeps the map small
+	rs.sent = sent
+	return due
+}
+
+// sentTimes returns the reminder time last sent for each todo
+func (rs *reminderScheduler) sentTimes() map[string]time.Time {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return maps.Clone(rs.sent)
+}
+
+// replaceSent swaps in the sent reminders, as loading a state file does,
+// so reminders sent before a restart don't fire again
+func (rs *reminderScheduler) replaceSent(sent map[string]time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.sent = maps.Clone(sent)
+}
+
+// runReminders sends due reminders every interval until ctx is cancelled
+func (s *server) runReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sendReminders(ctx, now)
+		}
+	}
+}
+
+// sendReminders notifies the owners of todos whose reminders are due
+func (s *server) sendReminders(ctx context.Context, now time.Time) {
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		log.Printf("reminders: failed to list todos: %v", err)
+		return
+	}
+	for _, todo := range s.reminders.due(todos, now) {
+		owner, ok := s.todoOwner(todo)
+		user, known := s.users.get(owner)
+		if !ok || !known {
+			// only known users have somewhere to send reminders to
+			continue
+		}
+		s.notifications.notify(ctx, user, reminderNotification(todo, s.userLocation(user.ID)))
+	}
+}
+
+// reminderNotification tells of a todo, with its due time as the clock
+// reads in loc
+func reminderNotification(todo store.Todo, loc *time.Location) notification {
+	text := todo.Title
+	if todo.DueAt != nil {
+		text = fmt.Sprintf("%s is due %s.", todo.Title, todo.DueAt.In(loc).Format("Mon 2 Jan 15:04 MST"))
+	}
+	if todo.Description != "" {
+		text += "\n\n" + todo.Description
+	}
+	return notification{TodoID: todo.ID, Subject: "Reminder: " + todo.Title, Text: text}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// decodeJSON is a helper function that decodes JSON request body into a target struct
+// using generics for type-safe JSON decoding
+func decodeJSON[T any](r *http.Request) (T, error) {
+	var v T
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		return v, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	defer r.Body.Close()
+	return v, nil
+}
+
+// respondJSON is a helper function that writes JSON response with proper headers
+func respondJSON(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// problem is an RFC 9457 problem details body
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// respondProblem is a helper function that writes an application/problem+json error response
+func respondProblem(w http.ResponseWriter, status int, title, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{Type: "about:blank", Title: title, Status: status, Detail: detail})
+}
+
+// respondError answers a request whose backend call failed. A call that
+// ran out of time or was cancelled is a 503 with problem+json, so clients
+// know to retry; anything else is a 500. Requests that run past their
+// route's timeout get a 504 from the middleware instead.
+func respondError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		w.Header().Set("Retry-After", "1")
+		respondProblem(w, http.StatusServiceUnavailable, "Backend timed out", err.Error())
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
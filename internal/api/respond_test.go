@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{"store error", errors.New("disk full"), http.StatusInternalServerError, ""},
+		{"deadline", fmt.Errorf("list todos: %w", context.DeadlineExceeded), http.StatusServiceUnavailable, "1"},
+		{"cancelled", context.Canceled, http.StatusServiceUnavailable, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondError(w, tt.err)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.retryAfter)
+			}
+			if !strings.Contains(w.Body.String(), tt.err.Error()) {
+				t.Errorf("body %q doesn't explain %q", w.Body.String(), tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// reviewStaleAfter is how long an open todo can go untouched before a
+// weekly review brings it up as stale
+const reviewStaleAfter = 14 * 24 * time.Hour
+
+// Reasons a todo is queued for review
+const (
+	reviewOverdue   = "overdue"
+	reviewStale     = "stale"
+	reviewNoDueDate = "no_due_date"
+	reviewUntagged  = "untagged"
+	reviewPostponed = "postponed"
+)
+
+// Review decisions. Keep and skip change nothing; the others change the
+// todo the way their names say.
+const (
+	decisionKeep     = "keep"
+	decisionComplete = "complete"
+	decisionSchedule = "schedule"
+	decisionTag      = "tag"
+	decisionDelete   = "delete"
+	decisionSkip     = "skip"
+)
+
+// ReviewItem is one todo in a review queue
+type ReviewItem struct {
+	TodoID  string   `json:"todo_id"`
+	Title   string   `json:"title"`
+	Reasons []string `json:"reasons"`
+	// Decision is empty until the item has been reviewed
+	Decision  string     `json:"decision,omitempty"`
+	Note      string     `json:"note,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+}
+
+// Review is a weekly review session: a queue of open todos needing
+// attention, stepped through one at a time
+type Review struct {
+	ID         string       `json:"id"`
+	User       string       `json:"user"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Items      []ReviewItem `json:"items"`
+	// Current is the index of the first undecided item; it equals the
+	// number of items once all are decided
+	Current int `json:"current"`
+}
+
+// advance moves Current past decided items
+func (rv *Review) advance() {
+	for rv.Current < len(rv.Items) && rv.Items[rv.Current].Decision != "" {
+		rv.Current++
+	}
+}
+
+// reviewSummary reports what a review decided
+type reviewSummary struct {
+	ReviewID        string         `json:"review_id"`
+	DurationSeconds int64          `json:"duration_seconds"`
+	Reviewed        int            `json:"reviewed"`
+	Remaining       int            `json:"remaining"`
+	Decisions       map[string]int `json:"decisions"`
+	// ByReason counts the queued todos by why they were queued
+	ByReason map[string]int `json:"by_reason"`
+}
+
+func (rv Review) summary(now time.Time) reviewSummary {
+	end := now
+	if rv.FinishedAt != nil {
+		end = *rv.FinishedAt
+	}
+	sum := reviewSummary{
+		ReviewID:        rv.ID,
+		DurationSeconds: int64(end.Sub(rv.StartedAt) / time.Second),
+		Decisions:       map[string]int{},
+		ByReason:        map[string]int{},
+	}
+	for _, item := range rv.Items {
+		if item.Decision == "" {
+			sum.Remaining++
+		} else {
+			sum.Reviewed++
+			sum.Decisions[item.Decision]++
+		}
+		for _, reason := range item.Reasons {
+			sum.ByReason[reason]++
+		}
+	}
+	return sum
+}
+
+// reviewReasons says why an open todo needs reviewing, if it does, going by
+// the todo and its touches
+func reviewReasons(todo store.Todo, touches touchRecord, now time.Time) []string {
+	var reasons []string
+	if todo.DueAt != nil && todo.DueAt.Before(now) {
+		reasons = append(reasons, reviewOverdue)
+	}
+	if now.Sub(touches.lastTouched(todo.UpdatedAt)) > reviewStaleAfter {
+		reasons = append(reasons, reviewStale)
+	}
+	if todo.DueAt == nil {
+		reasons = append(reasons, reviewNoDueDate)
+	}
+	if len(todo.Tags) == 0 {
+		reasons = append(reasons, reviewUntagged)
+	}
+	if touches.counts[touchPostponed] >= insightPostponedAfter {
+		reasons = append(reasons, reviewPostponed)
+	}
+	return reasons
+}
+
+// reviewQueue lists the open todos needing review, overdue ones first, then
+// those with the most reasons, oldest first among equals
+func reviewQueue(todos []store.Todo, touches *touchRegistry, now time.Time) []ReviewItem {
+	open := slices.DeleteFunc(todos, func(t store.Todo) bool { return t.Status == store.StatusCompleted })
+	slices.SortStableFunc(open, func(a, b store.Todo) int { return a.UpdatedAt.Compare(b.UpdatedAt) })
+	items := []ReviewItem{}
+	for _, todo := range open {
+		if reasons := reviewReasons(todo, touches.get(todo.ID), now); len(reasons) > 0 {
+			items = append(items, ReviewItem{TodoID: todo.ID, Title: todo.Title, Reasons: reasons})
+		}
+	}
+	slices.SortStableFunc(items, func(a, b ReviewItem) int {
+		overdue := func(i ReviewItem) bool { return i.Reasons[0] == reviewOverdue }
+		switch {
+		case overdue(a) && !overdue(b):
+			return -1
+		case overdue(b) && !overdue(a):
+			return 1
+		}
+		return len(b.Reasons) - len(a.Reasons)
+	})
+	return items
+}
+
+// reviewRegistry holds review sessions, oldest first
+type reviewRegistry struct {
+	mu      sync.Mutex
+	reviews []*Review
+}
+
+func (rr *reviewRegistry) add(rv *Review) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.reviews = append(rr.reviews, rv)
+}
+
+// list returns the sessions of user, or every session for ""
+func (rr *reviewRegistry) list(user string) []Review {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	reviews := []Review{}
+	for _, rv := range rr.reviews {
+		if user == "" || rv.User == user {
+			reviews = append(reviews, rv.snapshot())
+		}
+	}
+	return reviews
+}
+
+// replace swaps in a whole new set of sessions, as loading a state file
+// does
+func (rr *reviewRegistry) replace(reviews []Review) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.reviews = make([]*Review, len(reviews))
+	for i := range reviews {
+		rv := reviews[i].snapshot()
+		rr.reviews[i] = &rv
+	}
+}
+
+func (rr *reviewRegistry) get(id string) (Review, bool) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	for _, rv := range rr.reviews {
+		if rv.ID == id {
+			return rv.snapshot(), true
+		}
+	}
+	return Review{}, false
+}
+
+// update runs fn on the session with id while holding the lock
+func (rr *reviewRegistry) update(id string, fn func(*Review) error) (Review, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	for _, rv := range rr.reviews {
+		if rv.ID == id {
+			err := fn(rv)
+			return rv.snapshot(), err
+		}
+	}
+	return Review{}, store.ErrNotFound
+}
+
+func (rv *Review) snapshot() Review {
+	c := *rv
+	c.Items = slices.Clone(rv.Items)
+	return c
+}
+
+// errReviewFinished refuses decisions once a review is finished
+var errReviewFinished = errors.New("the review is finished")
+
+// reviewFor looks up a review the request may see: its user's own, or any
+// for an admin
+func (s *server) reviewFor(w http.ResponseWriter, r *http.Request) (Review, bool) {
+	rv, ok := s.reviews.get(r.PathValue("id"))
+	if !ok || !s.canManageUser(r, rv.User) {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return Review{}, false
+	}
+	return rv, true
+}
+
+// reviewResponse is a session along with the todo to review next
+type reviewResponse struct {
+	Review
+	Next *store.Todo `json:"next,omitempty"`
+}
+
+// respondReview answers with a session and its next todo
+func (s *server) respondReview(ctx context.Context, w http.ResponseWriter, status int, rv Review) {
+	resp := reviewResponse{Review: rv}
+	if rv.Current < len(rv.Items) {
+		if todo, err := s.store.Get(ctx, rv.Items[rv.Current].TodoID); err == nil {
+			resp.Next = &s.decorate(todo)[0]
+		}
+	}
+	if err := respondJSON(w, status, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /reviews
+func (s *server) handleStartReview(w http.ResponseWriter, r *http.Request) {
+	todos, err := s.listTodos(r)
+	if err != nil {
+		respondListError(w, err)
+		return
+	}
+	now := time.Now()
+	rv := &Review{
+		ID:        uuid.New().String(),
+		User:      actorFromRequest(r),
+		StartedAt: now,
+		Items:     reviewQueue(todos, s.touches, now),
+	}
+	s.reviews.add(rv)
+	s.respondReview(r.Context(), w, http.StatusCreated, rv.snapshot())
+}
+
+// GET /reviews
+func (s *server) handleListReviews(w http.ResponseWriter, r *http.Request) {
+	user := actorFromRequest(r)
+	if s.isAdmin(r) {
+		user = r.URL.Query().Get("user")
+	}
+	if err := respondJSON(w, http.StatusOK, s.reviews.list(user)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /reviews/{id}
+func (s *server) handleGetReview(w http.ResponseWriter, r *http.Request) {
+	if rv, ok := s.reviewFor(w, r); ok {
+		s.respondReview(r.Context(), w, http.StatusOK, rv)
+	}
+}
+
+// POST /reviews/{id}/items/{todo_id}
+func (s *server) handleDecideReviewItem(w http.ResponseWriter, r *http.Request) {
+	rv, ok := s.reviewFor(w, r)
+	if !ok {
+		return
+	}
+	req, err := decodeJSON[struct {
+		Decision string     `json:"decision"`
+		DueAt    *time.Time `json:"due_at"`
+		Tags     []string   `json:"tags"`
+		Note     string     `json:"note"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch req.Decision {
+	case decisionKeep, decisionComplete, decisionDelete, decisionSkip:
+	case decisionSchedule:
+		if req.DueAt == nil {
+			http.Error(w, "schedule needs a due_at", http.StatusBadRequest)
+			return
+		}
+	case decisionTag:
+		if req.Tags = normalizeTags(req.Tags); len(req.Tags) == 0 {
+			http.Error(w, "tag needs tags", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "decision must be keep, complete, schedule, tag, delete or skip", http.StatusBadRequest)
+		return
+	}
+	todoID := r.PathValue("todo_id")
+	i := slices.IndexFunc(rv.Items, func(item ReviewItem) bool { return item.TodoID == todoID })
+	if i < 0 {
+		http.Error(w, "todo "+todoID+" is not in this review", http.StatusNotFound)
+		return
+	}
+	if rv.FinishedAt != nil {
+		http.Error(w, errReviewFinished.Error(), http.StatusConflict)
+		return
+	}
+	if rv.Items[i].Decision != "" {
+		http.Error(w, "todo "+todoID+" was already reviewed as "+rv.Items[i].Decision, http.StatusConflict)
+		return
+	}
+
+	now, actor := time.Now(), actorFromRequest(r)
+	if req.Decision != decisionKeep && req.Decision != decisionSkip {
+		if status, err := s.applyReviewDecision(r, todoID, req.Decision, req.DueAt, req.Tags, actor, now); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	rv, err = s.reviews.update(rv.ID, func(rv *Review) error {
+		if rv.FinishedAt != nil {
+			return errReviewFinished
+		}
+		rv.Items[i].Decision, rv.Items[i].Note, rv.Items[i].DecidedAt = req.Decision, req.Note, &now
+		rv.advance()
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.respondReview(r.Context(), w, http.StatusOK, rv)
+}
+
+// applyReviewDecision makes the change a decision stands for, returning
+// the status to answer with if it fails
+func (s *server) applyReviewDecision(r *http.Request, id, decision string, dueAt *time.Time, tags []string, actor string, now time.Time) (int, error) {
+	todo, err := s.store.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return http.StatusGone, errors.New("the todo no longer exists; skip it")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var events []store.Event
+	switch decision {
+	case decisionDelete:
+		deleted := store.NewEvent(store.EventTodoDeleted, actor, todo)
+		if err := s.store.Delete(r.Context(), id, s.outboxEvents(deleted)...); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		s.emitFor(r, deleted)
+		return http.StatusOK, nil
+	case decisionComplete:
+		if todo, events, err = s.applyStatus(todo, store.StatusCompleted, actor, now); err != nil {
+			return http.StatusConflict, fmt.Errorf("can't complete the todo: %w", err)
+		}
+	case decisionSchedule:
+		todo, events = applyUpdate(todo, actor, now, func(t *store.Todo) { t.DueAt = dueAt })
+	case decisionTag:
+		todo, events = applyUpdate(todo, actor, now, func(t *store.Todo) { t.Tags = normalizeTags(append(t.Tags, tags...)) })
+	}
+	if err := s.store.Update(r.Context(), todo, s.outboxEvents(events...)...); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	s.emitFor(r, events...)
+	return http.StatusOK, nil
+}
+
+// POST /reviews/{id}/finish
+func (s *server) handleFinishReview(w http.ResponseWriter, r *http.Request) {
+	rv, ok := s.reviewFor(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	rv, _ = s.reviews.update(rv.ID, func(rv *Review) error {
+		if rv.FinishedAt == nil {
+			rv.FinishedAt = &now
+		}
+		return nil
+	})
+	if err := respondJSON(w, http.StatusOK, rv.summary(now)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /reviews/{id}/summary
+func (s *server) handleReviewSummary(w http.ResponseWriter, r *http.Request) {
+	rv, ok := s.reviewFor(w, r)
+	if !ok {
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, rv.summary(time.Now())); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// scheduleEntry is the computed schedule of one open todo. Times assume
+// work starts now and each todo takes its estimate once its blockers are
+// done; unestimated todos count as taking no time.
+type scheduleEntry struct {
+	ID             string           `json:"id"`
+	Title          string           `json:"title"`
+	Status         store.TodoStatus `json:"status"`
+	Estimate       int              `json:"estimate_minutes"`
+	Unestimated    bool             `json:"unestimated,omitempty"`
+	SuggestedStart time.Time        `json:"suggested_start"`
+	EarliestFinish time.Time        `json:"earliest_finish"`
+	// LatestStart is the last moment the todo can start without making it,
+	// or anything it blocks, miss a due date or delay the overall finish
+	LatestStart  time.Time  `json:"latest_start"`
+	DueAt        *time.Time `json:"due_at,omitempty"`
+	SlackMinutes int        `json:"slack_minutes"`
+	Critical     bool       `json:"critical,omitempty"`
+	// AtRisk means the todo can't finish by its due date even if started
+	// as early as its blockers allow
+	AtRisk bool `json:"at_risk,omitempty"`
+}
+
+// scheduleResponse is the result of GET /todos/schedule
+type scheduleResponse struct {
+	GeneratedAt  time.Time       `json:"generated_at"`
+	Finish       time.Time       `json:"finish"`
+	CriticalPath []string        `json:"critical_path"`
+	AtRisk       []string        `json:"at_risk"`
+	Todos        []scheduleEntry `json:"todos"`
+}
+
+// buildSchedule runs a critical path analysis over the open todos: a
+// forward pass through blocked_by finds the earliest each todo can start
+// and finish, a backward pass from due dates and the overall finish finds
+// the latest it can start. Completed and missing blockers don't delay
+// anything, and links that would form a cycle are ignored.
+func buildSchedule(todos []store.Todo, now time.Time) scheduleResponse {
+	open := map[string]store.Todo{}
+	var order []string
+	for _, todo := range todos {
+		if todo.Status != store.StatusCompleted {
+			open[todo.ID] = todo
+			order = append(order, todo.ID)
+		}
+	}
+	duration := func(t store.Todo) time.Duration { return time.Duration(t.EstimateMinutes) * time.Minute }
+
+	// forward pass, in dependency order
+	start, finish := map[string]time.Time{}, map[string]time.Time{}
+	driver := map[string]string{}
+	var topo []string
+	visiting := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		if _, done := finish[id]; done || visiting[id] {
+			return
+		}
+		visiting[id] = true
+		es := now
+		for _, blocker := range open[id].BlockedBy {
+			if _, ok := open[blocker]; !ok {
+				continue
+			}
+			visit(blocker)
+			if ef, ok := finish[blocker]; ok && ef.After(es) {
+				es, driver[id] = ef, blocker
+			}
+		}
+		visiting[id] = false
+		start[id], finish[id] = es, es.Add(duration(open[id]))
+		topo = append(topo, id)
+	}
+	for _, id := range order {
+		visit(id)
+	}
+
+	end := now
+	last := ""
+	for _, id := range topo {
+		if finish[id].After(end) {
+			end, last = finish[id], id
+		}
+	}
+
+	// backward pass, dependents before their blockers
+	latestFinish := map[string]time.Time{}
+	for _, id := range topo {
+		latestFinish[id] = end
+		if due := open[id].DueAt; due != nil && due.Before(end) {
+			latestFinish[id] = *due
+		}
+	}
+	for i := len(topo) - 1; i >= 0; i-- {
+		id := topo[i]
+		ls := latestFinish[id].Add(-duration(open[id]))
+		for _, blocker := range open[id].BlockedBy {
+			if lf, ok := latestFinish[blocker]; ok && ls.Before(lf) {
+				latestFinish[blocker] = ls
+			}
+		}
+	}
+
+	resp := scheduleResponse{GeneratedAt: now, Finish: end, CriticalPath: []string{}, AtRisk: []string{}, Todos: []scheduleEntry{}}
+	for id := last; id != ""; id = driver[id] {
+		resp.CriticalPath = append(resp.CriticalPath, id)
+	}
+	slices.Reverse(resp.CriticalPath)
+
+	for _, id := range topo {
+		todo := open[id]
+		ls := latestFinish[id].Add(-duration(todo))
+		entry := scheduleEntry{
+			ID:             id,
+			Title:          todo.Title,
+			Status:         todo.Status,
+			Estimate:       todo.EstimateMinutes,
+			Unestimated:    todo.EstimateMinutes == 0,
+			SuggestedStart: start[id],
+			EarliestFinish: finish[id],
+			LatestStart:    ls,
+			DueAt:          todo.DueAt,
+			SlackMinutes:   int(ls.Sub(start[id]) / time.Minute),
+			Critical:       slices.Contains(resp.CriticalPath, id),
+			AtRisk:         todo.DueAt != nil && finish[id].After(*todo.DueAt),
+		}
+		if entry.AtRisk {
+			resp.AtRisk = append(resp.AtRisk, id)
+		}
+		resp.Todos = append(resp.Todos, entry)
+	}
+	slices.SortStableFunc(resp.Todos, func(a, b scheduleEntry) int {
+		if c := a.SuggestedStart.Compare(b.SuggestedStart); c != 0 {
+			return c
+		}
+		return a.LatestStart.Compare(b.LatestStart)
+	})
+	return resp
+}
+
+// GET /todos/schedule
+func (s *server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	resp := buildSchedule(todos, time.Now().Truncate(time.Minute))
+
+	// dependencies can cross projects, so filter after scheduling everything
+	if projectID := r.URL.Query().Get("project_id"); projectID != "" {
+		inProject := map[string]bool{}
+		for _, todo := range todos {
+			inProject[todo.ID] = todo.ProjectID == projectID
+		}
+		resp.Todos = slices.DeleteFunc(resp.Todos, func(e scheduleEntry) bool { return !inProject[e.ID] })
+		resp.AtRisk = slices.DeleteFunc(resp.AtRisk, func(id string) bool { return !inProject[id] })
+	}
+
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
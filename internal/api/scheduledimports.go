@@ -0,0 +1,494 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/secrets"
+)
+
+const (
+	// importRunHistory is how many runs are kept per scheduled import
+	importRunHistory = 20
+	// minImportInterval keeps schedules from hammering the source
+	minImportInterval = time.Minute
+	// importFetchTimeout bounds downloading one export
+	importFetchTimeout = time.Minute
+)
+
+// importCredentials authenticate against the import source. Values may be
+// secret store references such as "env:JIRA_TOKEN", which are resolved
+// for every run so rotated secrets are picked up.
+type importCredentials struct {
+	BearerToken string `json:"bearer_token,omitempty" yaml:"bearer_token,omitempty"`
+	Username    string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password    string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// public hides secrets that aren't references, which are safe to show
+func (c importCredentials) public() importCredentials {
+	hide := func(v string) string {
+		if v == "" || secrets.IsRef(v) {
+			return v
+		}
+		return "********"
+	}
+	return importCredentials{BearerToken: hide(c.BearerToken), Username: c.Username, Password: hide(c.Password)}
+}
+
+// scheduledImport fetches an export from URL every Interval and imports
+// it. Re-runs only add new records: rows whose id or external_ref already
+// exists are skipped.
+type scheduledImport struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Mapping is the stored import mapping to read the export with;
+	// without one Format must be json or csv exports of this server
+	Mapping     string            `json:"mapping,omitempty"`
+	Format      string            `json:"format,omitempty"`
+	Credentials importCredentials `json:"credentials"`
+	Interval    duration          `json:"interval"`
+	Paused      bool              `json:"paused"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CreatedBy   string            `json:"created_by"`
+	NextRunAt   time.Time         `json:"next_run_at"`
+	LastRun     *importRun        `json:"last_run,omitempty"`
+	runs        []importRun
+	running     bool
+}
+
+// importRun is one run of a scheduled import
+type importRun struct {
+	ID         string    `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Trigger is schedule or manual
+	Trigger string `json:"trigger"`
+	// Status is ok, partial when some rows errored, or failed
+	Status string `json:"status"`
+	// Error says why a failed run couldn't import anything
+	Error  string        `json:"error,omitempty"`
+	Report *importReport `json:"report,omitempty"`
+}
+
+// duration is a time.Duration written as a string such as "1h" in JSON
+type duration time.Duration
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// view is a scheduled import as the API shows it
+func (si *scheduledImport) view() scheduledImport {
+	v := *si
+	v.Credentials = si.Credentials.public()
+	v.runs = nil
+	return v
+}
+
+// importScheduler holds the scheduled imports
+type importScheduler struct {
+	mu      sync.Mutex
+	imports []*scheduledImport
+	client  *http.Client
+}
+
+func (is *importScheduler) add(si *scheduledImport) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.imports = append(is.imports, si)
+}
+
+func (is *importScheduler) get(id string) (scheduledImport, []importRun, bool) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	for _, si := range is.imports {
+		if si.ID == id {
+			return si.view(), slices.Clone(si.runs), true
+		}
+	}
+	return scheduledImport{}, nil, false
+}
+
+func (is *importScheduler) list() []scheduledImport {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	list := make([]scheduledImport, len(is.imports))
+	for i, si := range is.imports {
+		list[i] = si.view()
+	}
+	return list
+}
+
+// all returns every import with its credentials and runs, as a state file
+// keeps them
+func (is *importScheduler) all() []scheduledImport {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	list := make([]scheduledImport, len(is.imports))
+	for i, si := range is.imports {
+		list[i] = *si
+		list[i].runs = slices.Clone(si.runs)
+		list[i].running = false
+	}
+	return list
+}
+
+// replace swaps in a whole new set of imports, as loading a state file
+// does
+func (is *importScheduler) replace(imports []scheduledImport) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.imports = make([]*scheduledImport, len(imports))
+	for i := range imports {
+		si := imports[i]
+		si.running = false
+		if si.LastRun = nil; len(si.runs) > 0 {
+			si.LastRun = &si.runs[len(si.runs)-1]
+		}
+		is.imports[i] = &si
+	}
+}
+
+// configure adds si, or updates the settings of the import with its ID
+// and keeps that import's runs and next run
+func (is *importScheduler) configure(si scheduledImport) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	for _, existing := range is.imports {
+		if existing.ID == si.ID {
+			existing.Name, existing.URL, existing.Mapping, existing.Format = si.Name, si.URL, si.Mapping, si.Format
+			existing.Credentials, existing.Interval, existing.Paused = si.Credentials, si.Interval, si.Paused
+			return
+		}
+	}
+	is.imports = append(is.imports, &si)
+}
+
+func (is *importScheduler) remove(id string) bool {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	n := len(is.imports)
+	is.imports = slices.DeleteFunc(is.imports, func(si *scheduledImport) bool { return si.ID == id })
+	return len(is.imports) < n
+}
+
+// setPaused pauses or resumes an import; resuming schedules the next run
+// an interval from now
+func (is *importScheduler) setPaused(id string, paused bool, now time.Time) (scheduledImport, bool) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	for _, si := range is.imports {
+		if si.ID == id {
+			if si.Paused && !paused {
+				si.NextRunAt = now.Add(time.Duration(si.Interval))
+			}
+			si.Paused = paused
+			return si.view(), true
+		}
+	}
+	return scheduledImport{}, false
+}
+
+// claim marks an import as running and returns a copy to run, unless it
+// is already running. due limits it to imports whose next run has come.
+func (is *importScheduler) claim(id string, due bool, now time.Time) (scheduledImport, bool) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	for _, si := range is.imports {
+		if si.ID != id || si.running || (due && (si.Paused || now.Before(si.NextRunAt))) {
+			continue
+		}
+		si.running = true
+		return *si, true
+	}
+	return scheduledImport{}, false
+}
+
+// dueIDs lists the imports whose next run has come
+func (is *importScheduler) dueIDs(now time.Time) []string {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	var ids []string
+	for _, si := range is.imports {
+		if !si.Paused && !si.running && !now.Before(si.NextRunAt) {
+			ids = append(ids, si.ID)
+		}
+	}
+	return ids
+}
+
+// finish records a run and schedules the next one
+func (is *importScheduler) finish(id string, run importRun) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	for _, si := range is.imports {
+		if si.ID != id {
+			continue
+		}
+		si.running = false
+		si.runs = append(si.runs, run)
+		if len(si.runs) > importRunHistory {
+			si.runs = si.runs[len(si.runs)-importRunHistory:]
+		}
+		si.LastRun = &si.runs[len(si.runs)-1]
+		si.NextRunAt = run.FinishedAt.Add(time.Duration(si.Interval))
+	}
+}
+
+// runImportSchedules starts due imports every interval until ctx is
+// cancelled
+func (s *server) runImportSchedules(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, id := range s.imports.dueIDs(now) {
+				if si, ok := s.imports.claim(id, true, now); ok {
+					go s.runImport(ctx, si, "schedule")
+				}
+			}
+		}
+	}
+}
+
+// runImport runs a claimed import and records the run
+func (s *server) runImport(ctx context.Context, si scheduledImport, trigger string) importRun {
+	run := importRun{ID: uuid.New().String(), StartedAt: time.Now(), Trigger: trigger}
+	report, err := s.fetchAndImport(ctx, si)
+	run.FinishedAt = time.Now()
+	switch {
+	case err != nil:
+		run.Status, run.Error = "failed", err.Error()
+		log.Printf("scheduled import %s (%s) failed: %v", si.Name, si.ID, err)
+	case len(report.Errored) > 0:
+		run.Status, run.Report = "partial", &report
+	default:
+		run.Status, run.Report = "ok", &report
+	}
+	s.imports.finish(si.ID, run)
+	return run
+}
+
+// fetchAndImport downloads the export and imports its rows
+func (s *server) fetchAndImport(ctx context.Context, si scheduledImport) (importReport, error) {
+	parse := importParsers[si.Format]
+	if si.Mapping != "" {
+		mapping, ok := s.importMappings.get(si.Mapping)
+		if !ok {
+			return importReport{}, fmt.Errorf("import mapping %q no longer exists", si.Mapping)
+		}
+		parse = mapping.parse
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, importFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, si.URL, nil)
+	if err != nil {
+		return importReport{}, err
+	}
+	creds := si.Credentials
+	for _, v := range []*string{&creds.BearerToken, &creds.Username, &creds.Password} {
+		if *v, err = secrets.Resolve(ctx, *v); err != nil {
+			return importReport{}, fmt.Errorf("resolving credentials: %w", err)
+		}
+	}
+	switch {
+	case creds.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+creds.BearerToken)
+	case creds.Username != "":
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := s.imports.client.Do(req)
+	if err != nil {
+		return importReport{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return importReport{}, fmt.Errorf("source answered %s", resp.Status)
+	}
+	body := io.LimitReader(resp.Body, s.maxImportSize+1)
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return importReport{}, err
+	}
+	if int64(len(data)) > s.maxImportSize {
+		return importReport{}, fmt.Errorf("export is larger than %d bytes", s.maxImportSize)
+	}
+	rows, err := parse(bytes.NewReader(data))
+	if err != nil {
+		return importReport{}, err
+	}
+	report, err := s.importRows(ctx, rows, false, "import:"+si.ID)
+	report.Format, report.Mapping = si.Format, si.Mapping
+	return report, err
+}
+
+// checkScheduledImport validates a new scheduled import, looking up its
+// mapping with mappings
+func checkScheduledImport(si *scheduledImport, mappings func(source string) (*importMapping, bool)) error {
+	if strings.TrimSpace(si.Name) == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(si.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http:// or https:// URL")
+	}
+	if time.Duration(si.Interval) < minImportInterval {
+		return fmt.Errorf("interval must be at least %s", minImportInterval)
+	}
+	if si.Mapping != "" {
+		mapping, ok := mappings(si.Mapping)
+		if !ok {
+			return fmt.Errorf("no import mapping for %q; create one with PUT /import/mappings/%s", si.Mapping, si.Mapping)
+		}
+		// without a stable key every run would import the same records again
+		if !slices.ContainsFunc(mapping.Fields, func(f fieldMapping) bool { return f.To == "external_ref" || f.To == "id" }) {
+			return fmt.Errorf("mapping %q must map a field to external_ref so runs can skip records they already imported", si.Mapping)
+		}
+		si.Format = mapping.Format
+		return nil
+	}
+	if si.Format != "json" && si.Format != "csv" {
+		return errors.New("set mapping, or format to json or csv for exports of this server, which carry ids")
+	}
+	return nil
+}
+
+// POST /admin/imports
+func (s *server) handleCreateScheduledImport(w http.ResponseWriter, r *http.Request) {
+	si, err := decodeJSON[scheduledImport](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkScheduledImport(&si, s.importMappings.get); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	si.ID, si.CreatedAt, si.CreatedBy = uuid.New().String(), now, actorFromRequest(r)
+	// the first run comes right away, so a broken source shows up early
+	si.NextRunAt, si.LastRun, si.runs, si.running = now, nil, nil, false
+	s.imports.add(&si)
+	if err := respondJSON(w, http.StatusCreated, si.view()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/imports
+func (s *server) handleListScheduledImports(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.imports.list()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/imports/{id}
+func (s *server) handleGetScheduledImport(w http.ResponseWriter, r *http.Request) {
+	si, _, ok := s.imports.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Scheduled import not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, si); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /admin/imports/{id}
+func (s *server) handleDeleteScheduledImport(w http.ResponseWriter, r *http.Request) {
+	if !s.imports.remove(r.PathValue("id")) {
+		http.Error(w, "Scheduled import not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PATCH /admin/imports/{id}
+func (s *server) handlePauseScheduledImport(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Paused *bool `json:"paused"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Paused == nil {
+		http.Error(w, "paused is required", http.StatusBadRequest)
+		return
+	}
+	si, ok := s.imports.setPaused(r.PathValue("id"), *req.Paused, time.Now())
+	if !ok {
+		http.Error(w, "Scheduled import not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, si); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/imports/{id}/run
+func (s *server) handleRunScheduledImport(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	si, ok := s.imports.claim(id, false, time.Now())
+	if !ok {
+		if _, _, exists := s.imports.get(id); exists {
+			http.Error(w, "the import is already running", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Scheduled import not found", http.StatusNotFound)
+		return
+	}
+	run := s.runImport(r.Context(), si, "manual")
+	if err := respondJSON(w, http.StatusOK, run); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/imports/{id}/runs
+func (s *server) handleListImportRuns(w http.ResponseWriter, r *http.Request) {
+	_, runs, ok := s.imports.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Scheduled import not found", http.StatusNotFound)
+		return
+	}
+	// newest first
+	slices.Reverse(runs)
+	if runs == nil {
+		runs = []importRun{}
+	}
+	if err := respondJSON(w, http.StatusOK, runs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
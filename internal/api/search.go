@@ -0,0 +1,345 @@
+package api
+
+import (
+	"errors"
+	"html"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang-todo/internal/store"
+)
+
+// Search ranking weights: title matches count more than description
+// matches, and a query term matching only as a prefix counts less than an
+// exact word
+const (
+	searchTitleWeight  = 2.0
+	searchPrefixWeight = 0.5
+	searchSnippetRunes = 160
+)
+
+// defaultSearchPageSize and maxSearchPageSize bound GET /todos/search
+// pages; see routePageLimits
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// posting counts the occurrences of a term in one todo
+type posting struct {
+	title, description int
+}
+
+// searchIndex is an in-memory inverted index over todo titles and
+// descriptions, kept current by listening to todo events
+type searchIndex struct {
+	mu       sync.RWMutex
+	postings map[string]map[string]posting // term -> todo ID -> counts
+	lengths  map[string]int                // todo ID -> indexed token count
+	terms    map[string][]string           // todo ID -> distinct terms
+	// pending holds the events observed while the index loads in the
+	// background; they are replayed on top of the loaded todos
+	loading bool
+	pending []store.Event
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: map[string]map[string]posting{},
+		lengths:  map[string]int{},
+		terms:    map[string][]string{},
+	}
+}
+
+// tokenSpans returns the byte offsets of the words in s
+func tokenSpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		} else if !word && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// tokenize splits s into lowercase words
+func tokenize(s string) []string {
+	spans := tokenSpans(s)
+	tokens := make([]string, len(spans))
+	for i, span := range spans {
+		tokens[i] = strings.ToLower(s[span[0]:span[1]])
+	}
+	return tokens
+}
+
+// beginLoad starts holding events back for a rebuild from todos listed
+// after this call, so whatever changes while they load isn't lost
+func (x *searchIndex) beginLoad() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.loading = true
+}
+
+// rebuild replaces the index contents with todos, then replays the events
+// held back since beginLoad
+func (x *searchIndex) rebuild(todos []store.Todo) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.postings = map[string]map[string]posting{}
+	x.lengths = map[string]int{}
+	x.terms = map[string][]string{}
+	for _, todo := range todos {
+		x.add(todo)
+	}
+	pending := x.pending
+	x.loading, x.pending = false, nil
+	for _, evt := range pending {
+		x.apply(evt)
+	}
+}
+
+// observe is an event listener keeping the index in sync with the store
+func (x *searchIndex) observe(evt store.Event) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.loading {
+		x.pending = append(x.pending, evt)
+		return
+	}
+	x.apply(evt)
+}
+
+func (x *searchIndex) apply(evt store.Event) {
+	switch evt.Type {
+	case store.EventTodoCreated, store.EventTodoUpdated:
+		x.remove(evt.Todo.ID)
+		x.add(evt.Todo)
+	case store.EventTodoDeleted:
+		x.remove(evt.Todo.ID)
+	}
+}
+
+// forget drops a todo that has left the store without an event
+func (x *searchIndex) forget(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *searchIndex) add(todo store.Todo) {
+	counts := map[string]posting{}
+	title, description := tokenize(todo.Title), tokenize(todo.Description)
+	for _, term := range title {
+		p := counts[term]
+		p.title++
+		counts[term] = p
+	}
+	for _, term := range description {
+		p := counts[term]
+		p.description++
+		counts[term] = p
+	}
+	terms := make([]string, 0, len(counts))
+	for term, p := range counts {
+		if x.postings[term] == nil {
+			x.postings[term] = map[string]posting{}
+		}
+		x.postings[term][todo.ID] = p
+		terms = append(terms, term)
+	}
+	x.terms[todo.ID] = terms
+	x.lengths[todo.ID] = len(title) + len(description)
+}
+
+func (x *searchIndex) remove(id string) {
+	for _, term := range x.terms[id] {
+		delete(x.postings[term], id)
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	delete(x.terms, id)
+	delete(x.lengths, id)
+}
+
+// search returns the IDs of todos matching every query term, best first.
+// Each query term matches indexed words it is a prefix of.
+func (x *searchIndex) search(query []string) ([]string, map[string]float64) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if len(x.lengths) == 0 || len(query) == 0 {
+		return nil, nil
+	}
+	total := 0
+	for _, n := range x.lengths {
+		total += n
+	}
+	avgLen := math.Max(float64(total)/float64(len(x.lengths)), 1)
+	docs := float64(len(x.lengths))
+
+	var scores map[string]float64
+	for _, q := range query {
+		termScores := map[string]float64{}
+		for term, postings := range x.postings {
+			if !strings.HasPrefix(term, q) {
+				continue
+			}
+			weight := 1.0
+			if term != q {
+				weight = searchPrefixWeight
+			}
+			idf := math.Log(1 + (docs-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+			for id, p := range postings {
+				// BM25 term frequency saturation with length normalization
+				tf := searchTitleWeight*float64(p.title) + float64(p.description)
+				norm := 1.2 * (0.25 + 0.75*float64(x.lengths[id])/avgLen)
+				termScores[id] += weight * idf * tf * 2.2 / (tf + norm)
+			}
+		}
+
+		// every query term must match
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := termScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids, scores
+}
+
+// highlight HTML-escapes s and wraps words matching a query term in <mark>
+func highlight(s string, query []string) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range tokenSpans(s) {
+		if matchesAny(strings.ToLower(s[span[0]:span[1]]), query) {
+			b.WriteString(html.EscapeString(s[last:span[0]]))
+			b.WriteString("<mark>" + html.EscapeString(s[span[0]:span[1]]) + "</mark>")
+			last = span[1]
+		}
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+	return b.String()
+}
+
+// snippet cuts a window of text around the first matching word, so long
+// descriptions don't bloat search results
+func snippet(s string, query []string) string {
+	if utf8.RuneCountInString(s) <= searchSnippetRunes {
+		return s
+	}
+	start := 0
+	for _, span := range tokenSpans(s) {
+		word := strings.ToLower(s[span[0]:span[1]])
+		if matchesAny(word, query) {
+			start = span[0]
+			break
+		}
+	}
+	// back up a little so the match has some leading context
+	for n := 0; n < searchSnippetRunes/4 && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(s[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; n < searchSnippetRunes && end < len(s); n++ {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		end += size
+	}
+	out := s[start:end]
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(s) {
+		out += "…"
+	}
+	return out
+}
+
+func matchesAny(word string, query []string) bool {
+	for _, q := range query {
+		if strings.HasPrefix(word, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchResult is one hit returned by GET /todos/search
+type searchResult struct {
+	Todo       store.Todo        `json:"todo"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// GET /todos/search
+func (s *server) handleSearchTodos(w http.ResponseWriter, r *http.Request) {
+	query := tokenize(r.URL.Query().Get("q"))
+	if len(query) == 0 {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	limit, err := s.pageSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ids, scores := s.search.search(query)
+	results := []searchResult{}
+	for _, id := range ids {
+		if len(results) == limit {
+			break
+		}
+		// writes that emit no events, such as tiering, leave stale entries
+		todo, err := s.store.Get(r.Context(), id)
+		if errors.Is(err, store.ErrNotFound) {
+			s.search.forget(id)
+			continue
+		}
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		highlights := map[string]string{"title": highlight(todo.Title, query)}
+		if todo.Description != "" {
+			highlights["description"] = highlight(snippet(todo.Description, query), query)
+		}
+		results = append(results, searchResult{Todo: todo, Score: math.Round(scores[id]*1000) / 1000, Highlights: highlights})
+	}
+
+	if err := respondJSON(w, http.StatusOK, results); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,669 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang-todo/internal/metrics"
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+// server holds the dependencies shared by the HTTP handlers
+type server struct {
+	store         store.Store
+	cold          store.ColdStore
+	webhooks      *webhookDispatcher
+	publisher     EventPublisher
+	budgets       LatencyBudgets
+	readTimeout   time.Duration
+	writeTimeout  time.Duration
+	listeners     []func(store.Event)
+	events        *eventLog
+	haDueSoon     time.Duration
+	calendar      calendarSigner
+	audit         *auditLog
+	undo          *undoLog
+	search        *searchIndex
+	attachments   *attachmentRegistry
+	projects      *projectRegistry
+	presence      *presenceTracker
+	locks         *lockTable
+	comments      *commentRegistry
+	timeEntries   *timeRegistry
+	reviews       *reviewRegistry
+	touches       *touchRegistry
+	warmups       warmups
+	changes       *store.ChangeTracker // the store, tracking changes for sync
+	users         *userRegistry
+	anomalies     *anomalyDetector
+	canaries      *canaryRegistry
+	deprecations  *deprecationTracker
+	killSwitches  *killSwitches
+	notifications *notificationCenter
+	reminders     *reminderScheduler
+	// titleLinter is nil unless title linting is on
+	titleLinter TitleLinter
+	titleStyles *TitleStyles
+	// projectTokens confine integrations to one project; see
+	// scopeProjectTokens
+	projectTokens *projectTokenRegistry
+	// importMappings turn exports of other tools into todos; see
+	// importMapping
+	importMappings *importMappingRegistry
+	// apiKeys let scripts act as users; see authenticateUsers
+	apiKeys *apiKeyRegistry
+	// services are the accounts automations act as instead of a user
+	services *serviceAccountRegistry
+	// imports are the scheduled imports; see runImportSchedules
+	imports *importScheduler
+	// jobs are the background admin jobs, such as ownership transfers
+	jobs *jobRegistry
+	// snapshots are the daily stats snapshots; see runStatsSnapshots
+	snapshots *snapshotStore
+	// ciMu serializes CI results; see handleCIResult
+	ciMu       sync.Mutex
+	adminToken *secrets.Setting
+	// location is the timezone of users without a preference
+	location *time.Location
+	// keyRings are the rotatable signing keys by name, e.g. "calendar"
+	keyRings map[string]*keyRing
+	// pageLimits size pages by client class; see pageSize
+	pageLimits PageLimits
+	// workflow is the state machine todos move through
+	workflow *Workflow
+	// maxBodySize and maxImportSize cap request bodies; see bodyLimit
+	maxBodySize   int64
+	maxImportSize int64
+	// stopping counts the background jobs still writing after shutdown;
+	// see Server.Wait
+	stopping sync.WaitGroup
+}
+
+// routes registers every endpoint on a new mux
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// /health predates the split into liveness and readiness and stays a
+	// liveness probe for existing deployments
+	mux.HandleFunc("/health", s.handleLiveness)
+	mux.HandleFunc("GET /healthz", s.handleLiveness)
+	mux.HandleFunc("GET /readyz", s.handleReadiness)
+	mux.HandleFunc("GET /metrics", metrics.Handler(s.killSwitches.metrics))
+	s.handle(mux, "GET /{$}", s.handleWebUI)
+	s.handle(mux, "GET /ui/{file...}", s.handleWebAsset)
+
+	s.handle(mux, "POST /batch", s.handleBatch)
+	s.handle(mux, "POST /todos", s.handleCreateTodo)
+	s.handle(mux, "POST /todos/quickadd", s.handleQuickAdd)
+	s.handle(mux, "POST /todos/batch", s.handleBatchCreateTodos)
+	s.handle(mux, "PATCH /todos/batch", s.handleBatchUpdateTodos)
+	s.handle(mux, "GET /todos", s.handleListTodos)
+	s.handle(mux, "GET /todos.txt", s.handleListTodosText)
+	s.handle(mux, "GET /todos/stream", s.handleStreamTodos)
+	s.handle(mux, "GET /todos/search", s.handleSearchTodos)
+	s.handle(mux, "GET /todos/schedule", s.handleSchedule)
+	s.handle(mux, "GET /todos/calendar.ics", s.handleCalendarFeed)
+	s.handle(mux, "POST /calendar/tokens", s.handleCreateCalendarToken)
+	s.handle(mux, "GET /todos/{id}", s.handleGetTodo)
+	s.handle(mux, "GET /todos/{id}/touches", s.handleGetTouches)
+	s.handle(mux, "PATCH /todos/{id}", s.handleUpdateTodoStatus)
+	s.handle(mux, "DELETE /todos/{id}", s.handleDeleteTodo)
+	s.handle(mux, "GET /todos/{id}/history", s.handleTodoHistory)
+	s.handle(mux, "GET /todos/{id}/graph", s.handleTodoGraph)
+	s.handle(mux, "POST /todos/{id}/move", s.handleMoveTodo)
+	s.handle(mux, "GET /todos/{id}/title-suggestions", s.requireTitleLinter(s.handleTitleSuggestions))
+	s.handle(mux, "POST /titles/lint", s.requireTitleLinter(s.handleLintTitle))
+	s.handle(mux, "POST /todos/{id}/revert", s.handleRevertTodo)
+	s.handle(mux, "POST /todos/{id}/merge", s.handleMergeDescription)
+	s.handle(mux, "POST /todos/{id}/comments", s.handleCreateComment)
+	s.handle(mux, "GET /todos/{id}/comments", s.handleListComments)
+	s.handle(mux, "POST /todos/{id}/timer/start", s.handleStartTimer)
+	s.handle(mux, "POST /todos/{id}/timer/stop", s.handleStopTimer)
+	s.handle(mux, "POST /todos/{id}/time", s.handleAddTimeEntry)
+	s.handle(mux, "GET /todos/{id}/time", s.handleListTimeEntries)
+	s.handle(mux, "DELETE /todos/{id}/time/{entry_id}", s.handleDeleteTimeEntry)
+	s.handle(mux, "DELETE /todos/{id}/comments/{comment_id}", s.handleDeleteComment)
+	s.handle(mux, "POST /todos/{id}/lock", s.handleLockTodo)
+	s.handle(mux, "DELETE /todos/{id}/lock", s.handleUnlockTodo)
+	s.handle(mux, "POST /todos/{id}/attachments", s.handleUploadAttachments)
+	s.handle(mux, "GET /todos/{id}/attachments", s.handleListAttachments)
+	s.handle(mux, "GET /todos/{id}/attachments.zip", s.handleDownloadAttachmentsZip)
+	s.handle(mux, "GET /todos/{id}/attachments/{attachment_id}", s.handleDownloadAttachment)
+	s.handle(mux, "DELETE /todos/{id}/attachments/{attachment_id}", s.handleDeleteAttachment)
+	s.handle(mux, "GET /undo", s.handleListUndo)
+	s.handle(mux, "POST /undo", s.handleUndo)
+	s.handle(mux, "POST /undo/{id}", s.handleUndo)
+
+	s.handle(mux, "POST /reviews", s.handleStartReview)
+	s.handle(mux, "GET /reviews", s.handleListReviews)
+	s.handle(mux, "GET /reviews/{id}", s.handleGetReview)
+	s.handle(mux, "POST /reviews/{id}/items/{todo_id}", s.handleDecideReviewItem)
+	s.handle(mux, "POST /reviews/{id}/finish", s.handleFinishReview)
+	s.handle(mux, "GET /reviews/{id}/summary", s.handleReviewSummary)
+	s.handle(mux, "GET /workflow", s.handleGetWorkflow)
+	s.handle(mux, "GET /sync", s.handleSyncPull)
+	s.handle(mux, "POST /sync", s.handleSyncPush)
+	s.handle(mux, "GET /tags", s.handleListTags)
+	s.handle(mux, "POST /tags/rename", s.handleRenameTag)
+	s.handle(mux, "POST /tags/merge", s.handleMergeTags)
+	s.handle(mux, "POST /tags/suggestions", s.handleSuggestTags)
+	s.handle(mux, "GET /users", s.handleListUsers)
+	s.handle(mux, "GET /users/{id}/timezone", s.handleGetTimezone)
+	s.handle(mux, "PUT /users/{id}/timezone", s.handleSetTimezone)
+	s.handle(mux, "GET /users/{id}/notifications", s.handleGetNotificationPrefs)
+	s.handle(mux, "PUT /users/{id}/notifications", s.handleSetNotificationPrefs)
+	s.handle(mux, "POST /projects", s.handleCreateProject)
+	s.handle(mux, "GET /projects", s.handleListProjects)
+	s.handle(mux, "GET /projects/{id}", s.handleGetProject)
+	s.handle(mux, "DELETE /projects/{id}", s.handleDeleteProject)
+	s.handle(mux, "POST /projects/{id}/restore", s.handleRestoreProject)
+	s.handle(mux, "GET /projects/{id}/graph", s.handleProjectGraph)
+	s.handle(mux, "GET /projects/{id}/attachments.zip", s.handleDownloadProjectAttachmentsZip)
+	s.handle(mux, "POST /projects/{id}/tokens", s.requireAdmin(s.handleCreateProjectToken))
+	s.handle(mux, "GET /projects/{id}/tokens", s.requireAdmin(s.handleListProjectTokens))
+	s.handle(mux, "DELETE /projects/{id}/tokens/{token_id}", s.requireAdmin(s.handleRevokeProjectToken))
+	s.handle(mux, "POST /projects/{id}/presence", s.handlePresenceHeartbeat)
+	s.handle(mux, "DELETE /projects/{id}/presence", s.handlePresenceLeave)
+	s.handle(mux, "GET /projects/{id}/presence", s.handleGetPresence)
+
+	s.handle(mux, "GET /dashboard", s.handleDashboard)
+	s.handle(mux, "GET /stats", s.handleStats)
+	s.handle(mux, "GET /stats/trends", s.handleStatsTrends)
+	s.handle(mux, "GET /export", s.handleExport)
+	s.handle(mux, "POST /import", s.handleImport)
+	s.handle(mux, "GET /import/mappings", s.handleListImportMappings)
+	s.handle(mux, "GET /import/mappings/{source}", s.handleGetImportMapping)
+	s.handle(mux, "PUT /import/mappings/{source}", s.handlePutImportMapping)
+	s.handle(mux, "DELETE /import/mappings/{source}", s.handleDeleteImportMapping)
+
+	s.handle(mux, "GET /integrations/homeassistant/sensors", s.handleHASensors)
+	s.handle(mux, "GET /integrations/homeassistant/sensors/{entity_id}", s.handleHASensor)
+	s.handle(mux, "POST /integrations/homeassistant/services/{service}", s.handleHAService)
+	s.handle(mux, "POST /integrations/ci", s.handleCIResult)
+
+	s.handle(mux, "GET /events", s.handleListEvents)
+	s.handle(mux, "GET /events/consumers", s.handleListEventConsumers)
+	s.handle(mux, "PUT /events/consumers/{name}", s.handleAckEvents)
+
+	s.handle(mux, "POST /webhooks", s.handleCreateWebhook)
+	s.handle(mux, "GET /webhooks", s.handleListWebhooks)
+	s.handle(mux, "DELETE /webhooks/{id}", s.handleDeleteWebhook)
+	s.handle(mux, "POST /webhooks/{id}/rotate-secret", s.handleRotateWebhookSecret)
+	s.handle(mux, "GET /webhooks/{id}/deliveries", s.handleListWebhookDeliveries)
+
+	s.handle(mux, "GET /admin/audit", s.requireAdmin(s.handleAdminAudit))
+	s.handle(mux, "GET /admin/audit/verify", s.requireAdmin(s.handleVerifyAudit))
+	s.handle(mux, "POST /admin/backup", s.requireAdmin(s.handleBackup))
+	s.handle(mux, "POST /admin/restore", s.requireAdmin(s.handleRestore))
+	s.handle(mux, "POST /admin/seed", s.requireAdmin(s.handleSeed))
+	s.handle(mux, "POST /admin/canaries", s.requireAdmin(s.handleCreateCanary))
+	s.handle(mux, "GET /admin/canaries", s.requireAdmin(s.handleListCanaries))
+	s.handle(mux, "DELETE /admin/canaries/{id}", s.requireAdmin(s.handleDeleteCanary))
+	s.handle(mux, "GET /admin/keys/{ring}", s.requireAdmin(s.handleListKeys))
+	s.handle(mux, "POST /admin/keys/{ring}/rotate", s.requireAdmin(s.handleRotateKey))
+	s.handle(mux, "DELETE /admin/keys/{ring}/{id}", s.requireAdmin(s.handleRevokeKey))
+	s.handle(mux, "GET /admin/users", s.requireAdmin(s.handleAdminListUsers))
+	s.handle(mux, "PUT /admin/users/{id}", s.requireAdmin(s.handleAdminPutUser))
+	s.handle(mux, "POST /admin/users/{id}/disable", s.requireAdmin(s.handleDisableUser))
+	s.handle(mux, "POST /admin/users/{id}/enable", s.requireAdmin(s.handleEnableUser))
+	s.handle(mux, "POST /admin/transfers", s.requireAdmin(s.handleTransferOwnership))
+	s.handle(mux, "POST /admin/roles", s.requireAdmin(s.handleChangeRoles))
+	s.handle(mux, "POST /admin/stats/backfill", s.requireAdmin(s.handleBackfillSnapshots))
+	s.handle(mux, "GET /admin/jobs", s.requireAdmin(s.handleListJobs))
+	s.handle(mux, "GET /admin/jobs/{id}", s.requireAdmin(s.handleGetJob))
+	s.handle(mux, "POST /admin/api-keys", s.requireAdmin(s.handleCreateAPIKey))
+	s.handle(mux, "GET /admin/api-keys", s.requireAdmin(s.handleListAPIKeys))
+	s.handle(mux, "GET /admin/api-keys/{id}", s.requireAdmin(s.handleGetAPIKey))
+	s.handle(mux, "DELETE /admin/api-keys/{id}", s.requireAdmin(s.handleRevokeAPIKey))
+	s.handle(mux, "POST /admin/service-accounts", s.requireAdmin(s.handleCreateServiceAccount))
+	s.handle(mux, "GET /admin/service-accounts", s.requireAdmin(s.handleListServiceAccounts))
+	s.handle(mux, "GET /admin/service-accounts/{id}", s.requireAdmin(s.handleGetServiceAccount))
+	s.handle(mux, "POST /admin/service-accounts/{id}/rotate", s.requireAdmin(s.handleRotateServiceAccount))
+	s.handle(mux, "DELETE /admin/service-accounts/{id}", s.requireAdmin(s.handleRevokeServiceAccount))
+	s.handle(mux, "POST /admin/imports", s.requireAdmin(s.handleCreateScheduledImport))
+	s.handle(mux, "GET /admin/imports", s.requireAdmin(s.handleListScheduledImports))
+	s.handle(mux, "GET /admin/imports/{id}", s.requireAdmin(s.handleGetScheduledImport))
+	s.handle(mux, "PATCH /admin/imports/{id}", s.requireAdmin(s.handlePauseScheduledImport))
+	s.handle(mux, "DELETE /admin/imports/{id}", s.requireAdmin(s.handleDeleteScheduledImport))
+	s.handle(mux, "POST /admin/imports/{id}/run", s.requireAdmin(s.handleRunScheduledImport))
+	s.handle(mux, "GET /admin/imports/{id}/runs", s.requireAdmin(s.handleListImportRuns))
+	s.handle(mux, "GET /admin/anomalies", s.requireAdmin(s.handleListAnomalies))
+	s.handle(mux, "POST /admin/anomalies/{id}/ack", s.requireAdmin(s.handleAckAnomaly))
+	s.handle(mux, "GET /admin/features", s.requireAdmin(s.handleListFeatures))
+	s.handle(mux, "PUT /admin/features/{name}", s.requireAdmin(s.handleSetFeature))
+	s.handle(mux, "GET /admin/deprecations", s.requireAdmin(s.handleDeprecationReport))
+	s.handle(mux, "GET /admin/notifications/deliveries", s.requireAdmin(s.handleListDeliveries))
+	s.handle(mux, "GET /admin/config", s.requireAdmin(s.handleExportConfig))
+	s.handle(mux, "PUT /admin/config", s.requireAdmin(s.handleApplyConfig))
+
+	return mux
+}
+
+// includeCold reports whether the caller explicitly asked to read through
+// to the cold storage tier
+func (s *server) includeCold(r *http.Request) bool {
+	return s.cold != nil && r.URL.Query().Get("include_cold") == "true"
+}
+
+// POST /todos
+func (s *server) handleCreateTodo(w http.ResponseWriter, r *http.Request) {
+	// Use helper function to decode request body
+	todo, err := decodeJSON[store.Todo](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.createTodo(w, r, todo)
+}
+
+// createTodo validates and stores a todo a client asked for, answering with
+// the created todo
+func (s *server) createTodo(w http.ResponseWriter, r *http.Request, requested store.Todo) {
+	var todo store.Todo
+	var created store.Event
+	var rejected int
+	err := s.store.Atomically(r.Context(), func(tx store.Tx) error {
+		var err error
+		todo, created, rejected, err = s.insertTodo(r, tx, requested, time.Now())
+		return err
+	})
+	if err != nil && rejected != 0 {
+		http.Error(w, err.Error(), rejected)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	s.emitFor(r, created)
+
+	// Use helper function to respond with JSON
+	if err := respondJSON(w, http.StatusCreated, todo); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// insertTodo creates in tx a todo a client asked for with r, the same way
+// for single and batch creates. It returns the created todo and its
+// event, or the status to refuse the todo with, which is 0 when it wasn't
+// the todo's fault.
+func (s *server) insertTodo(r *http.Request, tx store.Tx, todo store.Todo, now time.Time) (store.Todo, store.Event, int, error) {
+	// todos created with a project token go in the token's project
+	if token, ok := s.projectToken(r); ok {
+		if todo.ProjectID != "" && todo.ProjectID != token.ProjectID {
+			return todo, store.Event{}, http.StatusForbidden, errors.New("project tokens can only create todos in their own project")
+		}
+		todo.ProjectID = token.ProjectID
+	}
+	// due dates are kept in the zone they are meant in, the creator's
+	// unless the todo names one
+	if todo.DueAt != nil && todo.DueTimezone == "" {
+		loc, err := s.requestLocation(r)
+		if err != nil {
+			return todo, store.Event{}, http.StatusBadRequest, err
+		}
+		todo.DueTimezone = loc.String()
+	}
+
+	if err := s.checkNewTodo(todo); err != nil {
+		return todo, store.Event{}, http.StatusBadRequest, err
+	}
+	if err := checkBlockedBy(r.Context(), tx, "", normalizeBlockedBy(todo.BlockedBy)); err != nil {
+		return todo, store.Event{}, http.StatusBadRequest, err
+	}
+
+	// create new todo with ID, CreatedAt, UpdatedAt
+	todo = newTodo(todo, now)
+	created := store.NewEvent(store.EventTodoCreated, actorFromRequest(r), todo)
+	if err := tx.Create(r.Context(), todo, s.outboxEvents(created)...); err != nil {
+		return todo, store.Event{}, 0, err
+	}
+	return todo, created, 0, nil
+}
+
+// listFilter returns whether a todo is visible to a list request, going by
+// its query parameters and project token
+func (s *server) listFilter(r *http.Request) (func(store.Todo) bool, error) {
+	loc, err := s.requestLocation(r)
+	if err != nil {
+		return nil, err
+	}
+	match, err := parseQuery(r.URL.Query().Get("query"), s.workflow, time.Now().In(loc))
+	if err != nil {
+		return nil, err
+	}
+	metaMatches, err := metadataParams(r.URL.Query(), s.workflow)
+	if err != nil {
+		return nil, err
+	}
+	// archived todos are listed only on request, and then on their own
+	archived := r.URL.Query().Get("archived") == "true"
+	token, scoped := s.projectToken(r)
+	return func(t store.Todo) bool {
+		if (t.ArchivedAt != nil) != archived || !match(t) {
+			return false
+		}
+		for _, metaMatch := range metaMatches {
+			if !metaMatch(t) {
+				return false
+			}
+		}
+		// project tokens only see their own project
+		return !scoped || t.ProjectID == token.ProjectID
+	}, nil
+}
+
+// listTodos returns the todos visible to a list request, filtered by the
+// optional query parameter
+func (s *server) listTodos(r *http.Request) ([]store.Todo, error) {
+	visible, err := s.listFilter(r)
+	if err != nil {
+		return nil, err
+	}
+
+	//get all todos
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// append archived todos only when explicitly requested
+	if s.includeCold(r) {
+		archived, err := s.cold.List(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, archived...)
+	}
+	todos = slices.DeleteFunc(todos, func(t store.Todo) bool { return !visible(t) })
+	sortByPosition(todos)
+	return todos, nil
+}
+
+// defaultTodoPageSize and maxTodoPageSize bound GET /todos pages; see
+// routePageLimits
+const (
+	defaultTodoPageSize = 500
+	maxTodoPageSize     = 5000
+)
+
+// pageTodos cuts the page a list request asks for with its limit and
+// offset query parameters out of todos, linking to the next page in the
+// Link header when there is one
+func (s *server) pageTodos(w http.ResponseWriter, r *http.Request, todos []store.Todo) ([]store.Todo, error) {
+	limit, err := s.pageSize(r)
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return nil, errors.New("offset must be a non-negative number")
+		}
+	}
+	todos = todos[min(offset, len(todos)):]
+	if len(todos) > limit {
+		todos = todos[:limit]
+		next := *r.URL
+		query := next.Query()
+		query.Set("offset", strconv.Itoa(offset+limit))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+	return todos, nil
+}
+
+// respondListError reports a listTodos failure, blaming the client for
+// invalid queries
+func respondListError(w http.ResponseWriter, err error) {
+	var qerr *queryError
+	if errors.As(err, &qerr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respondError(w, err)
+}
+
+// GET /todos
+func (s *server) handleListTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	format := negotiate(r, "application/json", "text/plain", ndjsonType)
+	// streams hold one todo at a time however many there are, so they
+	// aren't paged
+	if format == ndjsonType {
+		s.streamTodos(w, r)
+		return
+	}
+	todos, err := s.listTodos(r)
+	if err != nil {
+		respondListError(w, err)
+		return
+	}
+	if todos, err = s.pageTodos(w, r, todos); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if format == "text/plain" {
+		respondText(w, http.StatusOK, s.renderTodosText(r, todos))
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.decorate(todos...)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /todos.txt
+func (s *server) handleListTodosText(w http.ResponseWriter, r *http.Request) {
+	todos, err := s.listTodos(r)
+	if err != nil {
+		respondListError(w, err)
+		return
+	}
+	if todos, err = s.pageTodos(w, r, todos); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respondText(w, http.StatusOK, s.renderTodosText(r, todos))
+}
+
+// GET /todos/{id}
+func (s *server) handleGetTodo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	todo, err := s.store.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) && s.includeCold(r) {
+		// fall back to the cold tier for todos that have been archived
+		todo, err = s.cold.Get(r.Context(), id)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	s.touches.touch(todo.ID, touchViewed, time.Now())
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("ETag", todoETag(todo))
+	if negotiate(r, "application/json", "text/plain") == "text/plain" {
+		loc, err := s.requestLocation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respondText(w, http.StatusOK, renderTodoText(todo, loc))
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.decorate(todo)[0]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PATCH /todos/{id} status, description, blocked_by, estimate_minutes, reminders and metadata
+func (s *server) handleUpdateTodoStatus(w http.ResponseWriter, r *http.Request) {
+	//get id from path
+	id := r.PathValue("id")
+
+	// Use helper function to decode status update
+	update, err := decodeJSON[struct {
+		Status       store.TodoStatus `json:"status"`
+		Description  *string          `json:"description"`
+		BlockedBy    *[]string        `json:"blocked_by"`
+		Estimate     *int             `json:"estimate_minutes"`
+		RemindAt     optionalTime     `json:"remind_at"`
+		RemindBefore *int             `json:"remind_before_minutes"`
+		Metadata     map[string]any   `json:"metadata"`
+		Force        bool             `json:"force"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if update.Status == "" && update.Description == nil && update.BlockedBy == nil && update.Estimate == nil && !update.RemindAt.set && update.RemindBefore == nil && update.Metadata == nil {
+		http.Error(w, "at least one of status, description, blocked_by, estimate_minutes, remind_at, remind_before_minutes or metadata is required", http.StatusBadRequest)
+		return
+	}
+	if update.Estimate != nil && *update.Estimate < 0 {
+		http.Error(w, "estimate_minutes can't be negative", http.StatusBadRequest)
+		return
+	}
+	if update.RemindBefore != nil && *update.RemindBefore < 0 {
+		http.Error(w, "remind_before_minutes can't be negative", http.StatusBadRequest)
+		return
+	}
+
+	if update.Status != "" && !s.workflow.valid(update.Status) {
+		http.Error(w, fmt.Sprintf("invalid status %q; want one of %s", update.Status, s.workflow.describe()), http.StatusBadRequest)
+		return
+	}
+
+	// the todo is checked and updated in one transaction, so the checks
+	// hold for the todo that is written
+	ctx, now := r.Context(), time.Now()
+	var todo store.Todo
+	var events []store.Event
+	var rejected int // the status to refuse the update with, if it is refused
+	err = s.store.Atomically(ctx, func(tx store.Tx) error {
+		rejected = 0
+		var err error
+		if todo, err = tx.Get(ctx, id); err != nil {
+			return err
+		}
+		// with If-Match, a todo changed since the client read it is
+		// returned as it is now, e.g. to merge descriptions with
+		// POST /todos/{id}/merge
+		if !(precondition{IfMatch: r.Header.Get("If-Match")}).check(todo) {
+			return errPreconditionFailed
+		}
+		if update.Status != "" {
+			if err := s.workflow.checkTransition(todo.Status, update.Status); err != nil {
+				rejected = http.StatusConflict
+				return err
+			}
+		}
+		metadata := todo.Metadata
+		if update.Metadata != nil {
+			metadata = mergeMetadata(todo.Metadata, update.Metadata)
+			if err := validateMetadata(metadata); err != nil {
+				rejected = http.StatusBadRequest
+				return err
+			}
+		}
+		blockedBy := todo.BlockedBy
+		if update.BlockedBy != nil {
+			blockedBy = normalizeBlockedBy(*update.BlockedBy)
+			if err := checkBlockedBy(ctx, tx, id, blockedBy); err != nil {
+				rejected = http.StatusBadRequest
+				return err
+			}
+		}
+
+		// completion is checked against the blockers as updated
+		pending := todo
+		pending.BlockedBy = blockedBy
+		if err := checkCanComplete(ctx, tx, pending, update.Status, update.Force); err != nil {
+			rejected = completionErrorStatus(err)
+			return err
+		}
+
+		todo, events = applyUpdate(todo, actorFromRequest(r), now, func(t *store.Todo) {
+			t.BlockedBy, t.Metadata = blockedBy, metadata
+			if update.Description != nil {
+				t.Description = *update.Description
+			}
+			if update.Estimate != nil {
+				t.EstimateMinutes = *update.Estimate
+			}
+			if update.RemindAt.set {
+				t.RemindAt = update.RemindAt.value
+			}
+			if update.RemindBefore != nil {
+				t.RemindBeforeMinutes = *update.RemindBefore
+			}
+			if update.Status != "" {
+				setStatus(t, update.Status, now)
+			}
+		})
+		return tx.Update(ctx, todo, s.outboxEvents(events...)...)
+	})
+	switch {
+	case err != nil && rejected != 0:
+		http.Error(w, err.Error(), rejected)
+		return
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errPreconditionFailed):
+		w.Header().Set("ETag", todoETag(todo))
+		if err := respondJSON(w, http.StatusPreconditionFailed, map[string]any{"error": errPreconditionFailed.Error(), "todo": todo}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	case err != nil:
+		respondError(w, err)
+		return
+	}
+	s.emitFor(r, events...)
+
+	// Respond with updated todo
+	if err := respondJSON(w, http.StatusOK, s.decorate(todo)[0]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /todos/{id}
+func (s *server) handleDeleteTodo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	todo, err := s.store.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	deleted := store.NewEvent(store.EventTodoDeleted, actorFromRequest(r), todo)
+	if err := s.store.Delete(r.Context(), id, s.outboxEvents(deleted)...); err != nil {
+		respondError(w, err)
+		return
+	}
+	s.emitFor(r, deleted)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang-todo/internal/store"
+)
+
+// newTestHandler builds the API on an in-memory store, keeping attachment
+// contents in a temporary directory
+func newTestHandler(t *testing.T, opts Options) http.Handler {
+	t.Helper()
+	return newTestServer(t, opts).routes()
+}
+
+// newTestServer builds the server behind newTestHandler, for tests that
+// reach into its registries
+func newTestServer(t *testing.T, opts Options) *server {
+	t.Helper()
+	if opts.Blobs == nil {
+		blobs, err := store.NewBlobStore("disk", t.TempDir(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.Blobs = blobs
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv, err := newServer(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// serve sends a request to h as user al and returns the response
+func serve(h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("X-User-ID", "al")
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestUpdateTodoChecks(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	blocker := createTodo(t, h, `{"title":"blocker"}`)
+	todo := createTodo(t, h, `{"title":"todo","blocked_by":["`+blocker.ID+`"]}`)
+	etag := strconv.Quote(strconv.Itoa(todo.Version))
+	tests := []struct {
+		name   string
+		body   string
+		header []string
+		status int
+	}{
+		{"stale If-Match", `{"description":"x"}`, []string{"If-Match", `"999"`}, http.StatusPreconditionFailed},
+		{"unknown status", `{"status":"done"}`, nil, http.StatusBadRequest},
+		{"forbidden move", `{"status":"review"}`, nil, http.StatusConflict},
+		{"pending blocker", `{"status":"completed"}`, nil, http.StatusConflict},
+		{"unknown blocker", `{"blocked_by":["nope"]}`, nil, http.StatusBadRequest},
+		{"blocking itself", `{"blocked_by":["` + todo.ID + `"]}`, nil, http.StatusBadRequest},
+		{"forced completion", `{"status":"completed","force":true}`, []string{"If-Match", etag}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(h, "PATCH", "/todos/"+todo.ID, tt.body, tt.header...); w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+		}
+	}
+	if w := serve(h, "PATCH", "/todos/missing", `{"description":"x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing todo: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// serviceTokenPrefix starts every service account token, so they can be
+// told apart from other bearer tokens without a lookup
+const serviceTokenPrefix = "tds_"
+
+// serviceActorPrefix starts the actor of every change a service account
+// makes, e.g. "service:3f2a…"
+const serviceActorPrefix = "service:"
+
+// ServiceAccount is a non-human identity an automation such as a bot or a
+// sync integration acts as. Unlike an API key it isn't tied to a user, so
+// its changes are attributed to the automation itself. Revoked accounts
+// are kept so the history they appear in can still name them.
+type ServiceAccount struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Scope       string     `json:"scope"`
+	Class       string     `json:"class,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CreatedBy   string     `json:"created_by"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	hash        string
+}
+
+// actor is who changes made as the account are attributed to
+func (a ServiceAccount) actor() string {
+	return serviceActorPrefix + a.ID
+}
+
+// isServiceActor reports whether actor is a service account, for feeds
+// that leave automations out
+func isServiceActor(actor string) bool {
+	return strings.HasPrefix(actor, serviceActorPrefix)
+}
+
+// excludeServices reports whether a feed request asks to leave out what
+// service accounts did, with exclude_services=true
+func excludeServices(r *http.Request) bool {
+	return r.URL.Query().Get("exclude_services") == "true"
+}
+
+// serviceAccountRegistry holds the service accounts in creation order
+type serviceAccountRegistry struct {
+	mu       sync.Mutex
+	accounts []*ServiceAccount
+}
+
+// newServiceSecret returns a fresh token and its hash
+func newServiceSecret() (string, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := serviceTokenPrefix + hex.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
+
+// create adds an account and returns it along with its token
+func (sa *serviceAccountRegistry) create(name, description, scope, class, actor string, now time.Time) (ServiceAccount, string, error) {
+	secret, hash, err := newServiceSecret()
+	if err != nil {
+		return ServiceAccount{}, "", err
+	}
+	account := &ServiceAccount{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: description,
+		Scope:       scope,
+		Class:       class,
+		CreatedAt:   now,
+		CreatedBy:   actor,
+		hash:        hash,
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	sa.accounts = append(sa.accounts, account)
+	return *account, secret, nil
+}
+
+// authenticate looks up the unrevoked account with secret and records its
+// use
+func (sa *serviceAccountRegistry) authenticate(secret string, now time.Time) (ServiceAccount, bool) {
+	hash := hashSecret(secret)
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	for _, account := range sa.accounts {
+		if account.hash == hash && account.RevokedAt == nil {
+			account.LastUsedAt = &now
+			return *account, true
+		}
+	}
+	return ServiceAccount{}, false
+}
+
+func (sa *serviceAccountRegistry) get(id string) (ServiceAccount, bool) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	for _, account := range sa.accounts {
+		if account.ID == id {
+			return *account, true
+		}
+	}
+	return ServiceAccount{}, false
+}
+
+func (sa *serviceAccountRegistry) list() []ServiceAccount {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	accounts := make([]ServiceAccount, 0, len(sa.accounts))
+	for _, account := range sa.accounts {
+		accounts = append(accounts, *account)
+	}
+	return accounts
+}
+
+// replace swaps in a whole new set of accounts, as loading a state file
+// does
+func (sa *serviceAccountRegistry) replace(accounts []ServiceAccount) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	sa.accounts = make([]*ServiceAccount, len(accounts))
+	for i := range accounts {
+		account := accounts[i]
+		sa.accounts[i] = &account
+	}
+}
+
+// rotate replaces the token of an unrevoked account, invalidating the old
+// one straight away
+func (sa *serviceAccountRegistry) rotate(id string) (ServiceAccount, string, bool, error) {
+	secret, hash, err := newServiceSecret()
+	if err != nil {
+		return ServiceAccount{}, "", false, err
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	for _, account := range sa.accounts {
+		if account.ID == id && account.RevokedAt == nil {
+			account.hash = hash
+			return *account, secret, true, nil
+		}
+	}
+	return ServiceAccount{}, "", false, nil
+}
+
+// revoke refuses the account's token from now on, reporting whether an
+// unrevoked account with id existed
+func (sa *serviceAccountRegistry) revoke(id string, now time.Time) bool {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	for _, account := range sa.accounts {
+		if account.ID == id && account.RevokedAt == nil {
+			account.RevokedAt = &now
+			return true
+		}
+	}
+	return false
+}
+
+// POST /admin/service-accounts
+func (s *server) handleCreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Scope       string `json:"scope"`
+		Class       string `json:"class"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required, e.g. the automation the account is for", http.StatusBadRequest)
+		return
+	}
+	if req.Scope != scopeRead && req.Scope != scopeWrite {
+		http.Error(w, "scope must be read or write", http.StatusBadRequest)
+		return
+	}
+	if err := s.checkClientClass(req.Class); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	account, secret, err := s.services.create(strings.TrimSpace(req.Name), strings.TrimSpace(req.Description), req.Scope, req.Class, actorFromRequest(r), time.Now())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	resp := struct {
+		ServiceAccount
+		Actor string `json:"actor"`
+		Token string `json:"token"`
+	}{account, account.actor(), secret}
+	if err := respondJSON(w, http.StatusCreated, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/service-accounts
+func (s *server) handleListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.services.list()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /admin/service-accounts/{id}
+func (s *server) handleGetServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.services.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Service account not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, account); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/service-accounts/{id}/rotate
+func (s *server) handleRotateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, secret, ok, err := s.services.rotate(r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, "Service account not found", http.StatusNotFound)
+		return
+	}
+	resp := struct {
+		ServiceAccount
+		Token string `json:"token"`
+	}{account, secret}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /admin/service-accounts/{id}
+func (s *server) handleRevokeServiceAccount(w http.ResponseWriter, r *http.Request) {
+	if !s.services.revoke(r.PathValue("id"), time.Now()) {
+		http.Error(w, "Service account not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
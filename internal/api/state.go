@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+const stateVersion = 1
+
+// serverState is what a state file keeps of the server besides the todos,
+// which their store keeps. Secrets are kept the way the registries keep
+// them: issued tokens as hashes, webhook secrets as they sign or as the
+// secret store reference they came from. Locks, presence, undo history,
+// the event log, jobs, delivery logs and kill switches start afresh; event
+// consumers are kept, but the cursors they acknowledged answer 410 Gone
+// in the next run.
+type serverState struct {
+	Version          int                              `json:"version"`
+	SavedAt          time.Time                        `json:"saved_at"`
+	Projects         []Project                        `json:"projects"`
+	Users            []User                           `json:"users"`
+	Comments         []Comment                        `json:"comments"`
+	TimeEntries      []TimeEntry                      `json:"time_entries,omitempty"`
+	Attachments      []Attachment                     `json:"attachments"`
+	Canaries         []string                         `json:"canaries,omitempty"`
+	APIKeys          []storedAPIKey                   `json:"api_keys,omitempty"`
+	ProjectTokens    []storedProjectToken             `json:"project_tokens,omitempty"`
+	ServiceAccounts  []storedServiceAccount           `json:"service_accounts,omitempty"`
+	Webhooks         []storedWebhook                  `json:"webhooks,omitempty"`
+	Audit            []storedAuditEntry               `json:"audit,omitempty"`
+	Anomalies        map[anomalyRule]anomalyThreshold `json:"anomalies,omitempty"`
+	ImportMappings   []*importMapping                 `json:"import_mappings,omitempty"`
+	ScheduledImports []storedScheduledImport          `json:"scheduled_imports,omitempty"`
+	Notifications    map[string]NotificationPrefs     `json:"notifications,omitempty"`
+	RemindersSent    map[string]time.Time             `json:"reminders_sent,omitempty"`
+	Reviews          []Review                         `json:"reviews,omitempty"`
+	Touches          map[string]storedTouches         `json:"touches,omitempty"`
+	EventConsumers   []eventConsumer                  `json:"event_consumers,omitempty"`
+}
+
+type storedAPIKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+type storedProjectToken struct {
+	ProjectToken
+	Hash string `json:"hash"`
+}
+
+type storedServiceAccount struct {
+	ServiceAccount
+	Hash string `json:"hash"`
+}
+
+// storedWebhook leaves Secret out when it came from a secret store, which
+// it is resolved from again on load
+type storedWebhook struct {
+	Webhook
+	SecretRef       string    `json:"secret_ref,omitempty"`
+	PreviousSecret  string    `json:"previous_secret,omitempty"`
+	PreviousExpires time.Time `json:"previous_expires,omitempty"`
+}
+
+type storedAuditEntry struct {
+	AuditEntry
+	Snapshot *store.Todo `json:"snapshot,omitempty"`
+}
+
+// storedScheduledImport keeps the credentials in full, unlike the API
+type storedScheduledImport struct {
+	scheduledImport
+	Runs []importRun `json:"runs,omitempty"`
+}
+
+type storedTouches struct {
+	Counts map[string]int       `json:"counts"`
+	Last   map[string]time.Time `json:"last"`
+}
+
+// state captures what a state file keeps. Like a backup, it reads the
+// registries one after the other.
+func (s *server) state(now time.Time) serverState {
+	st := serverState{
+		Version:     stateVersion,
+		SavedAt:     now,
+		Projects:    s.projects.list(),
+		Users:       s.users.list(),
+		Comments:    s.comments.all(),
+		TimeEntries: s.timeEntries.all(),
+		Attachments: s.attachments.all(),
+		Canaries:    s.canaries.list(),
+		Anomalies:   s.anomalies.thresholdsSnapshot(),
+
+		ImportMappings: s.importMappings.list(),
+		Notifications:  s.notifications.allPreferences(),
+		RemindersSent:  s.reminders.sentTimes(),
+		Reviews:        s.reviews.list(""),
+		EventConsumers: s.events.listConsumers(),
+	}
+	for _, key := range s.apiKeys.list("") {
+		st.APIKeys = append(st.APIKeys, storedAPIKey{APIKey: key, Hash: key.hash})
+	}
+	for _, token := range s.projectTokens.all() {
+		st.ProjectTokens = append(st.ProjectTokens, storedProjectToken{ProjectToken: token, Hash: token.hash})
+	}
+	for _, account := range s.services.list() {
+		st.ServiceAccounts = append(st.ServiceAccounts, storedServiceAccount{ServiceAccount: account, Hash: account.hash})
+	}
+	for _, wh := range s.webhooks.list() {
+		stored := storedWebhook{Webhook: wh, SecretRef: wh.secretRef}
+		if wh.secretRef != "" {
+			stored.Secret = ""
+		} else if wh.previousSecret != "" && now.Before(wh.previousExpires) {
+			stored.PreviousSecret, stored.PreviousExpires = wh.previousSecret, wh.previousExpires
+		}
+		st.Webhooks = append(st.Webhooks, stored)
+	}
+	for _, entry := range s.audit.all() {
+		st.Audit = append(st.Audit, storedAuditEntry{AuditEntry: entry, Snapshot: entry.snapshot})
+	}
+	for _, si := range s.imports.all() {
+		st.ScheduledImports = append(st.ScheduledImports, storedScheduledImport{scheduledImport: si, Runs: si.runs})
+	}
+	for id, rec := range s.touches.all() {
+		if st.Touches == nil {
+			st.Touches = map[string]storedTouches{}
+		}
+		st.Touches[id] = storedTouches{Counts: rec.counts, Last: rec.last}
+	}
+	return st
+}
+
+// loadState applies the state file at path, if there is one yet
+func (s *server) loadState(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st serverState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if st.Version != stateVersion {
+		return fmt.Errorf("%s: unsupported state version %d; want %d", path, st.Version, stateVersion)
+	}
+
+	keys := make([]APIKey, len(st.APIKeys))
+	for i, stored := range st.APIKeys {
+		keys[i] = stored.APIKey
+		keys[i].hash = stored.Hash
+	}
+	tokens := make([]ProjectToken, len(st.ProjectTokens))
+	for i, stored := range st.ProjectTokens {
+		tokens[i] = stored.ProjectToken
+		tokens[i].hash = stored.Hash
+	}
+	accounts := make([]ServiceAccount, len(st.ServiceAccounts))
+	for i, stored := range st.ServiceAccounts {
+		accounts[i] = stored.ServiceAccount
+		accounts[i].hash = stored.Hash
+	}
+	webhooks := make([]Webhook, len(st.Webhooks))
+	for i, stored := range st.Webhooks {
+		wh := stored.Webhook
+		wh.previousSecret, wh.previousExpires = stored.PreviousSecret, stored.PreviousExpires
+		if wh.secretRef = stored.SecretRef; wh.secretRef != "" {
+			if wh.Secret, err = secrets.Resolve(ctx, wh.secretRef); err != nil {
+				return fmt.Errorf("%s: webhook %s: %w", path, wh.ID, err)
+			}
+		}
+		webhooks[i] = wh
+	}
+	entries := make([]AuditEntry, len(st.Audit))
+	for i, stored := range st.Audit {
+		entries[i] = stored.AuditEntry
+		entries[i].snapshot = stored.Snapshot
+	}
+	for _, m := range st.ImportMappings {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("%s: import mapping %s: %w", path, m.Source, err)
+		}
+	}
+	imports := make([]scheduledImport, len(st.ScheduledImports))
+	for i, stored := range st.ScheduledImports {
+		imports[i] = stored.scheduledImport
+		imports[i].runs = stored.Runs
+	}
+	touches := make(map[string]touchRecord, len(st.Touches))
+	for id, stored := range st.Touches {
+		touches[id] = touchRecord{counts: stored.Counts, last: stored.Last}
+	}
+
+	s.projects.replace(st.Projects)
+	s.users.replace(st.Users)
+	s.comments.replace(st.Comments)
+	s.timeEntries.replace(st.TimeEntries)
+	s.attachments.replace(st.Attachments)
+	s.canaries.replace(st.Canaries)
+	s.apiKeys.replace(keys)
+	s.projectTokens.replace(tokens)
+	s.services.replace(accounts)
+	s.webhooks.replace(webhooks)
+	s.audit.replace(entries)
+	s.importMappings.replace(st.ImportMappings)
+	s.imports.replace(imports)
+	s.notifications.replacePreferences(st.Notifications)
+	s.reminders.replaceSent(st.RemindersSent)
+	s.reviews.replace(st.Reviews)
+	s.touches.replace(touches)
+	s.events.replaceConsumers(st.EventConsumers)
+	for rule, t := range st.Anomalies {
+		if validAnomalyRule(rule) {
+			s.anomalies.setThreshold(rule, t)
+		}
+	}
+	return nil
+}
+
+// runStateSaver writes the state file at path every interval in which
+// something changed, and once more when ctx is cancelled. Changes made
+// since the last save are lost if the process dies.
+func (s *server) runStateSaver(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var saved []byte
+	save := func() {
+		now := time.Now()
+		st := s.state(now)
+		st.SavedAt = time.Time{}
+		data, err := json.Marshal(st)
+		if err != nil {
+			log.Printf("failed to encode the server state: %v", err)
+			return
+		}
+		if bytes.Equal(data, saved) {
+			return
+		}
+		st.SavedAt = now
+		if err := store.WriteFileAtomic(path, st); err != nil {
+			log.Printf("failed to save the server state to %s: %v", path, err)
+			return
+		}
+		saved = data
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+func TestStateSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	srv := newTestServer(t, Options{})
+	h := srv.routes()
+	w := serve(h, "POST", "/projects", `{"name":"Home"}`)
+	var project Project
+	if err := json.Unmarshal(w.Body.Bytes(), &project); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create project: %d %s", w.Code, w.Body)
+	}
+	todo := createTodo(t, h, `{"title":"a","project_id":"`+project.ID+`"}`)
+	now := time.Now()
+	srv.users.put(User{ID: "bob", Name: "Bob", CreatedAt: now})
+	srv.comments.add(Comment{ID: "c1", TodoID: todo.ID, Author: "al", Body: "note", CreatedAt: now})
+	_, keySecret, err := srv.apiKeys.issue("al", "script", scopeWrite, "", "al", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, tokenSecret, err := srv.projectTokens.issue(project.ID, "ci", scopeWrite, "al", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, serviceSecret, err := srv.services.create("bot", "", scopeWrite, "", "al", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.webhooks.register(Webhook{ID: "wh1", URL: "http://example.com/hook", Secret: "s3cret", CreatedAt: now})
+
+	// a cancelled saver writes the state once and returns
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv.runStateSaver(ctx, path, time.Hour)
+
+	restarted := newTestServer(t, Options{Store: srv.changes.Store})
+	if err := restarted.loadState(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.projects.get(project.ID); err != nil {
+		t.Errorf("project after the restart: %v", err)
+	}
+	if _, ok := restarted.users.get("bob"); !ok {
+		t.Error("user bob is gone after the restart")
+	}
+	if len(restarted.comments.list(todo.ID)) != 1 {
+		t.Error("comment is gone after the restart")
+	}
+	if _, ok, _ := restarted.apiKeys.use(keySecret, "GET /todos", false, func(APIKey) bool { return true }, now); !ok {
+		t.Error("API key stopped working after the restart")
+	}
+	if _, ok := restarted.projectTokens.find(tokenSecret); !ok {
+		t.Error("project token stopped working after the restart")
+	}
+	if _, ok := restarted.services.authenticate(serviceSecret, now); !ok {
+		t.Error("service account token stopped working after the restart")
+	}
+	if wh, err := restarted.webhooks.get("wh1"); err != nil || wh.Secret != "s3cret" {
+		t.Errorf("webhook after the restart = %+v, %v", wh, err)
+	}
+	entries := restarted.audit.all()
+	if len(entries) != len(srv.audit.all()) || !VerifyAuditChain(entries).Valid {
+		t.Errorf("audit log after the restart has %d entries, want an intact %d", len(entries), len(srv.audit.all()))
+	}
+	if snapshot, _ := restarted.audit.revision(todo.ID, todo.Version); snapshot == nil {
+		t.Error("audit log lost the todo's revisions, so it can't be reverted")
+	}
+}
+
+func TestWaitSavesStateOnShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	blobs, err := store.NewBlobStore("disk", t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := New(ctx, Options{Blobs: blobs, StateFile: path, StateFlush: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(srv, "POST", "/projects", `{"name":"Home"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create project: %d %s", w.Code, w.Body)
+	}
+
+	// long before the next flush, shutting down saves the project
+	cancel()
+	srv.Wait()
+	restarted := newTestServer(t, Options{})
+	if err := restarted.loadState(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if projects := restarted.projects.list(); len(projects) != 1 || projects[0].Name != "Home" {
+		t.Errorf("projects after the restart = %+v, want Home", projects)
+	}
+}
+
+func TestStateKeepsImportsReviewsAndConsumers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	srv := newTestServer(t, Options{})
+	h := srv.routes()
+	todo := createTodo(t, h, `{"title":"a"}`)
+	if w := serve(h, "PUT", "/import/mappings/jira", `{"format":"json","timezone":"Europe/Berlin","fields":[{"from":"summary","to":"title"}]}`); w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("put mapping: %d %s", w.Code, w.Body)
+	}
+	now := time.Now()
+	srv.imports.add(&scheduledImport{ID: "si1", Name: "nightly", URL: "http://example.com/export", Mapping: "jira",
+		Credentials: importCredentials{BearerToken: "t0ken"}, Interval: duration(time.Hour), CreatedAt: now, NextRunAt: now.Add(time.Hour)})
+	srv.imports.finish("si1", importRun{ID: "r1", StartedAt: now, FinishedAt: now, Trigger: "manual", Status: "ok"})
+	srv.notifications.setPreferences("al", NotificationPrefs{Channels: []string{"email"}, Email: "al@example.com", UpdatedAt: now})
+	w := serve(h, "POST", "/reviews", "")
+	var review Review
+	if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("start review: %d %s", w.Code, w.Body)
+	}
+	srv.touches.touch(todo.ID, touchPostponed, now)
+	srv.reminders.replaceSent(map[string]time.Time{todo.ID: now})
+	if w := serve(h, "PUT", "/events/consumers/sink", `{"cursor":"`+srv.events.cursor(srv.events.head())+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("ack events: %d %s", w.Code, w.Body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv.runStateSaver(ctx, path, time.Hour)
+
+	restarted := newTestServer(t, Options{Store: srv.changes.Store})
+	if err := restarted.loadState(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := restarted.importMappings.get("jira"); !ok || m.loc == nil || m.loc.String() != "Europe/Berlin" {
+		t.Errorf("import mapping after the restart = %+v, %v", m, ok)
+	}
+	if imports := restarted.imports.all(); len(imports) != 1 || imports[0].Credentials.BearerToken != "t0ken" || imports[0].Interval != duration(time.Hour) ||
+		len(imports[0].runs) != 1 || imports[0].LastRun == nil || imports[0].LastRun.ID != "r1" {
+		t.Errorf("scheduled imports after the restart = %+v", imports)
+	}
+	if prefs, _ := restarted.notifications.preferences("al"); prefs.Email != "al@example.com" {
+		t.Errorf("notification preferences after the restart = %+v", prefs)
+	}
+	if _, ok := restarted.reviews.get(review.ID); !ok {
+		t.Error("review is gone after the restart")
+	}
+	if rec := restarted.touches.get(todo.ID); rec.counts[touchPostponed] != 1 {
+		t.Errorf("touches after the restart = %+v", rec)
+	}
+	if sent := restarted.reminders.sentTimes(); !sent[todo.ID].Equal(now) {
+		t.Errorf("sent reminders after the restart = %v", sent)
+	}
+
+	// the consumer is kept, but its cursor is from the previous run
+	if _, ok := restarted.events.consumer("sink"); !ok {
+		t.Fatal("event consumer is gone after the restart")
+	}
+	if w := serve(restarted.routes(), "GET", "/events?consumer=sink", ""); w.Code != http.StatusGone {
+		t.Errorf("resuming the consumer after the restart: %d %s, want 410", w.Code, w.Body)
+	}
+}
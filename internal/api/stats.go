@@ -0,0 +1,191 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// defaultStatsRange is how far back GET /stats looks without a from date
+const defaultStatsRange = 30 * 24 * time.Hour
+
+// statsBucket counts the todos created and completed in one day or week
+type statsBucket struct {
+	Start     string `json:"start"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// statsResponse is the result of GET /stats. Counts cover every current
+// todo; the series and completion time cover the requested range; the
+// streak always runs up to today.
+type statsResponse struct {
+	From       time.Time                  `json:"from"`
+	To         time.Time                  `json:"to"`
+	Total      int                        `json:"total"`
+	ByStatus   map[store.TodoStatus]int   `json:"by_status"`
+	ByPriority map[store.TodoPriority]int `json:"by_priority"`
+	ByTag      map[string]int             `json:"by_tag"`
+	Bucket     string                     `json:"bucket"`
+	Series     []statsBucket              `json:"series"`
+	// AvgCompletionHours is the mean time from creation to completion of
+	// the todos completed in the range; omitted when there were none
+	AvgCompletionHours *float64 `json:"avg_completion_hours,omitempty"`
+	// StreakDays counts consecutive days, ending today or yesterday, on
+	// which at least one todo was completed
+	StreakDays int `json:"streak_days"`
+	// Time is the time tracked within the range
+	Time timeSummary `json:"time"`
+}
+
+// bucketStart returns the day, or the Monday starting the week, that t
+// falls in, going by loc's calendar
+func bucketStart(t time.Time, weekly bool, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	if weekly {
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// buildStats aggregates todos over [from, to), with days as they fall in
+// now's location
+func buildStats(todos []store.Todo, from, to time.Time, weekly bool, now time.Time) statsResponse {
+	resp := statsResponse{
+		From:       from,
+		To:         to,
+		Total:      len(todos),
+		ByStatus:   map[store.TodoStatus]int{},
+		ByPriority: map[store.TodoPriority]int{},
+		ByTag:      map[string]int{},
+		Bucket:     "day",
+		Series:     []statsBucket{},
+	}
+	step := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	if weekly {
+		resp.Bucket = "week"
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	}
+	index := map[time.Time]int{}
+	for b := bucketStart(from, weekly, now.Location()); b.Before(to); b = step(b) {
+		index[b] = len(resp.Series)
+		resp.Series = append(resp.Series, statsBucket{Start: b.Format(time.DateOnly)})
+	}
+	inRange := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+
+	var completionTotal time.Duration
+	var completions int
+	completedDays := map[time.Time]bool{}
+	for _, todo := range todos {
+		resp.ByStatus[todo.Status]++
+		priority := todo.Priority
+		if priority == "" {
+			priority = "none"
+		}
+		resp.ByPriority[priority]++
+		for _, tag := range todo.Tags {
+			resp.ByTag[tag]++
+		}
+
+		if inRange(todo.CreatedAt) {
+			resp.Series[index[bucketStart(todo.CreatedAt, weekly, now.Location())]].Created++
+		}
+		if todo.Status != store.StatusCompleted || todo.CompletedAt == nil {
+			continue
+		}
+		completedAt := *todo.CompletedAt
+		completedDays[bucketStart(completedAt, false, now.Location())] = true
+		if inRange(completedAt) {
+			resp.Series[index[bucketStart(completedAt, weekly, now.Location())]].Completed++
+			completionTotal += completedAt.Sub(todo.CreatedAt)
+			completions++
+		}
+	}
+	if completions > 0 {
+		avg := completionTotal.Hours() / float64(completions)
+		resp.AvgCompletionHours = &avg
+	}
+
+	// a streak still counts until the end of the day after its last completion
+	day := bucketStart(now, false, now.Location())
+	if !completedDays[day] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for completedDays[day] {
+		resp.StreakDays++
+		day = day.AddDate(0, 0, -1)
+	}
+	return resp
+}
+
+// GET /stats
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	loc, err := s.requestLocation(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, now := r.URL.Query(), time.Now().In(loc)
+	to := now
+	if v := query.Get("to"); v != "" {
+		_, end, err := parseQueryDate(v, now)
+		if err != nil {
+			http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = end
+	}
+	from := to.Add(-defaultStatsRange)
+	if v := query.Get("from"); v != "" {
+		start, _, err := parseQueryDate(v, now)
+		if err != nil {
+			http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = start
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	var weekly bool
+	switch query.Get("bucket") {
+	case "", "day":
+		if to.Sub(from) > 366*24*time.Hour {
+			http.Error(w, "daily buckets are limited to a year; use bucket=week", http.StatusBadRequest)
+			return
+		}
+	case "week":
+		if to.Sub(from) > 10*366*24*time.Hour {
+			http.Error(w, "weekly buckets are limited to ten years", http.StatusBadRequest)
+			return
+		}
+		weekly = true
+	default:
+		http.Error(w, "bucket must be day or week", http.StatusBadRequest)
+		return
+	}
+
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if s.includeCold(r) {
+		archived, err := s.cold.List(r.Context())
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		todos = append(todos, archived...)
+	}
+
+	resp := buildStats(todos, from, to, weekly, now)
+	resp.Time = summarizeTime(s.timeEntries.all(), todos, from, to, now)
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
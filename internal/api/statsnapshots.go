@@ -0,0 +1,309 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// snapshotsKey is the blob all daily stats snapshots are kept in
+const snapshotsKey = "stats/snapshots.json"
+
+// defaultTrendsRange is how far back GET /stats/trends looks without a
+// from date
+const defaultTrendsRange = 365 * 24 * time.Hour
+
+// snapshotCounts are the aggregates a snapshot keeps for one project
+type snapshotCounts struct {
+	Open      int `json:"open"`
+	Completed int `json:"completed"`
+	// Overdue counts the open todos that were past due
+	Overdue int `json:"overdue"`
+}
+
+func (c *snapshotCounts) add(o snapshotCounts) {
+	c.Open += o.Open
+	c.Completed += o.Completed
+	c.Overdue += o.Overdue
+}
+
+// statsSnapshot is what the todos added up to at the end of a day, going
+// by the server's timezone. Today's snapshot is retaken through the day
+// and stays as it was last taken once the day is over.
+type statsSnapshot struct {
+	Date    string    `json:"date"`
+	TakenAt time.Time `json:"taken_at"`
+	// Projects holds the counts by project ID, "" for todos in none
+	Projects map[string]snapshotCounts `json:"projects"`
+	// Backfilled is set on snapshots reconstructed from the todos after
+	// the fact; see backfillSnapshots
+	Backfilled bool `json:"backfilled,omitempty"`
+}
+
+// countTodos adds up todos as they stood at t. A todo is counted if it was
+// created by then, as completed if it was completed by then and as open
+// otherwise; it counts toward the project it is in now.
+func countTodos(todos []store.Todo, t time.Time) map[string]snapshotCounts {
+	projects := map[string]snapshotCounts{}
+	for _, todo := range todos {
+		if !todo.CreatedAt.Before(t) {
+			continue
+		}
+		counts := projects[todo.ProjectID]
+		if todo.Status == store.StatusCompleted && (todo.CompletedAt == nil || todo.CompletedAt.Before(t)) {
+			counts.Completed++
+		} else {
+			counts.Open++
+			if todo.DueAt != nil && todo.DueAt.Before(t) {
+				counts.Overdue++
+			}
+		}
+		projects[todo.ProjectID] = counts
+	}
+	return projects
+}
+
+// snapshotStore holds the daily snapshots by date, persisting them all to
+// one blob
+type snapshotStore struct {
+	blobs store.BlobStore
+	mu    sync.Mutex
+	days  map[string]statsSnapshot
+	// saveMu keeps saves in order, so an older state never overwrites a
+	// newer one
+	saveMu sync.Mutex
+}
+
+func newSnapshotStore(blobs store.BlobStore) *snapshotStore {
+	return &snapshotStore{blobs: blobs, days: map[string]statsSnapshot{}}
+}
+
+// load reads the persisted snapshots; there are none before the first save
+func (ss *snapshotStore) load(ctx context.Context) error {
+	rc, err := ss.blobs.Get(ctx, snapshotsKey)
+	if errors.Is(err, store.ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load stats snapshots: %w", err)
+	}
+	defer rc.Close()
+	var snapshots []statsSnapshot
+	if err := json.NewDecoder(rc).Decode(&snapshots); err != nil {
+		return fmt.Errorf("failed to load stats snapshots: %w", err)
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, snapshot := range snapshots {
+		ss.days[snapshot.Date] = snapshot
+	}
+	return nil
+}
+
+// save persists every snapshot
+func (ss *snapshotStore) save(ctx context.Context) error {
+	ss.saveMu.Lock()
+	defer ss.saveMu.Unlock()
+	data, err := json.Marshal(ss.between("", "9999-12-31"))
+	if err != nil {
+		return err
+	}
+	return ss.blobs.Put(ctx, snapshotsKey, bytes.NewReader(data), "application/json")
+}
+
+// put adds snapshot. The one already kept for its day is replaced if
+// replace is set or if it was only backfilled.
+func (ss *snapshotStore) put(snapshot statsSnapshot, replace bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if existing, ok := ss.days[snapshot.Date]; ok && !replace && !existing.Backfilled {
+		return
+	}
+	ss.days[snapshot.Date] = snapshot
+}
+
+// between returns the snapshots from one date to another, both included,
+// oldest first
+func (ss *snapshotStore) between(from, to string) []statsSnapshot {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	snapshots := []statsSnapshot{}
+	for date, snapshot := range ss.days {
+		if date >= from && date <= to {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	slices.SortFunc(snapshots, func(a, b statsSnapshot) int { return cmp.Compare(a.Date, b.Date) })
+	return snapshots
+}
+
+// allTodos lists the todos in the store and in cold storage, so completed
+// todos keep counting after tiering moves them
+func (s *server) allTodos(ctx context.Context) ([]store.Todo, error) {
+	todos, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.cold != nil {
+		archived, err := s.cold.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, archived...)
+	}
+	return todos, nil
+}
+
+// runStatsSnapshots takes today's snapshot every interval until ctx is
+// cancelled
+func (s *server) runStatsSnapshots(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.takeSnapshot(ctx, now); err != nil {
+				log.Printf("taking the stats snapshot failed: %v", err)
+			}
+		}
+	}
+}
+
+// takeSnapshot records the counts as of now as the snapshot of today
+func (s *server) takeSnapshot(ctx context.Context, now time.Time) error {
+	todos, err := s.allTodos(ctx)
+	if err != nil {
+		return err
+	}
+	s.snapshots.put(statsSnapshot{
+		Date:     now.In(s.location).Format(time.DateOnly),
+		TakenAt:  now,
+		Projects: countTodos(todos, now),
+	}, true)
+	return s.snapshots.save(ctx)
+}
+
+// backfillSnapshots reconstructs the snapshots of the days before today
+// that weren't taken on the day, back to the first todo's creation.
+// They're approximate: deleted todos are gone, todos count toward the
+// project they are in now and reopened todos count as open all along.
+func (s *server) backfillSnapshots(ctx context.Context, progress jobProgress, now time.Time) error {
+	todos, err := s.allTodos(ctx)
+	if err != nil {
+		return err
+	}
+	today := bucketStart(now, false, s.location)
+	first := today
+	for _, todo := range todos {
+		if todo.CreatedAt.Before(first) {
+			first = bucketStart(todo.CreatedAt, false, s.location)
+		}
+	}
+	var days []time.Time
+	for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	progress.total(len(days))
+
+	for _, day := range days {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := day.AddDate(0, 0, 1)
+		snapshot := statsSnapshot{
+			Date:       day.Format(time.DateOnly),
+			TakenAt:    now,
+			Projects:   countTodos(todos, end),
+			Backfilled: true,
+		}
+		// a snapshot taken on the day beats any reconstruction
+		s.snapshots.put(snapshot, false)
+		progress.done(snapshot.Date, nil)
+	}
+	return s.snapshots.save(ctx)
+}
+
+// trendPoint is one day of GET /stats/trends
+type trendPoint struct {
+	Date string `json:"date"`
+	snapshotCounts
+	Backfilled bool `json:"backfilled,omitempty"`
+}
+
+// GET /stats/trends
+func (s *server) handleStatsTrends(w http.ResponseWriter, r *http.Request) {
+	query, now := r.URL.Query(), time.Now().In(s.location)
+	to := now
+	if v := query.Get("to"); v != "" {
+		_, end, err := parseQueryDate(v, now)
+		if err != nil {
+			http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = end
+	}
+	from := to.Add(-defaultTrendsRange)
+	if v := query.Get("from"); v != "" {
+		start, _, err := parseQueryDate(v, now)
+		if err != nil {
+			http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = start
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	projectID := query.Get("project_id")
+	if projectID != "" {
+		if _, err := s.projects.get(projectID); err != nil {
+			http.Error(w, "project_id: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// snapshots are dated by the server's days, whatever the caller's zone
+	first := from.In(s.location).Format(time.DateOnly)
+	last := to.Add(-time.Nanosecond).In(s.location).Format(time.DateOnly)
+	series := []trendPoint{}
+	for _, snapshot := range s.snapshots.between(first, last) {
+		point := trendPoint{Date: snapshot.Date, Backfilled: snapshot.Backfilled}
+		for id, counts := range snapshot.Projects {
+			if projectID == "" || id == projectID {
+				point.add(counts)
+			}
+		}
+		series = append(series, point)
+	}
+	resp := struct {
+		From      time.Time    `json:"from"`
+		To        time.Time    `json:"to"`
+		ProjectID string       `json:"project_id,omitempty"`
+		Series    []trendPoint `json:"series"`
+	}{from, to, projectID, series}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /admin/stats/backfill
+func (s *server) handleBackfillSnapshots(w http.ResponseWriter, r *http.Request) {
+	job := s.jobs.start(context.WithoutCancel(r.Context()), "stats-backfill", actorFromRequest(r), func(ctx context.Context, progress jobProgress) error {
+		return s.backfillSnapshots(ctx, progress, time.Now())
+	})
+	respondJob(w, job)
+}
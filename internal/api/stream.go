@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"golang-todo/internal/store"
+)
+
+// ndjsonType is newline-delimited JSON: one todo per line
+const ndjsonType = "application/x-ndjson"
+
+// streamFlushEvery is how many todos are written between flushes
+const streamFlushEvery = 100
+
+// streamTodos writes the todos visible to a list request one per line,
+// flushing as it goes. Hot todos come first in list order; archived todos
+// from the cold tier follow one at a time as they are read, so exporting
+// them never holds the whole tier in memory. Once the stream has started
+// a failure can no longer change the status, so it ends the stream with a
+// line of the form {"error": "..."} instead.
+func (s *server) streamTodos(w http.ResponseWriter, r *http.Request) {
+	visible, err := s.listFilter(r)
+	if err != nil {
+		respondListError(w, err)
+		return
+	}
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	todos = slices.DeleteFunc(todos, func(t store.Todo) bool { return !visible(t) })
+	sortByPosition(todos)
+
+	w.Header().Set("Content-Type", ndjsonType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	written := 0
+	write := func(todo store.Todo) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		if err := enc.Encode(s.decorate(todo)[0]); err != nil {
+			return err
+		}
+		if written++; written%streamFlushEvery == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	for _, todo := range todos {
+		if err := write(todo); err != nil {
+			s.endStream(enc, err)
+			return
+		}
+	}
+	// let the hot todos go before reading the cold tier
+	todos = nil
+	if s.includeCold(r) {
+		err := s.cold.Each(r.Context(), func(todo store.Todo) error {
+			if !visible(todo) {
+				return nil
+			}
+			return write(todo)
+		})
+		if err != nil {
+			s.endStream(enc, err)
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// endStream reports a failure partway through a stream
+func (s *server) endStream(enc *json.Encoder, err error) {
+	log.Printf("todo stream failed: %v", err)
+	enc.Encode(map[string]string{"error": err.Error()})
+}
+
+// GET /todos/stream
+func (s *server) handleStreamTodos(w http.ResponseWriter, r *http.Request) {
+	s.streamTodos(w, r)
+}
@@ -0,0 +1,468 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// Sync page and batch sizes
+const (
+	defaultSyncPageSize = 500
+	maxSyncPageSize     = 5000
+	maxSyncMutations    = 500
+)
+
+// How conflicting offline edits are resolved. Last-write-wins keeps
+// whichever side changed the todo last; merge keeps the edits of both
+// sides to different fields and merges descriptions line by line.
+const (
+	resolveLastWriteWins = "lww"
+	resolveMerge         = "merge"
+)
+
+// Outcomes of a sync mutation
+const (
+	syncApplied   = "applied"
+	syncMerged    = "merged"
+	syncServerWon = "server_won"
+	syncRejected  = "rejected"
+)
+
+// errSyncOutOfScope is returned for todos a project token can't see, as if
+// they didn't exist
+var errSyncOutOfScope = errors.New("todo not found")
+
+// syncTombstone tells a client to drop a todo. DeletedAt is unset for
+// todos that still exist but that the client can no longer see, such as
+// one moved out of a project token's project.
+type syncTombstone struct {
+	ID        string     `json:"id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// syncPull is what changed since a client's cursor. With Reset, the
+// client's cursor couldn't be caught up from, and Todos is everything it
+// can see: it should replace its local copy rather than apply changes.
+type syncPull struct {
+	Cursor     string          `json:"cursor"`
+	Reset      bool            `json:"reset"`
+	Todos      []store.Todo    `json:"todos"`
+	Tombstones []syncTombstone `json:"tombstones"`
+	HasMore    bool            `json:"has_more"`
+}
+
+// syncCursor is a position in the change log, written epoch.seq
+func (s *server) syncCursor(seq uint64) string {
+	return fmt.Sprintf("%s.%d", s.changes.Epoch(), seq)
+}
+
+// parseSyncCursor reads a cursor; current is false for cursors from an
+// earlier run of the server, which the client can't catch up from
+func (s *server) parseSyncCursor(cursor string) (seq uint64, current bool, err error) {
+	epoch, n, found := strings.Cut(cursor, ".")
+	if !found {
+		return 0, false, errors.New("invalid cursor")
+	}
+	if seq, err = strconv.ParseUint(n, 10, 64); err != nil {
+		return 0, false, errors.New("invalid cursor")
+	}
+	return seq, epoch == s.changes.Epoch() && seq <= s.changes.Head(), nil
+}
+
+// syncVisible returns whether a sync request can see a todo: project
+// tokens only see their own project. Unlike lists, sync includes archived
+// todos.
+func (s *server) syncVisible(r *http.Request) func(store.Todo) bool {
+	token, scoped := s.projectToken(r)
+	return func(t store.Todo) bool {
+		return !scoped || t.ProjectID == token.ProjectID
+	}
+}
+
+// GET /sync
+func (s *server) handleSyncPull(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := s.pageSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var seq uint64
+	current := false
+	if since := query.Get("since"); since != "" {
+		var err error
+		if seq, current, err = s.parseSyncCursor(since); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var changes []store.Change
+	if current {
+		changes, current = s.changes.Since(seq, limit)
+	}
+
+	visible := s.syncVisible(r)
+	resp := syncPull{Todos: []store.Todo{}, Tombstones: []syncTombstone{}}
+	if !current {
+		// the cursor is taken before listing, so writes racing the listing
+		// are sent again next time rather than missed
+		head := s.changes.Head()
+		todos, err := s.store.List(r.Context())
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		resp.Cursor, resp.Reset = s.syncCursor(head), true
+		resp.Todos = s.decorate(slices.DeleteFunc(todos, func(t store.Todo) bool { return !visible(t) })...)
+		if err := respondJSON(w, http.StatusOK, resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	for _, change := range changes {
+		seq = change.Seq
+		if change.DeletedAt != nil {
+			// tombstones carry no project, so project tokens get them all;
+			// they reveal nothing but an ID
+			resp.Tombstones = append(resp.Tombstones, syncTombstone{ID: change.ID, DeletedAt: change.DeletedAt})
+			continue
+		}
+		todo, err := s.store.Get(r.Context(), change.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			// deleted since the changes were read; its tombstone is later on
+			continue
+		}
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		if !visible(todo) {
+			resp.Tombstones = append(resp.Tombstones, syncTombstone{ID: todo.ID})
+			continue
+		}
+		resp.Todos = append(resp.Todos, todo)
+	}
+	resp.Todos = s.decorate(resp.Todos...)
+	resp.Cursor, resp.HasMore = s.syncCursor(seq), len(changes) == limit
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// syncMutation is a change a client made offline. Upserts set only the
+// fields they contain. BaseVersion is the version of the todo the client
+// last saw, and UpdatedAt when the client made the change; they decide
+// conflicts with changes made on the server meanwhile.
+type syncMutation struct {
+	Op          string              `json:"op"`
+	ID          string              `json:"id"`
+	BaseVersion int                 `json:"base_version"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	Resolution  string              `json:"resolution"`
+	Title       *string             `json:"title"`
+	Description *string             `json:"description"`
+	Status      *store.TodoStatus   `json:"status"`
+	Priority    *store.TodoPriority `json:"priority"`
+	Tags        *[]string           `json:"tags"`
+	DueAt       optionalTime        `json:"due_at"`
+	ProjectID   *string             `json:"project_id"`
+}
+
+// syncResult is the outcome of a mutation, with the todo as it now is on
+// the server; a todo that is gone has none. Conflicts lists the fields
+// both sides changed where the server's value was kept.
+type syncResult struct {
+	ID        string      `json:"id"`
+	Result    string      `json:"result"`
+	Conflicts []string    `json:"conflicts,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Todo      *store.Todo `json:"todo,omitempty"`
+}
+
+// validate checks a mutation and fills in its defaults
+func (m *syncMutation) validate(now time.Time) error {
+	if m.Op != "upsert" && m.Op != "delete" {
+		return fmt.Errorf("invalid op %q; want upsert or delete", m.Op)
+	}
+	if m.ID == "" {
+		return errors.New("id is required")
+	}
+	if m.UpdatedAt.IsZero() {
+		return errors.New("updated_at is required")
+	}
+	// a client clock running ahead can't make its writes win every
+	// conflict
+	if m.UpdatedAt.After(now) {
+		m.UpdatedAt = now
+	}
+	m.Resolution = cmp.Or(m.Resolution, resolveLastWriteWins)
+	if m.Resolution != resolveLastWriteWins && m.Resolution != resolveMerge {
+		return fmt.Errorf("invalid resolution %q; want lww or merge", m.Resolution)
+	}
+	return nil
+}
+
+// fields lists the todo fields an upsert sets, by their JSON names
+func (m *syncMutation) fields() []string {
+	var fields []string
+	for name, set := range map[string]bool{
+		"title": m.Title != nil, "description": m.Description != nil, "status": m.Status != nil,
+		"priority": m.Priority != nil, "tags": m.Tags != nil, "due_at": m.DueAt.set, "project_id": m.ProjectID != nil,
+	} {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// drop unsets a field, so the upsert leaves it alone
+func (m *syncMutation) drop(field string) {
+	switch field {
+	case "title":
+		m.Title = nil
+	case "description":
+		m.Description = nil
+	case "status":
+		m.Status = nil
+	case "priority":
+		m.Priority = nil
+	case "tags":
+		m.Tags = nil
+	case "due_at":
+		m.DueAt = optionalTime{}
+	case "project_id":
+		m.ProjectID = nil
+	}
+}
+
+// apply sets the upsert's fields on a todo, moving its status along the
+// workflow
+func (m *syncMutation) apply(t *store.Todo, workflow *Workflow, now time.Time) error {
+	if m.Status != nil && *m.Status != t.Status {
+		if !workflow.valid(*m.Status) {
+			return fmt.Errorf("invalid status %q; want one of %s", *m.Status, workflow.describe())
+		}
+		if err := workflow.checkTransition(t.Status, *m.Status); err != nil {
+			return err
+		}
+		setStatus(t, *m.Status, now)
+	}
+	if m.Title != nil {
+		t.Title = *m.Title
+	}
+	if m.Description != nil {
+		t.Description = *m.Description
+	}
+	if m.Priority != nil {
+		t.Priority = *m.Priority
+	}
+	if m.Tags != nil {
+		t.Tags = normalizeTags(*m.Tags)
+	}
+	if m.DueAt.set {
+		t.DueAt = m.DueAt.value
+	}
+	if m.ProjectID != nil {
+		t.ProjectID = *m.ProjectID
+	}
+	return nil
+}
+
+// POST /sync
+func (s *server) handleSyncPush(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Mutations []syncMutation `json:"mutations"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Mutations) == 0 {
+		http.Error(w, "mutations is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Mutations) > maxSyncMutations {
+		http.Error(w, fmt.Sprintf("at most %d mutations can be synced at once", maxSyncMutations), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// each mutation commits on its own, so one that is rejected doesn't
+	// hold back the rest
+	now := time.Now()
+	results := make([]syncResult, 0, len(req.Mutations))
+	for _, m := range req.Mutations {
+		var res syncResult
+		var events []store.Event
+		err := m.validate(now)
+		if err == nil {
+			err = s.store.Atomically(r.Context(), func(tx store.Tx) error {
+				var err error
+				res, events, err = s.syncMutate(r, tx, m, now)
+				return err
+			})
+		}
+		if err != nil {
+			res = syncResult{ID: m.ID, Result: syncRejected, Error: err.Error()}
+		} else {
+			s.emitFor(r, events...)
+		}
+		if res.Todo != nil {
+			res.Todo = &s.decorate(*res.Todo)[0]
+		}
+		results = append(results, res)
+	}
+	if err := respondJSON(w, http.StatusOK, map[string]any{"results": results}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// syncMutate applies a mutation in tx, resolving conflicts with changes
+// made on the server since the client's base version
+func (s *server) syncMutate(r *http.Request, tx store.Tx, m syncMutation, now time.Time) (syncResult, []store.Event, error) {
+	token, scoped := s.projectToken(r)
+	if scoped && m.ProjectID != nil && *m.ProjectID != token.ProjectID {
+		return syncResult{}, nil, errors.New("project tokens can only sync todos in their own project")
+	}
+	current, err := tx.Get(r.Context(), m.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return s.syncMissing(r, tx, m, now)
+	}
+	if err != nil {
+		return syncResult{}, nil, err
+	}
+	if scoped && current.ProjectID != token.ProjectID {
+		return syncResult{}, nil, errSyncOutOfScope
+	}
+	kept := syncResult{ID: m.ID, Result: syncServerWon, Todo: &current}
+	clientNewer := m.UpdatedAt.After(current.UpdatedAt)
+	stale := m.BaseVersion != current.Version
+
+	if m.Op == "delete" {
+		// edits made on the server since the client's version survive a
+		// merge, and a later edit survives last-write-wins
+		if stale && (m.Resolution == resolveMerge || !clientNewer) {
+			return kept, nil, nil
+		}
+		deleted := store.NewEvent(store.EventTodoDeleted, actorFromRequest(r), current)
+		if err := tx.Delete(r.Context(), m.ID, s.outboxEvents(deleted)...); err != nil {
+			return syncResult{}, nil, err
+		}
+		return syncResult{ID: m.ID, Result: syncApplied}, []store.Event{deleted}, nil
+	}
+
+	result := syncApplied
+	var conflicts []string
+	if stale {
+		var base *store.Todo
+		if m.Resolution == resolveMerge {
+			base, _ = s.audit.revision(m.ID, m.BaseVersion)
+		}
+		switch {
+		case base != nil:
+			result = syncMerged
+			changed := map[string]bool{}
+			for _, change := range diffTodos(*base, current) {
+				changed[change.Field] = true
+			}
+			for _, field := range m.fields() {
+				if !changed[field] {
+					continue
+				}
+				if field == "description" {
+					if merged := merge3(base.Description, current.Description, *m.Description); merged.Clean {
+						m.Description = &merged.Merged
+						continue
+					}
+				}
+				// both sides changed the field: the later change wins
+				if !clientNewer {
+					m.drop(field)
+					conflicts = append(conflicts, field)
+				}
+			}
+		case !clientNewer:
+			// last-write-wins, also for merges whose base version is no
+			// longer in the history
+			return kept, nil, nil
+		}
+	}
+	if len(m.fields()) == 0 {
+		kept.Conflicts = conflicts
+		if !stale {
+			kept.Result = syncApplied
+		}
+		return kept, nil, nil
+	}
+
+	var applyErr error
+	todo, events := applyUpdate(current, actorFromRequest(r), now, func(t *store.Todo) { applyErr = m.apply(t, s.workflow, now) })
+	if applyErr != nil {
+		return syncResult{}, nil, applyErr
+	}
+	if err := s.checkNewTodo(todo); err != nil {
+		return syncResult{}, nil, err
+	}
+	if err := tx.Update(r.Context(), todo, s.outboxEvents(events...)...); err != nil {
+		return syncResult{}, nil, err
+	}
+	return syncResult{ID: m.ID, Result: result, Conflicts: conflicts, Todo: &todo}, events, nil
+}
+
+// syncMissing applies a mutation of a todo the server doesn't have: one
+// the client created offline, or one deleted meanwhile
+func (s *server) syncMissing(r *http.Request, tx store.Tx, m syncMutation, now time.Time) (syncResult, []store.Event, error) {
+	deletedAt, deleted := s.changes.Tombstone(m.ID)
+	if m.Op == "delete" {
+		return syncResult{ID: m.ID, Result: syncApplied}, nil, nil
+	}
+	// an edit to a deleted todo brings it back only if it is later than
+	// the deletion under last-write-wins
+	if deleted && (m.Resolution == resolveMerge || !m.UpdatedAt.After(deletedAt)) {
+		return syncResult{ID: m.ID, Result: syncServerWon}, nil, nil
+	}
+	if _, err := uuid.Parse(m.ID); err != nil {
+		return syncResult{}, nil, errors.New("id of a new todo must be a UUID generated by the client")
+	}
+
+	todo := newTodo(store.Todo{}, now)
+	todo.ID = m.ID
+	// a recreated todo carries on from the versions in its history
+	_, latest := s.audit.revision(m.ID, 0)
+	todo.Version = latest + 1
+	if err := m.apply(&todo, s.workflow, now); err != nil {
+		return syncResult{}, nil, err
+	}
+	if token, ok := s.projectToken(r); ok {
+		todo.ProjectID = token.ProjectID
+	}
+	if todo.DueAt != nil {
+		loc, err := s.requestLocation(r)
+		if err != nil {
+			return syncResult{}, nil, err
+		}
+		todo.DueTimezone = loc.String()
+	}
+	if err := s.checkNewTodo(todo); err != nil {
+		return syncResult{}, nil, err
+	}
+	created := store.NewEvent(store.EventTodoCreated, actorFromRequest(r), todo)
+	if err := tx.Create(r.Context(), todo, s.outboxEvents(created)...); err != nil {
+		return syncResult{}, nil, err
+	}
+	return syncResult{ID: m.ID, Result: syncApplied, Todo: &todo}, []store.Event{created}, nil
+}
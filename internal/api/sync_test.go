@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// pull fetches what changed since cursor, or everything for ""
+func pull(t *testing.T, h http.Handler, cursor string, header ...string) syncPull {
+	t.Helper()
+	w := serve(h, "GET", "/sync?since="+url.QueryEscape(cursor), "", header...)
+	var resp syncPull
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("pull since %q: %d %s", cursor, w.Code, w.Body)
+	}
+	return resp
+}
+
+// push syncs mutations, returning one result for each
+func push(t *testing.T, h http.Handler, mutations string, header ...string) []syncResult {
+	t.Helper()
+	w := serve(h, "POST", "/sync", `{"mutations":`+mutations+`}`, header...)
+	var resp struct {
+		Results []syncResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("push %s: %d %s", mutations, w.Code, w.Body)
+	}
+	return resp.Results
+}
+
+func TestSyncPullCatchesUp(t *testing.T) {
+	srv := newTestServer(t, Options{})
+	h := srv.routes()
+	kept := createTodo(t, h, `{"title":"kept"}`)
+	gone := createTodo(t, h, `{"title":"gone"}`)
+	first := pull(t, h, "")
+	if !first.Reset || len(first.Todos) != 2 {
+		t.Fatalf("first pull = %+v, want a reset with both todos", first)
+	}
+
+	if w := serve(h, "PATCH", "/todos/"+kept.ID, `{"description":"edited"}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	deleteTodo(t, h, gone.ID)
+	next := pull(t, h, first.Cursor)
+	if next.Reset || len(next.Todos) != 1 || next.Todos[0].Description != "edited" {
+		t.Errorf("pull after an edit = %+v, want only the edited todo", next)
+	}
+	if len(next.Tombstones) != 1 || next.Tombstones[0].ID != gone.ID || next.Tombstones[0].DeletedAt == nil {
+		t.Errorf("tombstones = %+v, want the deleted todo", next.Tombstones)
+	}
+	if again := pull(t, h, next.Cursor); len(again.Todos)+len(again.Tombstones) != 0 || again.Cursor != next.Cursor {
+		t.Errorf("pull with nothing new = %+v", again)
+	}
+	if w := serve(h, "GET", "/sync?since=garbage", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("pull with an invalid cursor: %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// pages end at the limit
+	for _, title := range []string{"b", "c"} {
+		createTodo(t, h, `{"title":"`+title+`"}`)
+	}
+	w := serve(h, "GET", "/sync?limit=1&since="+url.QueryEscape(next.Cursor), "")
+	var page syncPull
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Todos) != 1 || !page.HasMore {
+		t.Errorf("limited pull = %d %s, want one todo and more to come", w.Code, w.Body)
+	}
+
+	// a cursor past pruned tombstones can't be caught up from
+	srv.changes.Retention = time.Nanosecond
+	deleteTodo(t, h, kept.ID)
+	time.Sleep(time.Millisecond)
+	if resp := pull(t, h, next.Cursor); !resp.Reset {
+		t.Errorf("pull from before a pruned tombstone = %+v, want a reset", resp)
+	}
+}
+
+func TestSyncCursorsAfterRestart(t *testing.T) {
+	srv := newTestServer(t, Options{})
+	createTodo(t, srv.routes(), `{"title":"a"}`)
+	cursor := pull(t, srv.routes(), "").Cursor
+
+	// a new run starts a new epoch, so the old cursor resets the client
+	restarted := newTestServer(t, Options{Store: srv.changes.Store})
+	resp := pull(t, restarted.routes(), cursor)
+	if !resp.Reset || len(resp.Todos) != 1 || resp.Cursor == cursor {
+		t.Errorf("pull with a cursor from the previous run = %+v, want a reset with a new cursor", resp)
+	}
+}
+
+func TestSyncPushResolvesConflicts(t *testing.T) {
+	srv := newTestServer(t, Options{})
+	h := srv.routes()
+	todo := createTodo(t, h, `{"title":"a","description":"one\ntwo\nthree\n"}`)
+	before := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	if w := serve(h, "PATCH", "/todos/"+todo.ID, `{"description":"ONE\ntwo\nthree\n"}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	later := time.Now().Add(time.Second).UTC().Format(time.RFC3339Nano)
+	id := `"id":"` + todo.ID + `","base_version":1`
+
+	tests := []struct {
+		name      string
+		mutation  string
+		result    string
+		conflicts int
+	}{
+		{"older edit under last-write-wins", `{"op":"upsert",` + id + `,"updated_at":"` + before + `","title":"older"}`, syncServerWon, 0},
+		{"edit to another field, merged", `{"op":"upsert",` + id + `,"updated_at":"` + before + `","resolution":"merge","priority":"high"}`, syncMerged, 0},
+		{"older edit to the same field, merged", `{"op":"upsert",` + id + `,"updated_at":"` + before + `","resolution":"merge","description":"one\ntwo\nTHREE\n"}`, syncMerged, 0},
+		{"older delete of an edited todo", `{"op":"delete",` + id + `,"updated_at":"` + before + `"}`, syncServerWon, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := push(t, h, "["+tt.mutation+"]")
+			if len(results) != 1 || results[0].Result != tt.result || len(results[0].Conflicts) != tt.conflicts {
+				t.Errorf("results = %+v, want %s with %d conflicts", results, tt.result, tt.conflicts)
+			}
+		})
+	}
+	got, err := srv.store.Get(context.Background(), todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "a" || got.Priority != store.PriorityHigh || got.Description != "ONE\ntwo\nTHREE\n" {
+		t.Errorf("todo after the merges = %+v", got)
+	}
+
+	// a later delete wins over the edits; of the edits made after it, only
+	// a later one brings the todo back
+	results := push(t, h, `[{"op":"delete","id":"`+todo.ID+`","base_version":1,"updated_at":"`+later+`"},
+		{"op":"upsert","id":"`+todo.ID+`","updated_at":"`+before+`","title":"stale"}]`)
+	if results[0].Result != syncApplied || results[1].Result != syncServerWon {
+		t.Fatalf("delete then older edit = %+v", results)
+	}
+	results = push(t, h, `[{"op":"upsert","id":"`+todo.ID+`","updated_at":"`+time.Now().Add(2*time.Second).UTC().Format(time.RFC3339Nano)+`","title":"back"}]`)
+	if results[0].Result != syncApplied || results[0].Todo == nil || results[0].Todo.Version <= got.Version {
+		t.Errorf("later edit of the deleted todo = %+v, want it recreated past version %d", results, got.Version)
+	}
+
+	// todos created offline need a client-generated UUID
+	results = push(t, h, `[{"op":"upsert","id":"`+uuid.New().String()+`","updated_at":"`+before+`","title":"new"},
+		{"op":"upsert","id":"not-a-uuid","updated_at":"`+before+`","title":"new"}]`)
+	if results[0].Result != syncApplied || results[1].Result != syncRejected {
+		t.Errorf("offline creations = %+v, want the UUID applied and the other rejected", results)
+	}
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// tagSeparator nests tags, as in work/clients/acme
+const tagSeparator = "/"
+
+// subtreeSuffix on a tag filter matches the tag and everything nested
+// under it, as in tag:work/*
+const subtreeSuffix = "/*"
+
+// cleanTag trims a tag and each of its levels, dropping empty levels, so
+// " work / acme/ " becomes "work/acme"
+func cleanTag(tag string) string {
+	var levels []string
+	for _, level := range strings.Split(tag, tagSeparator) {
+		if level = strings.TrimSpace(level); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, tagSeparator)
+}
+
+// inSubtree reports whether tag is root or nested under it
+func inSubtree(tag, root string) bool {
+	return tag == root || strings.HasPrefix(tag, root+tagSeparator)
+}
+
+// tagMatcher returns whether a todo's tags satisfy a tag filter: the exact
+// tag, or a whole subtree when the filter ends in /*
+func tagMatcher(filter string) func(tags []string) bool {
+	if root, ok := strings.CutSuffix(filter, subtreeSuffix); ok {
+		root = cleanTag(root)
+		return func(tags []string) bool {
+			return slices.ContainsFunc(tags, func(tag string) bool { return inSubtree(tag, root) })
+		}
+	}
+	return func(tags []string) bool { return slices.Contains(tags, filter) }
+}
+
+// retag moves the subtree under from to under to in tags, reporting
+// whether anything changed
+func retag(tags []string, from, to string) ([]string, bool) {
+	out := make([]string, 0, len(tags))
+	changed := false
+	for _, tag := range tags {
+		if inSubtree(tag, from) {
+			tag, changed = to+strings.TrimPrefix(tag, from), true
+		}
+		out = append(out, tag)
+	}
+	return normalizeTags(out), changed
+}
+
+// tagCount counts the todos carrying a tag. Parents that no todo carries
+// directly are listed too, with a Count of 0.
+type tagCount struct {
+	Tag    string `json:"tag"`
+	Parent string `json:"parent,omitempty"`
+	Depth  int    `json:"depth"`
+	// Count is the todos tagged with exactly this tag
+	Count int `json:"count"`
+	// Total also includes the todos tagged with anything nested under it,
+	// counting each todo once
+	Total int `json:"total"`
+}
+
+// countTags tallies the tags of todos, sorted so parents come before their
+// children
+func countTags(todos []store.Todo) []tagCount {
+	counts := map[string]*tagCount{}
+	for _, todo := range todos {
+		seen := map[string]bool{}
+		for _, tag := range todo.Tags {
+			levels := strings.Split(tag, tagSeparator)
+			for depth := range levels {
+				name := strings.Join(levels[:depth+1], tagSeparator)
+				c, ok := counts[name]
+				if !ok {
+					c = &tagCount{Tag: name, Depth: depth, Parent: strings.Join(levels[:depth], tagSeparator)}
+					counts[name] = c
+				}
+				if !seen[name] {
+					c.Total++
+					seen[name] = true
+				}
+			}
+			counts[tag].Count++
+		}
+	}
+	out := make([]tagCount, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, *c)
+	}
+	slices.SortFunc(out, func(a, b tagCount) int { return strings.Compare(a.Tag, b.Tag) })
+	return out
+}
+
+// GET /tags
+func (s *server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	todos, err := s.listTodos(r)
+	if err != nil {
+		respondListError(w, err)
+		return
+	}
+	tags := countTags(todos)
+	if root := cleanTag(r.URL.Query().Get("under")); root != "" {
+		tags = slices.DeleteFunc(tags, func(c tagCount) bool { return !inSubtree(c.Tag, root) })
+	}
+	if err := respondJSON(w, http.StatusOK, tags); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// tagChange reports a rename or merge
+type tagChange struct {
+	From    []string `json:"from"`
+	To      string   `json:"to"`
+	Updated int      `json:"updated"`
+}
+
+// errTagInUse refuses a rename onto a tag that todos already carry
+var errTagInUse = errors.New("tag is already in use; merge into it instead")
+
+// retagAll moves each of the from subtrees to under to on every todo in one
+// transaction, so no todo is seen with half the change. Unless merge is
+// set, to must be a tag no todo carries yet. Archived todos moved to cold
+// storage keep their tags.
+func (s *server) retagAll(r *http.Request, from []string, to string, merge bool) (tagChange, error) {
+	change := tagChange{From: from, To: to}
+	now, actor := time.Now(), actorFromRequest(r)
+	var events []store.Event
+	err := s.store.Atomically(r.Context(), func(tx store.Tx) error {
+		todos, err := tx.List(r.Context())
+		if err != nil {
+			return err
+		}
+		if !merge && slices.ContainsFunc(todos, func(t store.Todo) bool { return tagMatcher(to + subtreeSuffix)(t.Tags) }) {
+			return errTagInUse
+		}
+		events, change.Updated = nil, 0
+		for _, todo := range todos {
+			tags, changed := todo.Tags, false
+			for _, f := range from {
+				var c bool
+				tags, c = retag(tags, f, to)
+				changed = changed || c
+			}
+			if !changed {
+				continue
+			}
+			var evts []store.Event
+			todo, evts = applyUpdate(todo, actor, now, func(t *store.Todo) { t.Tags = tags })
+			if err := tx.Update(r.Context(), todo, s.outboxEvents(evts...)...); err != nil {
+				return err
+			}
+			events = append(events, evts...)
+			change.Updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return tagChange{}, err
+	}
+	s.emitFor(r, events...)
+	return change, nil
+}
+
+// checkRetag validates the tags of a rename or merge
+func checkRetag(from []string, to string) error {
+	if len(from) == 0 {
+		return errors.New("at least one tag to move is required")
+	}
+	for _, f := range from {
+		if f == "" {
+			return errors.New("tags to move can't be empty")
+		}
+		if inSubtree(to, f) {
+			return errors.New("can't move " + f + " to itself or under itself")
+		}
+	}
+	return nil
+}
+
+// respondRetag answers a rename or merge
+func respondRetag(w http.ResponseWriter, change tagChange, err error) {
+	if errors.Is(err, errTagInUse) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, change); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /tags/rename
+func (s *server) handleRenameTag(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to := cleanTag(req.From), cleanTag(req.To)
+	if from == "" || to == "" {
+		http.Error(w, "from and to are required", http.StatusBadRequest)
+		return
+	}
+	if err := checkRetag([]string{from}, to); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	change, err := s.retagAll(r, []string{from}, to, false)
+	respondRetag(w, change, err)
+}
+
+// POST /tags/merge
+func (s *server) handleMergeTags(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Tags []string `json:"tags"`
+		Into string   `json:"into"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var from []string
+	for _, tag := range req.Tags {
+		from = append(from, cleanTag(tag))
+	}
+	into := cleanTag(req.Into)
+	if into == "" {
+		http.Error(w, "into is required", http.StatusBadRequest)
+		return
+	}
+	if err := checkRetag(from, into); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	change, err := s.retagAll(r, from, into, true)
+	respondRetag(w, change, err)
+}
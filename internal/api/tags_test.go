@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"golang-todo/internal/store"
+)
+
+func TestListTagsErrors(t *testing.T) {
+	backend := &failingStore{Store: store.NewMemoryStore()}
+	h := newTestHandler(t, Options{Store: backend})
+	createTodo(t, h, `{"title":"a","tags":["work"]}`)
+	if w := serve(h, "GET", "/tags?query=colour:red", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("tags of an invalid query: status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+
+	backend.fail.Store(true)
+	if w := serve(h, "GET", "/tags", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("tags on a failing store: status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang-todo/internal/store"
+)
+
+// Tag suggestion tuning: tags used on fewer todos than minTagExamples
+// aren't suggested, and suggestions under minTagConfidence are dropped
+const (
+	minTagExamples    = 2
+	minTagConfidence  = 0.3
+	maxTagSuggestions = 5
+)
+
+// TagSuggestion is a tag proposed for a todo, with the estimated chance
+// that it applies
+type TagSuggestion struct {
+	Tag        string  `json:"tag"`
+	Confidence float64 `json:"confidence"`
+}
+
+// tagFeatures are the words of a todo that tag suggestions learn from: its
+// title and description words, plus its project
+func tagFeatures(title, description, projectID string) []string {
+	var features []string
+	for _, token := range tokenize(title + " " + description) {
+		if len(token) > 1 && !slices.Contains(features, token) {
+			features = append(features, token)
+		}
+	}
+	if projectID != "" {
+		features = append(features, "project:"+projectID)
+	}
+	return features
+}
+
+// tagModel is a naive Bayes classifier per tag, trained on existing todos.
+// Each tag is decided on its own, since a todo can carry several.
+type tagModel struct {
+	docs int
+	// tagged counts the todos with each tag
+	tagged map[string]int
+	// words counts the todos containing each feature
+	words map[string]int
+	// wordsTagged counts, per tag, the todos with it containing each
+	// feature
+	wordsTagged map[string]map[string]int
+}
+
+func trainTagModel(todos []store.Todo) *tagModel {
+	m := &tagModel{tagged: map[string]int{}, words: map[string]int{}, wordsTagged: map[string]map[string]int{}}
+	for _, todo := range todos {
+		features := tagFeatures(todo.Title, todo.Description, todo.ProjectID)
+		m.docs++
+		for _, f := range features {
+			m.words[f]++
+		}
+		for _, tag := range todo.Tags {
+			m.tagged[tag]++
+			if m.wordsTagged[tag] == nil {
+				m.wordsTagged[tag] = map[string]int{}
+			}
+			for _, f := range features {
+				m.wordsTagged[tag][f]++
+			}
+		}
+	}
+	return m
+}
+
+// suggest scores each tag for a todo with features, skipping those in has
+func (m *tagModel) suggest(features, has []string, limit int) []TagSuggestion {
+	suggestions := []TagSuggestion{}
+	for tag, n := range m.tagged {
+		if n < minTagExamples || slices.Contains(has, tag) {
+			continue
+		}
+		// log odds of the tag applying, from its prior and each known
+		// feature's rate with and without the tag, all add-one smoothed
+		logOdds := math.Log((float64(n) + 1) / (float64(m.docs-n) + 1))
+		supported := false
+		for _, f := range features {
+			total := m.words[f]
+			if total == 0 {
+				continue
+			}
+			with := m.wordsTagged[tag][f]
+			supported = supported || with > 0
+			pWith := (float64(with) + 1) / (float64(n) + 2)
+			pWithout := (float64(total-with) + 1) / (float64(m.docs-n) + 2)
+			logOdds += math.Log(pWith / pWithout)
+		}
+		// a tag none of the words have been seen with is only its prior
+		if !supported {
+			continue
+		}
+		confidence := 1 / (1 + math.Exp(-logOdds))
+		if confidence >= minTagConfidence {
+			suggestions = append(suggestions, TagSuggestion{Tag: tag, Confidence: math.Round(confidence*1000) / 1000})
+		}
+	}
+	slices.SortFunc(suggestions, func(a, b TagSuggestion) int {
+		return cmp.Or(cmp.Compare(b.Confidence, a.Confidence), strings.Compare(a.Tag, b.Tag))
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// POST /tags/suggestions
+func (s *server) handleSuggestTags(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		ProjectID   string   `json:"project_id"`
+		Tags        []string `json:"tags"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Title+req.Description) == "" {
+		http.Error(w, "title or description is required", http.StatusBadRequest)
+		return
+	}
+	todos, err := s.store.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	// project tokens only learn from, and so only reveal, their own
+	// project's tags
+	if token, scoped := s.projectToken(r); scoped {
+		todos = slices.DeleteFunc(todos, func(t store.Todo) bool { return t.ProjectID != token.ProjectID })
+		req.ProjectID = token.ProjectID
+	}
+	model := trainTagModel(todos)
+	features := tagFeatures(req.Title, req.Description, req.ProjectID)
+	if err := respondJSON(w, http.StatusOK, model.suggest(features, normalizeTags(req.Tags), maxTagSuggestions)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,378 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// maxTimeEntry caps a manual time entry, which is almost certainly a typo
+// beyond a day
+const maxTimeEntry = 24 * time.Hour
+
+// TimeEntry is a stretch of time someone spent on a todo, either timed
+// with POST /todos/{id}/timer/start and stop or entered by hand
+type TimeEntry struct {
+	ID        string    `json:"id"`
+	TodoID    string    `json:"todo_id"`
+	User      string    `json:"user"`
+	StartedAt time.Time `json:"started_at"`
+	// EndedAt is nil while the timer is running
+	EndedAt *time.Time `json:"ended_at,omitempty"`
+	// Seconds is the length of the entry, up to now for a running timer
+	Seconds int64  `json:"seconds"`
+	Note    string `json:"note,omitempty"`
+	Manual  bool   `json:"manual,omitempty"`
+}
+
+// running reports whether the entry is a timer that hasn't been stopped
+func (e TimeEntry) running() bool {
+	return e.EndedAt == nil
+}
+
+// end is when the entry ended, or now for a running timer
+func (e TimeEntry) end(now time.Time) time.Time {
+	if e.EndedAt != nil {
+		return *e.EndedAt
+	}
+	return now
+}
+
+// within is how much of the entry falls in [from, to)
+func (e TimeEntry) within(from, to, now time.Time) time.Duration {
+	start, end := e.StartedAt, e.end(now)
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	return max(end.Sub(start), 0)
+}
+
+// measured fills in Seconds as of now
+func (e TimeEntry) measured(now time.Time) TimeEntry {
+	e.Seconds = int64(max(e.end(now).Sub(e.StartedAt), 0) / time.Second)
+	return e
+}
+
+// errNoTimer reports a stop without a running timer
+var errNoTimer = errors.New("no timer is running on this todo")
+
+// timeRegistry holds time entries by todo, oldest first
+type timeRegistry struct {
+	mu     sync.RWMutex
+	byTodo map[string][]TimeEntry
+}
+
+func newTimeRegistry() *timeRegistry {
+	return &timeRegistry{byTodo: map[string][]TimeEntry{}}
+}
+
+// start starts user's timer on a todo. Each user has one timer at a time,
+// so any other timer of theirs is stopped and returned; starting a timer
+// that is already running just returns it.
+func (t *timeRegistry) start(todoID, user string, now time.Time) (TimeEntry, []TimeEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var stopped []TimeEntry
+	for id, entries := range t.byTodo {
+		for i, e := range entries {
+			if e.User != user || !e.running() {
+				continue
+			}
+			if id == todoID {
+				return e.measured(now), stopped
+			}
+			entries[i].EndedAt = &now
+			stopped = append(stopped, entries[i].measured(now))
+		}
+	}
+	entry := TimeEntry{ID: uuid.New().String(), TodoID: todoID, User: user, StartedAt: now}
+	t.byTodo[todoID] = append(t.byTodo[todoID], entry)
+	return entry, stopped
+}
+
+// stop stops user's timer on a todo
+func (t *timeRegistry) stop(todoID, user, note string, now time.Time) (TimeEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := t.byTodo[todoID]
+	i := slices.IndexFunc(entries, func(e TimeEntry) bool { return e.User == user && e.running() })
+	if i < 0 {
+		return TimeEntry{}, errNoTimer
+	}
+	entries[i].EndedAt = &now
+	if note != "" {
+		entries[i].Note = note
+	}
+	return entries[i].measured(now), nil
+}
+
+// stopUser stops every running timer of user and returns them
+func (t *timeRegistry) stopUser(user string, now time.Time) []TimeEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var stopped []TimeEntry
+	for _, entries := range t.byTodo {
+		for i, e := range entries {
+			if e.User == user && e.running() {
+				entries[i].EndedAt = &now
+				stopped = append(stopped, entries[i].measured(now))
+			}
+		}
+	}
+	return stopped
+}
+
+func (t *timeRegistry) add(entry TimeEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.byTodo[entry.TodoID] = append(t.byTodo[entry.TodoID], entry)
+}
+
+func (t *timeRegistry) list(todoID string, now time.Time) []TimeEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	entries := make([]TimeEntry, 0, len(t.byTodo[todoID]))
+	for _, e := range t.byTodo[todoID] {
+		entries = append(entries, e.measured(now))
+	}
+	return entries
+}
+
+// spent totals the time spent on a todo up to now
+func (t *timeRegistry) spent(todoID string, now time.Time) time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var total time.Duration
+	for _, e := range t.byTodo[todoID] {
+		total += max(e.end(now).Sub(e.StartedAt), 0)
+	}
+	return total
+}
+
+func (t *timeRegistry) get(todoID, id string) (TimeEntry, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	i := slices.IndexFunc(t.byTodo[todoID], func(e TimeEntry) bool { return e.ID == id })
+	if i < 0 {
+		return TimeEntry{}, false
+	}
+	return t.byTodo[todoID][i], true
+}
+
+func (t *timeRegistry) remove(todoID, id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.byTodo[todoID] = slices.DeleteFunc(t.byTodo[todoID], func(e TimeEntry) bool { return e.ID == id })
+}
+
+// removeTodo drops every entry on a todo
+func (t *timeRegistry) removeTodo(todoID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.byTodo, todoID)
+}
+
+// all returns every entry, grouped by todo
+func (t *timeRegistry) all() []TimeEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	entries := []TimeEntry{}
+	for _, todoID := range slices.Sorted(maps.Keys(t.byTodo)) {
+		entries = append(entries, t.byTodo[todoID]...)
+	}
+	return entries
+}
+
+// replace swaps in a whole new set of entries, as restoring a backup does
+func (t *timeRegistry) replace(entries []TimeEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.byTodo = map[string][]TimeEntry{}
+	for _, e := range entries {
+		t.byTodo[e.TodoID] = append(t.byTodo[e.TodoID], e)
+	}
+}
+
+// timeSummary is the time spent in a stats range, in hours, in total and
+// by the tags and project of the todos it was spent on. A todo's time
+// counts towards each of its tags.
+type timeSummary struct {
+	TotalHours float64            `json:"total_hours"`
+	ByTag      map[string]float64 `json:"by_tag"`
+	ByProject  map[string]float64 `json:"by_project"`
+}
+
+// summarizeTime totals the part of each entry that falls in [from, to).
+// Entries on todos that are gone count towards the total only.
+func summarizeTime(entries []TimeEntry, todos []store.Todo, from, to, now time.Time) timeSummary {
+	byID := make(map[string]store.Todo, len(todos))
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+	}
+	sum := timeSummary{ByTag: map[string]float64{}, ByProject: map[string]float64{}}
+	for _, e := range entries {
+		hours := e.within(from, to, now).Hours()
+		if hours == 0 {
+			continue
+		}
+		sum.TotalHours += hours
+		todo, ok := byID[e.TodoID]
+		if !ok {
+			continue
+		}
+		for _, tag := range todo.Tags {
+			sum.ByTag[tag] += hours
+		}
+		project := todo.ProjectID
+		if project == "" {
+			project = "none"
+		}
+		sum.ByProject[project] += hours
+	}
+	return sum
+}
+
+// checkTimedTodo answers 404 unless the todo in the path exists
+func (s *server) checkTimedTodo(ctx context.Context, w http.ResponseWriter, id string) bool {
+	if _, err := s.store.Get(ctx, id); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		respondError(w, err)
+		return false
+	}
+	return true
+}
+
+// POST /todos/{id}/timer/start
+func (s *server) handleStartTimer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.checkTimedTodo(r.Context(), w, id) {
+		return
+	}
+	entry, stopped := s.timeEntries.start(id, actorFromRequest(r), time.Now())
+	resp := struct {
+		TimeEntry
+		// Stopped are the timers on other todos this one replaced
+		Stopped []TimeEntry `json:"stopped,omitempty"`
+	}{entry, stopped}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /todos/{id}/timer/stop
+func (s *server) handleStopTimer(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Note string `json:"note"`
+	}](r)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry, err := s.timeEntries.stop(r.PathValue("id"), actorFromRequest(r), req.Note, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, entry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /todos/{id}/time
+func (s *server) handleAddTimeEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.checkTimedTodo(r.Context(), w, id) {
+		return
+	}
+	req, err := decodeJSON[struct {
+		Minutes   int        `json:"minutes"`
+		StartedAt *time.Time `json:"started_at"`
+		Note      string     `json:"note"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	length := time.Duration(req.Minutes) * time.Minute
+	if length <= 0 || length > maxTimeEntry {
+		http.Error(w, "minutes must be between 1 and 1440", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	// without a start, the time is taken to have ended just now
+	started := now.Add(-length)
+	if req.StartedAt != nil {
+		started = *req.StartedAt
+	}
+	ended := started.Add(length)
+	if ended.After(now) {
+		http.Error(w, "time entries can't end in the future", http.StatusBadRequest)
+		return
+	}
+	entry := TimeEntry{
+		ID:        uuid.New().String(),
+		TodoID:    id,
+		User:      actorFromRequest(r),
+		StartedAt: started,
+		EndedAt:   &ended,
+		Note:      req.Note,
+		Manual:    true,
+	}
+	s.timeEntries.add(entry)
+	if err := respondJSON(w, http.StatusCreated, entry.measured(now)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /todos/{id}/time
+func (s *server) handleListTimeEntries(w http.ResponseWriter, r *http.Request) {
+	id, now := r.PathValue("id"), time.Now()
+	entries := s.timeEntries.list(id, now)
+	if len(entries) == 0 && !s.checkTimedTodo(r.Context(), w, id) {
+		return
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Seconds
+	}
+	resp := struct {
+		TotalSeconds int64       `json:"total_seconds"`
+		Entries      []TimeEntry `json:"entries"`
+	}{total, entries}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /todos/{id}/time/{entry_id}
+func (s *server) handleDeleteTimeEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.timeEntries.get(r.PathValue("id"), r.PathValue("entry_id"))
+	if !ok {
+		http.Error(w, "Time entry not found", http.StatusNotFound)
+		return
+	}
+	if entry.User != actorFromRequest(r) && !s.isAdmin(r) {
+		http.Error(w, "only the user who logged the time or an admin can delete it", http.StatusForbidden)
+		return
+	}
+	s.timeEntries.remove(entry.TodoID, entry.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
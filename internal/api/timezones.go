@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// timezoneHeader lets a request say which IANA zone it is made from,
+// overriding the user's preference
+const timezoneHeader = "X-Timezone"
+
+// loadTimezone resolves an IANA zone name such as Europe/Berlin
+func loadTimezone(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" || name == "Local" {
+		// Local is the server's zone, the very thing preferences avoid
+		return nil, fmt.Errorf("unknown timezone %q; want an IANA name such as Europe/Berlin", name)
+	}
+	return loc, nil
+}
+
+// userLocation is the preferred timezone of user id, or the server's
+// default
+func (s *server) userLocation(id string) *time.Location {
+	if user, ok := s.users.get(id); ok && user.Timezone != "" {
+		if loc, err := loadTimezone(user.Timezone); err == nil {
+			return loc
+		}
+	}
+	return s.location
+}
+
+// requestLocation is the timezone dates in a request are meant in: the
+// X-Timezone header, else the user's preference, else the server's
+// default. It decides where days start and end for "today" and due:DATE
+// queries, quick-add dates and stats buckets.
+func (s *server) requestLocation(r *http.Request) (*time.Location, error) {
+	if name := r.Header.Get(timezoneHeader); name != "" {
+		return loadTimezone(name)
+	}
+	return s.userLocation(actorFromRequest(r)), nil
+}
+
+// GET /users/{id}/timezone
+func (s *server) handleGetTimezone(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	user, ok := s.users.get(id)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	resp := struct {
+		Timezone string `json:"timezone"`
+		// Default is set when the user has no preference and the server's
+		// default applies
+		Default bool `json:"default,omitempty"`
+	}{user.Timezone, user.Timezone == ""}
+	if resp.Default {
+		resp.Timezone = s.location.String()
+	}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PUT /users/{id}/timezone
+func (s *server) handleSetTimezone(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.canManageUser(r, id) {
+		http.Error(w, "only the user or an admin may change their timezone", http.StatusForbidden)
+		return
+	}
+	req, err := decodeJSON[struct {
+		Timezone string `json:"timezone"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// an empty timezone goes back to the server's default
+	if req.Timezone != "" {
+		if _, err := loadTimezone(req.Timezone); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	user, ok := s.users.setTimezone(id, req.Timezone)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"golang-todo/internal/store"
+)
+
+// TitleLinter is an optional enrichment step that checks todo titles
+// against a style. Linters only suggest changes: titles are always stored
+// as the client wrote them.
+type TitleLinter interface {
+	LintTitle(title string, style TitleStyle) []TitleSuggestion
+}
+
+// Title casings a TitleStyle can ask for
+const (
+	CasingSentence = "sentence"
+	CasingTitle    = "title"
+	CasingLower    = "lower"
+)
+
+// TitleStyle is a house style for todo titles
+type TitleStyle struct {
+	// Casing is sentence, title or lower; empty leaves casing alone
+	Casing string `json:"casing,omitempty" yaml:"casing"`
+	// Corrections are typo fixes on top of the built-in ones, from the
+	// misspelling in lowercase to the correct spelling
+	Corrections map[string]string `json:"corrections,omitempty" yaml:"corrections"`
+	// Words are always written exactly as listed, e.g. "GitHub" or "iOS"
+	Words []string `json:"words,omitempty" yaml:"words"`
+}
+
+// TitleStyles is the style titles follow by default and the styles of
+// projects that want their own, by project ID. A project's style replaces
+// the default rather than adding to it.
+type TitleStyles struct {
+	Default  TitleStyle            `json:"default" yaml:"default"`
+	Projects map[string]TitleStyle `json:"projects,omitempty" yaml:"projects"`
+}
+
+// forProject returns the style of the project with id
+func (ts *TitleStyles) forProject(id string) TitleStyle {
+	if style, ok := ts.Projects[id]; ok && id != "" {
+		return style
+	}
+	return ts.Default
+}
+
+func (ts *TitleStyles) validate() error {
+	check := func(name string, style TitleStyle) error {
+		switch style.Casing {
+		case "", CasingSentence, CasingTitle, CasingLower:
+		default:
+			return fmt.Errorf("%s: unknown casing %q; want sentence, title or lower", name, style.Casing)
+		}
+		for typo, fix := range style.Corrections {
+			if strings.TrimSpace(typo) == "" || strings.TrimSpace(fix) == "" {
+				return fmt.Errorf("%s: corrections need a misspelling and a fix", name)
+			}
+		}
+		return nil
+	}
+	if err := check("default", ts.Default); err != nil {
+		return err
+	}
+	for id, style := range ts.Projects {
+		if err := check("project "+id, style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadTitleStyles reads a title style file; .json files are parsed as JSON
+// and anything else as YAML
+func LoadTitleStyles(path string) (*TitleStyles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	styles := &TitleStyles{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(styles)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(styles)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse title styles %s: %w", path, err)
+	}
+	if err := styles.validate(); err != nil {
+		return nil, fmt.Errorf("invalid title styles %s: %w", path, err)
+	}
+	return styles, nil
+}
+
+// TitleSuggestion proposes replacing title[Start:End] with Replacement
+type TitleSuggestion struct {
+	// Rule is typo, casing or repeat
+	Rule        string `json:"rule"`
+	Message     string `json:"message"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Replacement string `json:"replacement"`
+}
+
+// applySuggestions makes every suggested change to title, skipping any
+// that overlaps one before it
+func applySuggestions(title string, suggestions []TitleSuggestion) string {
+	sorted := slices.Clone(suggestions)
+	slices.SortStableFunc(sorted, func(a, b TitleSuggestion) int { return a.Start - b.Start })
+	var b strings.Builder
+	pos := 0
+	for _, s := range sorted {
+		if s.Start < pos || s.End > len(title) || s.Start > s.End {
+			continue
+		}
+		b.WriteString(title[pos:s.Start])
+		b.WriteString(s.Replacement)
+		pos = s.End
+	}
+	b.WriteString(title[pos:])
+	return b.String()
+}
+
+// commonTypos are misspellings BasicTitleLinter always corrects
+var commonTypos = map[string]string{
+	"acommodate":  "accommodate",
+	"adress":      "address",
+	"agian":       "again",
+	"apointment":  "appointment",
+	"appointmnet": "appointment",
+	"beleive":     "believe",
+	"buisness":    "business",
+	"calender":    "calendar",
+	"comming":     "coming",
+	"definately":  "definitely",
+	"enviroment":  "environment",
+	"freind":      "friend",
+	"groceires":   "groceries",
+	"goverment":   "government",
+	"meeitng":     "meeting",
+	"meetign":     "meeting",
+	"occured":     "occurred",
+	"recieve":     "receive",
+	"recieved":    "received",
+	"reciept":     "receipt",
+	"remeber":     "remember",
+	"rember":      "remember",
+	"resturant":   "restaurant",
+	"schedlue":    "schedule",
+	"seperate":    "separate",
+	"teh":         "the",
+	"thier":       "their",
+	"tommorow":    "tomorrow",
+	"tomorow":     "tomorrow",
+	"untill":      "until",
+	"wich":        "which",
+	"wierd":       "weird",
+}
+
+// minorWords stay lowercase in title case unless they start the title
+var minorWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "in": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "via": true, "with": true,
+}
+
+// BasicTitleLinter is a small dictionary-based TitleLinter. It corrects
+// common typos, flags words written twice in a row and applies the
+// style's casing. Words it can't judge, such as acronyms, mixed-case
+// names and anything with digits, are left alone.
+type BasicTitleLinter struct{}
+
+func (BasicTitleLinter) LintTitle(title string, style TitleStyle) []TitleSuggestion {
+	known := map[string]string{}
+	for _, word := range style.Words {
+		known[strings.ToLower(word)] = word
+	}
+	suggestions := []TitleSuggestion{}
+	words := titleWords(title)
+	// previous is the last word as the suggestions would write it, so
+	// "teh the" counts as a repeat
+	previous := ""
+	for i, span := range words {
+		word := title[span[0]:span[1]]
+		lower := strings.ToLower(word)
+		if i > 0 && lower == previous && isOnlySpace(title[words[i-1][1]:span[0]]) {
+			suggestions = append(suggestions, TitleSuggestion{
+				Rule:    "repeat",
+				Message: fmt.Sprintf("%q is repeated", word),
+				Start:   words[i-1][1],
+				End:     span[1],
+			})
+			continue
+		}
+
+		fixed, rule, message := word, "", ""
+		if exact, ok := known[lower]; ok {
+			fixed, rule, message = exact, "casing", fmt.Sprintf("write %q as %q", word, exact)
+		} else {
+			correction, ok := style.Corrections[lower]
+			if !ok {
+				correction, ok = commonTypos[lower]
+			}
+			if ok {
+				fixed = matchCase(word, correction)
+				rule, message = "typo", fmt.Sprintf("%q looks like a typo for %q", word, fixed)
+			}
+			if cased := applyCasing(style.Casing, fixed, i == 0); cased != fixed {
+				fixed = cased
+				if rule == "" {
+					rule, message = "casing", fmt.Sprintf("%s case writes %q as %q", style.Casing, word, fixed)
+				}
+			}
+		}
+		previous = strings.ToLower(fixed)
+		if fixed != word {
+			suggestions = append(suggestions, TitleSuggestion{
+				Rule:        rule,
+				Message:     message,
+				Start:       span[0],
+				End:         span[1],
+				Replacement: fixed,
+			})
+		}
+	}
+	return suggestions
+}
+
+// titleWords returns the byte spans of the words of title: runs of letters
+// and digits, with apostrophes inside words, as in "don't"
+func titleWords(title string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range title {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if !inWord && r == '\'' && start >= 0 {
+			next, _ := utf8.DecodeRuneInString(title[i+1:])
+			inWord = unicode.IsLetter(next)
+		}
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(title)})
+	}
+	return spans
+}
+
+func isOnlySpace(s string) bool {
+	return s != "" && strings.TrimSpace(s) == ""
+}
+
+// plainWord reports whether word is all lowercase, or capitalized with the
+// rest lowercase: the only words casing rules change
+func plainWord(word string) bool {
+	for i, r := range word {
+		switch {
+		case unicode.IsDigit(r):
+			return false
+		case unicode.IsUpper(r) && i > 0:
+			return false
+		}
+	}
+	return true
+}
+
+func capitalize(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+// matchCase writes correction the way word was written: all caps,
+// capitalized or lowercase
+func matchCase(word, correction string) string {
+	switch {
+	case len(word) > 1 && strings.ToUpper(word) == word:
+		return strings.ToUpper(correction)
+	case word != "" && plainWord(word) && capitalize(word) == word:
+		return capitalize(correction)
+	default:
+		return correction
+	}
+}
+
+// applyCasing writes word in casing; first is whether it starts the title.
+// Sentence case only capitalizes the first word, since later capitals may
+// well be names.
+func applyCasing(casing, word string, first bool) string {
+	if !plainWord(word) {
+		return word
+	}
+	switch {
+	case casing == CasingSentence && first:
+		return capitalize(word)
+	case casing == CasingTitle && (first || !minorWords[strings.ToLower(word)]):
+		return capitalize(word)
+	case casing == CasingTitle, casing == CasingLower:
+		return strings.ToLower(word)
+	default:
+		return word
+	}
+}
+
+// titleLint is what the API answers about a title: the suggestions and
+// the title they would make
+type titleLint struct {
+	Title       string            `json:"title"`
+	Suggestions []TitleSuggestion `json:"suggestions"`
+	Suggested   string            `json:"suggested"`
+}
+
+func (s *server) lintTitle(title, projectID string) titleLint {
+	suggestions := s.titleLinter.LintTitle(title, s.titleStyles.forProject(projectID))
+	if suggestions == nil {
+		suggestions = []TitleSuggestion{}
+	}
+	return titleLint{Title: title, Suggestions: suggestions, Suggested: applySuggestions(title, suggestions)}
+}
+
+// requireTitleLinter rejects requests when no linter is configured
+func (s *server) requireTitleLinter(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.titleLinter == nil {
+			http.Error(w, "title linting is disabled; start the server with -lint-titles to enable it", http.StatusNotFound)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// POST /titles/lint
+func (s *server) handleLintTitle(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJSON[struct {
+		Title     string `json:"title"`
+		ProjectID string `json:"project_id"`
+	}](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Title == "" {
+		http.Error(w, "title is required", http.StatusBadRequest)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.lintTitle(req.Title, req.ProjectID)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /todos/{id}/title-suggestions
+func (s *server) handleTitleSuggestions(w http.ResponseWriter, r *http.Request) {
+	todo, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.lintTitle(todo.Title, todo.ProjectID)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
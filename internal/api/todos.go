@@ -0,0 +1,199 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// priorityRank orders priorities for comparisons; unset and unknown
+// priorities rank 0
+func priorityRank(p store.TodoPriority) int {
+	switch p {
+	case store.PriorityLow:
+		return 1
+	case store.PriorityMedium:
+		return 2
+	case store.PriorityHigh:
+		return 3
+	case store.PriorityUrgent:
+		return 4
+	}
+	return 0
+}
+
+// normalizeTags cleans tags, drops empty ones and removes duplicates
+func normalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		tag = cleanTag(tag)
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// validateNewTodo checks the client-supplied fields of a todo being created
+func validateNewTodo(todo store.Todo) error {
+	if strings.TrimSpace(todo.Title) == "" {
+		return errors.New("title is required")
+	}
+	if todo.EstimateMinutes < 0 {
+		return errors.New("estimate_minutes can't be negative")
+	}
+	if todo.RemindBeforeMinutes < 0 {
+		return errors.New("remind_before_minutes can't be negative")
+	}
+	if err := validateMetadata(todo.Metadata); err != nil {
+		return err
+	}
+	if todo.DueTimezone != "" {
+		if _, err := loadTimezone(todo.DueTimezone); err != nil {
+			return fmt.Errorf("due_timezone: %w", err)
+		}
+	}
+	if todo.Priority != "" && priorityRank(todo.Priority) == 0 {
+		return fmt.Errorf("invalid priority %q; want low, medium, high or urgent", todo.Priority)
+	}
+	return nil
+}
+
+// todoETag is the entity tag of a todo, derived from its version
+func todoETag(todo store.Todo) string {
+	return fmt.Sprintf("\"%d\"", todo.Version)
+}
+
+// checkNewTodo validates a todo being created, including references to
+// other resources
+func (s *server) checkNewTodo(todo store.Todo) error {
+	if err := validateNewTodo(todo); err != nil {
+		return err
+	}
+	if todo.ProjectID != "" {
+		if _, err := s.projects.active(todo.ProjectID); errors.Is(err, errProjectDeleted) {
+			return fmt.Errorf("project %q is deleted", todo.ProjectID)
+		} else if err != nil {
+			return fmt.Errorf("unknown project %q", todo.ProjectID)
+		}
+	}
+	return nil
+}
+
+// decorate fills in the response-only fields of todos about to be returned
+func (s *server) decorate(todos ...store.Todo) []store.Todo {
+	now := time.Now()
+	for i := range todos {
+		todos[i].Lock = s.locks.current(todos[i].ID, now)
+		todos[i].CommentCount = s.comments.count(todos[i].ID)
+		todos[i].TimeSpentSeconds = int64(s.timeEntries.spent(todos[i].ID, now) / time.Second)
+	}
+	return todos
+}
+
+// newTodo fills in the server-assigned fields of a todo being created
+func newTodo(todo store.Todo, now time.Time) store.Todo {
+	todo.ID = uuid.New().String()
+	todo.CreatedAt = now
+	todo.UpdatedAt = now
+	todo.Status = store.StatusPending
+	todo.StatusChangedAt = map[store.TodoStatus]time.Time{store.StatusPending: now}
+	todo.CompletedAt = nil
+	todo.ArchivedAt = nil
+	todo.Version = 1
+	todo.Position = 0
+	todo.Owner = ""
+	todo.Lock, todo.CommentCount, todo.TimeSpentSeconds = nil, 0, 0
+	todo.Tags = normalizeTags(todo.Tags)
+	if loc, err := loadTimezone(todo.DueTimezone); err == nil && todo.DueAt != nil {
+		due := todo.DueAt.In(loc)
+		todo.DueAt = &due
+	}
+	todo.BlockedBy = normalizeBlockedBy(todo.BlockedBy)
+	return todo
+}
+
+// applyStatus moves a todo to a new status along the server's workflow
+// and returns the events the change produces
+func (s *server) applyStatus(todo store.Todo, status store.TodoStatus, actor string, now time.Time) (store.Todo, []store.Event, error) {
+	if !s.workflow.valid(status) {
+		return todo, nil, fmt.Errorf("invalid status %q", status)
+	}
+	if err := s.workflow.checkTransition(todo.Status, status); err != nil {
+		return todo, nil, err
+	}
+	todo, events := applyUpdate(todo, actor, now, func(t *store.Todo) { setStatus(t, status, now) })
+	return todo, events, nil
+}
+
+// setStatus changes a todo's status, stamping when it entered the new
+// state and when it was completed
+func setStatus(t *store.Todo, status store.TodoStatus, now time.Time) {
+	if t.Status != status {
+		// copied so the todo's previous version keeps its own timestamps
+		t.StatusChangedAt = maps.Clone(t.StatusChangedAt)
+		if t.StatusChangedAt == nil {
+			t.StatusChangedAt = map[store.TodoStatus]time.Time{}
+		}
+		t.StatusChangedAt[status] = now
+	}
+	t.Status = status
+	if status == store.StatusCompleted {
+		t.CompletedAt = &now
+	} else {
+		// reopened todos are no longer completed and come back out of the
+		// archive
+		t.CompletedAt, t.ArchivedAt = nil, nil
+	}
+}
+
+// applyUpdate applies change to a todo, bumping its version, and returns
+// the events the change produces
+func applyUpdate(todo store.Todo, actor string, now time.Time, change func(*store.Todo)) (store.Todo, []store.Event) {
+	before := todo
+	change(&todo)
+	todo.UpdatedAt = now
+	todo.Version++
+
+	updated := store.NewEvent(store.EventTodoUpdated, actor, todo)
+	updated.Before = &before
+	events := []store.Event{updated}
+	if todo.Status == store.StatusCompleted && before.Status != store.StatusCompleted {
+		completed := store.NewEvent(store.EventTodoCompleted, actor, todo)
+		completed.Before = &before
+		events = append(events, completed)
+	}
+	return todo, events
+}
+
+// restoreTodo rolls a todo back to the state in snapshot and returns the
+// events the change produces. A nil current means the todo was deleted and
+// is recreated; lastVersion is then the version it was deleted at.
+func restoreTodo(current *store.Todo, snapshot store.Todo, lastVersion int, actor string, now time.Time) (store.Todo, []store.Event) {
+	todo := snapshot
+	todo.UpdatedAt = now
+	if current == nil {
+		todo.Version = lastVersion + 1
+		return todo, []store.Event{store.NewEvent(store.EventTodoCreated, actor, todo)}
+	}
+
+	before := *current
+	todo.ID, todo.CreatedAt = current.ID, current.CreatedAt
+	todo.Version = current.Version + 1
+	updated := store.NewEvent(store.EventTodoUpdated, actor, todo)
+	updated.Before = &before
+	events := []store.Event{updated}
+	if todo.Status == store.StatusCompleted && current.Status != store.StatusCompleted {
+		completed := store.NewEvent(store.EventTodoCompleted, actor, todo)
+		completed.Before = &before
+		events = append(events, completed)
+	}
+	return todo, events
+}
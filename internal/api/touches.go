@@ -0,0 +1,201 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// Kinds of touch: a todo is viewed when it is fetched on its own, edited
+// by any update and postponed when its due date moves later
+const (
+	touchViewed    = "viewed"
+	touchEdited    = "edited"
+	touchPostponed = "postponed"
+)
+
+// touchViewDebounce merges views of a todo in quick succession, such as a
+// client refreshing, into one
+const touchViewDebounce = time.Minute
+
+// Insight thresholds
+const (
+	insightPostponedAfter = 3
+	insightViewedAfter    = 5
+	insightIdleAfter      = 14 * 24 * time.Hour
+)
+
+// touchRecord counts the touches of one todo and when each kind last
+// happened
+type touchRecord struct {
+	counts map[string]int
+	last   map[string]time.Time
+}
+
+// lastTouched is when the todo was last touched in any way, or changed at
+// updatedAt if that was later
+func (tr touchRecord) lastTouched(updatedAt time.Time) time.Time {
+	latest := updatedAt
+	for _, at := range tr.last {
+		if at.After(latest) {
+			latest = at
+		}
+	}
+	return latest
+}
+
+// touchRegistry tracks touches per todo. It is kept in memory only: touches
+// are hints for insights and reviews, not history.
+type touchRegistry struct {
+	mu    sync.Mutex
+	todos map[string]*touchRecord
+}
+
+func newTouchRegistry() *touchRegistry {
+	return &touchRegistry{todos: map[string]*touchRecord{}}
+}
+
+func (tr *touchRegistry) touch(id, kind string, at time.Time) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	rec, ok := tr.todos[id]
+	if !ok {
+		rec = &touchRecord{counts: map[string]int{}, last: map[string]time.Time{}}
+		tr.todos[id] = rec
+	}
+	if kind == touchViewed && at.Sub(rec.last[kind]) < touchViewDebounce {
+		return
+	}
+	rec.counts[kind]++
+	rec.last[kind] = at
+}
+
+// get returns a copy of the touches of todo id; untouched todos have none
+func (tr *touchRegistry) get(id string) touchRecord {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	rec := touchRecord{counts: map[string]int{}, last: map[string]time.Time{}}
+	if stored, ok := tr.todos[id]; ok {
+		maps.Copy(rec.counts, stored.counts)
+		maps.Copy(rec.last, stored.last)
+	}
+	return rec
+}
+
+// forget drops the touches of todo id
+func (tr *touchRegistry) forget(id string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	delete(tr.todos, id)
+}
+
+// todoIDs returns the IDs of the touched todos
+func (tr *touchRegistry) todoIDs() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return slices.Collect(maps.Keys(tr.todos))
+}
+
+// all returns copies of the touches of every touched todo, by todo ID
+func (tr *touchRegistry) all() map[string]touchRecord {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	records := make(map[string]touchRecord, len(tr.todos))
+	for id, rec := range tr.todos {
+		records[id] = touchRecord{counts: maps.Clone(rec.counts), last: maps.Clone(rec.last)}
+	}
+	return records
+}
+
+// replace swaps in a whole new set of touches, as loading a state file
+// does
+func (tr *touchRegistry) replace(records map[string]touchRecord) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.todos = make(map[string]*touchRecord, len(records))
+	for id, rec := range records {
+		rec := touchRecord{counts: maps.Clone(rec.counts), last: maps.Clone(rec.last)}
+		if rec.counts == nil {
+			rec.counts = map[string]int{}
+		}
+		if rec.last == nil {
+			rec.last = map[string]time.Time{}
+		}
+		tr.todos[id] = &rec
+	}
+}
+
+// observe is a server listener recording edits and postponements. Deleted
+// todos keep their touches until they are purged.
+func (tr *touchRegistry) observe(evt store.Event) {
+	if evt.Type != store.EventTodoUpdated {
+		return
+	}
+	tr.touch(evt.Todo.ID, touchEdited, evt.OccurredAt)
+	if before := evt.Before; before != nil && before.DueAt != nil && evt.Todo.DueAt != nil && evt.Todo.DueAt.After(*before.DueAt) {
+		tr.touch(evt.Todo.ID, touchPostponed, evt.OccurredAt)
+	}
+}
+
+// touchInsights are remarks on how a todo has been handled, like "postponed
+// 7 times"
+func touchInsights(todo store.Todo, rec touchRecord, now time.Time) []string {
+	insights := []string{}
+	if n := rec.counts[touchPostponed]; n >= insightPostponedAfter {
+		insights = append(insights, fmt.Sprintf("postponed %d times", n))
+	}
+	if n := rec.counts[touchViewed]; n >= insightViewedAfter && rec.counts[touchEdited] == 0 {
+		insights = append(insights, fmt.Sprintf("viewed %d times but never edited", n))
+	}
+	if idle := now.Sub(rec.lastTouched(todo.UpdatedAt)); idle > insightIdleAfter && todo.Status != store.StatusCompleted {
+		insights = append(insights, fmt.Sprintf("untouched for %d days", int(idle/(24*time.Hour))))
+	}
+	return insights
+}
+
+// GET /todos/{id}/touches
+func (s *server) handleGetTouches(w http.ResponseWriter, r *http.Request) {
+	todo, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	now := time.Now()
+	rec := s.touches.get(todo.ID)
+	resp := struct {
+		TodoID string               `json:"todo_id"`
+		Counts map[string]int       `json:"counts"`
+		Last   map[string]time.Time `json:"last"`
+		// AgeSeconds is how long ago each kind of touch last happened
+		AgeSeconds map[string]int64 `json:"age_seconds"`
+		// IdleSeconds is how long ago the todo was last touched or changed
+		IdleSeconds int64    `json:"idle_seconds"`
+		Insights    []string `json:"insights"`
+	}{
+		TodoID:      todo.ID,
+		Counts:      map[string]int{touchViewed: 0, touchEdited: 0, touchPostponed: 0},
+		Last:        rec.last,
+		AgeSeconds:  map[string]int64{},
+		IdleSeconds: int64(now.Sub(rec.lastTouched(todo.UpdatedAt)) / time.Second),
+		Insights:    touchInsights(todo, rec, now),
+	}
+	maps.Copy(resp.Counts, rec.counts)
+	for kind, at := range rec.last {
+		resp.AgeSeconds[kind] = int64(now.Sub(at) / time.Second)
+	}
+	if err := respondJSON(w, http.StatusOK, resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/store"
+)
+
+// undoItem is one todo touched by an undoable operation: its state before
+// the operation and after it, where after is nil if the operation deleted it.
+type undoItem struct {
+	before store.Todo
+	after  *store.Todo
+}
+
+// undoOperation groups the destructive changes one request made, so a bulk
+// update or delete is undone as a whole
+type undoOperation struct {
+	ID    string
+	Actor string
+	// Session is the undo session of the request, if it named one
+	Session string
+	At      time.Time
+	items   []undoItem
+}
+
+// undoSessionHeader names the undo session of a request. A client such as
+// a browser tab sends a random ID of its own so its undo stack holds only
+// its own actions; without one, a user's undo history covers all of them.
+const undoSessionHeader = "X-Session-ID"
+
+// undoSession returns the undo session request r belongs to, or "" when
+// there is no request or it doesn't name one
+func undoSession(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(undoSessionHeader))
+}
+
+// undoLog remembers recent destructive operations per actor and session
+// for a short window. Anonymous requests share a single undo history.
+type undoLog struct {
+	mu     sync.Mutex
+	window time.Duration
+	ops    []undoOperation
+}
+
+// record turns the events emitted together for one request into an undoable
+// operation. Creations aren't destructive and are ignored, as are the
+// events of an undo itself.
+func (u *undoLog) record(session string, events []store.Event) {
+	op := undoOperation{Session: session}
+	index := map[string]int{}
+	for _, evt := range events {
+		if evt.Undoing {
+			return
+		}
+		var item undoItem
+		switch evt.Type {
+		case store.EventTodoUpdated:
+			if evt.Before == nil {
+				continue
+			}
+			after := evt.Todo
+			item = undoItem{before: *evt.Before, after: &after}
+		case store.EventTodoDeleted:
+			item = undoItem{before: evt.Todo}
+		default:
+			continue
+		}
+		op.Actor, op.At = evt.Actor, evt.OccurredAt
+
+		// a todo touched several times keeps its first before and last after
+		if i, ok := index[evt.Todo.ID]; ok {
+			op.items[i].after = item.after
+			continue
+		}
+		index[evt.Todo.ID] = len(op.items)
+		op.items = append(op.items, item)
+	}
+	if len(op.items) == 0 {
+		return
+	}
+	op.ID = uuid.New().String()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.prune(time.Now())
+	u.ops = append(u.ops, op)
+}
+
+// belongs reports whether op is in the undo history of actor's session;
+// the empty session covers every session of the actor
+func (op undoOperation) belongs(actor, session string) bool {
+	return op.Actor == actor && (session == "" || op.Session == session)
+}
+
+// take removes and returns the operation with the given ID from the undo
+// history of actor's session, or the most recent one if id is empty
+func (u *undoLog) take(actor, session, id string, now time.Time) (undoOperation, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.prune(now)
+	for i := len(u.ops) - 1; i >= 0; i-- {
+		if u.ops[i].belongs(actor, session) && (id == "" || u.ops[i].ID == id) {
+			op := u.ops[i]
+			u.ops = append(u.ops[:i], u.ops[i+1:]...)
+			return op, true
+		}
+	}
+	return undoOperation{}, false
+}
+
+// putBack returns an operation taken for an undo that failed to the undo
+// history, in its place. It is the caller's to undo again, until it
+// expires as if it had never been taken.
+func (u *undoLog) putBack(op undoOperation) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	i, _ := slices.BinarySearchFunc(u.ops, op.At, func(o undoOperation, at time.Time) int { return o.At.Compare(at) })
+	u.ops = slices.Insert(u.ops, i, op)
+}
+
+// undoEntry describes an undoable operation to the client
+type undoEntry struct {
+	ID        string     `json:"id"`
+	At        time.Time  `json:"at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Summary   string     `json:"summary"`
+	Todos     []undoTodo `json:"todos"`
+}
+
+type undoTodo struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Deleted is set when the operation deleted the todo
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// list returns the undo stack of actor's session, most recent first
+func (u *undoLog) list(actor, session string, now time.Time) []undoEntry {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.prune(now)
+	entries := []undoEntry{}
+	for i := len(u.ops) - 1; i >= 0; i-- {
+		op := u.ops[i]
+		if !op.belongs(actor, session) {
+			continue
+		}
+		entry := undoEntry{ID: op.ID, At: op.At, ExpiresAt: op.At.Add(u.window)}
+		deleted := 0
+		for _, item := range op.items {
+			entry.Todos = append(entry.Todos, undoTodo{ID: item.before.ID, Title: item.before.Title, Deleted: item.after == nil})
+			if item.after == nil {
+				deleted++
+			}
+		}
+		entry.Summary = summarizeUndo(entry.Todos, deleted)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// summarizeUndo describes an operation in a few words, e.g. for the label
+// of an undo button
+func summarizeUndo(todos []undoTodo, deleted int) string {
+	verb := "Updated"
+	switch deleted {
+	case 0:
+	case len(todos):
+		verb = "Deleted"
+	default:
+		verb = "Updated and deleted"
+	}
+	if len(todos) == 1 {
+		return fmt.Sprintf("%s %q", verb, todos[0].Title)
+	}
+	return fmt.Sprintf("%s %d todos", verb, len(todos))
+}
+
+// prune drops operations older than the window; ops are kept in order
+func (u *undoLog) prune(now time.Time) {
+	cutoff := now.Add(-u.window)
+	i := 0
+	for i < len(u.ops) && u.ops[i].At.Before(cutoff) {
+		i++
+	}
+	u.ops = u.ops[i:]
+}
+
+// errUndoConflict aborts an undo when a todo changed after the operation
+var errUndoConflict = errors.New("undo conflict")
+
+// GET /undo
+func (s *server) handleListUndo(w http.ResponseWriter, r *http.Request) {
+	entries := s.undo.list(actorFromRequest(r), undoSession(r), time.Now())
+	if err := respondJSON(w, http.StatusOK, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /undo
+// POST /undo/{id}
+func (s *server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	now, actor := time.Now(), actorFromRequest(r)
+	op, ok := s.undo.take(actor, undoSession(r), r.PathValue("id"), now)
+	if !ok {
+		http.Error(w, "nothing to undo", http.StatusNotFound)
+		return
+	}
+
+	var restored []store.Todo
+	var conflicts []string
+	var emitted []store.Event
+	err := s.store.Atomically(r.Context(), func(tx store.Tx) error {
+		restored, emitted, conflicts = nil, nil, nil
+		for _, item := range op.items {
+			current, err := tx.Get(r.Context(), item.before.ID)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			exists := err == nil
+
+			var todo store.Todo
+			var evts []store.Event
+			switch {
+			case item.after == nil && !exists:
+				todo, evts = restoreTodo(nil, item.before, item.before.Version, actor, now)
+				err = tx.Create(r.Context(), todo, s.outboxEvents(evts...)...)
+			case item.after != nil && exists && current.Version == item.after.Version:
+				todo, evts = restoreTodo(&current, item.before, 0, actor, now)
+				err = tx.Update(r.Context(), todo, s.outboxEvents(evts...)...)
+			default:
+				conflicts = append(conflicts, item.before.ID)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			restored = append(restored, todo)
+			emitted = append(emitted, evts...)
+		}
+		if len(conflicts) > 0 {
+			return errUndoConflict
+		}
+		return nil
+	})
+	if err != nil {
+		// taking the operation kept concurrent undos from both applying
+		// it; one that didn't apply stays in the history
+		s.undo.putBack(op)
+	}
+	if errors.Is(err, errUndoConflict) {
+		http.Error(w, fmt.Sprintf("todos changed since the action and can't be undone: %s", strings.Join(conflicts, ", ")), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	for i := range emitted {
+		emitted[i].Undoing = true
+	}
+	s.emitFor(r, emitted...)
+
+	if err := respondJSON(w, http.StatusOK, map[string]any{
+		"operation_id": op.ID,
+		"undone_at":    now,
+		"restored":     restored,
+	}); err != nil {
+		respondError(w, err)
+		return
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"golang-todo/internal/store"
+)
+
+// failingStore fails every transaction and listing while fail is set
+type failingStore struct {
+	store.Store
+	fail atomic.Bool
+}
+
+func (s *failingStore) Atomically(ctx context.Context, fn func(tx store.Tx) error) error {
+	if s.fail.Load() {
+		return errors.New("store unavailable")
+	}
+	return s.Store.Atomically(ctx, fn)
+}
+
+func (s *failingStore) List(ctx context.Context) ([]store.Todo, error) {
+	if s.fail.Load() {
+		return nil, errors.New("store unavailable")
+	}
+	return s.Store.List(ctx)
+}
+
+// undoStack returns the IDs of al's undoable operations, most recent first
+func undoStack(t *testing.T, h http.Handler) []string {
+	t.Helper()
+	w := serve(h, "GET", "/undo", "")
+	var entries []undoEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("list undo: %d %s", w.Code, w.Body)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestUndoKeepsOperationOnConflict(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	todo := createTodo(t, h, `{"title":"a"}`)
+	if w := serve(h, "PATCH", "/todos/"+todo.ID, `{"description":"first"}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	first := undoStack(t, h)
+	if w := serve(h, "PATCH", "/todos/"+todo.ID, `{"description":"second"}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	stack := undoStack(t, h)
+	if len(first) != 1 || len(stack) != 2 {
+		t.Fatalf("undo stacks = %v then %v, want one operation then two", first, stack)
+	}
+
+	// the second update changed the todo after the first
+	if w := serve(h, "POST", "/undo/"+first[0], ""); w.Code != http.StatusConflict {
+		t.Fatalf("undo first: status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+	}
+	if got := undoStack(t, h); len(got) != 2 || got[0] != stack[0] || got[1] != stack[1] {
+		t.Fatalf("undo stack after the conflict = %v, want %v", got, stack)
+	}
+
+	if w := serve(h, "POST", "/undo", ""); w.Code != http.StatusOK {
+		t.Fatalf("undo second: %d %s", w.Code, w.Body)
+	}
+	if got := undoStack(t, h); len(got) != 1 || got[0] != first[0] {
+		t.Errorf("undo stack after undoing the second update = %v, want %v", got, first)
+	}
+}
+
+func TestUndoKeepsOperationOnStoreError(t *testing.T) {
+	backend := &failingStore{Store: store.NewMemoryStore()}
+	h := newTestHandler(t, Options{Store: backend})
+	todo := createTodo(t, h, `{"title":"a"}`)
+	if w := serve(h, "DELETE", "/todos/"+todo.ID, ""); w.Code >= 300 {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+
+	backend.fail.Store(true)
+	if w := serve(h, "POST", "/undo", ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("undo on a failing store: status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+	if got := undoStack(t, h); len(got) != 1 {
+		t.Fatalf("undo stack after the failure = %v, want the delete kept", got)
+	}
+
+	backend.fail.Store(false)
+	if w := serve(h, "POST", "/undo", ""); w.Code != http.StatusOK {
+		t.Fatalf("undo: %d %s", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/todos/"+todo.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("get restored todo: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// User is a known collaborator. Requests still identify their user with
+// the X-User-ID header, which is matched against User.ID.
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// DisabledAt is set while an admin has disabled the user; their
+	// requests and API keys are refused
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// Timezone is the IANA zone the user works in; the server's default
+	// when empty. See requestLocation.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// userRegistry holds the known users in creation order
+type userRegistry struct {
+	mu    sync.RWMutex
+	users []User
+}
+
+// put adds a user or replaces the one with the same ID
+func (u *userRegistry) put(user User) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := range u.users {
+		if u.users[i].ID == user.ID {
+			u.users[i] = user
+			return
+		}
+	}
+	u.users = append(u.users, user)
+}
+
+func (u *userRegistry) get(id string) (User, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for _, user := range u.users {
+		if user.ID == id {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (u *userRegistry) list() []User {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return append([]User{}, u.users...)
+}
+
+// setDisabled disables or re-enables the user with id
+func (u *userRegistry) setDisabled(id string, disabled bool, now time.Time) (User, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := range u.users {
+		if u.users[i].ID == id {
+			u.users[i].DisabledAt = nil
+			if disabled {
+				u.users[i].DisabledAt = &now
+			}
+			return u.users[i], true
+		}
+	}
+	return User{}, false
+}
+
+// setTimezone sets the preferred timezone of the user with id
+func (u *userRegistry) setTimezone(id, timezone string) (User, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := range u.users {
+		if u.users[i].ID == id {
+			u.users[i].Timezone = timezone
+			return u.users[i], true
+		}
+	}
+	return User{}, false
+}
+
+// disabled reports whether id is a user an admin has disabled
+func (u *userRegistry) disabled(id string) bool {
+	user, ok := u.get(id)
+	return ok && user.DisabledAt != nil
+}
+
+// replace swaps in a whole new set of users, as restoring a backup does
+func (u *userRegistry) replace(users []User) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.users = append([]User{}, users...)
+}
+
+// GET /users
+func (s *server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.users.list()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
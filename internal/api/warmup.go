@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// Subsystems that can warm up in the background while the readiness probe
+// holds traffic back
+const (
+	warmSearch = "search"
+	warmCache  = "cache"
+)
+
+// warmupRetry is how long a failed warm-up waits before trying again
+const warmupRetry = 5 * time.Second
+
+// warmupStatus is the state of one warm-up task in the readiness probe
+type warmupStatus struct {
+	Status     string  `json:"status"` // warming or ok
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms,omitempty"`
+}
+
+// checkWarmUp validates the subsystems Options.WarmUp names
+func checkWarmUp(names []string) error {
+	for _, name := range names {
+		if name != warmSearch && name != warmCache {
+			return fmt.Errorf("unknown warm-up %q; want search or cache", name)
+		}
+	}
+	return nil
+}
+
+// warmups tracks the background tasks readiness waits for
+type warmups struct {
+	mu    sync.Mutex
+	tasks map[string]warmupStatus
+}
+
+// start runs fn in the background until it succeeds, retrying after
+// failures, and reports it warming until then
+func (wu *warmups) start(ctx context.Context, name string, fn func(context.Context) error) {
+	wu.set(name, warmupStatus{Status: "warming"})
+	go func() {
+		start := time.Now()
+		for {
+			err := fn(ctx)
+			if err == nil {
+				wu.set(name, warmupStatus{Status: "ok", DurationMS: float64(time.Since(start).Microseconds()) / 1000})
+				return
+			}
+			log.Printf("warming up %s failed, retrying in %s: %v", name, warmupRetry, err)
+			wu.set(name, warmupStatus{Status: "warming", Error: err.Error()})
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(warmupRetry):
+			}
+		}
+	}()
+}
+
+func (wu *warmups) set(name string, status warmupStatus) {
+	wu.mu.Lock()
+	defer wu.mu.Unlock()
+	if wu.tasks == nil {
+		wu.tasks = map[string]warmupStatus{}
+	}
+	wu.tasks[name] = status
+}
+
+// snapshot returns every task's status and whether all have finished
+func (wu *warmups) snapshot() (map[string]warmupStatus, bool) {
+	wu.mu.Lock()
+	defer wu.mu.Unlock()
+	tasks := make(map[string]warmupStatus, len(wu.tasks))
+	done := true
+	for name, status := range wu.tasks {
+		tasks[name] = status
+		done = done && status.Status == "ok"
+	}
+	return tasks, done
+}
+
+// cachedStore returns the read cache in front of the store, if there is one
+func (s *server) cachedStore() (*store.CachedStore, bool) {
+	todos := s.store
+	if tracked, ok := todos.(*store.ChangeTracker); ok {
+		todos = tracked.Store
+	}
+	cached, ok := todos.(*store.CachedStore)
+	return cached, ok
+}
+
+// warmUp starts the warm-up of each subsystem in names. The search
+// index is otherwise built before New returns.
+func (s *server) warmUp(ctx context.Context, names []string) error {
+	for _, name := range names {
+		switch name {
+		case warmSearch:
+			s.search.beginLoad()
+			s.warmups.start(ctx, name, func(ctx context.Context) error {
+				todos, err := s.store.List(ctx)
+				if err != nil {
+					return err
+				}
+				s.search.rebuild(todos)
+				return nil
+			})
+		case warmCache:
+			cached, ok := s.cachedStore()
+			if !ok {
+				return fmt.Errorf("can't warm up the cache: no cache is configured")
+			}
+			s.warmups.start(ctx, name, cached.Warm)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// The web UI talks to the same JSON API as every other client. URLs are
+// relative so the UI also works when the server is mounted below a path.
+"use strict";
+
+const state = { status: "", tag: "", todos: [], cursor: "" };
+
+// Each tab gets its own undo stack through the X-Session-ID header
+const session = sessionStorage.getItem("todo-session") || randomID();
+sessionStorage.setItem("todo-session", session);
+
+const $ = (id) => document.getElementById(id);
+
+function randomID() {
+  if (window.crypto && crypto.randomUUID) {
+    return crypto.randomUUID();
+  }
+  return Math.random().toString(36).slice(2) + Date.now().toString(36);
+}
+
+async function api(method, path, body) {
+  const headers = { "Accept": "application/json", "X-Session-ID": session };
+  const user = localStorage.getItem("todo-user");
+  if (user) {
+    headers["X-User-ID"] = user;
+  }
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+  }
+  const resp = await fetch(path, { method, headers, body: body === undefined ? undefined : JSON.stringify(body) });
+  if (!resp.ok) {
+    const err = new Error((await resp.text()).trim() || resp.statusText);
+    err.status = resp.status;
+    throw err;
+  }
+  return resp.status === 204 ? null : resp.json();
+}
+
+function showError(err) {
+  $("error").textContent = err ? err.message : "";
+  $("error").hidden = !err;
+}
+
+async function load() {
+  const terms = [];
+  if (state.status) {
+    terms.push("status:" + state.status);
+  }
+  if (state.tag) {
+    terms.push('tag:"' + state.tag + '"');
+  }
+  try {
+    state.todos = await api("GET", "todos?query=" + encodeURIComponent(terms.join(" ")));
+    showError(null);
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  render();
+}
+
+function render() {
+  const list = $("todos");
+  list.replaceChildren(...state.todos.map(renderTodo));
+  $("empty").hidden = state.todos.length > 0;
+  renderTagFilters();
+}
+
+function renderTodo(todo) {
+  const li = document.createElement("li");
+  li.classList.toggle("completed", todo.status === "completed");
+
+  const done = document.createElement("input");
+  done.type = "checkbox";
+  done.checked = todo.status === "completed";
+  done.title = done.checked ? "Mark pending" : "Mark completed";
+  done.onchange = () => setStatus(todo, done.checked ? "completed" : "pending");
+
+  const title = document.createElement("span");
+  title.className = "title";
+  title.textContent = todo.title;
+  const meta = document.createElement("span");
+  meta.className = "meta";
+  if (todo.due_at) {
+    const due = new Date(todo.due_at);
+    const when = document.createElement("span");
+    when.textContent = " due " + due.toLocaleDateString();
+    when.classList.toggle("overdue", todo.status !== "completed" && due < new Date());
+    meta.append(when);
+  }
+  for (const tag of todo.tags || []) {
+    const chip = document.createElement("span");
+    chip.className = "tag";
+    chip.textContent = tag;
+    meta.append(chip);
+  }
+  title.append(meta);
+
+  const remove = document.createElement("button");
+  remove.className = "delete";
+  remove.title = "Delete";
+  remove.textContent = "✕";
+  remove.onclick = () => deleteTodo(todo);
+
+  li.append(done, title, remove);
+  return li;
+}
+
+// renderTagFilters offers every tag of the listed todos, plus the one
+// being filtered by
+function renderTagFilters() {
+  const tags = new Set(state.tag ? [state.tag] : []);
+  for (const todo of state.todos) {
+    (todo.tags || []).forEach((tag) => tags.add(tag));
+  }
+  $("tag-filters").replaceChildren(...[...tags].sort().map((tag) => {
+    const button = document.createElement("button");
+    button.textContent = "#" + tag;
+    button.classList.toggle("active", tag === state.tag);
+    button.onclick = () => {
+      state.tag = state.tag === tag ? "" : tag;
+      load();
+    };
+    return button;
+  }));
+}
+
+async function createTodo(event) {
+  event.preventDefault();
+  const todo = {
+    title: $("title").value.trim(),
+    tags: $("tags").value.split(",").map((t) => t.trim()).filter(Boolean),
+  };
+  if ($("due").value) {
+    // a due date means the end of that day, local time
+    const [y, m, d] = $("due").value.split("-").map(Number);
+    todo.due_at = new Date(y, m - 1, d, 23, 59).toISOString();
+  }
+  try {
+    await api("POST", "todos", todo);
+    $("new-todo").reset();
+    $("title").focus();
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  load();
+}
+
+async function setStatus(todo, status) {
+  try {
+    await api("PATCH", "todos/" + encodeURIComponent(todo.id), { status });
+  } catch (err) {
+    showError(err);
+  }
+  load();
+}
+
+async function deleteTodo(todo) {
+  try {
+    await api("DELETE", "todos/" + encodeURIComponent(todo.id));
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  toast('Deleted "' + todo.title + '"');
+  load();
+}
+
+let toastTimer;
+
+function toast(text) {
+  $("toast-text").textContent = text;
+  $("toast").hidden = false;
+  clearTimeout(toastTimer);
+  toastTimer = setTimeout(() => { $("toast").hidden = true; }, 10000);
+}
+
+async function undo() {
+  $("toast").hidden = true;
+  try {
+    await api("POST", "undo");
+  } catch (err) {
+    showError(err);
+  }
+  load();
+}
+
+// watch long-polls the event log and reloads the list whenever anything
+// changes, whoever changed it
+async function watch() {
+  for (;;) {
+    try {
+      const page = await api("GET", "events?wait=25s&after=" + (state.cursor || "latest"));
+      if (page.events.length > 0) {
+        load();
+      }
+      state.cursor = page.next_cursor;
+    } catch (err) {
+      // a cursor past retention restarts from the end of the log
+      state.cursor = "";
+      if (err.status !== 410) {
+        await new Promise((resolve) => setTimeout(resolve, 5000));
+      }
+      load();
+    }
+  }
+}
+
+document.querySelectorAll("#filters .statuses button").forEach((button) => {
+  button.onclick = () => {
+    document.querySelectorAll("#filters .statuses button").forEach((b) => b.classList.toggle("active", b === button));
+    state.status = button.dataset.status;
+    load();
+  };
+});
+$("new-todo").onsubmit = createTodo;
+$("undo").onclick = undo;
+$("user").value = localStorage.getItem("todo-user") || "";
+$("user").onchange = () => {
+  localStorage.setItem("todo-user", $("user").value.trim());
+  load();
+};
+
+load();
+watch();
@@ -0,0 +1,493 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+const (
+	// webhookMaxAttempts is how many times a delivery is tried before giving up
+	webhookMaxAttempts = 5
+	// webhookBaseBackoff is the delay before the first retry; it doubles each attempt
+	webhookBaseBackoff = time.Second
+	// webhookLogSize is how many delivery attempts are kept per webhook
+	webhookLogSize = 100
+	// webhookSecretGrace is how long deliveries stay signed with the old
+	// secret too after it is rotated
+	webhookSecretGrace = 24 * time.Hour
+	// webhookPausePoll is how often paused workers check whether to resume
+	webhookPausePoll = 5 * time.Second
+)
+
+var (
+	errWebhookNotFound  = errors.New("webhook not found")
+	errWebhookSecretRef = errors.New("webhook secret comes from a secret store; rotate it there")
+)
+
+// Webhook is a registered callback URL that receives signed event payloads
+type Webhook struct {
+	ID        string            `json:"id"`
+	URL       string            `json:"url"`
+	Events    []store.EventType `json:"events,omitempty"`
+	Secret    string            `json:"secret,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	// secretRef is the secret store reference Secret was resolved from, if
+	// any; the secret is resolved again when secrets are reloaded
+	secretRef string
+	// previousSecret also signs deliveries until previousExpires, so
+	// receivers can switch to a rotated secret without dropping callbacks
+	previousSecret  string
+	previousExpires time.Time
+}
+
+// signature is the X-Todo-Signature header value: one sha256= entry per
+// secret currently in use, newest first
+func (wh Webhook) signature(timestamp string, body []byte, now time.Time) string {
+	sig := "sha256=" + signWebhook(wh.Secret, timestamp, body)
+	if wh.previousSecret != "" && now.Before(wh.previousExpires) {
+		sig += ",sha256=" + signWebhook(wh.previousSecret, timestamp, body)
+	}
+	return sig
+}
+
+// replaceSecret makes secret the signing secret, keeping the old one valid
+// for grace
+func (wh *Webhook) replaceSecret(secret string, grace time.Duration, now time.Time) {
+	if secret == wh.Secret {
+		return
+	}
+	wh.previousSecret, wh.previousExpires = wh.Secret, now.Add(grace)
+	wh.Secret = secret
+}
+
+// subscribes reports whether the webhook wants events of the given type;
+// an empty event list subscribes to everything
+func (wh Webhook) subscribes(eventType store.EventType) bool {
+	return len(wh.Events) == 0 || slices.Contains(wh.Events, eventType)
+}
+
+// WebhookDelivery records a single delivery attempt for debugging
+type WebhookDelivery struct {
+	ID         string          `json:"id"`
+	WebhookID  string          `json:"webhook_id"`
+	EventID    string          `json:"event_id"`
+	EventType  store.EventType `json:"event_type"`
+	Attempt    int             `json:"attempt"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Success    bool            `json:"success"`
+	Duration   string          `json:"duration"`
+	AttemptAt  time.Time       `json:"attempted_at"`
+}
+
+// webhookJob is a pending delivery of one event to one webhook
+type webhookJob struct {
+	deliveryID string
+	webhook    Webhook
+	event      store.Event
+	body       []byte
+	attempt    int
+}
+
+// webhookDispatcher stores webhook registrations and delivers events to
+// them in the background, retrying failures with exponential backoff
+type webhookDispatcher struct {
+	mu         sync.RWMutex
+	webhooks   []Webhook
+	deliveries map[string][]WebhookDelivery
+
+	client *http.Client
+	jobs   chan webhookJob
+	// paused holds deliveries back while it reports true, e.g. while the
+	// webhooks kill switch is off; nil never pauses
+	paused func() bool
+}
+
+// newWebhookDispatcher creates a dispatcher and starts its delivery workers
+func newWebhookDispatcher(workers int) *webhookDispatcher {
+	d := &webhookDispatcher{
+		deliveries: map[string][]WebhookDelivery{},
+		client:     &http.Client{Timeout: 10 * time.Second},
+		jobs:       make(chan webhookJob, 1024),
+	}
+	for range workers {
+		go d.worker()
+	}
+	return d
+}
+
+func (d *webhookDispatcher) register(wh Webhook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks = append(d.webhooks, wh)
+}
+
+// put registers a webhook or replaces the one with the same ID
+func (d *webhookDispatcher) put(wh Webhook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.webhooks {
+		if d.webhooks[i].ID == wh.ID {
+			d.webhooks[i] = wh
+			return
+		}
+	}
+	d.webhooks = append(d.webhooks, wh)
+}
+
+// rotateSecrets resolves the secrets of webhooks signing with a secret
+// store reference again, keeping the old secret if that fails
+func (d *webhookDispatcher) rotateSecrets(ctx context.Context) {
+	for _, wh := range d.list() {
+		if wh.secretRef == "" {
+			continue
+		}
+		secret, err := secrets.Resolve(ctx, wh.secretRef)
+		if err != nil {
+			log.Printf("webhook %s: keeping the previous secret: %v", wh.ID, err)
+			continue
+		}
+		d.mu.Lock()
+		for i := range d.webhooks {
+			if d.webhooks[i].ID == wh.ID && d.webhooks[i].secretRef == wh.secretRef {
+				d.webhooks[i].replaceSecret(secret, webhookSecretGrace, time.Now())
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+// rotateSecret gives a webhook a new generated secret and returns it
+func (d *webhookDispatcher) rotateSecret(id string, grace time.Duration, now time.Time) (Webhook, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return Webhook{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.webhooks {
+		if d.webhooks[i].ID != id {
+			continue
+		}
+		if d.webhooks[i].secretRef != "" {
+			return Webhook{}, errWebhookSecretRef
+		}
+		d.webhooks[i].replaceSecret(secret, grace, now)
+		return d.webhooks[i], nil
+	}
+	return Webhook{}, errWebhookNotFound
+}
+
+func (d *webhookDispatcher) list() []Webhook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return slices.Clone(d.webhooks)
+}
+
+// replace swaps in a whole new set of webhooks, as loading a state file
+// does. Their delivery logs are dropped.
+func (d *webhookDispatcher) replace(webhooks []Webhook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks = slices.Clone(webhooks)
+	d.deliveries = map[string][]WebhookDelivery{}
+}
+
+func (d *webhookDispatcher) get(id string) (Webhook, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, wh := range d.webhooks {
+		if wh.ID == id {
+			return wh, nil
+		}
+	}
+	return Webhook{}, errWebhookNotFound
+}
+
+func (d *webhookDispatcher) remove(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, wh := range d.webhooks {
+		if wh.ID == id {
+			d.webhooks = append(d.webhooks[:i], d.webhooks[i+1:]...)
+			delete(d.deliveries, id)
+			return nil
+		}
+	}
+	return errWebhookNotFound
+}
+
+// deliveryLog returns the recent delivery attempts of a webhook, newest first
+func (d *webhookDispatcher) deliveryLog(id string) []WebhookDelivery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	entries := slices.Clone(d.deliveries[id])
+	slices.Reverse(entries)
+	return entries
+}
+
+func (d *webhookDispatcher) record(entry WebhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := append(d.deliveries[entry.WebhookID], entry)
+	if len(entries) > webhookLogSize {
+		entries = entries[len(entries)-webhookLogSize:]
+	}
+	d.deliveries[entry.WebhookID] = entries
+}
+
+// dispatch queues the event for every subscribed webhook
+func (d *webhookDispatcher) dispatch(evt store.Event) {
+	body, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("failed to encode webhook payload for event %s: %v", evt.ID, err)
+		return
+	}
+	for _, wh := range d.list() {
+		if !wh.subscribes(evt.Type) {
+			continue
+		}
+		d.enqueue(webhookJob{
+			deliveryID: uuid.New().String(),
+			webhook:    wh,
+			event:      evt,
+			body:       body,
+			attempt:    1,
+		})
+	}
+}
+
+func (d *webhookDispatcher) enqueue(job webhookJob) {
+	select {
+	case d.jobs <- job:
+	default:
+		log.Printf("webhook queue full, dropping delivery %s to %s", job.deliveryID, job.webhook.URL)
+	}
+}
+
+func (d *webhookDispatcher) worker() {
+	for job := range d.jobs {
+		// queued jobs wait rather than being dropped; the queue only
+		// overflows if the pause outlasts its capacity
+		for d.paused != nil && d.paused() {
+			time.Sleep(webhookPausePoll)
+		}
+		d.deliver(job)
+	}
+}
+
+// deliver performs one attempt and schedules a retry when it fails
+func (d *webhookDispatcher) deliver(job webhookJob) {
+	start := time.Now()
+	entry := WebhookDelivery{
+		ID:        job.deliveryID,
+		WebhookID: job.webhook.ID,
+		EventID:   job.event.ID,
+		EventType: job.event.Type,
+		Attempt:   job.attempt,
+		AttemptAt: start,
+	}
+
+	status, err := d.send(job, start)
+	entry.StatusCode = status
+	entry.Duration = time.Since(start).String()
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Success = true
+	}
+	d.record(entry)
+
+	if entry.Success || job.attempt >= webhookMaxAttempts {
+		return
+	}
+	// Skip the retry if the webhook was removed in the meantime
+	if _, err := d.get(job.webhook.ID); err != nil {
+		return
+	}
+	backoff := webhookBaseBackoff << (job.attempt - 1)
+	job.attempt++
+	time.AfterFunc(backoff, func() { d.enqueue(job) })
+}
+
+func (d *webhookDispatcher) send(job webhookJob, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, job.webhook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "golang-todo-webhooks/1.0")
+	req.Header.Set("X-Todo-Event", string(job.event.Type))
+	req.Header.Set("X-Todo-Delivery", job.deliveryID)
+	req.Header.Set("X-Todo-Timestamp", timestamp)
+	req.Header.Set("X-Todo-Signature", job.webhook.signature(timestamp, job.body, now))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook computes the hex HMAC-SHA256 of "<timestamp>.<body>"; receivers
+// recompute it with their copy of the secret to authenticate the callback
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookSecret generates a random signing secret
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// validateWebhook checks the client-supplied fields of a webhook
+func validateWebhook(wh Webhook) error {
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	for _, eventType := range wh.Events {
+		switch eventType {
+		case store.EventTodoCreated, store.EventTodoUpdated, store.EventTodoCompleted, store.EventTodoDeleted:
+		default:
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// POST /webhooks
+func (s *server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	wh, err := decodeJSON[Webhook](r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateWebhook(wh); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// generate a signing secret unless the caller supplied one
+	if secrets.IsRef(wh.Secret) {
+		wh.secretRef = wh.Secret
+		if wh.Secret, err = secrets.Resolve(r.Context(), wh.secretRef); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if wh.Secret == "" {
+		if wh.Secret, err = newWebhookSecret(); err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+	wh.ID = uuid.New().String()
+	wh.CreatedAt = time.Now()
+	s.webhooks.register(wh)
+
+	// The secret is only ever returned on creation, and never when it
+	// comes from a secret store
+	if wh.secretRef != "" {
+		wh.Secret = wh.secretRef
+	}
+	if err := respondJSON(w, http.StatusCreated, wh); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /webhooks
+func (s *server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks := s.webhooks.list()
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	if err := respondJSON(w, http.StatusOK, webhooks); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DELETE /webhooks/{id}
+func (s *server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := s.webhooks.remove(r.PathValue("id")); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /webhooks/{id}/rotate-secret
+func (s *server) handleRotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	grace, err := parseGrace(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if grace == 0 {
+		grace = webhookSecretGrace
+	}
+	wh, err := s.webhooks.rotateSecret(r.PathValue("id"), grace, time.Now())
+	switch {
+	case errors.Is(err, errWebhookNotFound):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errWebhookSecretRef):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		respondError(w, err)
+		return
+	}
+	// like on creation, the new secret is returned once
+	if err := respondJSON(w, http.StatusOK, wh); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET /webhooks/{id}/deliveries
+func (s *server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.webhooks.get(id); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err := respondJSON(w, http.StatusOK, s.webhooks.deliveryLog(id)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedBy returns which of secrets signed a delivery, in the order of its
+// X-Todo-Signature entries
+func signedBy(r *http.Request, body []byte, secrets ...string) []string {
+	var signers []string
+	for _, entry := range strings.Split(r.Header.Get("X-Todo-Signature"), ",") {
+		for _, secret := range secrets {
+			if entry == "sha256="+signWebhook(secret, r.Header.Get("X-Todo-Timestamp"), body) {
+				signers = append(signers, secret)
+			}
+		}
+	}
+	return signers
+}
+
+func TestWebhookSignature(t *testing.T) {
+	now := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	wh := Webhook{Secret: "old"}
+	body := []byte(`{"id":"e1"}`)
+	if got := wh.signature("1", body, now); got != "sha256="+signWebhook("old", "1", body) {
+		t.Errorf("signature = %q, want one entry signed with old", got)
+	}
+
+	// the rotated-out secret signs too, after the new one, until the grace
+	// period ends
+	wh.replaceSecret("new", time.Hour, now)
+	want := "sha256=" + signWebhook("new", "1", body) + ",sha256=" + signWebhook("old", "1", body)
+	if got := wh.signature("1", body, now.Add(59*time.Minute)); got != want {
+		t.Errorf("signature within the grace period = %q, want %q", got, want)
+	}
+	if got := wh.signature("1", body, now.Add(time.Hour)); got != "sha256="+signWebhook("new", "1", body) {
+		t.Errorf("signature after the grace period = %q, want one entry signed with new", got)
+	}
+
+	// resolving the same secret again doesn't cut the grace period short
+	wh.replaceSecret("new", time.Hour, now.Add(30*time.Minute))
+	if got := wh.signature("1", body, now.Add(59*time.Minute)); got != want {
+		t.Errorf("signature after replacing the secret with itself = %q, want %q", got, want)
+	}
+	if signWebhook("new", "2", body) == signWebhook("new", "1", body) {
+		t.Error("signature doesn't cover the timestamp")
+	}
+}
+
+func TestWebhookDeliveriesAcrossRotation(t *testing.T) {
+	type delivery struct {
+		r    *http.Request
+		body []byte
+	}
+	deliveries := make(chan delivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r, body}
+	}))
+	defer receiver.Close()
+	srv := newTestServer(t, Options{})
+	h := srv.routes()
+	next := func(secrets ...string) []string {
+		t.Helper()
+		createTodo(t, h, `{"title":"a"}`)
+		select {
+		case d := <-deliveries:
+			return signedBy(d.r, d.body, secrets...)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no delivery")
+			return nil
+		}
+	}
+	create := func(body string) Webhook {
+		t.Helper()
+		w := serve(h, "POST", "/webhooks", body)
+		var wh Webhook
+		if err := json.Unmarshal(w.Body.Bytes(), &wh); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("create webhook: %d %s", w.Code, w.Body)
+		}
+		return wh
+	}
+
+	// secrets from a secret store, rotated when secrets are reloaded
+	t.Setenv("TODO_TEST_WEBHOOK_SECRET", "old")
+	wh := create(`{"url":"` + receiver.URL + `","events":["todo.created"],"secret":"env:TODO_TEST_WEBHOOK_SECRET"}`)
+	if wh.Secret != "env:TODO_TEST_WEBHOOK_SECRET" {
+		t.Errorf("created webhook shows secret %q, want only its reference", wh.Secret)
+	}
+	if got := next("old", "new"); !slices.Equal(got, []string{"old"}) {
+		t.Errorf("signed by %v before the rotation, want old", got)
+	}
+	os.Setenv("TODO_TEST_WEBHOOK_SECRET", "new")
+	srv.webhooks.rotateSecrets(context.Background())
+	if got := next("old", "new"); !slices.Equal(got, []string{"new", "old"}) {
+		t.Errorf("signed by %v after the rotation, want new then old", got)
+	}
+	// a failed lookup keeps signing with what was last resolved
+	os.Unsetenv("TODO_TEST_WEBHOOK_SECRET")
+	srv.webhooks.rotateSecrets(context.Background())
+	if got := next("old", "new"); !slices.Equal(got, []string{"new", "old"}) {
+		t.Errorf("signed by %v after a failed lookup, want new then old", got)
+	}
+	if w := serve(h, "POST", "/webhooks/"+wh.ID+"/rotate-secret", ""); w.Code != http.StatusConflict {
+		t.Errorf("rotate a secret store secret: %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := serve(h, "DELETE", "/webhooks/"+wh.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete webhook: %d %s", w.Code, w.Body)
+	}
+
+	// generated secrets, rotated through the API
+	wh = create(`{"url":"` + receiver.URL + `","events":["todo.created"]}`)
+	old := wh.Secret
+	w := serve(h, "POST", "/webhooks/"+wh.ID+"/rotate-secret", `{"grace":"1h"}`)
+	var rotated Webhook
+	if err := json.Unmarshal(w.Body.Bytes(), &rotated); err != nil || w.Code != http.StatusOK || rotated.Secret == old {
+		t.Fatalf("rotate: %d %s", w.Code, w.Body)
+	}
+	if got := next(old, rotated.Secret); !slices.Equal(got, []string{rotated.Secret, old}) {
+		t.Errorf("signed by %v after rotating through the API, want the new secret then the old", got)
+	}
+	if w := serve(h, "POST", "/webhooks/missing/rotate-secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("rotate a missing webhook: %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// webFiles is the browser UI, a single page using the JSON API. It is
+// built into the binary so the server ships as one file.
+//
+//go:embed web
+var webFiles embed.FS
+
+// webAssets serves the UI's scripts and styles below /ui/
+var webAssets = func() http.Handler {
+	sub, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServerFS(sub))
+}()
+
+// GET /{$}
+func (s *server) handleWebUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFileFS(w, r, webFiles, "web/index.html")
+}
+
+// GET /ui/{file...}
+func (s *server) handleWebAsset(w http.ResponseWriter, r *http.Request) {
+	// no directory listings
+	if file := r.PathValue("file"); file == "" || strings.HasSuffix(file, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	webAssets.ServeHTTP(w, r)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"golang-todo/internal/store"
+)
+
+// Workflow is the state machine todos move through. Every workflow starts
+// at pending and ends at completed; custom states sit in between, and a
+// todo may only move along the listed transitions.
+type Workflow struct {
+	States      []store.TodoStatus                      `json:"states" yaml:"states"`
+	Transitions map[store.TodoStatus][]store.TodoStatus `json:"transitions" yaml:"transitions"`
+}
+
+// defaultWorkflow is a small kanban flow that still lets clients move a
+// todo straight between pending and completed
+func defaultWorkflow() *Workflow {
+	return &Workflow{
+		States: []store.TodoStatus{store.StatusPending, "in_progress", "review", store.StatusCompleted},
+		Transitions: map[store.TodoStatus][]store.TodoStatus{
+			store.StatusPending:   {"in_progress", store.StatusCompleted},
+			"in_progress":         {store.StatusPending, "review", store.StatusCompleted},
+			"review":              {"in_progress", store.StatusCompleted},
+			store.StatusCompleted: {store.StatusPending},
+		},
+	}
+}
+
+// transitionError reports a status change the workflow doesn't allow
+type transitionError struct {
+	From, To store.TodoStatus
+	Allowed  []store.TodoStatus
+}
+
+func (e *transitionError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("cannot move todo from %s to %s; %s is final", e.From, e.To, e.From)
+	}
+	allowed := make([]string, len(e.Allowed))
+	for i, status := range e.Allowed {
+		allowed[i] = string(status)
+	}
+	return fmt.Sprintf("cannot move todo from %s to %s; allowed: %s", e.From, e.To, strings.Join(allowed, ", "))
+}
+
+// valid reports whether status is a state of the workflow
+func (wf *Workflow) valid(status store.TodoStatus) bool {
+	return slices.Contains(wf.States, status)
+}
+
+// checkTransition allows staying in the same state and any listed move
+func (wf *Workflow) checkTransition(from, to store.TodoStatus) error {
+	if from == to || slices.Contains(wf.Transitions[from], to) {
+		return nil
+	}
+	return &transitionError{From: from, To: to, Allowed: wf.Transitions[from]}
+}
+
+// describe lists the states for error messages
+func (wf *Workflow) describe() string {
+	states := make([]string, len(wf.States))
+	for i, status := range wf.States {
+		states[i] = string(status)
+	}
+	return strings.Join(states, ", ")
+}
+
+// validate checks the workflow is well formed
+func (wf *Workflow) validate() error {
+	seen := map[store.TodoStatus]bool{}
+	for _, status := range wf.States {
+		name := string(status)
+		if name == "" || strings.TrimSpace(name) != name || strings.ContainsAny(name, " :,") {
+			return fmt.Errorf("invalid state name %q", name)
+		}
+		if seen[status] {
+			return fmt.Errorf("state %q is listed twice", name)
+		}
+		seen[status] = true
+	}
+	if !seen[store.StatusPending] || !seen[store.StatusCompleted] {
+		return fmt.Errorf("workflow must include the %s and %s states", store.StatusPending, store.StatusCompleted)
+	}
+	for from, targets := range wf.Transitions {
+		if !seen[from] {
+			return fmt.Errorf("transitions: unknown state %q", from)
+		}
+		for _, to := range targets {
+			if !seen[to] {
+				return fmt.Errorf("transitions from %s: unknown state %q", from, to)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadWorkflow reads a workflow file; .json files are parsed as JSON and
+// anything else as YAML
+func LoadWorkflow(path string) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	wf := &Workflow{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(wf)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(wf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse workflow %s: %w", path, err)
+	}
+	if err := wf.validate(); err != nil {
+		return nil, fmt.Errorf("invalid workflow %s: %w", path, err)
+	}
+	return wf, nil
+}
+
+// statusErrorCode maps an applyStatus error to an HTTP status: moves the
+// workflow forbids conflict with the todo's current state
+func statusErrorCode(err error) int {
+	if errors.As(err, new(*transitionError)) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// GET /workflow
+func (s *server) handleGetWorkflow(w http.ResponseWriter, r *http.Request) {
+	if err := respondJSON(w, http.StatusOK, s.workflow); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
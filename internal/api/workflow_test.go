@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang-todo/internal/store"
+)
+
+func TestWorkflowPerServer(t *testing.T) {
+	strict := &Workflow{
+		States: []store.TodoStatus{store.StatusPending, "doing", store.StatusCompleted},
+		Transitions: map[store.TodoStatus][]store.TodoStatus{
+			store.StatusPending:   {"doing"},
+			"doing":               {store.StatusCompleted},
+			store.StatusCompleted: {store.StatusPending},
+		},
+	}
+	if err := strict.validate(); err != nil {
+		t.Fatal(err)
+	}
+	custom := newTestHandler(t, Options{Workflow: strict})
+	standard := newTestHandler(t, Options{})
+
+	var got Workflow
+	w := serve(custom, "GET", "/workflow", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got.States) != 3 {
+		t.Fatalf("GET /workflow on the custom server: %d %s", w.Code, w.Body)
+	}
+	w = serve(standard, "GET", "/workflow", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got.States) != 4 {
+		t.Fatalf("GET /workflow on the default server: %d %s", w.Code, w.Body)
+	}
+
+	// building the custom server left the default one's workflow alone
+	tests := []struct {
+		h      http.Handler
+		body   string
+		status int
+	}{
+		{custom, `{"status":"completed"}`, http.StatusConflict},
+		{custom, `{"status":"in_progress"}`, http.StatusBadRequest},
+		{custom, `{"status":"doing"}`, http.StatusOK},
+		{standard, `{"status":"doing"}`, http.StatusBadRequest},
+		{standard, `{"status":"completed"}`, http.StatusOK},
+	}
+	todos := map[http.Handler]string{
+		custom:   createTodo(t, custom, `{"title":"a"}`).ID,
+		standard: createTodo(t, standard, `{"title":"a"}`).ID,
+	}
+	for _, tt := range tests {
+		if w := serve(tt.h, "PATCH", "/todos/"+todos[tt.h], tt.body); w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.body, w.Code, tt.status, w.Body)
+		}
+	}
+	if w := serve(standard, "GET", "/todos?query=status:doing", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("query on a status of the other server's workflow: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestReopenedTodoIsNotCompleted(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	todo := createTodo(t, h, `{"title":"a"}`)
+	for _, status := range []string{"completed", "pending"} {
+		if w := serve(h, "PATCH", "/todos/"+todo.ID, `{"status":"`+status+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("set status %s: %d %s", status, w.Code, w.Body)
+		}
+	}
+
+	w := serve(h, "GET", "/todos/"+todo.ID, "")
+	var reopened store.Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &reopened); err != nil || reopened.CompletedAt != nil {
+		t.Errorf("reopened todo = %d %s, want no completed_at", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/todos", "", "Accept", "text/plain"); strings.Contains(w.Body.String(), "Completed:") {
+		t.Errorf("plain text listing calls the reopened todo completed:\n%s", w.Body)
+	}
+	w = serve(h, "GET", "/export?format=csv", "")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("CSV export: %d %v %v", w.Code, records, err)
+	}
+	if column := slices.Index(records[0], "completed_at"); column < 0 || records[1][column] != "" {
+		t.Errorf("CSV export of the reopened todo = %v", records)
+	}
+}
@@ -0,0 +1,218 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The metrics in this file are exposed at GET /metrics in the Prometheus
+// text exposition format. They are intentionally minimal: labeled counters,
+// gauges and histograms are all the server needs.
+
+var Default = &Registry{}
+
+// collector is implemented by every metric kind the registry can expose
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds every registered metric in registration order
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func (m *Registry) register(c collector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.collectors = append(m.collectors, c)
+}
+
+// writeTo renders all metrics in the Prometheus text format
+func (m *Registry) writeTo(w io.Writer) {
+	m.mu.Lock()
+	collectors := slices.Clone(m.collectors)
+	m.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// metricSeries tracks labeled values of one metric, keyed by label values
+type metricSeries[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]T
+}
+
+func (s *metricSeries[T]) key(labelValues []string) string {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", s.name, len(labelValues), len(s.labels)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// labelString formats label pairs, with optional extra pairs appended
+func (s *metricSeries[T]) labelString(key string, extra ...string) string {
+	var pairs []string
+	if len(s.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", s.labels[i], v))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys must be called with the lock held
+func (s *metricSeries[T]) sortedKeys() []string {
+	keys := make([]string, 0, len(s.series))
+	for k := range s.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *metricSeries[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.kind)
+}
+
+// CounterVec is a monotonically increasing labeled counter
+type CounterVec struct {
+	metricSeries[float64]
+}
+
+func (m *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metricSeries[float64]{name: name, help: help, kind: "counter", labels: labels, series: map[string]float64{}}}
+	m.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[key] += v
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %g\n", c.name, c.labelString(k), c.series[k])
+	}
+}
+
+// GaugeVec is a labeled value that can go up and down
+type GaugeVec struct {
+	metricSeries[float64]
+}
+
+func (m *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{metricSeries[float64]{name: name, help: help, kind: "gauge", labels: labels, series: map[string]float64{}}}
+	m.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series[key] = v
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(w)
+	for _, k := range g.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %g\n", g.name, g.labelString(k), g.series[k])
+	}
+}
+
+// histogram is the bucketed state of one histogram series
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a labeled histogram with fixed upper bounds
+type HistogramVec struct {
+	metricSeries[*histogram]
+	buckets []float64
+}
+
+func (m *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		metricSeries: metricSeries[*histogram]{name: name, help: help, kind: "histogram", labels: labels, series: map[string]*histogram{}},
+		buckets:      buckets,
+	}
+	m.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, k := range h.sortedKeys() {
+		s := h.series[k]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(k, "le", fmt.Sprintf("%g", upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, h.labelString(k), s.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(k), s.count)
+	}
+}
+
+// Handler serves GET /metrics: the metrics of Default, followed by those
+// of each extra registry
+func Handler(extra ...*Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.writeTo(w)
+		for _, m := range extra {
+			m.writeTo(w)
+		}
+	}
+}
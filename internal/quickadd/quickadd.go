@@ -0,0 +1,397 @@
+// Package quickadd parses the one-line todos people type into a quick-add
+// box, such as
+//
+//	Pay rent tomorrow 9am #finance !high +household
+//
+// into a title, due date, tags, priority and project. Anything it doesn't recognise
+// stays in the title, and words in double quotes are always kept as
+// written, so "Read \"Monday\" notes" keeps its Monday.
+package quickadd
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Result is what Parse found
+type Result struct {
+	Title string
+	// Due is nil when no date or time was given. A date without a time is
+	// due at the end of that day, 23:59, like due dates elsewhere.
+	Due *time.Time
+	// HasTime is whether a time of day was given
+	HasTime bool
+	Tags    []string
+	// Priority is low, medium, high, urgent or empty
+	Priority string
+	// Project is the project named with +name, as written; empty if none
+	Project string
+}
+
+// priorities maps !words to priorities
+var priorities = map[string]string{
+	"low": "low", "medium": "medium", "med": "medium", "high": "high", "urgent": "urgent",
+	"p4": "low", "p3": "medium", "p2": "high", "p1": "urgent",
+}
+
+// prepositions are dropped along with the date or time they introduce
+var prepositions = map[string]bool{"on": true, "at": true, "by": true, "due": true}
+
+// everyday are abbreviations that are also ordinary words, so they are only
+// dates after a preposition, as in "on sat"
+var everyday = map[string]bool{"sun": true, "sat": true, "wed": true}
+
+// word is one whitespace-separated part of the input
+type word struct {
+	text   string
+	quoted bool
+}
+
+// key is a word as the date and time matchers see it: lowercased, with
+// trailing punctuation removed
+func (w word) key() string {
+	if w.quoted {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(w.text, ",.;"))
+}
+
+// Parse parses input relative to now, whose location is the one dates and
+// times are meant in
+func Parse(input string, now time.Time) Result {
+	words := split(input)
+	var (
+		result      Result
+		title       []string
+		date        *time.Time
+		hour, min   = 0, 0
+		haveTime    bool
+		matchedDate bool
+	)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		k := w.key()
+		switch {
+		case w.quoted:
+			title = append(title, w.text)
+			continue
+		case strings.HasPrefix(w.text, "#") && validTag(w.text[1:]):
+			tag := w.text[1:]
+			if !contains(result.Tags, tag) {
+				result.Tags = append(result.Tags, tag)
+			}
+			continue
+		case strings.HasPrefix(k, "!") && priorities[k[1:]] != "" && result.Priority == "":
+			result.Priority = priorities[k[1:]]
+			continue
+		case strings.HasPrefix(w.text, "+") && validProject(w.text[1:]) && result.Project == "":
+			result.Project = w.text[1:]
+			continue
+		}
+
+		// a preposition only goes when what follows is a date or time
+		start := i
+		if prepositions[k] && i+1 < len(words) {
+			start = i + 1
+		}
+		if !matchedDate {
+			if n, d, ok := parseDate(words[start:], now, start > i); ok {
+				date, matchedDate = &d, true
+				i = start + n - 1
+				continue
+			}
+		}
+		if !haveTime {
+			if n, h, m, ok := parseTime(words[start:]); ok {
+				hour, min, haveTime = h, m, true
+				i = start + n - 1
+				continue
+			}
+		}
+		title = append(title, w.text)
+	}
+	result.Title = strings.Join(title, " ")
+	loc := now.Location()
+	switch {
+	case date != nil && haveTime:
+		due := time.Date(date.Year(), date.Month(), date.Day(), hour, min, 0, 0, loc)
+		result.Due, result.HasTime = &due, true
+	case date != nil:
+		due := time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 0, 0, loc)
+		result.Due = &due
+	case haveTime:
+		// a time on its own is the next time the clock shows it
+		due := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, loc)
+		if !due.After(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		result.Due, result.HasTime = &due, true
+	}
+	return result
+}
+
+// split breaks input into words, keeping double-quoted phrases together
+func split(input string) []word {
+	var words []word
+	var b strings.Builder
+	quoted, wasQuoted := false, false
+	flush := func() {
+		if b.Len() > 0 || wasQuoted {
+			words = append(words, word{text: b.String(), quoted: wasQuoted})
+		}
+		b.Reset()
+		wasQuoted = false
+	}
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			wasQuoted = true
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return words
+}
+
+func validTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_/", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validProject is a tag that starts with a letter, so "+1" stays text
+func validProject(name string) bool {
+	first, _ := utf8.DecodeRuneInString(name)
+	return validTag(name) && unicode.IsLetter(first)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// midnight is the start of t's day
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// parseDate matches a date at the start of words, returning how many words
+// it took; introduced is whether a preposition came before it
+func parseDate(words []word, now time.Time, introduced bool) (int, time.Time, bool) {
+	if len(words) == 0 {
+		return 0, time.Time{}, false
+	}
+	today := midnight(now)
+	first := words[0].key()
+	second := ""
+	if len(words) > 1 {
+		second = words[1].key()
+	}
+	switch first {
+	case "today", "tonight":
+		return 1, today, true
+	case "tomorrow", "tmr", "tmrw":
+		return 1, today.AddDate(0, 0, 1), true
+	case "next":
+		if second == "week" {
+			// the Monday of next week
+			ahead := (int(time.Monday) - int(now.Weekday()) + 7) % 7
+			if ahead == 0 {
+				ahead = 7
+			}
+			return 2, today.AddDate(0, 0, ahead), true
+		}
+		if second == "month" {
+			return 2, time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()), true
+		}
+		if day, ok := weekday(second); ok {
+			return 2, nextWeekday(today, day), true
+		}
+	case "this":
+		if day, ok := weekday(second); ok {
+			return 2, nextWeekday(today, day), true
+		}
+	case "in":
+		if len(words) > 2 {
+			n, err := strconv.Atoi(second)
+			if err == nil && n > 0 && n <= 366 {
+				switch strings.TrimSuffix(words[2].key(), "s") {
+				case "day":
+					return 3, today.AddDate(0, 0, n), true
+				case "week":
+					return 3, today.AddDate(0, 0, 7*n), true
+				case "month":
+					return 3, today.AddDate(0, n, 0), true
+				}
+			}
+		}
+	}
+	if day, ok := weekday(first); ok && (introduced || !everyday[first]) {
+		return 1, nextWeekday(today, day), true
+	}
+	if d, err := time.ParseInLocation(time.DateOnly, first, now.Location()); err == nil {
+		return 1, d, true
+	}
+	// "oct 20", "october 20", "20 oct"
+	if month, ok := monthName(first); ok {
+		if day, err := strconv.Atoi(ordinal(second)); err == nil {
+			if d, ok := upcoming(today, month, day); ok {
+				return 2, d, true
+			}
+		}
+	}
+	if day, err := strconv.Atoi(ordinal(first)); err == nil {
+		if month, ok := monthName(second); ok {
+			if d, ok := upcoming(today, month, day); ok {
+				return 2, d, true
+			}
+		}
+	}
+	return 0, time.Time{}, false
+}
+
+// ordinal strips an English ordinal suffix, as in "20th"
+func ordinal(s string) string {
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		if trimmed, ok := strings.CutSuffix(s, suffix); ok && trimmed != "" {
+			return trimmed
+		}
+	}
+	return s
+}
+
+// weekday matches a day name or an abbreviation of at least three letters,
+// such as "tue" or "thurs"
+func weekday(s string) (time.Weekday, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), s) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// nextWeekday is the next day, after today, that falls on day
+func nextWeekday(today time.Time, day time.Weekday) time.Time {
+	ahead := (int(day) - int(today.Weekday()) + 7) % 7
+	if ahead == 0 {
+		ahead = 7
+	}
+	return today.AddDate(0, 0, ahead)
+}
+
+func monthName(s string) (time.Month, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	for month := time.January; month <= time.December; month++ {
+		name := strings.ToLower(month.String())
+		if s == name || s == name[:3] || (s == "sept" && month == time.September) {
+			return month, true
+		}
+	}
+	return 0, false
+}
+
+// upcoming is the next occurrence of a month and day, today included
+func upcoming(today time.Time, month time.Month, day int) (time.Time, bool) {
+	if day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	d := time.Date(today.Year(), month, day, 0, 0, 0, 0, today.Location())
+	if d.Day() != day {
+		// no such day in the month, e.g. feb 30
+		return time.Time{}, false
+	}
+	if d.Before(today) {
+		d = d.AddDate(1, 0, 0)
+	}
+	return d, true
+}
+
+// parseTime matches a time of day at the start of words: 9am, 9:30 pm,
+// 21:00, noon or midnight
+func parseTime(words []word) (n, hour, min int, ok bool) {
+	if len(words) == 0 {
+		return 0, 0, 0, false
+	}
+	first := words[0].key()
+	switch first {
+	case "noon", "midday":
+		return 1, 12, 0, true
+	case "midnight":
+		return 1, 23, 59, true
+	}
+	n = 1
+	clock, meridiem := first, ""
+	for _, suffix := range []string{"am", "pm", "a.m", "p.m", "a.m.", "p.m."} {
+		if trimmed, ok := strings.CutSuffix(first, suffix); ok && trimmed != "" {
+			clock, meridiem = trimmed, suffix[:1]
+			break
+		}
+	}
+	if meridiem == "" && len(words) > 1 {
+		switch words[1].key() {
+		case "am", "a.m":
+			meridiem, n = "a", 2
+		case "pm", "p.m":
+			meridiem, n = "p", 2
+		}
+	}
+	h, m, ok := parseClock(clock)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	switch {
+	case meridiem != "":
+		if h < 1 || h > 12 {
+			return 0, 0, 0, false
+		}
+		if h == 12 {
+			h = 0
+		}
+		if meridiem == "p" {
+			h += 12
+		}
+	case !strings.Contains(clock, ":"):
+		// a bare number is a count, not a time
+		return 0, 0, 0, false
+	}
+	return n, h, m, true
+}
+
+// parseClock parses "9", "9:30" or "21:00"
+func parseClock(s string) (hour, min int, ok bool) {
+	hs, ms, hasMinutes := strings.Cut(s, ":")
+	hour, err := strconv.Atoi(hs)
+	if err != nil || hour < 0 || hour > 23 || len(hs) > 2 {
+		return 0, 0, false
+	}
+	if hasMinutes {
+		min, err = strconv.Atoi(ms)
+		if err != nil || min < 0 || min > 59 || len(ms) != 2 {
+			return 0, 0, false
+		}
+	}
+	return hour, min, true
+}
@@ -0,0 +1,111 @@
+package quickadd
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// a Wednesday morning
+	now := time.Date(2025, 6, 18, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input    string
+		title    string
+		due      string // "" for none
+		hasTime  bool
+		tags     []string
+		priority string
+		project  string
+	}{
+		{input: "Pay rent tomorrow 9am #finance !high +household", title: "Pay rent", due: "2025-06-19 09:00", hasTime: true, tags: []string{"finance"}, priority: "high", project: "household"},
+		{input: "Call mom", title: "Call mom"},
+
+		// dates
+		{input: "Water plants today", title: "Water plants", due: "2025-06-18 23:59"},
+		{input: "Report by friday", title: "Report", due: "2025-06-20 23:59"},
+		{input: "Team sync wednesday", title: "Team sync", due: "2025-06-25 23:59"},
+		{input: "Team sync on wed", title: "Team sync", due: "2025-06-25 23:59"},
+		{input: "Get wed", title: "Get wed"},
+		{input: "Party on sat", title: "Party", due: "2025-06-21 23:59"},
+		{input: "Ship it next week", title: "Ship it", due: "2025-06-23 23:59"},
+		{input: "Invoice next month", title: "Invoice", due: "2025-07-01 23:59"},
+		{input: "Renew passport in 2 weeks", title: "Renew passport", due: "2025-07-02 23:59"},
+		{input: "Dentist oct 20th", title: "Dentist", due: "2025-10-20 23:59"},
+		{input: "Birthday 3 jan", title: "Birthday", due: "2026-01-03 23:59"},
+		{input: "Launch on 2025-07-04", title: "Launch", due: "2025-07-04 23:59"},
+		{input: "Only the first date counts today tomorrow", title: "Only the first date counts tomorrow", due: "2025-06-18 23:59"},
+
+		// times, with and without a date
+		{input: "Dentist oct 20th 3pm", title: "Dentist", due: "2025-10-20 15:00", hasTime: true},
+		{input: "Standup at 9:30", title: "Standup", due: "2025-06-19 09:30", hasTime: true},
+		{input: "Lunch noon", title: "Lunch", due: "2025-06-18 12:00", hasTime: true},
+		{input: "Call 7 pm friday", title: "Call", due: "2025-06-20 19:00", hasTime: true},
+		{input: "Deploy 21:00", title: "Deploy", due: "2025-06-18 21:00", hasTime: true},
+
+		// priorities
+		{input: "Fix outage !p1", title: "Fix outage", priority: "urgent"},
+		{input: "Tidy desk !MED", title: "Tidy desk", priority: "medium"},
+		{input: "Refactor !low !high", title: "Refactor !high", priority: "low"},
+
+		// tags
+		{input: "Read #books/fiction #fun #fun", title: "Read", tags: []string{"books/fiction", "fun"}},
+
+		// projects
+		{input: "Fix sink +Home-Renovation", title: "Fix sink", project: "Home-Renovation"},
+		{input: "Draft +work +home", title: "Draft +home", project: "work"},
+
+		// input that matches none of the tokens stays in the title
+		{input: `Read "Monday" notes`, title: "Read Monday notes"},
+		{input: "sat with friends", title: "sat with friends"},
+		{input: "Buy 2 apples", title: "Buy 2 apples"},
+		{input: "Meet at the cafe", title: "Meet at the cafe"},
+		{input: "Visit feb 30", title: "Visit feb 30"},
+		{input: "Alarm 25:00 13pm", title: "Alarm 25:00 13pm"},
+		{input: "Say # and ! and + out loud !huge", title: "Say # and ! and + out loud !huge"},
+		{input: "Vote +1 #not-a-tag! on it", title: "Vote +1 #not-a-tag! on it"},
+		{input: "in 2 fortnights", title: "in 2 fortnights"},
+		{input: "", title: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := Parse(tt.input, now)
+			if got.Title != tt.title {
+				t.Errorf("title = %q, want %q", got.Title, tt.title)
+			}
+			due := ""
+			if got.Due != nil {
+				due = got.Due.Format("2006-01-02 15:04")
+				if got.Due.Location() != now.Location() {
+					t.Errorf("due in %s, want %s", got.Due.Location(), now.Location())
+				}
+			}
+			if due != tt.due || got.HasTime != tt.hasTime {
+				t.Errorf("due = %q (has time %v), want %q (%v)", due, got.HasTime, tt.due, tt.hasTime)
+			}
+			if !slices.Equal(got.Tags, tt.tags) {
+				t.Errorf("tags = %v, want %v", got.Tags, tt.tags)
+			}
+			if got.Priority != tt.priority {
+				t.Errorf("priority = %q, want %q", got.Priority, tt.priority)
+			}
+			if got.Project != tt.project {
+				t.Errorf("project = %q, want %q", got.Project, tt.project)
+			}
+		})
+	}
+}
+
+func TestParseInLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	// late evening in Tokyo is still the morning in UTC
+	now := time.Date(2025, 6, 18, 23, 30, 0, 0, tokyo)
+	got := Parse("Call tomorrow 8am", now)
+	want := time.Date(2025, 6, 19, 8, 0, 0, 0, tokyo)
+	if got.Due == nil || !got.Due.Equal(want) {
+		t.Errorf("due = %v, want %v", got.Due, want)
+	}
+}
@@ -0,0 +1,271 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretTimeout bounds each lookup in an external secret store
+const secretTimeout = 10 * time.Second
+
+// Provider resolves references to secrets kept outside the
+// server's configuration. Resolved values are only ever held in memory.
+type Provider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// Providers maps reference schemes to providers. A setting such as
+// "vault:secret/data/todo#admin_token" is resolved by the vault provider;
+// values without a known scheme are used as they are.
+var Providers = map[string]Provider{
+	"env":    envSecrets{},
+	"file":   fileSecrets{},
+	"vault":  &vaultSecrets{},
+	"aws-sm": &awsSecrets{},
+}
+
+// IsRef reports whether value refers to a secret store rather than
+// being the secret itself
+func IsRef(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	_, known := Providers[scheme]
+	return ok && known
+}
+
+// Resolve returns the secret value refers to, or value itself if it
+// isn't a reference
+func Resolve(ctx context.Context, value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	scheme, ref, _ := strings.Cut(value, ":")
+	ctx, cancel := context.WithTimeout(ctx, secretTimeout)
+	defer cancel()
+	secret, err := Providers[scheme].Resolve(ctx, ref)
+	if err != nil {
+		// the reference names the secret without revealing it
+		return "", fmt.Errorf("failed to resolve secret %s: %w", value, err)
+	}
+	return secret, nil
+}
+
+// splitSecretField splits "path#field"; the field is optional
+func splitSecretField(ref string) (path, field string) {
+	path, field, _ = strings.Cut(ref, "#")
+	return path, field
+}
+
+// envSecrets reads "env:NAME" from another environment variable
+type envSecrets struct{}
+
+func (envSecrets) Resolve(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%s is not set", name)
+	}
+	return value, nil
+}
+
+// fileSecrets reads "file:/path", e.g. a Kubernetes or Docker secret mount.
+// A trailing newline is dropped.
+type fileSecrets struct{}
+
+func (fileSecrets) Resolve(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// vaultSecrets reads "vault:path#field" from HashiCorp Vault's HTTP API at
+// VAULT_ADDR with VAULT_TOKEN. Both KV version 1 and 2 mounts work; for
+// version 2 the path includes "data/", e.g. secret/data/todo#db_password.
+type vaultSecrets struct{}
+
+func (*vaultSecrets) Resolve(ctx context.Context, ref string) (string, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", errors.New("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+	path, field := splitSecretField(ref)
+	if field == "" {
+		return "", errors.New("vault references need a #field")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+(&url.URL{Path: path}).EscapedPath(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	data := body.Data
+	// KV version 2 nests the secret under data.data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("no string field %q", field)
+	}
+	return value, nil
+}
+
+// awsSecrets reads "aws-sm:name#key" from AWS Secrets Manager using the
+// default credential chain. Without a key the whole secret string is
+// used; with one the secret must be a JSON object.
+type awsSecrets struct {
+	once   sync.Once
+	client *secretsmanager.Client
+	err    error
+}
+
+func (p *awsSecrets) Resolve(ctx context.Context, ref string) (string, error) {
+	p.once.Do(func() {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			p.err = fmt.Errorf("failed to load AWS config: %w", err)
+			return
+		}
+		p.client = secretsmanager.NewFromConfig(cfg)
+	})
+	if p.err != nil {
+		return "", p.err
+	}
+	name, key := splitSecretField(ref)
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", errors.New("secret has no string value")
+	}
+	if key == "" {
+		return *out.SecretString, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(*out.SecretString), &fields); err != nil {
+		return "", errors.New("secret is not a JSON object")
+	}
+	value, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("no string key %q", key)
+	}
+	return value, nil
+}
+
+// Setting is a configured secret whose value can be swapped while
+// the server runs
+type Setting struct {
+	name  string
+	ref   string
+	value atomic.Pointer[string]
+}
+
+// Get returns the current value, or "" if there is none
+func (s *Setting) Get() string {
+	if v := s.value.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+func (s *Setting) Set(value string) { s.value.Store(&value) }
+
+// Settings are the secrets read from the environment, kept so they
+// can be resolved again when rotated
+type Settings struct {
+	mu       sync.Mutex
+	settings []*Setting
+	// OnReload runs after every reload, e.g. to re-resolve webhook secrets
+	OnReload []func(ctx context.Context)
+}
+
+// Env returns the secret configured by the environment variable name,
+// resolving it if it is a reference
+func (s *Settings) Env(ctx context.Context, name string) (*Setting, error) {
+	setting := &Setting{name: name, ref: os.Getenv(name)}
+	value, err := Resolve(ctx, setting.ref)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	setting.Set(value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = append(s.settings, setting)
+	return setting, nil
+}
+
+// Reload resolves every reference again. A secret that fails to resolve
+// keeps its previous value so a store outage can't lock everyone out.
+func (s *Settings) Reload(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rotated := 0
+	for _, setting := range s.settings {
+		if !IsRef(setting.ref) {
+			continue
+		}
+		value, err := Resolve(ctx, setting.ref)
+		if err != nil {
+			log.Printf("%s: keeping the previous value: %v", setting.name, err)
+			continue
+		}
+		if value != setting.Get() {
+			setting.Set(value)
+			rotated++
+		}
+	}
+	for _, fn := range s.OnReload {
+		fn(ctx)
+	}
+	log.Printf("secrets reloaded: %d rotated", rotated)
+}
+
+// ReloadOnSignal reloads secrets on every SIGHUP until ctx is cancelled
+func (s *Settings) ReloadOnSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			s.Reload(ctx)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"golang-todo/internal/secrets"
+)
+
+// ErrBlobNotFound is returned by blob stores when no object has the key
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore is the interface implemented by backends holding attachment
+// contents. Keys are slash-separated paths made of server-generated IDs
+// and content hashes.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// Move renames a blob, replacing any blob already at the new key
+	Move(ctx context.Context, from, to string) error
+}
+
+// NewBlobStore creates the backend named by kind: "disk" stores blobs
+// under location, "s3" stores them in the bucket at an S3-compatible
+// endpoint URL such as https://s3.amazonaws.com/my-bucket
+func NewBlobStore(kind, location, region string) (BlobStore, error) {
+	switch kind {
+	case "disk":
+		return newDiskBlobStore(location)
+	case "s3":
+		accessKey, err := secrets.Resolve(context.Background(), os.Getenv("TODO_S3_ACCESS_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("TODO_S3_ACCESS_KEY: %w", err)
+		}
+		secretKey, err := secrets.Resolve(context.Background(), os.Getenv("TODO_S3_SECRET_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("TODO_S3_SECRET_KEY: %w", err)
+		}
+		return newS3BlobStore(location, region, accessKey, secretKey)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q; want disk or s3", kind)
+	}
+}
+
+// diskBlobStore keeps each blob as a file below a directory
+type diskBlobStore struct {
+	dir string
+}
+
+// newDiskBlobStore stores blobs below dir, which is created on first write
+func newDiskBlobStore(dir string) (*diskBlobStore, error) {
+	if dir == "" {
+		return nil, errors.New("disk blob store needs a directory")
+	}
+	return &diskBlobStore{dir: dir}, nil
+}
+
+// path maps a key into the directory, refusing keys that would escape it
+func (s *diskBlobStore) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *diskBlobStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// Write to a temp file first so a failed upload never leaves a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *diskBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+func (s *diskBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *diskBlobStore) Move(ctx context.Context, from, to string) error {
+	src, err := s.path(from)
+	if err != nil {
+		return err
+	}
+	dst, err := s.path(to)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	if err := os.Rename(src, dst); errors.Is(err, os.ErrNotExist) {
+		return ErrBlobNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// memoryBlobStore keeps blobs in memory, for servers without a place on
+// disk of their own
+type memoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryBlobStore creates an empty in-memory blob store
+func NewMemoryBlobStore() BlobStore {
+	return &memoryBlobStore{blobs: map[string][]byte{}}
+}
+
+func (s *memoryBlobStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memoryBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryBlobStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *memoryBlobStore) Move(ctx context.Context, from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[from]
+	if !ok {
+		return ErrBlobNotFound
+	}
+	delete(s.blobs, from)
+	s.blobs[to] = data
+	return nil
+}
+
+// s3BlobStore keeps blobs in a bucket of an S3-compatible object store
+type s3BlobStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// newS3BlobStore connects to the bucket named by the first path segment of
+// endpoint; any further segments become a key prefix
+func newS3BlobStore(endpoint, region, accessKey, secretKey string) (*s3BlobStore, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q; want e.g. https://s3.amazonaws.com/bucket", endpoint)
+	}
+	bucket, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("S3 endpoint %q does not name a bucket", endpoint)
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: u.Scheme != "http",
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return &s3BlobStore{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *s3BlobStore) key(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.key(key), r, -1, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.key(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing key before streaming starts
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.key(key), minio.RemoveObjectOptions{})
+}
+
+// Move copies the object server-side, since S3 has no rename
+func (s *s3BlobStore) Move(ctx context.Context, from, to string) error {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: s.key(to)},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: s.key(from)})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrBlobNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, from)
+}
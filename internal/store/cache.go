@@ -0,0 +1,337 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"golang-todo/internal/metrics"
+)
+
+var (
+	cacheLookupsTotal = metrics.Default.NewCounterVec("todo_cache_lookups_total",
+		"Store reads answered by the read cache, by kind of read and result (hit, miss or error).", "read", "result")
+	cacheInvalidationsTotal = metrics.Default.NewCounterVec("todo_cache_invalidations_total",
+		"Cache entries dropped because a write changed the data behind them.")
+)
+
+// Cache is a byte cache for encoded store reads. Entries expire after
+// a TTL so a missed invalidation can only serve stale data for so long.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// NewCache returns the cache selected by -cache: lru keeps up to size
+// entries in process, redis uses the server at url. "off" disables caching.
+func NewCache(kind, url string, size int, ttl time.Duration) (Cache, error) {
+	switch kind {
+	case "off", "":
+		return nil, nil
+	case "lru":
+		return newLRUCache(size, ttl), nil
+	case "redis":
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+		return &redisCache{client: redis.NewClient(opts), prefix: "todo:cache:", ttl: ttl}, nil
+	}
+	return nil, fmt.Errorf("unknown cache %q; want off, lru or redis", kind)
+}
+
+// lruCache is an in-process todoCache evicting the least recently used
+// entry once full
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{size: max(size, 1), ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *lruCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (c *lruCache) Set(ctx context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (c *lruCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.order.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+// redisCache keeps entries in Redis under a common prefix
+type redisCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.client.Set(ctx, c.prefix+key, value, c.ttl).Err()
+}
+
+func (c *redisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+func (c *redisCache) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+	return c.client.Del(ctx, prefixed...).Err()
+}
+
+// cacheListKey caches List; single todos are cached under cacheTodoKey
+const cacheListKey = "list"
+
+func cacheTodoKey(id string) string { return "todo/" + id }
+
+// CachedStore serves List and Get from a cache in front of the wrapped
+// store. Writes go straight through and then invalidate what they touched.
+// Cache failures are logged and fall back to the store.
+type CachedStore struct {
+	Store
+	Cache Cache
+	// generation is bumped by every invalidation; a read only fills the
+	// cache if no write happened while it was reading the store
+	generation atomic.Uint64
+}
+
+// cacheTimeout bounds each cache call so a slow cache can't stall reads
+const cacheTimeout = 100 * time.Millisecond
+
+func (s *CachedStore) List(ctx context.Context) ([]Todo, error) {
+	var todos []Todo
+	err := s.read(ctx, "list", cacheListKey, &todos, func() (any, error) {
+		var err error
+		todos, err = s.Store.List(ctx)
+		return todos, err
+	})
+	return todos, err
+}
+
+func (s *CachedStore) Get(ctx context.Context, id string) (Todo, error) {
+	var todo Todo
+	err := s.read(ctx, "get", cacheTodoKey(id), &todo, func() (any, error) {
+		var err error
+		todo, err = s.Store.Get(ctx, id)
+		return todo, err
+	})
+	return todo, err
+}
+
+// read decodes key from the cache into dst, or calls load on a miss and
+// caches what it returns
+func (s *CachedStore) read(ctx context.Context, kind, key string, dst any, load func() (any, error)) error {
+	cacheCtx, cancel := context.WithTimeout(ctx, cacheTimeout)
+	defer cancel()
+	data, ok, err := s.Cache.Get(cacheCtx, key)
+	switch {
+	case err != nil:
+		cacheLookupsTotal.Inc(kind, "error")
+		log.Printf("cache get %s failed: %v", key, err)
+	case ok:
+		if err := json.Unmarshal(data, dst); err == nil {
+			cacheLookupsTotal.Inc(kind, "hit")
+			return nil
+		}
+		cacheLookupsTotal.Inc(kind, "error")
+	default:
+		cacheLookupsTotal.Inc(kind, "miss")
+	}
+
+	generation := s.generation.Load()
+	value, err := load()
+	if err != nil {
+		return err
+	}
+	if data, err = json.Marshal(value); err != nil || s.generation.Load() != generation {
+		return nil
+	}
+	cacheCtx, cancel = context.WithTimeout(ctx, cacheTimeout)
+	defer cancel()
+	if err := s.Cache.Set(cacheCtx, key, data); err != nil {
+		log.Printf("cache set %s failed: %v", key, err)
+		return nil
+	}
+	// a write finishing while the value was set may have invalidated the
+	// key before the stale value landed
+	if s.generation.Load() != generation {
+		if err := s.Cache.Delete(cacheCtx, key); err != nil {
+			log.Printf("cache delete %s failed: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// invalidate drops the list and the given todos from the cache
+func (s *CachedStore) invalidate(ids ...string) {
+	s.generation.Add(1)
+	keys := []string{cacheListKey}
+	for _, id := range ids {
+		keys = append(keys, cacheTodoKey(id))
+	}
+	cacheInvalidationsTotal.Add(float64(len(keys)))
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+	if err := s.Cache.Delete(ctx, keys...); err != nil {
+		log.Printf("cache invalidation failed: %v", err)
+	}
+}
+
+func (s *CachedStore) Create(ctx context.Context, todo Todo, events ...Event) error {
+	defer s.invalidate(todo.ID)
+	return s.Store.Create(ctx, todo, events...)
+}
+
+func (s *CachedStore) Update(ctx context.Context, todo Todo, events ...Event) error {
+	defer s.invalidate(todo.ID)
+	return s.Store.Update(ctx, todo, events...)
+}
+
+func (s *CachedStore) Delete(ctx context.Context, id string, events ...Event) error {
+	defer s.invalidate(id)
+	return s.Store.Delete(ctx, id, events...)
+}
+
+// Atomically tracks the todos a transaction writes and invalidates them
+// once it has finished
+func (s *CachedStore) Atomically(ctx context.Context, fn func(tx Tx) error) error {
+	tx := &trackingTx{}
+	defer func() { s.invalidate(tx.touched...) }()
+	return s.Store.Atomically(ctx, func(inner Tx) error {
+		tx.Tx = inner
+		return fn(tx)
+	})
+}
+
+// trackingTx records the IDs of the todos written through it
+type trackingTx struct {
+	Tx
+	touched []string
+}
+
+func (t *trackingTx) Create(ctx context.Context, todo Todo, events ...Event) error {
+	t.touched = append(t.touched, todo.ID)
+	return t.Tx.Create(ctx, todo, events...)
+}
+
+func (t *trackingTx) Update(ctx context.Context, todo Todo, events ...Event) error {
+	t.touched = append(t.touched, todo.ID)
+	return t.Tx.Update(ctx, todo, events...)
+}
+
+func (t *trackingTx) Delete(ctx context.Context, id string, events ...Event) error {
+	t.touched = append(t.touched, id)
+	return t.Tx.Delete(ctx, id, events...)
+}
+
+// Warm fills the cache with the list of todos and each todo in it, so the
+// first reads after a start don't all miss. It stops early, leaving the
+// rest to reads, if a write invalidates the cache meanwhile.
+func (s *CachedStore) Warm(ctx context.Context) error {
+	generation := s.generation.Load()
+	todos, err := s.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+	entries := map[string]any{cacheListKey: todos}
+	for _, todo := range todos {
+		entries[cacheTodoKey(todo.ID)] = todo
+	}
+	var set []string
+	for key, value := range entries {
+		if s.generation.Load() != generation {
+			break
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		cacheCtx, cancel := context.WithTimeout(ctx, cacheTimeout)
+		err = s.Cache.Set(cacheCtx, key, data)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("cache set %s failed: %w", key, err)
+		}
+		set = append(set, key)
+	}
+	// like read, drop what a write may have invalidated before it was set
+	if s.generation.Load() != generation && len(set) > 0 {
+		cacheCtx, cancel := context.WithTimeout(ctx, cacheTimeout)
+		defer cancel()
+		if err := s.Cache.Delete(cacheCtx, set...); err != nil {
+			return fmt.Errorf("cache delete failed: %w", err)
+		}
+	}
+	return nil
+}
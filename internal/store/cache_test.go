@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedStoreInvalidatesOnWrite(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore()
+	s := &CachedStore{Store: backend, Cache: newLRUCache(10, time.Hour)}
+	if err := s.Create(ctx, testTodo("a", "first")); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, s); got["a"] != "first" {
+		t.Fatalf("titles = %v", got)
+	}
+
+	// writes behind the cache's back aren't seen until the cache is
+	// invalidated, so the list is really served from the cache
+	todo := testTodo("a", "second")
+	if err := backend.Update(ctx, todo); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, s); got["a"] != "first" {
+		t.Fatalf("titles = %v, want the cached first", got)
+	}
+
+	todo.Title = "third"
+	if err := s.Update(ctx, todo); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, s); got["a"] != "third" {
+		t.Errorf("titles after an update = %v, want third", got)
+	}
+	if err := s.Atomically(ctx, func(tx Tx) error {
+		todo.Title = "fourth"
+		return tx.Update(ctx, todo)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, "a"); err != nil || got.Title != "fourth" {
+		t.Errorf("get after a transaction = %+v, %v; want fourth", got, err)
+	}
+	if got := titles(t, s); got["a"] != "fourth" {
+		t.Errorf("titles after a transaction = %v, want fourth", got)
+	}
+}
+
+// racingCache runs beforeSet once, just before the first value is set
+type racingCache struct {
+	Cache
+	beforeSet func()
+}
+
+func (c *racingCache) Set(ctx context.Context, key string, value []byte) error {
+	if fn := c.beforeSet; fn != nil {
+		c.beforeSet = nil
+		fn()
+	}
+	return c.Cache.Set(ctx, key, value)
+}
+
+func TestCachedStoreDropsReadRacingAWrite(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore()
+	if err := backend.Create(ctx, testTodo("a", "old")); err != nil {
+		t.Fatal(err)
+	}
+	cache := &racingCache{Cache: newLRUCache(10, time.Hour)}
+	s := &CachedStore{Store: backend, Cache: cache}
+
+	// the write finishes, invalidating the list, after the read loaded
+	// the old list but before it is cached
+	cache.beforeSet = func() {
+		if err := s.Update(ctx, testTodo("a", "new")); err != nil {
+			t.Error(err)
+		}
+	}
+	if got := titles(t, s); got["a"] != "old" {
+		t.Fatalf("racing read = %v, want the old title it loaded", got)
+	}
+	if got := titles(t, s); got["a"] != "new" {
+		t.Errorf("titles after the racing write = %v, want new", got)
+	}
+}
+
+func TestCachedStoreWarmRacingAWrite(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore()
+	if err := backend.Create(ctx, testTodo("a", "old")); err != nil {
+		t.Fatal(err)
+	}
+	cache := &racingCache{Cache: newLRUCache(10, time.Hour)}
+	s := &CachedStore{Store: backend, Cache: cache}
+	cache.beforeSet = func() {
+		if err := s.Update(ctx, testTodo("a", "new")); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := s.Warm(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, s); got["a"] != "new" {
+		t.Errorf("titles after warming raced a write = %v, want new", got)
+	}
+	if got, err := s.Get(ctx, "a"); err != nil || got.Title != "new" {
+		t.Errorf("get after warming raced a write = %+v, %v; want new", got, err)
+	}
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Change says that a todo was written at a point in a ChangeTracker's
+// sequence. Deleted todos leave a tombstone, so readers catching up learn
+// about deletions too.
+type Change struct {
+	ID  string
+	Seq uint64
+	// DeletedAt is set for tombstones
+	DeletedAt *time.Time
+}
+
+// ChangeTracker numbers every write to the wrapped store, keeping each
+// todo's latest change and a tombstone for each deleted todo, so readers
+// can ask what changed since a point in the sequence. Sequence numbers
+// only mean something within one epoch: the tracker lives in memory and
+// starts a new epoch, and readers over, each time the process starts.
+type ChangeTracker struct {
+	Store
+	// Retention is how long tombstones are kept; readers further behind
+	// must start over
+	Retention time.Duration
+
+	mu    sync.Mutex
+	epoch string
+	seq   uint64
+	// latest maps each todo written since the epoch began to its change
+	latest map[string]Change
+	// horizon is the highest sequence number of a pruned tombstone
+	horizon uint64
+}
+
+// NewChangeTracker tracks the changes made through it to s
+func NewChangeTracker(s Store, retention time.Duration) *ChangeTracker {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &ChangeTracker{Store: s, Retention: retention, epoch: hex.EncodeToString(b), latest: map[string]Change{}}
+}
+
+// Epoch identifies this run of the tracker
+func (c *ChangeTracker) Epoch() string {
+	return c.epoch
+}
+
+// Head is the sequence number of the latest change
+func (c *ChangeTracker) Head() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// Since returns up to limit changes after seq, oldest first, and whether
+// they are complete: false means tombstones after seq have been pruned, so
+// the reader must start over.
+func (c *ChangeTracker) Since(seq uint64, limit int) ([]Change, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(time.Now())
+	if seq < c.horizon {
+		return nil, false
+	}
+	var changes []Change
+	for _, change := range c.latest {
+		if change.Seq > seq {
+			changes = append(changes, change)
+		}
+	}
+	slices.SortFunc(changes, func(a, b Change) int { return cmp.Compare(a.Seq, b.Seq) })
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, true
+}
+
+// Tombstone returns when todo id was deleted, if it was deleted since the
+// epoch began and its tombstone hasn't been pruned
+func (c *ChangeTracker) Tombstone(id string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	change, ok := c.latest[id]
+	if !ok || change.DeletedAt == nil {
+		return time.Time{}, false
+	}
+	return *change.DeletedAt, true
+}
+
+// record notes writes that have been committed
+func (c *ChangeTracker) record(changes ...Change) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, change := range changes {
+		c.seq++
+		change.Seq = c.seq
+		c.latest[change.ID] = change
+	}
+}
+
+// prune drops tombstones past the retention period
+func (c *ChangeTracker) prune(now time.Time) {
+	if c.Retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-c.Retention)
+	for id, change := range c.latest {
+		if change.DeletedAt != nil && change.DeletedAt.Before(cutoff) {
+			c.horizon = max(c.horizon, change.Seq)
+			delete(c.latest, id)
+		}
+	}
+}
+
+func (c *ChangeTracker) Create(ctx context.Context, todo Todo, events ...Event) error {
+	if err := c.Store.Create(ctx, todo, events...); err != nil {
+		return err
+	}
+	c.record(Change{ID: todo.ID})
+	return nil
+}
+
+func (c *ChangeTracker) Update(ctx context.Context, todo Todo, events ...Event) error {
+	if err := c.Store.Update(ctx, todo, events...); err != nil {
+		return err
+	}
+	c.record(Change{ID: todo.ID})
+	return nil
+}
+
+func (c *ChangeTracker) Delete(ctx context.Context, id string, events ...Event) error {
+	if err := c.Store.Delete(ctx, id, events...); err != nil {
+		return err
+	}
+	now := time.Now()
+	c.record(Change{ID: id, DeletedAt: &now})
+	return nil
+}
+
+// Atomically records a transaction's writes once it has committed
+func (c *ChangeTracker) Atomically(ctx context.Context, fn func(tx Tx) error) error {
+	var tx *changeTx
+	err := c.Store.Atomically(ctx, func(inner Tx) error {
+		// a retried transaction starts its record over
+		tx = &changeTx{Tx: inner}
+		return fn(tx)
+	})
+	if err == nil && tx != nil {
+		c.record(tx.changes...)
+	}
+	return err
+}
+
+// changeTx collects the writes of a transaction
+type changeTx struct {
+	Tx
+	changes []Change
+}
+
+func (t *changeTx) Create(ctx context.Context, todo Todo, events ...Event) error {
+	if err := t.Tx.Create(ctx, todo, events...); err != nil {
+		return err
+	}
+	t.changes = append(t.changes, Change{ID: todo.ID})
+	return nil
+}
+
+func (t *changeTx) Update(ctx context.Context, todo Todo, events ...Event) error {
+	if err := t.Tx.Update(ctx, todo, events...); err != nil {
+		return err
+	}
+	t.changes = append(t.changes, Change{ID: todo.ID})
+	return nil
+}
+
+func (t *changeTx) Delete(ctx context.Context, id string, events ...Event) error {
+	if err := t.Tx.Delete(ctx, id, events...); err != nil {
+		return err
+	}
+	now := time.Now()
+	t.changes = append(t.changes, Change{ID: id, DeletedAt: &now})
+	return nil
+}
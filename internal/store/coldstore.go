@@ -0,0 +1,184 @@
+package store
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ColdStore is the interface implemented by archive tiers that hold
+// completed todos which are no longer kept in the hot store
+type ColdStore interface {
+	Put(ctx context.Context, todo Todo) error
+	Get(ctx context.Context, id string) (Todo, error)
+	List(ctx context.Context) ([]Todo, error)
+	// Each calls fn with every archived todo in turn, without holding them
+	// all in memory, stopping at the first error fn returns
+	Each(ctx context.Context, fn func(Todo) error) error
+}
+
+// blobColdStore keeps each archived todo as a gzip-compressed JSON blob
+// in a directory, which plays the role of a cheap storage bucket
+type blobColdStore struct {
+	dir string
+}
+
+// NewBlobColdStore creates a cold store rooted at dir, creating it if needed
+func NewBlobColdStore(dir string) (*blobColdStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cold storage directory: %w", err)
+	}
+	return &blobColdStore{dir: dir}, nil
+}
+
+func (s *blobColdStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json.gz")
+}
+
+func (s *blobColdStore) Put(ctx context.Context, todo Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Write to a temp file first so a crash never leaves a truncated blob
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cold blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(todo); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode cold blob: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compress cold blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cold blob: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path(todo.ID))
+}
+
+func (s *blobColdStore) Get(ctx context.Context, id string) (Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return Todo{}, err
+	}
+	return s.read(s.path(id))
+}
+
+func (s *blobColdStore) List(ctx context.Context) ([]Todo, error) {
+	var todos []Todo
+	err := s.Each(ctx, func(todo Todo) error {
+		todos = append(todos, todo)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if todos == nil {
+		todos = []Todo{}
+	}
+	return todos, nil
+}
+
+// Each stops early with the context's error once ctx is done
+func (s *blobColdStore) Each(ctx context.Context, fn func(Todo) error) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json.gz"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		todo, err := s.read(p)
+		if err != nil {
+			return err
+		}
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *blobColdStore) read(path string) (Todo, error) {
+	var todo Todo
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return todo, ErrNotFound
+	}
+	if err != nil {
+		return todo, fmt.Errorf("failed to open cold blob: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return todo, fmt.Errorf("failed to decompress cold blob %s: %w", strings.TrimSuffix(filepath.Base(path), ".json.gz"), err)
+	}
+	defer zr.Close()
+	if err := json.NewDecoder(zr).Decode(&todo); err != nil {
+		return todo, fmt.Errorf("failed to decode cold blob: %w", err)
+	}
+	return todo, nil
+}
+
+// Tierer periodically moves completed todos older than a threshold from
+// the hot store into the cold store
+type Tierer struct {
+	Hot   Store
+	Cold  ColdStore
+	After time.Duration
+}
+
+// Run executes a tiering pass every interval until ctx is cancelled
+func (t *Tierer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := t.tierOnce(ctx, time.Now()); err != nil {
+			log.Printf("cold tiering failed after moving %d todos: %v", n, err)
+		} else if n > 0 {
+			log.Printf("cold tiering moved %d todos", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tierOnce moves every eligible todo and returns how many were moved
+func (t *Tierer) tierOnce(ctx context.Context, now time.Time) (int, error) {
+	todos, err := t.Hot.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := now.Add(-t.After)
+	moved := 0
+	for _, todo := range todos {
+		if todo.Status != StatusCompleted || todo.CompletedAt == nil || todo.CompletedAt.After(cutoff) {
+			continue
+		}
+		// Only drop the hot copy once the cold copy is safely written
+		if err := t.Cold.Put(ctx, todo); err != nil {
+			return moved, err
+		}
+		if err := t.Hot.Delete(ctx, todo.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
@@ -0,0 +1,322 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// fileSnapshot is the JSON document a fileStore compacts its state into
+type fileSnapshot struct {
+	Todos   []Todo        `json:"todos"`
+	Outbox  []outboxEntry `json:"outbox"`
+	NextSeq uint64        `json:"next_seq"`
+	// JournalSeq is the last journal record the snapshot includes
+	JournalSeq uint64 `json:"journal_seq"`
+}
+
+// fileJournalRecord is one committed transaction, appended to the journal
+// as a line of JSON
+type fileJournalRecord struct {
+	Seq       uint64          `json:"seq"`
+	Ops       []fileJournalOp `json:"ops,omitempty"`
+	Events    []Event         `json:"events,omitempty"`
+	Published []uint64        `json:"published,omitempty"`
+}
+
+// fileJournalOp writes one todo: Put creates or replaces it, Delete
+// removes it
+type fileJournalOp struct {
+	Put    *Todo  `json:"put,omitempty"`
+	Delete string `json:"delete,omitempty"`
+}
+
+// FileStore is a memoryStore that survives restarts. Every committed write
+// is appended to a JSONL journal before it becomes visible, and the
+// journal is periodically compacted into a JSON snapshot replaced by
+// atomic rename. Writes reach the OS as they commit, so a crashed process
+// loses nothing; after a power loss the journal may be cut short, which
+// recovery tolerates.
+type FileStore struct {
+	*memoryStore
+	path       string
+	journal    *os.File
+	journalSeq uint64
+	// flushedSeq is the journal record the snapshot on disk includes
+	flushedSeq uint64
+}
+
+// NewFileStore opens the store snapshotted at path, creating it if
+// needed, and replays the journal left by the last run
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{memoryStore: NewMemoryStore(), path: path}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// a leftover temporary file is a snapshot that was never renamed
+	os.Remove(path + ".tmp")
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayJournal(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) journalPath() string { return s.path + ".journal" }
+
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap fileSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to read snapshot %s: %w", s.path, err)
+	}
+	if snap.Todos == nil {
+		snap.Todos = []Todo{}
+	}
+	s.data = &memoryData{todos: snap.Todos, outbox: snap.Outbox, nextSeq: snap.NextSeq}
+	s.journalSeq, s.flushedSeq = snap.JournalSeq, snap.JournalSeq
+	return nil
+}
+
+// replayJournal applies the records written since the snapshot. A torn
+// last line, from a write cut short by a crash, is dropped; damage
+// anywhere else is an error rather than silently losing later writes.
+func (s *FileStore) replayJournal() error {
+	f, err := os.OpenFile(s.journalPath(), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	var offset int64
+	replayed := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Printf("dropping incomplete last record of %s", s.journalPath())
+			}
+			break
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+		var rec fileJournalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			f.Close()
+			return fmt.Errorf("journal %s is corrupt at byte %d: %w", s.journalPath(), offset, err)
+		}
+		offset += int64(len(line))
+		// records of a compaction that crashed before truncating the
+		// journal are already in the snapshot
+		if rec.Seq <= s.journalSeq {
+			continue
+		}
+		s.data.apply(rec)
+		s.journalSeq = rec.Seq
+		replayed++
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	if replayed > 0 {
+		log.Printf("recovered %d writes from %s", replayed, s.journalPath())
+	}
+	s.journal = f
+	return nil
+}
+
+// apply replays a journal record
+func (d *memoryData) apply(rec fileJournalRecord) {
+	for _, op := range rec.Ops {
+		if op.Put == nil {
+			d.Delete(context.Background(), op.Delete)
+		} else if err := d.Update(context.Background(), *op.Put); errors.Is(err, ErrNotFound) {
+			d.Create(context.Background(), *op.Put)
+		}
+	}
+	d.appendOutbox(rec.Events)
+	d.outbox = slices.DeleteFunc(d.outbox, func(e outboxEntry) bool {
+		return slices.Contains(rec.Published, e.Seq)
+	})
+}
+
+// appendJournal writes rec; the caller holds s.mu
+func (s *FileStore) appendJournal(rec fileJournalRecord) error {
+	rec.Seq = s.journalSeq + 1
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.journal.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	s.journalSeq = rec.Seq
+	return nil
+}
+
+func (s *FileStore) Create(ctx context.Context, todo Todo, events ...Event) error {
+	return s.Atomically(ctx, func(tx Tx) error { return tx.Create(ctx, todo, events...) })
+}
+
+func (s *FileStore) Update(ctx context.Context, todo Todo, events ...Event) error {
+	return s.Atomically(ctx, func(tx Tx) error { return tx.Update(ctx, todo, events...) })
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string, events ...Event) error {
+	return s.Atomically(ctx, func(tx Tx) error { return tx.Delete(ctx, id, events...) })
+}
+
+// Atomically journals the transaction's writes as one record before
+// swapping them in, so a recovered store never holds half a transaction
+func (s *FileStore) Atomically(ctx context.Context, fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := &journalingTx{memoryData: s.data.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tx.rec.Ops == nil && tx.rec.Events == nil {
+		return nil
+	}
+	if err := s.appendJournal(tx.rec); err != nil {
+		return err
+	}
+	s.data = tx.memoryData
+	return nil
+}
+
+func (s *FileStore) MarkPublished(ctx context.Context, seqs ...uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := fileJournalRecord{Published: seqs}
+	if err := s.appendJournal(rec); err != nil {
+		return err
+	}
+	s.data.apply(rec)
+	return nil
+}
+
+// journalingTx records the writes made through it as a journal record
+type journalingTx struct {
+	*memoryData
+	rec fileJournalRecord
+}
+
+func (t *journalingTx) Create(ctx context.Context, todo Todo, events ...Event) error {
+	if err := t.memoryData.Create(ctx, todo, events...); err != nil {
+		return err
+	}
+	t.rec.Ops = append(t.rec.Ops, fileJournalOp{Put: &todo})
+	t.rec.Events = append(t.rec.Events, events...)
+	return nil
+}
+
+func (t *journalingTx) Update(ctx context.Context, todo Todo, events ...Event) error {
+	if err := t.memoryData.Update(ctx, todo, events...); err != nil {
+		return err
+	}
+	t.rec.Ops = append(t.rec.Ops, fileJournalOp{Put: &todo})
+	t.rec.Events = append(t.rec.Events, events...)
+	return nil
+}
+
+func (t *journalingTx) Delete(ctx context.Context, id string, events ...Event) error {
+	if err := t.memoryData.Delete(ctx, id, events...); err != nil {
+		return err
+	}
+	t.rec.Ops = append(t.rec.Ops, fileJournalOp{Delete: id})
+	t.rec.Events = append(t.rec.Events, events...)
+	return nil
+}
+
+// flush compacts the journal into a new snapshot if anything was written
+// since the last one
+func (s *FileStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journalSeq == s.flushedSeq {
+		return nil
+	}
+	snap := fileSnapshot{Todos: s.data.todos, Outbox: s.data.outbox, NextSeq: s.data.nextSeq, JournalSeq: s.journalSeq}
+	if err := WriteFileAtomic(s.path, snap); err != nil {
+		return err
+	}
+	s.flushedSeq = s.journalSeq
+	if err := s.journal.Truncate(0); err != nil {
+		return err
+	}
+	_, err := s.journal.Seek(0, io.SeekStart)
+	return err
+}
+
+// WriteFileAtomic replaces path with v encoded as JSON. The data is synced
+// before the rename, so readers see either the old file or the new one.
+func WriteFileAtomic(path string, v any) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(v)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// make the rename itself durable
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// RunFlusher compacts the journal every interval until ctx is cancelled
+func (s *FileStore) RunFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.flush(); err != nil {
+			log.Printf("failed to flush %s: %v", s.path, err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openFileStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.journal.Close() })
+	return s
+}
+
+// titles returns the titles of the todos in s by ID
+func titles(t *testing.T, s Store) map[string]string {
+	t.Helper()
+	todos, err := s.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, todo := range todos {
+		got[todo.ID] = todo.Title
+	}
+	return got
+}
+
+func testTodo(id, title string) Todo {
+	now := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	return Todo{ID: id, Title: title, Status: StatusPending, CreatedAt: now, UpdatedAt: now, Version: 1}
+}
+
+func TestFileStoreReplaysJournalOverSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todos.json")
+	s := openFileStore(t, path)
+	if err := s.Create(ctx, testTodo("a", "first"), Event{ID: "e1", Type: EventTodoCreated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create(ctx, testTodo("gone", "deleted later")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+	// written after the snapshot, so only the journal has them
+	if err := s.Update(ctx, testTodo("a", "renamed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create(ctx, testTodo("b", "second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openFileStore(t, path)
+	got := titles(t, reopened)
+	if len(got) != 2 || got["a"] != "renamed" || got["b"] != "second" {
+		t.Fatalf("todos after reopening = %v, want a renamed and b", got)
+	}
+	pending, err := reopened.PendingEvents(ctx, 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending events after reopening = %v, %v; want the one event", pending, err)
+	}
+	if err := reopened.MarkPublished(ctx, pending[0].Seq); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := openFileStore(t, path).PendingEvents(ctx, 10); len(pending) != 0 {
+		t.Errorf("pending events after publishing and reopening = %v, want none", pending)
+	}
+}
+
+func TestFileStoreDropsTornLastLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todos.json")
+	s := openFileStore(t, path)
+	for _, id := range []string{"a", "b"} {
+		if err := s.Create(ctx, testTodo(id, id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a write cut short by a crash
+	if _, err := s.journal.WriteString(`{"seq":3,"ops":[{"put":{"id":"c"`); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openFileStore(t, path)
+	if got := titles(t, reopened); len(got) != 2 {
+		t.Fatalf("todos after reopening = %v, want a and b", got)
+	}
+	// the torn line is gone, so the next record starts on a line of its own
+	if err := reopened.Create(ctx, testTodo("c", "c")); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, openFileStore(t, path)); len(got) != 3 {
+		t.Errorf("todos after writing past the torn line and reopening = %v, want a, b and c", got)
+	}
+}
+
+func TestFileStoreRejectsCorruptJournal(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todos.json")
+	s := openFileStore(t, path)
+	if err := s.Create(ctx, testTodo("a", "a")); err != nil {
+		t.Fatal(err)
+	}
+	journal, err := os.ReadFile(path + ".journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// damage before the last line would lose the records after it
+	if err := os.WriteFile(path+".journal", append([]byte("{not json}\n"), journal...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Error("NewFileStore with a corrupt journal line before the last succeeded")
+	}
+}
+
+func TestFileStoreSkipsCompactedRecords(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todos.json")
+	s := openFileStore(t, path)
+	if err := s.Create(ctx, testTodo("a", "old")); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := os.ReadFile(path + ".journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(ctx, testTodo("a", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+	// a compaction that crashed after renaming the snapshot but before
+	// truncating the journal leaves records the snapshot already has
+	if err := os.WriteFile(path+".journal", stale, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openFileStore(t, path)
+	if got := titles(t, reopened); got["a"] != "new" {
+		t.Fatalf("todo after reopening = %q, want the snapshot's %q", got["a"], "new")
+	}
+	// the skipped record's seq isn't reused, so the next write survives too
+	if err := reopened.Create(ctx, testTodo("b", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(t, openFileStore(t, path)); got["a"] != "new" || got["b"] != "b" {
+		t.Errorf("todos after writing and reopening = %v", got)
+	}
+}
+
+func TestFileStoreIgnoresUnrenamedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todos.json")
+	s := openFileStore(t, path)
+	if err := s.Create(ctx, testTodo("a", "a")); err != nil {
+		t.Fatal(err)
+	}
+	// a compaction that crashed while writing the new snapshot
+	if err := os.WriteFile(path+".tmp", []byte(`{"todos":[{"id":"half`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := titles(t, openFileStore(t, path)); len(got) != 1 || got["a"] != "a" {
+		t.Errorf("todos after reopening = %v, want a from the journal", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("leftover temporary snapshot: %v", err)
+	}
+}
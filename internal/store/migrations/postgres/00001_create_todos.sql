@@ -0,0 +1,20 @@
+-- +goose Up
+-- Todos are kept as JSON documents so new fields don't need a migration;
+-- seq preserves creation order for listing.
+CREATE TABLE todos (
+    seq        BIGSERIAL   NOT NULL UNIQUE,
+    id         TEXT        PRIMARY KEY,
+    data       JSONB       NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Events are written in the same transaction as the change that caused
+-- them and removed once the relay has published them.
+CREATE TABLE outbox (
+    seq   BIGSERIAL PRIMARY KEY,
+    event JSONB     NOT NULL
+);
+
+-- +goose Down
+DROP TABLE outbox;
+DROP TABLE todos;
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TodoStatus represents the state of a Todo item. Pending and completed
+// always exist; the active workflow may add states between them.
+type TodoStatus string
+
+const (
+	StatusPending   TodoStatus = "pending"
+	StatusCompleted TodoStatus = "completed"
+)
+
+// TodoPriority ranks how urgent a todo is; unset means no priority
+type TodoPriority string
+
+const (
+	PriorityLow    TodoPriority = "low"
+	PriorityMedium TodoPriority = "medium"
+	PriorityHigh   TodoPriority = "high"
+	PriorityUrgent TodoPriority = "urgent"
+)
+
+// Todo represents a single todo item in the application
+type Todo struct {
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Status      TodoStatus   `json:"status"`
+	Priority    TodoPriority `json:"priority,omitempty"`
+	ProjectID   string       `json:"project_id,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	BlockedBy   []string     `json:"blocked_by,omitempty"`
+	// Owner is the user responsible for the todo once ownership has been
+	// transferred to them; until then it is empty and the creator owns it
+	Owner string `json:"owner,omitempty"`
+	// ExternalRef links the todo to something outside, such as the CI
+	// pipeline whose failure it tracks
+	ExternalRef string `json:"external_ref,omitempty"`
+	// Metadata holds custom fields such as ticket IDs or client names;
+	// values are strings, numbers or booleans
+	Metadata map[string]any `json:"metadata,omitempty"`
+	// Position orders the todo within its project's list; zero until it is
+	// first moved, which sorts it after the manually ordered todos
+	Position int64      `json:"position,omitempty"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	// DueTimezone is the IANA zone DueAt is meant in, such as the creator's
+	// when the due date was set, so "end of day" stays theirs
+	DueTimezone string `json:"due_timezone,omitempty"`
+	// RemindAt is when to remind the todo's owner about it;
+	// RemindBeforeMinutes instead reminds them that long before DueAt
+	RemindAt            *time.Time `json:"remind_at,omitempty"`
+	RemindBeforeMinutes int        `json:"remind_before_minutes,omitempty"`
+	// EstimateMinutes is how much work the todo is expected to take
+	EstimateMinutes int        `json:"estimate_minutes,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	// ArchivedAt is set once a completed todo is auto-archived; archived
+	// todos are hidden from default listings until reopened
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// StatusChangedAt records when the todo last entered each state
+	StatusChangedAt map[TodoStatus]time.Time `json:"status_changed_at,omitempty"`
+	Version         int                      `json:"version"`
+
+	// Response-only fields, filled in by server.decorate and never stored
+	Lock         *EditLock `json:"lock,omitempty"`
+	CommentCount int       `json:"comment_count,omitempty"`
+	// TimeSpentSeconds totals the time tracked on the todo, running timers
+	// included
+	TimeSpentSeconds int64 `json:"time_spent_seconds,omitempty"`
+}
+
+// EditLock is an advisory lock telling collaborators that someone is
+// editing a todo. Writes are not blocked; clients are expected to check it.
+type EditLock struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// FieldChange is one field-level difference between two versions of a todo
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// EventType names a lifecycle change of a todo
+type EventType string
+
+const (
+	EventTodoCreated   EventType = "todo.created"
+	EventTodoUpdated   EventType = "todo.updated"
+	EventTodoCompleted EventType = "todo.completed"
+	EventTodoDeleted   EventType = "todo.deleted"
+)
+
+// Event describes a single change to a todo, as delivered to subscribers
+type Event struct {
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Actor      string    `json:"actor,omitempty"`
+	Todo       Todo      `json:"todo"`
+	// Changes lists the fields an update changed with their old and new
+	// values, so consumers needn't keep a copy of the previous state
+	Changes []FieldChange `json:"changes,omitempty"`
+
+	// Before is the todo's state prior to an update or completion, used for
+	// diffs; it isn't delivered
+	Before *Todo `json:"-"`
+	// Undoing marks events produced by POST /undo, which can't be undone
+	// themselves
+	Undoing bool `json:"-"`
+}
+
+// NewEvent creates an event of the given type for a todo, caused by actor
+func NewEvent(eventType EventType, actor string, todo Todo) Event {
+	return Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		OccurredAt: time.Now(),
+		Actor:      actor,
+		Todo:       todo,
+	}
+}
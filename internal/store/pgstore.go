@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// pgQueryTimeout bounds every query the Postgres store runs, also when the
+// caller's context has no deadline
+const pgQueryTimeout = 5 * time.Second
+
+// pgQuerier is the part of pgxpool.Pool and pgx.Tx the store queries use
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// pgStore keeps todos and the outbox in PostgreSQL. Connections are
+// pooled; pool settings such as pool_max_conns go in the URL.
+type pgStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgStore connects to the database at url, running pending migrations
+// first when migrate is set
+func NewPgStore(ctx context.Context, url string, migrate bool) (*pgStore, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid postgres URL: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	if migrate {
+		if err := MigratePostgres(ctx, pool, "up"); err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+	return &pgStore{pool: pool}, nil
+}
+
+func (s *pgStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+// MigratePostgres applies (up) or rolls back one (down) of the embedded
+// migrations, or logs their state (status)
+func MigratePostgres(ctx context.Context, pool *pgxpool.Pool, command string) error {
+	db := stdlib.OpenDBFromPool(pool)
+	defer db.Close()
+	migrations, err := fs.Sub(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		return err
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations)
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "up":
+		results, err := provider.Up(ctx)
+		for _, r := range results {
+			fmt.Printf("migrated %s in %s\n", r.Source.Path, r.Duration)
+		}
+		return err
+	case "down":
+		r, err := provider.Down(ctx)
+		if r != nil {
+			fmt.Printf("rolled back %s\n", r.Source.Path)
+		}
+		return err
+	case "status":
+		statuses, err := provider.Status(ctx)
+		for _, s := range statuses {
+			fmt.Printf("%-40s %s\n", s.Source.Path, s.State)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown migrate command %q; want up, down or status", command)
+}
+
+func (s *pgStore) List(ctx context.Context) ([]Todo, error) { return pgList(ctx, s.pool) }
+
+func (s *pgStore) Get(ctx context.Context, id string) (Todo, error) { return pgGet(ctx, s.pool, id) }
+
+func (s *pgStore) Create(ctx context.Context, todo Todo, events ...Event) error {
+	return s.Atomically(ctx, func(tx Tx) error { return tx.Create(ctx, todo, events...) })
+}
+
+func (s *pgStore) Update(ctx context.Context, todo Todo, events ...Event) error {
+	return s.Atomically(ctx, func(tx Tx) error { return tx.Update(ctx, todo, events...) })
+}
+
+func (s *pgStore) Delete(ctx context.Context, id string, events ...Event) error {
+	return s.Atomically(ctx, func(tx Tx) error { return tx.Delete(ctx, id, events...) })
+}
+
+// pgWriteLock is the advisory lock key every write transaction holds
+const pgWriteLock = 0x746f646f
+
+// Atomically runs fn in a transaction holding an advisory lock, so writes
+// run one after the other, as in the memory store, even across instances
+// sharing the database
+func (s *pgStore) Atomically(ctx context.Context, fn func(tx Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, pgWriteLock); err != nil {
+			return err
+		}
+		return fn(&pgTx{tx: tx})
+	})
+}
+
+func (s *pgStore) PendingEvents(ctx context.Context, limit int) ([]outboxEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	rows, err := s.pool.Query(ctx, `SELECT seq, event FROM outbox ORDER BY seq LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (outboxEntry, error) {
+		var entry outboxEntry
+		var data []byte
+		if err := row.Scan(&entry.Seq, &data); err != nil {
+			return entry, err
+		}
+		return entry, json.Unmarshal(data, &entry.Event)
+	})
+}
+
+func (s *pgStore) MarkPublished(ctx context.Context, seqs ...uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	_, err := s.pool.Exec(ctx, `DELETE FROM outbox WHERE seq = ANY($1)`, seqs)
+	return err
+}
+
+// pgTx is a Tx inside a Postgres transaction
+type pgTx struct {
+	tx pgx.Tx
+}
+
+func (t *pgTx) List(ctx context.Context) ([]Todo, error) { return pgList(ctx, t.tx) }
+
+func (t *pgTx) Get(ctx context.Context, id string) (Todo, error) { return pgGet(ctx, t.tx, id) }
+
+func (t *pgTx) Create(ctx context.Context, todo Todo, events ...Event) error {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	if _, err := t.tx.Exec(ctx, `INSERT INTO todos (id, data, updated_at) VALUES ($1, $2, $3)`, todo.ID, data, todo.UpdatedAt); err != nil {
+		return err
+	}
+	return pgAppendOutbox(ctx, t.tx, events)
+}
+
+func (t *pgTx) Update(ctx context.Context, todo Todo, events ...Event) error {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	tag, err := t.tx.Exec(ctx, `UPDATE todos SET data = $2, updated_at = $3 WHERE id = $1`, todo.ID, data, todo.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return pgAppendOutbox(ctx, t.tx, events)
+}
+
+func (t *pgTx) Delete(ctx context.Context, id string, events ...Event) error {
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	tag, err := t.tx.Exec(ctx, `DELETE FROM todos WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return pgAppendOutbox(ctx, t.tx, events)
+}
+
+func pgList(ctx context.Context, q pgQuerier) ([]Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	rows, err := q.Query(ctx, `SELECT data FROM todos ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	todos, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Todo, error) {
+		var todo Todo
+		var data []byte
+		if err := row.Scan(&data); err != nil {
+			return todo, err
+		}
+		return todo, json.Unmarshal(data, &todo)
+	})
+	if todos == nil {
+		todos = []Todo{}
+	}
+	return todos, err
+}
+
+func pgGet(ctx context.Context, q pgQuerier, id string) (Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, pgQueryTimeout)
+	defer cancel()
+	var todo Todo
+	var data []byte
+	err := q.QueryRow(ctx, `SELECT data FROM todos WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return todo, ErrNotFound
+	}
+	if err != nil {
+		return todo, err
+	}
+	return todo, json.Unmarshal(data, &todo)
+}
+
+func pgAppendOutbox(ctx context.Context, q pgQuerier, events []Event) error {
+	for _, evt := range events {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		if _, err := q.Exec(ctx, `INSERT INTO outbox (event) VALUES ($1)`, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
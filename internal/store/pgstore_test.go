@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+// openPgStore connects to the database TODO_TEST_POSTGRES_URL names,
+// migrated and emptied; the tests own that database
+func openPgStore(t *testing.T) *pgStore {
+	t.Helper()
+	url := os.Getenv("TODO_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("set TODO_TEST_POSTGRES_URL to test the Postgres store")
+	}
+	ctx := context.Background()
+	s, err := NewPgStore(ctx, url, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.pool.Close)
+	if _, err := s.pool.Exec(ctx, `TRUNCATE todos, outbox`); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPgStore(t *testing.T) {
+	ctx := context.Background()
+	s := openPgStore(t)
+	for _, id := range []string{"b", "a", "c"} {
+		if err := s.Create(ctx, testTodo(id, id), Event{ID: "created-" + id, Type: EventTodoCreated}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Create(ctx, testTodo("a", "again")); err == nil {
+		t.Error("creating a todo twice succeeded")
+	}
+
+	// lists keep creation order
+	todos, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, todo := range todos {
+		ids = append(ids, todo.ID)
+	}
+	if !slices.Equal(ids, []string{"b", "a", "c"}) {
+		t.Errorf("listed %v, want b a c", ids)
+	}
+
+	if err := s.Update(ctx, testTodo("a", "renamed")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, "a"); err != nil || got.Title != "renamed" {
+		t.Errorf("get after an update = %+v, %v; want renamed", got, err)
+	}
+	if err := s.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	for name, err := range map[string]error{
+		"get":    func() error { _, err := s.Get(ctx, "c"); return err }(),
+		"update": s.Update(ctx, testTodo("c", "gone")),
+		"delete": s.Delete(ctx, "c"),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s a deleted todo = %v, want %v", name, err, ErrNotFound)
+		}
+	}
+
+	pending, err := s.PendingEvents(ctx, 2)
+	if err != nil || len(pending) != 2 || pending[0].Event.ID != "created-b" || pending[1].Event.ID != "created-a" {
+		t.Fatalf("pending events = %+v, %v; want the first two creations", pending, err)
+	}
+	if err := s.MarkPublished(ctx, pending[0].Seq, pending[1].Seq); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := s.PendingEvents(ctx, 10); err != nil || len(pending) != 1 || pending[0].Event.ID != "created-c" {
+		t.Errorf("pending events after publishing = %+v, %v; want created-c", pending, err)
+	}
+}
+
+func TestPgStoreRollsBackFailedTransactions(t *testing.T) {
+	ctx := context.Background()
+	s := openPgStore(t)
+	if err := s.Create(ctx, testTodo("a", "first")); err != nil {
+		t.Fatal(err)
+	}
+	errAbort := errors.New("abort")
+	err := s.Atomically(ctx, func(tx Tx) error {
+		if err := tx.Update(ctx, testTodo("a", "changed"), Event{ID: "e1", Type: EventTodoUpdated}); err != nil {
+			return err
+		}
+		if err := tx.Create(ctx, testTodo("b", "second")); err != nil {
+			return err
+		}
+		// the transaction sees its own writes
+		if got, err := tx.Get(ctx, "a"); err != nil || got.Title != "changed" {
+			t.Errorf("get within the transaction = %+v, %v; want changed", got, err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Atomically = %v, want %v", err, errAbort)
+	}
+	if got := titles(t, s); len(got) != 1 || got["a"] != "first" {
+		t.Errorf("todos after the rollback = %v, want only a first", got)
+	}
+	if pending, err := s.PendingEvents(ctx, 10); err != nil || len(pending) != 0 {
+		t.Errorf("pending events after the rollback = %+v, %v; want none", pending, err)
+	}
+}
+
+func TestMigratePostgres(t *testing.T) {
+	ctx := context.Background()
+	s := openPgStore(t)
+	if err := MigratePostgres(ctx, s.pool, "down"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.List(ctx); err == nil {
+		t.Error("listing after rolling back the migrations succeeded")
+	}
+	if err := MigratePostgres(ctx, s.pool, "up"); err != nil {
+		t.Fatal(err)
+	}
+	if todos, err := s.List(ctx); err != nil || len(todos) != 0 {
+		t.Errorf("list after migrating up again = %v, %v; want none", todos, err)
+	}
+	if err := MigratePostgres(ctx, s.pool, "sideways"); err == nil {
+		t.Error("an unknown migrate command succeeded")
+	}
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrNotFound is returned by stores when no todo matches the requested ID
+var ErrNotFound = errors.New("todo not found")
+
+// Tx is the set of reads and writes available both directly on a store
+// and inside an atomic batch. Mutations accept events that must be recorded
+// in the store's outbox in the same write, so an event is never lost once
+// the change is committed.
+type Tx interface {
+	List(ctx context.Context) ([]Todo, error)
+	Get(ctx context.Context, id string) (Todo, error)
+	Create(ctx context.Context, todo Todo, events ...Event) error
+	Update(ctx context.Context, todo Todo, events ...Event) error
+	Delete(ctx context.Context, id string, events ...Event) error
+}
+
+// Store is the interface implemented by todo storage backends
+type Store interface {
+	Tx
+	// Atomically runs fn against a transaction; its writes are committed
+	// only if fn returns nil and are discarded otherwise
+	Atomically(ctx context.Context, fn func(tx Tx) error) error
+	Outbox
+}
+
+// Pinger is implemented by stores and caches that depend on a connection
+// to another service; Ping reports whether that connection works
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// outboxEntry is an event waiting in the outbox to be relayed to a broker
+type outboxEntry struct {
+	Seq   uint64 `json:"seq"`
+	Event Event  `json:"event"`
+}
+
+// Outbox is the read side of the transactional outbox used by the relay
+type Outbox interface {
+	// PendingEvents returns up to limit unpublished entries in commit order
+	PendingEvents(ctx context.Context, limit int) ([]outboxEntry, error)
+	// MarkPublished removes entries once the broker has acknowledged them
+	MarkPublished(ctx context.Context, seqs ...uint64) error
+}
+
+// memoryData is the state of a memoryStore; its methods do no locking
+type memoryData struct {
+	todos   []Todo
+	outbox  []outboxEntry
+	nextSeq uint64
+}
+
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		todos:   slices.Clone(d.todos),
+		outbox:  slices.Clone(d.outbox),
+		nextSeq: d.nextSeq,
+	}
+}
+
+func (d *memoryData) List(ctx context.Context) ([]Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	todos := make([]Todo, len(d.todos))
+	copy(todos, d.todos)
+	return todos, nil
+}
+
+func (d *memoryData) Get(ctx context.Context, id string) (Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return Todo{}, err
+	}
+	for _, todo := range d.todos {
+		if todo.ID == id {
+			return todo, nil
+		}
+	}
+	return Todo{}, ErrNotFound
+}
+
+func (d *memoryData) Create(ctx context.Context, todo Todo, events ...Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d.todos = append(d.todos, todo)
+	d.appendOutbox(events)
+	return nil
+}
+
+func (d *memoryData) Update(ctx context.Context, todo Todo, events ...Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for i := range d.todos {
+		if d.todos[i].ID == todo.ID {
+			d.todos[i] = todo
+			d.appendOutbox(events)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (d *memoryData) Delete(ctx context.Context, id string, events ...Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for i := range d.todos {
+		if d.todos[i].ID == id {
+			d.todos = append(d.todos[:i], d.todos[i+1:]...)
+			d.appendOutbox(events)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (d *memoryData) appendOutbox(events []Event) {
+	for _, evt := range events {
+		d.nextSeq++
+		d.outbox = append(d.outbox, outboxEntry{Seq: d.nextSeq, Event: evt})
+	}
+}
+
+// memoryStore keeps todos in memory, guarded by a mutex so background
+// jobs can safely run alongside request handlers
+type memoryStore struct {
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{data: &memoryData{todos: []Todo{}}}
+}
+
+func (s *memoryStore) List(ctx context.Context) ([]Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.List(ctx)
+}
+
+func (s *memoryStore) Get(ctx context.Context, id string) (Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Get(ctx, id)
+}
+
+func (s *memoryStore) Create(ctx context.Context, todo Todo, events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Create(ctx, todo, events...)
+}
+
+func (s *memoryStore) Update(ctx context.Context, todo Todo, events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Update(ctx, todo, events...)
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id string, events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Delete(ctx, id, events...)
+}
+
+// Atomically runs fn on a copy of the data and swaps it in on success,
+// unless ctx was cancelled meanwhile
+func (s *memoryStore) Atomically(ctx context.Context, fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.data.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.data = tx
+	return nil
+}
+
+func (s *memoryStore) PendingEvents(ctx context.Context, limit int) ([]outboxEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := min(limit, len(s.data.outbox))
+	entries := make([]outboxEntry, n)
+	copy(entries, s.data.outbox[:n])
+	return entries, nil
+}
+
+func (s *memoryStore) MarkPublished(ctx context.Context, seqs ...uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.outbox = slices.DeleteFunc(s.data.outbox, func(e outboxEntry) bool {
+		return slices.Contains(seqs, e.Seq)
+	})
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package demo generates realistic sample data: users, projects and todos
+// in various states, with nested tags, priorities and due dates around a
+// given time. The same seed, size and time always give the same data, so
+// it serves both for demoing a server and as fixtures in tests:
+//
+//	data := demo.Generate(42, 50, time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC))
+//	todos := data.StoreTodos()
+package demo
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"golang-todo/internal/store"
+)
+
+// User is a demo user
+type User struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// Project is a demo project
+type Project struct {
+	ID          string
+	Name        string
+	Description string
+}
+
+// Todo is a demo todo. Statuses are those of the default workflow:
+// pending, in_progress, review and completed.
+type Todo struct {
+	ID          string
+	Title       string
+	Description string
+	Status      store.TodoStatus
+	Priority    store.TodoPriority
+	ProjectID   string
+	Tags        []string
+	DueAt       *time.Time
+	// CreatedAt is a few weeks before the time the data was generated for
+	CreatedAt time.Time
+	CreatedBy string
+}
+
+// Data is a generated data set. Every ID includes the seed, so data sets
+// from different seeds can be loaded side by side.
+type Data struct {
+	Seed     int64
+	Users    []User
+	Projects []Project
+	Todos    []Todo
+}
+
+var people = []struct{ name, handle string }{
+	{"Ada Byron", "ada"}, {"Grace Hopper", "grace"}, {"Alan Turing", "alan"},
+	{"Katherine Johnson", "katherine"}, {"Linus Ng", "linus"}, {"Margaret Hamilton", "margaret"},
+}
+
+// projectTemplates are the demo projects with the tags and titles of the
+// todos generated in them
+var projectTemplates = []struct {
+	name, description string
+	tags              []string
+	titles            []string
+}{
+	{
+		"Website relaunch", "New marketing site and blog",
+		[]string{"work/web", "work/design", "work/clients/acme"},
+		[]string{"Draft homepage copy", "Review wireframes with Acme", "Set up staging server", "Fix broken links on blog",
+			"Optimize hero images", "Write launch announcement", "Add cookie banner", "Migrate old blog posts"},
+	},
+	{
+		"Q3 planning", "Goals, budget and hiring for next quarter",
+		[]string{"work/planning", "work/finance", "work/hiring"},
+		[]string{"Collect team OKR proposals", "Update budget spreadsheet", "Schedule planning offsite", "Write job ad for backend engineer",
+			"Review vendor contracts", "Prepare board slides", "Send invoice to Acme", "Book interview rooms"},
+	},
+	{
+		"Home", "Chores and errands",
+		[]string{"home", "home/errands", "home/garden", "finance"},
+		[]string{"Buy milk and eggs", "Pay electricity bill", "Mow the lawn", "Call the plumber",
+			"Renew car insurance", "Return library books", "Plant tomatoes", "Clean the gutters"},
+	},
+}
+
+// looseTitles are generated without a project
+var looseTitles = []string{
+	"Read chapter 3 of the Go book", "Renew passport", "Reply to Sam's email", "Plan weekend hike",
+	"Back up laptop", "Update resume", "Buy birthday present for Mia", "Cancel unused subscription",
+}
+
+var descriptions = []string{
+	"", "", "",
+	"Check with the team before starting.",
+	"See the notes from last week's meeting.",
+	"Blocked until the budget is approved.",
+	"Low effort, good for a Friday afternoon.",
+}
+
+var statuses = []store.TodoStatus{store.StatusPending, store.StatusPending, "in_progress", "review", store.StatusCompleted, store.StatusCompleted}
+
+var priorities = []store.TodoPriority{"", "", store.PriorityLow, store.PriorityMedium, store.PriorityMedium, store.PriorityHigh, store.PriorityUrgent}
+
+// Generate creates size todos, along with the users and projects they
+// refer to, from seed. Due dates fall between ten days before now and a
+// month after it; some todos have none.
+func Generate(seed int64, size int, now time.Time) Data {
+	rng := rand.New(rand.NewPCG(uint64(seed), 0x5eed))
+	pick := func(n int) int { return rng.IntN(n) }
+	id := func(kind string, i int) string { return fmt.Sprintf("demo-%d-%s-%d", seed, kind, i+1) }
+
+	data := Data{Seed: seed}
+	for i, p := range people {
+		data.Users = append(data.Users, User{ID: id("user", i), Name: p.name, Email: p.handle + "@example.com"})
+	}
+	for i, p := range projectTemplates {
+		data.Projects = append(data.Projects, Project{ID: id("project", i), Name: p.name, Description: p.description})
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i := range size {
+		todo := Todo{
+			ID:          id("todo", i),
+			Description: descriptions[pick(len(descriptions))],
+			Status:      statuses[pick(len(statuses))],
+			Priority:    priorities[pick(len(priorities))],
+			CreatedBy:   data.Users[pick(len(data.Users))].ID,
+			CreatedAt:   now.Add(-time.Duration(1+pick(21*24)) * time.Hour),
+		}
+		if p := pick(len(projectTemplates) + 1); p < len(projectTemplates) {
+			tmpl := projectTemplates[p]
+			todo.ProjectID = data.Projects[p].ID
+			todo.Title = tmpl.titles[pick(len(tmpl.titles))]
+			todo.Tags = []string{tmpl.tags[pick(len(tmpl.tags))]}
+			if extra := tmpl.tags[pick(len(tmpl.tags))]; pick(3) == 0 && extra != todo.Tags[0] {
+				todo.Tags = append(todo.Tags, extra)
+			}
+		} else {
+			todo.Title = looseTitles[pick(len(looseTitles))]
+			if pick(2) == 0 {
+				todo.Tags = []string{"personal"}
+			}
+		}
+		if pick(4) != 0 {
+			due := today.AddDate(0, 0, pick(41)-10).Add(time.Duration(9+pick(9)) * time.Hour)
+			todo.DueAt = &due
+		}
+		data.Todos = append(data.Todos, todo)
+	}
+	return data
+}
+
+// StoreTodos turns the demo todos into todo.Todo values, as a test would
+// put in a store directly: version 1, with CompletedAt and StatusChangedAt
+// set from CreatedAt
+func (d Data) StoreTodos() []store.Todo {
+	todos := make([]store.Todo, 0, len(d.Todos))
+	for _, t := range d.Todos {
+		todo := store.Todo{
+			ID:              t.ID,
+			Title:           t.Title,
+			Description:     t.Description,
+			Status:          t.Status,
+			Priority:        t.Priority,
+			ProjectID:       t.ProjectID,
+			Tags:            append([]string(nil), t.Tags...),
+			DueAt:           t.DueAt,
+			CreatedAt:       t.CreatedAt,
+			UpdatedAt:       t.CreatedAt,
+			StatusChangedAt: map[store.TodoStatus]time.Time{t.Status: t.CreatedAt},
+			Version:         1,
+		}
+		if t.Status == store.StatusCompleted {
+			completed := t.CreatedAt
+			todo.CompletedAt = &completed
+		}
+		todos = append(todos, todo)
+	}
+	return todos
+}
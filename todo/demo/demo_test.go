@@ -0,0 +1,23 @@
+package demo_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang-todo/todo/demo"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	now := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	a, b := demo.Generate(42, 50, now), demo.Generate(42, 50, now)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("the same seed, size and time gave different data")
+	}
+	if len(a.Todos) != 50 || len(a.StoreTodos()) != 50 {
+		t.Fatalf("got %d todos, want 50", len(a.Todos))
+	}
+	if other := demo.Generate(43, 50, now); other.Todos[0].ID == a.Todos[0].ID {
+		t.Errorf("seeds 42 and 43 both gave todo ID %s", a.Todos[0].ID)
+	}
+}
@@ -0,0 +1,162 @@
+// Package todo embeds the todo API in another Go program. NewServer
+// returns a plain http.Handler, so it can be mounted on any router and
+// wrapped in the host program's own middleware:
+//
+//	todos, err := todo.NewServer(todo.WithAdminToken(os.Getenv("TODO_ADMIN_TOKEN")))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	mux := http.NewServeMux()
+//	mux.Handle("/todo/", http.StripPrefix("/todo", todos))
+//
+// Each call builds an independent server: several can run in one process,
+// each with its own store and settings.
+//
+// Todos are kept in memory unless another Store is given with WithStore,
+// and so are attachment contents and stats snapshots unless
+// WithAttachmentDir gives them a directory.
+package todo
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang-todo/internal/api"
+	"golang-todo/internal/secrets"
+	"golang-todo/internal/store"
+)
+
+type (
+	// Todo is a single todo item
+	Todo = store.Todo
+	// TodoStatus is the state of a todo
+	TodoStatus = store.TodoStatus
+	// TodoPriority ranks how urgent a todo is
+	TodoPriority = store.TodoPriority
+	// Event describes a single change to a todo
+	Event = store.Event
+	// EventType names a lifecycle change of a todo
+	EventType = store.EventType
+	// Store keeps todos, together with the events of every write
+	Store = store.Store
+)
+
+// config is what the options passed to NewServer build up
+type config struct {
+	ctx           context.Context
+	opts          api.Options
+	attachmentDir string
+}
+
+// Option configures NewServer
+type Option func(*config)
+
+// WithContext stops the server's background jobs, such as webhook retries
+// and auto-archiving, when ctx is cancelled
+func WithContext(ctx context.Context) Option {
+	return func(c *config) { c.ctx = ctx }
+}
+
+// WithStore keeps todos in s instead of in memory
+func WithStore(s Store) Option {
+	return func(c *config) { c.opts.Store = s }
+}
+
+// WithAdminToken enables the /admin API for requests bearing token
+func WithAdminToken(token string) Option {
+	return func(c *config) { c.opts.AdminToken = newSetting(token) }
+}
+
+// WithCalendarSecret signs calendar feed URLs with secret, so they keep
+// working across restarts
+func WithCalendarSecret(secret string) Option {
+	return func(c *config) { c.opts.CalendarSecret = newSetting(secret) }
+}
+
+// WithAttachmentDir keeps attachment contents and stats snapshots below
+// dir instead of in memory. Servers sharing a dir collect each other's
+// attachments as garbage, so give each server its own.
+func WithAttachmentDir(dir string) Option {
+	return func(c *config) { c.attachmentDir = dir }
+}
+
+// WithLatencyBudgets sets the longest time requests may take by route
+// pattern, such as "GET /todos"; the "*" key applies to all other routes
+func WithLatencyBudgets(budgets map[string]time.Duration) Option {
+	return func(c *config) { c.opts.Budgets = api.LatencyBudgets(budgets) }
+}
+
+// WithMaxBodySize caps request bodies at n bytes
+func WithMaxBodySize(n int64) Option {
+	return func(c *config) { c.opts.MaxBodySize = n }
+}
+
+// WithUndoWindow sets how long POST /undo can reverse a user's last
+// destructive action
+func WithUndoWindow(d time.Duration) Option {
+	return func(c *config) { c.opts.UndoWindow = d }
+}
+
+// WithArchiveAfter archives todos completed more than d ago, hiding them
+// from default listings
+func WithArchiveAfter(d time.Duration) Option {
+	return func(c *config) { c.opts.ArchiveAfter = d }
+}
+
+func newSetting(value string) *secrets.Setting {
+	setting := &secrets.Setting{}
+	setting.Set(value)
+	return setting
+}
+
+// NewServer returns the todo API configured by opts. Its routes are
+// registered from the root, e.g. GET /todos; use http.StripPrefix to mount
+// it below a path. NewServer fails if the options are invalid or the store
+// can't be read.
+func NewServer(opts ...Option) (http.Handler, error) {
+	c := &config{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.opts.Blobs = store.NewMemoryBlobStore()
+	if c.attachmentDir != "" {
+		blobs, err := store.NewBlobStore("disk", c.attachmentDir, "")
+		if err != nil {
+			return nil, err
+		}
+		c.opts.Blobs = blobs
+	}
+	srv, err := api.New(c.ctx, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// NewMemoryStore returns a Store keeping todos in memory only
+func NewMemoryStore() Store {
+	return store.NewMemoryStore()
+}
+
+// OpenFileStore returns a Store keeping todos in the JSON file at path,
+// journaling writes next to it and compacting the journal every few
+// seconds until ctx is cancelled
+func OpenFileStore(ctx context.Context, path string) (Store, error) {
+	s, err := store.NewFileStore(path)
+	if err != nil {
+		return nil, err
+	}
+	go s.RunFlusher(ctx, 5*time.Second)
+	return s, nil
+}
+
+// OpenPostgresStore returns a Store keeping todos in the PostgreSQL
+// database at url, applying pending migrations first
+func OpenPostgresStore(ctx context.Context, url string) (Store, error) {
+	s, err := store.NewPgStore(ctx, url, true)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
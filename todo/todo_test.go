@@ -0,0 +1,113 @@
+package todo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewServerReportsErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "taken")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := NewServer(WithAttachmentDir(filepath.Join(file, "attachments"))); err == nil || h != nil {
+		t.Fatalf("NewServer with an attachment dir below a file = %v, %v; want an error", h, err)
+	}
+}
+
+func TestNewServersAreIndependent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var servers [2]http.Handler
+	for i := range servers {
+		h, err := NewServer(WithContext(ctx), WithAttachmentDir(t.TempDir()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[i] = h
+	}
+	r := httptest.NewRequest("POST", "/todos", strings.NewReader(`{"title":"a"}`))
+	w := httptest.NewRecorder()
+	servers[0].ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	for i, want := range []string{`"title":"a"`, "[]"} {
+		w := httptest.NewRecorder()
+		servers[i].ServeHTTP(w, httptest.NewRequest("GET", "/todos", nil))
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("GET /todos on server %d = %s, want %s", i, w.Body, want)
+		}
+	}
+}
+
+func TestDefaultServersKeepAttachmentsApart(t *testing.T) {
+	// servers without an attachment dir must not write below the host's
+	// working directory, where they would share and collect each other's
+	// blobs
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var servers [2]http.Handler
+	var urls [2]string
+	for i := range servers {
+		h, err := NewServer(WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[i] = h
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/todos", strings.NewReader(`{"title":"a"}`)))
+		var todo Todo
+		if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("create: %d %s", w.Code, w.Body)
+		}
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, err := mw.CreateFormFile("file", "note.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("server " + string(rune('A'+i))))
+		mw.Close()
+		r := httptest.NewRequest("POST", "/todos/"+todo.ID+"/attachments", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var uploaded []struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil || w.Code != http.StatusCreated || len(uploaded) != 1 {
+			t.Fatalf("upload: %d %s", w.Code, w.Body)
+		}
+		urls[i] = "/todos/" + todo.ID + "/attachments/" + uploaded[0].ID
+	}
+
+	for i, h := range servers {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", urls[i], nil))
+		if want := "server " + string(rune('A'+i)); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("download from server %d = %d %q, want %q", i, w.Code, w.Body, want)
+		}
+	}
+	if entries, err := os.ReadDir("."); err != nil || len(entries) != 0 {
+		t.Errorf("servers wrote %v below the working directory (%v)", entries, err)
+	}
+}